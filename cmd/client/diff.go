@@ -0,0 +1,69 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strings"
+)
+
+// runDiff implements the "diff" subcommand, which reports the hosts and the
+// groups added, removed, and changed between two inventories, e.g. to
+// review a change before pushing it.
+func runDiff(args []string) {
+	var output string
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.StringVar(&output, "output", "text", "output format, text or json")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\nUsage: %s diff [arguments] <old inventory> <new inventory>\n\n", appName)
+		fmt.Fprintf(os.Stderr, "Reports the differences between two inventories. Each inventory is a file,\n")
+		fmt.Fprintf(os.Stderr, "a directory, an http(s) url, or a comma-separated list of them.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if output != "text" && output != "json" {
+		log.Fatalf("argument '-output %s': unsupported output format", output)
+	}
+
+	var invs []*db.Inventory
+	for _, arg := range fs.Args() {
+		inv := db.NewInventory()
+		if err := inv.LoadFromSources(context.Background(), strings.Split(arg, ",")...); err != nil {
+			log.Fatalf("inventory %s: %s", arg, err)
+		}
+		invs = append(invs, inv)
+	}
+	d := db.DiffInventories(invs[0], invs[1])
+	if output == "json" {
+		b, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			log.Fatalf("argument '-output %s': %s", output, err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", b)
+		return
+	}
+	printDelta(d)
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+// stringSliceFlag is a flag that may be repeated.
+type stringSliceFlag []string
+
+func (f *stringSliceFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringSliceFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// stdin is the reader of the standard input shared by the password
+// prompts, so that the input one prompt buffers is not lost to the next
+// one, e.g. with several "-vault-id label@prompt" arguments.
+var stdin = bufio.NewReader(os.Stdin)
+
+// promptPassword reads a password from the standard input. The password is
+// not echoed when the standard input is a terminal.
+func promptPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed reading password: %s", err)
+		}
+		return string(b), nil
+	}
+	s, err := stdin.ReadString('\n')
+	if err != nil && s == "" {
+		return "", fmt.Errorf("failed reading password: %s", err)
+	}
+	return strings.TrimRight(s, "\r\n"), nil
+}
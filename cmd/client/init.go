@@ -0,0 +1,60 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	log "github.com/sirupsen/logrus"
+	"os"
+)
+
+// runInit implements the "init" subcommand, which creates a starter
+// inventory and an encrypted vault.
+func runInit(args []string) {
+	var dir string
+	var inputVaultPassword string
+	var inputVaultPasswordFile string
+
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.StringVar(&dir, "dir", ".", "directory for the starter inventory")
+	fs.StringVar(&inputVaultPassword, "vault.key", "", "ansible vault password")
+	fs.StringVar(&inputVaultPasswordFile, "vault.key.file", "", "ansible vault password file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\nUsage: %s init [arguments]\n\n", appName)
+		fmt.Fprintf(os.Stderr, "Creates hosts, group_vars/, host_vars/, and an encrypted vault.yml.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	vlt := db.NewVault()
+	switch {
+	case inputVaultPassword != "":
+		if err := vlt.SetPassword(inputVaultPassword); err != nil {
+			log.Fatalf("argument '-vault.key': %s", err)
+		}
+	case inputVaultPasswordFile != "":
+		if err := vlt.LoadPasswordFromFile(inputVaultPasswordFile); err != nil {
+			log.Fatalf("argument '-vault.key.file %s': %s", inputVaultPasswordFile, err)
+		}
+	default:
+		log.Fatalf("init requires '-vault.key' or '-vault.key.file'")
+	}
+	if err := db.InitInventory(dir, vlt); err != nil {
+		log.Fatalf("init failed: %s", err)
+	}
+	fmt.Fprintf(os.Stdout, "initialized inventory in %s\n", dir)
+}
@@ -15,11 +15,19 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/greenpau/go-ansible-db/pkg/db"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var (
@@ -34,23 +42,111 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			runInit(os.Args[2:])
+			return
+		case "render":
+			runRender(os.Args[2:])
+			return
+		case "vars":
+			runVars(os.Args[2:])
+			return
+		case "vault":
+			runVault(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		}
+	}
+
 	var logLevel string
 	var isShowVersion bool
+	var isCheckCredentials bool
+	var isCompareAnsible bool
+	var isStrict bool
+	var isCheckSSH bool
+	var isCheckSSHDryRun bool
+	var checkSSHInterval time.Duration
+	var sshConcurrency int
+	var sshKnownHosts string
+	var factCommands stringSliceFlag
+	var isDryRun bool
+	var brokerSocket string
+	var brokerAllowGID int
+	var listenAddr string
+	var isList bool
+	var scriptHost string
+	var showSections string
+	var isReveal bool
+	var isListenCredentials bool
+	var listenTLSCert, listenTLSKey string
+	var listenTokenFile string
 
-	var inputInventoryFile string
+	var inputInventoryFiles stringSliceFlag
+	var inputBundleFile string
+	var inputOverlayFiles stringSliceFlag
 	var inputVaultFile string
 	var inputVaultPassword string
 	var inputVaultPasswordFile string
+	var inputVaultIDs stringSliceFlag
+	var inputVerifyKeyFile string
+	var anonymizeKey string
+	var query string
+	var filter string
+	var selector string
+	var limit string
+	var output string
+	var fieldList string
 
-	flag.StringVar(&inputInventoryFile, "inventory", "hosts", "ansible inventory file")
+	flag.Var(&inputInventoryFiles, "inventory", "ansible inventory file, directory, http(s) url, ~/.ssh/config, or comma-separated host list (repeatable, default: the ansible.cfg inventory, or hosts)")
+	flag.StringVar(&inputBundleFile, "bundle", "", "ansible inventory bundle (tar.gz) with hosts, group_vars, host_vars, and vaults")
+	flag.Var(&inputOverlayFiles, "overlay", "ansible inventory overlay file, e.g. per environment (repeatable)")
 	flag.StringVar(&inputVaultFile, "vault", "", "ansible vault file")
 	flag.StringVar(&inputVaultPassword, "vault.key", "", "ansible vault password")
-	flag.StringVar(&inputVaultPasswordFile, "vault.key.file", "", "ansible vault password file")
+	flag.StringVar(&inputVaultPasswordFile, "vault.key.file", "", "ansible vault password file, or an executable printing the password (default: the ansible.cfg vault_password_file)")
+	flag.Var(&inputVaultIDs, "vault-id", "ansible vault id, label@file, label@prompt, or label@script (repeatable)")
+	flag.StringVar(&inputVerifyKeyFile, "verify.key", "", "PEM-encoded Ed25519 public key or certificate verifying inventory signatures")
+	flag.StringVar(&anonymizeKey, "anonymize", "", "print the inventory as JSON with host names, IPs, and secrets pseudonymized with this key")
+	flag.StringVar(&query, "query", "", "print the inventory hosts and groups as JSON, filtered with a JMESPath expression, e.g. 'hosts[].name'")
+	flag.StringVar(&limit, "limit", "", "select hosts matching an Ansible host pattern, e.g. 'webservers:&staging:!excluded'")
+	flag.StringVar(&selector, "select", "", "select hosts matching a query, e.g. 'group=nyc* and vars.os=cisco_nxos and not host=ny-sw0[1-2]'")
+	flag.StringVar(&filter, "filter", "", "select hosts matching a CEL expression, e.g. '\"cisco\" in groups && vars.datacenter == \"ny4\"'")
+	flag.StringVar(&output, "output", "text", "output format, text, i.e. the host names, table, csv, yaml, json, i.e. the format of 'ansible-inventory --list' unless '-fields' is provided, graph, i.e. the tree of 'ansible-inventory --graph', or dot, i.e. the graphviz graph of the groups")
+	flag.StringVar(&fieldList, "fields", "", "comma-separated host fields of the table, csv, yaml, and json outputs, i.e. host, parent, groups, tags, vars, and vars.<key> (default: "+defaultHostFields+")")
+	flag.BoolVar(&isCheckCredentials, "check.credentials", false, "report hosts without host-specific vault credentials")
+	flag.BoolVar(&isCheckSSH, "check.ssh", false, "attempt SSH logins to the hosts with their vault credentials and report the results")
+	flag.BoolVar(&isCheckSSHDryRun, "check.ssh.dry-run", false, "report the SSH logins '-check.ssh' would attempt, without connecting")
+	flag.DurationVar(&checkSSHInterval, "check.ssh.interval", 0, "the minimum time between two SSH login attempts, e.g. 500ms")
+	flag.Var(&factCommands, "facts", "gather a host fact over SSH with vault credentials, name=command, e.g. 'kernel=uname -r' (repeatable)")
+	flag.IntVar(&sshConcurrency, "ssh.concurrency", 4, "the number of hosts connected to over SSH in parallel")
+	flag.StringVar(&sshKnownHosts, "ssh.known_hosts", "~/.ssh/known_hosts", "the known_hosts file verifying the SSH host keys")
+	flag.BoolVar(&isDryRun, "dry-run", false, "print the host changes the '-overlay' and '-facts' arguments would make, and exit")
+	flag.StringVar(&brokerSocket, "broker.socket", "", "serve the vault credentials to the local processes of the same user over this unix socket")
+	flag.IntVar(&brokerAllowGID, "broker.allow.gid", -1, "serve the vault credentials to the processes of this group, too")
+	flag.StringVar(&listenAddr, "listen", "", "serve the inventory, and the vault credentials, over HTTP on this address, e.g. ':8080'")
+	flag.BoolVar(&isListenCredentials, "listen.credentials", false, "serve the vault credentials of the hosts at /hosts/{name}/credentials, requires '-listen.tls.cert' or '-listen.token.file'")
+	flag.StringVar(&listenTLSCert, "listen.tls.cert", "", "serve HTTPS with this certificate file, along with '-listen.tls.key'")
+	flag.StringVar(&listenTLSKey, "listen.tls.key", "", "the private key file of '-listen.tls.cert'")
+	flag.StringVar(&listenTokenFile, "listen.token.file", "", "require the bearer token held by this file in the requests to the server")
+	flag.BoolVar(&isStrict, "strict", false, "fail on inventory groups without hosts, instead of warning")
+	flag.BoolVar(&isCompareAnsible, "compare.ansible", false, "report divergences from ansible-inventory --list on the same inventory file")
+	flag.BoolVar(&isList, "list", false, "print the inventory as JSON, the way Ansible expects from a dynamic inventory script")
+	flag.StringVar(&scriptHost, "host", "", "print the variables of a host as JSON, the way Ansible expects from a dynamic inventory script")
+	flag.StringVar(&showSections, "show", "", "with '-host', print the details of the host instead, i.e. all, or a comma-separated list of vars, groups, and credentials")
+	flag.BoolVar(&isReveal, "reveal", false, "print the secrets of the credentials with '-show', instead of masking them")
 	flag.StringVar(&logLevel, "log.level", "info", "logging severity level")
 	flag.BoolVar(&isShowVersion, "version", false, "version information")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "\n%s - %s\n\n", appName, appDescription)
-		fmt.Fprintf(os.Stderr, "Usage: %s [arguments]\n\n", appName)
+		fmt.Fprintf(os.Stderr, "Usage: %s [arguments]\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s init [arguments]\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s render [arguments]\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s vars show [arguments]\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s vault rekey|view|edit|create|export [arguments] <vault file>...\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s diff [arguments] <old inventory> <new inventory>\n\n", appName)
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nDocumentation: %s\n\n", appDocs)
 	}
@@ -69,6 +165,61 @@ func main() {
 		fmt.Fprint(os.Stdout, "\n")
 		os.Exit(0)
 	}
+	if len(inputInventoryFiles) == 0 {
+		inputInventoryFiles = append(inputInventoryFiles, envList(envInventory)...)
+	}
+	if len(inputOverlayFiles) == 0 {
+		inputOverlayFiles = append(inputOverlayFiles, envList(envOverlay)...)
+	}
+	inputBundleFile = envString(inputBundleFile, envBundle)
+	inputVaultFile = envString(inputVaultFile, envVault)
+	if inputVaultPassword == "" {
+		inputVaultPasswordFile = envString(inputVaultPasswordFile, envVaultPassword)
+	}
+	// The arguments omitted default to the settings of ansible.cfg, except
+	// the inventory of a dynamic inventory script, likely the script itself.
+	isScript := isList || (scriptHost != "" && showSections == "")
+	isConfigInventory := len(inputInventoryFiles) == 0 && inputBundleFile == "" && !isScript
+	if isConfigInventory || (inputVaultPassword == "" && inputVaultPasswordFile == "") {
+		cfg, err := db.LoadAnsibleConfig()
+		if err != nil {
+			log.Fatalf("ansible config: %s", err)
+		}
+		if isConfigInventory {
+			inputInventoryFiles = append(inputInventoryFiles, cfg.Inventory...)
+		}
+		if inputVaultPassword == "" && inputVaultPasswordFile == "" {
+			inputVaultPasswordFile = cfg.VaultPasswordFile
+		}
+	}
+	if len(inputInventoryFiles) == 0 {
+		inputInventoryFiles = append(inputInventoryFiles, "hosts")
+	}
+	switch output {
+	case "text", "table", "csv", "yaml", "json", "graph", "dot":
+	default:
+		log.Fatalf("argument '-output %s': unsupported output format", output)
+	}
+	if fieldList != "" && (output == "text" || output == "graph" || output == "dot") {
+		log.Fatalf("argument '-fields' requires '-output table', 'csv', 'yaml', or 'json'")
+	}
+	if query != "" && (output == "graph" || output == "dot") {
+		log.Fatalf("argument '-query' does not apply to '-output %s'", output)
+	}
+	isFieldList := fieldList != ""
+	if !isFieldList {
+		fieldList = defaultHostFields
+	}
+	fields, err := parseHostFields(fieldList)
+	if err != nil {
+		log.Fatalf("argument '-fields %s': %s", fieldList, err)
+	}
+	var sections map[string]bool
+	if showSections != "" {
+		if sections, err = parseHostDetailSections(showSections); err != nil {
+			log.Fatalf("argument '-show %s': %s", showSections, err)
+		}
+	}
 	if level, err := log.ParseLevel(logLevel); err == nil {
 		log.SetLevel(level)
 	} else {
@@ -76,16 +227,402 @@ func main() {
 		os.Exit(1)
 	}
 
-	inv := db.NewInventory()
-	if err := inv.LoadFromFile(inputInventoryFile); err != nil {
-		log.Fatalf("argument '-inventory %s': %s", inputInventoryFile, err)
+	vlt := db.NewVault(db.WithVaultLogger(log.StandardLogger()))
+	switch {
+	case inputVaultPassword != "":
+		if err := vlt.SetPassword(inputVaultPassword); err != nil {
+			log.Fatalf("argument '-vault.key': %s", err)
+		}
+	case inputVaultPasswordFile != "":
+		if err := vlt.LoadPasswordFromFile(inputVaultPasswordFile); err != nil {
+			log.Fatalf("argument '-vault.key.file %s': %s", inputVaultPasswordFile, err)
+		}
+	}
+
+	for _, id := range inputVaultIDs {
+		label, source := db.ParseVaultID(id)
+		if source == "prompt" {
+			password, err := promptPassword(fmt.Sprintf("Vault password (%s): ", label))
+			if err != nil {
+				log.Fatalf("argument '-vault-id %s': %s", id, err)
+			}
+			if err := vlt.AddVaultID(label, password); err != nil {
+				log.Fatalf("argument '-vault-id %s': %s", id, err)
+			}
+			continue
+		}
+		if err := vlt.LoadVaultIDFromFile(context.Background(), label, source); err != nil {
+			log.Fatalf("argument '-vault-id %s': %s", id, err)
+		}
+	}
+
+	opts := []db.InventoryOption{db.WithVault(vlt), db.WithStrictMode(isStrict), db.WithLogger(log.StandardLogger())}
+	if inputVerifyKeyFile != "" {
+		key, err := db.LoadVerificationKeyFromFile(inputVerifyKeyFile)
+		if err != nil {
+			log.Fatalf("argument '-verify.key %s': %s", inputVerifyKeyFile, err)
+		}
+		opts = append(opts, db.WithSignatureVerification(key))
+	}
+	inv := db.NewInventory(opts...)
+	switch {
+	case inputBundleFile != "":
+		if err := inv.LoadFromBundle(inputBundleFile); err != nil {
+			log.Fatalf("argument '-bundle %s': %s", inputBundleFile, err)
+		}
+		log.Debugf("inventory bundle: %s", inputBundleFile)
+	case len(inputInventoryFiles) == 1 && len(inputOverlayFiles) == 0 && isDir(inputInventoryFiles[0]):
+		if err := inv.LoadFromDir(inputInventoryFiles[0]); err != nil {
+			log.Fatalf("argument '-inventory %s': %s", inputInventoryFiles[0], err)
+		}
+		log.Debugf("inventory directory: %s", inputInventoryFiles[0])
+	case len(inputInventoryFiles) == 1 && len(inputOverlayFiles) == 0 && !db.IsHostList(inputInventoryFiles[0]) &&
+		!strings.HasPrefix(inputInventoryFiles[0], "http://") && !strings.HasPrefix(inputInventoryFiles[0], "https://"):
+		if err := inv.LoadFromFile(inputInventoryFiles[0]); err != nil {
+			log.Fatalf("argument '-inventory %s': %s", inputInventoryFiles[0], err)
+		}
+		log.Debugf("inventory file: %s", inputInventoryFiles[0])
+	default:
+		sources := append(inputInventoryFiles, inputOverlayFiles...)
+		if err := inv.LoadFromSources(context.Background(), sources...); err != nil {
+			log.Fatalf("arguments '-inventory %s': %s", strings.Join(sources, " "), err)
+		}
+		log.Debugf("inventory sources: %s", strings.Join(sources, " "))
 	}
-	log.Debugf("inventory file: %s", inputInventoryFile)
+	if isList {
+		b, err := inv.ToAnsibleJSON()
+		if err != nil {
+			log.Fatalf("argument '-list': %s", err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", b)
+		return
+	}
+	if scriptHost != "" && showSections == "" {
+		if err := printHostVars(inv, scriptHost); err != nil {
+			log.Fatalf("argument '-host %s': %s", scriptHost, err)
+		}
+		return
+	}
+
 	hosts, err := inv.GetHosts()
 	if err != nil {
 		log.Fatalf("GetHosts() failed: %s", err)
 	}
+	if limit != "" {
+		hosts, err = inv.GetHostsByPattern(limit)
+		if err != nil {
+			log.Fatalf("argument '-limit': %s", err)
+		}
+	}
+	if filter != "" {
+		match, err := db.MatchExpression(filter)
+		if err != nil {
+			log.Fatalf("argument '-filter': %s", err)
+		}
+		selected := []*db.InventoryHost{}
+		for _, h := range hosts {
+			if match(h) {
+				selected = append(selected, h)
+			}
+		}
+		hosts = selected
+	}
+	if selector != "" {
+		match, err := db.MatchQuery(selector)
+		if err != nil {
+			log.Fatalf("argument '-select': %s", err)
+		}
+		selected := []*db.InventoryHost{}
+		for _, h := range hosts {
+			if match(h) {
+				selected = append(selected, h)
+			}
+		}
+		hosts = selected
+	}
+
+	if inputVaultFile != "" {
+		if err := vlt.LoadFromFile(inputVaultFile); err != nil {
+			log.Fatalf("argument '-vault %s': %s", inputVaultFile, err)
+		}
+		log.Debugf("vault file: %s", inputVaultFile)
+	}
+
+	if showSections != "" {
+		if scriptHost == "" {
+			log.Fatalf("argument '-show' requires '-host'")
+		}
+		var hostVault *db.Vault
+		if inputVaultFile != "" || inputBundleFile != "" {
+			hostVault = vlt
+		}
+		if err := printHostDetail(os.Stdout, inv, hostVault, scriptHost, sections, isReveal); err != nil {
+			log.Fatalf("argument '-host %s': %s", scriptHost, err)
+		}
+		return
+	}
+
+	if isCheckCredentials {
+		if inputVaultFile == "" && inputBundleFile == "" {
+			log.Fatalf("argument '-check.credentials' requires '-vault' or '-bundle'")
+		}
+		gaps, err := vlt.GetCredentialGaps(inv)
+		if err != nil {
+			log.Fatalf("GetCredentialGaps() failed: %s", err)
+		}
+		for _, gap := range gaps {
+			if gap.Defaults > 0 {
+				fmt.Fprintf(os.Stdout, "%s: default credentials only (%d)\n", gap.Host, gap.Defaults)
+				continue
+			}
+			fmt.Fprintf(os.Stdout, "%s: no credentials\n", gap.Host)
+		}
+		if len(gaps) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if brokerSocket != "" {
+		if inputVaultFile == "" && inputBundleFile == "" {
+			log.Fatalf("argument '-broker.socket' requires '-vault' or '-bundle'")
+		}
+		b := db.NewCredentialBroker(vlt)
+		b.Logger = log.StandardLogger()
+		if brokerAllowGID >= 0 {
+			b.AllowedGIDs = append(b.AllowedGIDs, uint32(brokerAllowGID))
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		log.Infof("credential broker listening on %s", brokerSocket)
+		if err := b.ListenAndServe(ctx, brokerSocket); err != nil {
+			log.Fatalf("argument '-broker.socket %s': %s", brokerSocket, err)
+		}
+		return
+	}
+
+	if listenAddr != "" {
+		srv := &inventoryServer{inv: inv.Snapshot(), certFile: listenTLSCert, keyFile: listenTLSKey}
+		if (listenTLSCert == "") != (listenTLSKey == "") {
+			log.Fatalf("arguments '-listen.tls.cert' and '-listen.tls.key' must be provided together")
+		}
+		if listenTokenFile != "" {
+			token, err := loadServerToken(listenTokenFile)
+			if err != nil {
+				log.Fatalf("argument '-listen.token.file %s': %s", listenTokenFile, err)
+			}
+			srv.token = token
+		}
+		if isListenCredentials {
+			// The credentials are never served in the clear to anyone.
+			if srv.certFile == "" && srv.token == "" {
+				log.Fatalf("argument '-listen.credentials' requires '-listen.tls.cert' or '-listen.token.file'")
+			}
+			if inputVaultFile != "" || inputBundleFile != "" {
+				srv.vault = vlt
+			}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		log.Infof("inventory server listening on %s", listenAddr)
+		if err := serveInventory(ctx, listenAddr, srv); err != nil {
+			log.Fatalf("argument '-listen %s': %s", listenAddr, err)
+		}
+		return
+	}
+
+	var base *db.Inventory
+	if isDryRun {
+		base = inv.Clone()
+		if len(inputOverlayFiles) > 0 {
+			base = db.NewInventory(opts...)
+			if err := base.LoadFromSources(context.Background(), inputInventoryFiles...); err != nil {
+				log.Fatalf("arguments '-inventory %s': %s", strings.Join(inputInventoryFiles, " "), err)
+			}
+		}
+	}
+
+	if len(factCommands) > 0 {
+		if inputVaultFile == "" && inputBundleFile == "" {
+			log.Fatalf("argument '-facts' requires '-vault' or '-bundle'")
+		}
+		var commands []*db.FactCommand
+		for _, s := range factCommands {
+			cmd, err := db.ParseFactCommand(s)
+			if err != nil {
+				log.Fatalf("argument '-facts %s': %s", s, err)
+			}
+			commands = append(commands, cmd)
+		}
+		g := db.NewFactGatherer(vlt, loadKnownHosts(sshKnownHosts), commands...)
+		g.Concurrency = sshConcurrency
+		facts, err := g.Gather(context.Background(), hosts)
+		if err != nil {
+			log.Fatalf("argument '-facts': %s", err)
+		}
+		for _, f := range facts {
+			for _, e := range f.Errors {
+				log.Warnf("%s: %s", f.Host, e)
+			}
+		}
+		if err := inv.AddHostFacts(g.Prefix, facts); err != nil {
+			log.Fatalf("argument '-facts': %s", err)
+		}
+	}
+
+	if isDryRun {
+		printDelta(db.Diff(base, inv))
+		return
+	}
+
+	if isCheckSSH {
+		if inputVaultFile == "" && inputBundleFile == "" {
+			log.Fatalf("argument '-check.ssh' requires '-vault' or '-bundle'")
+		}
+		var cb ssh.HostKeyCallback
+		if !isCheckSSHDryRun {
+			cb = loadKnownHosts(sshKnownHosts)
+		}
+		checker := db.NewCredentialChecker(vlt, cb)
+		checker.DryRun = isCheckSSHDryRun
+		checker.Concurrency = sshConcurrency
+		checker.Interval = checkSSHInterval
+		results, err := checker.Check(context.Background(), hosts)
+		if err != nil {
+			log.Fatalf("argument '-check.ssh': %s", err)
+		}
+		failed := false
+		for _, r := range results {
+			fmt.Fprintf(os.Stdout, "%s\n", r)
+			if r.Status == db.CredentialInvalid || r.Status == db.CredentialUnreachable {
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if isCompareAnsible {
+		divergences, err := inv.CompareWithAnsible(context.Background(), append(inputInventoryFiles, inputOverlayFiles...)...)
+		if err != nil {
+			log.Fatalf("argument '-compare.ansible': %s", err)
+		}
+		for _, d := range divergences {
+			fmt.Fprintf(os.Stdout, "%s\n", d)
+		}
+		if len(divergences) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if anonymizeKey != "" {
+		anon, err := inv.Anonymize([]byte(anonymizeKey))
+		if err != nil {
+			log.Fatalf("argument '-anonymize': %s", err)
+		}
+		if err := writeJSON(os.Stdout, anon, query); err != nil {
+			log.Fatalf("argument '-anonymize': %s", err)
+		}
+		return
+	}
+
+	// The outputs of the whole inventory hold the selected hosts only.
+	selected := inv
+	if limit != "" || filter != "" || selector != "" {
+		names := make([]string, 0, len(hosts))
+		for _, h := range hosts {
+			names = append(names, h.Name)
+		}
+		selected = inv.Clone()
+		// The groups left without hosts are expected.
+		selected.SetLogger(nil)
+		if err := selected.RetainHosts(names...); err != nil {
+			log.Fatalf("host selection failed: %s", err)
+		}
+	}
+
+	if query != "" {
+		doc := map[string]interface{}{
+			"hosts":  hosts,
+			"groups": selected.Groups,
+		}
+		if err := writeJSON(os.Stdout, doc, query); err != nil {
+			log.Fatalf("argument '-query': %s", err)
+		}
+		return
+	}
+
+	if output == "json" && !isFieldList {
+		b, err := selected.ToAnsibleJSON()
+		if err != nil {
+			log.Fatalf("argument '-output %s': %s", output, err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", b)
+		return
+	}
+
+	if output == "graph" || output == "dot" {
+		graph, err := selected.ToGraph()
+		if err != nil {
+			log.Fatalf("argument '-output %s': %s", output, err)
+		}
+		if output == "dot" {
+			os.Stdout.Write(graph.ToDOT())
+		} else {
+			os.Stdout.Write(graph.ToTree())
+		}
+		return
+	}
+
+	if output != "text" {
+		if err := writeHosts(os.Stdout, output, hosts, fields); err != nil {
+			log.Fatalf("argument '-output %s': %s", output, err)
+		}
+		return
+	}
+
 	for _, h := range hosts {
-		fmt.Fprintf(os.Stdout, "%s", h.Name)
+		fmt.Fprintf(os.Stdout, "%s\n", h.Name)
+	}
+}
+
+// isDir returns true when the provided path is an existing directory.
+func isDir(fp string) bool {
+	fi, err := os.Stat(fp)
+	return err == nil && fi.IsDir()
+}
+
+// loadKnownHosts returns the callback verifying SSH host keys with the
+// provided known_hosts file.
+func loadKnownHosts(fp string) ssh.HostKeyCallback {
+	if strings.HasPrefix(fp, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			fp = filepath.Join(home, fp[2:])
+		}
+	}
+	cb, err := knownhosts.New(fp)
+	if err != nil {
+		log.Fatalf("argument '-ssh.known_hosts %s': %s", fp, err)
+	}
+	return cb
+}
+
+// printDelta prints the hosts added, removed, and changed, with the changed
+// fields indented.
+func printDelta(d *db.InventoryDelta) {
+	for _, h := range d.Hosts {
+		fmt.Fprintf(os.Stdout, "%s: %s\n", h.Host, h.Type)
+		for _, c := range h.Changes {
+			fmt.Fprintf(os.Stdout, "  %s\n", c)
+		}
+	}
+	for _, g := range d.Groups {
+		fmt.Fprintf(os.Stdout, "@%s: %s\n", g.Group, g.Type)
+		for _, c := range g.Changes {
+			fmt.Fprintf(os.Stdout, "  %s\n", c)
+		}
 	}
 }
@@ -0,0 +1,144 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"gopkg.in/yaml.v2"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultHostFields are the host fields printed by the table, csv, and yaml
+// outputs without the "-fields" argument.
+const defaultHostFields = "host,parent,groups"
+
+// hostField is a column of the host outputs.
+type hostField struct {
+	name  string
+	value func(*db.InventoryHost) interface{}
+}
+
+// parseHostFields parses the comma-separated list of the host fields, i.e.
+// host, parent, groups, tags, vars, and vars.<key> for a single variable.
+func parseHostFields(s string) ([]hostField, error) {
+	var fields []hostField
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		f := hostField{name: name}
+		switch name {
+		case "host", "name":
+			f.value = func(h *db.InventoryHost) interface{} { return h.Name }
+		case "parent":
+			f.value = func(h *db.InventoryHost) interface{} { return h.Parent }
+		case "groups":
+			f.value = func(h *db.InventoryHost) interface{} { return append([]string{}, h.Groups...) }
+		case "tags":
+			f.value = func(h *db.InventoryHost) interface{} { return append([]string{}, h.Tags...) }
+		case "vars":
+			f.value = func(h *db.InventoryHost) interface{} { return h.Variables }
+		default:
+			key := strings.TrimPrefix(name, "vars.")
+			if key == name || key == "" {
+				return nil, fmt.Errorf("unknown field %q", name)
+			}
+			f.value = func(h *db.InventoryHost) interface{} { return h.Variables[key] }
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// writeHosts prints the fields of the hosts in the table, csv, json, or yaml
+// format.
+func writeHosts(w io.Writer, format string, hosts []*db.InventoryHost, fields []hostField) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		var header []string
+		for _, f := range fields {
+			header = append(header, strings.ToUpper(f.name))
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, h := range hosts {
+			fmt.Fprintln(tw, strings.Join(hostRow(h, fields), "\t"))
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		var header []string
+		for _, f := range fields {
+			header = append(header, f.name)
+		}
+		cw.Write(header)
+		for _, h := range hosts {
+			cw.Write(hostRow(h, fields))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		records := []map[string]interface{}{}
+		for _, h := range hosts {
+			record := make(map[string]interface{}, len(fields))
+			for _, f := range fields {
+				record[f.name] = f.value(h)
+			}
+			records = append(records, record)
+		}
+		return writeJSON(w, records, "")
+	case "yaml":
+		records := []yaml.MapSlice{}
+		for _, h := range hosts {
+			var record yaml.MapSlice
+			for _, f := range fields {
+				record = append(record, yaml.MapItem{Key: f.name, Value: f.value(h)})
+			}
+			records = append(records, record)
+		}
+		b, err := yaml.Marshal(records)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	return fmt.Errorf("unsupported output format")
+}
+
+// hostRow returns the fields of a host as strings. The lists are joined
+// with commas, and the variables are printed as sorted key=value pairs.
+func hostRow(h *db.InventoryHost, fields []hostField) []string {
+	var row []string
+	for _, f := range fields {
+		switch v := f.value(h).(type) {
+		case string:
+			row = append(row, v)
+		case []string:
+			row = append(row, strings.Join(v, ","))
+		case map[string]string:
+			var pairs []string
+			for k, s := range v {
+				pairs = append(pairs, k+"="+s)
+			}
+			sort.Strings(pairs)
+			row = append(row, strings.Join(pairs, " "))
+		}
+	}
+	return row
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jmespath/go-jmespath"
+	"io"
+)
+
+// writeJSON writes a value as indented JSON. When the query is not empty,
+// the JMESPath expression is applied to the value first.
+func writeJSON(w io.Writer, v interface{}, query string) error {
+	if query != "" {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var data interface{}
+		if err := json.Unmarshal(b, &data); err != nil {
+			return err
+		}
+		v, err = jmespath.Search(query, data)
+		if err != nil {
+			return fmt.Errorf("query %q failed: %s", query, err)
+		}
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// runRender implements the "render" subcommand, which executes a template
+// once per host with its variables, groups, and credentials, writing one
+// output per host.
+func runRender(args []string) {
+	var inputInventoryFiles stringSliceFlag
+	var inputVaultFile string
+	var inputVaultPassword string
+	var inputVaultPasswordFile string
+	var templateFile string
+	var hostPattern string
+	var output string
+
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fs.Var(&inputInventoryFiles, "inventory", "ansible inventory file, directory, http(s) url, ~/.ssh/config, or comma-separated host list (repeatable, default: hosts)")
+	fs.StringVar(&inputVaultFile, "vault", "", "ansible vault file, making the host credentials available to the template")
+	fs.StringVar(&inputVaultPassword, "vault.key", "", "ansible vault password")
+	fs.StringVar(&inputVaultPasswordFile, "vault.key.file", "", "ansible vault password file")
+	fs.StringVar(&templateFile, "template", "", "Go template file, executed with .Name, .Parent, .Groups, .Tags, .Variables, and .Credentials of a host")
+	fs.StringVar(&hostPattern, "hosts", "all", "ansible host pattern, e.g. 'ny-sw*' or 'ny4:&cisco'")
+	fs.StringVar(&output, "output", "{{ .Name }}.txt", "output file name template per host, or '-' for standard output")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\nUsage: %s render [arguments]\n\n", appName)
+		fmt.Fprintf(os.Stderr, "Renders a template once per host, e.g. a configuration file.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if templateFile == "" {
+		log.Fatalf("render requires '-template'")
+	}
+	if len(inputInventoryFiles) == 0 {
+		inputInventoryFiles = append(inputInventoryFiles, "hosts")
+	}
+
+	tmpl, err := template.New(filepath.Base(templateFile)).Option("missingkey=error").ParseFiles(templateFile)
+	if err != nil {
+		log.Fatalf("argument '-template %s': %s", templateFile, err)
+	}
+	var outputTmpl *template.Template
+	if output != "-" {
+		outputTmpl, err = template.New("output").Option("missingkey=error").Parse(output)
+		if err != nil {
+			log.Fatalf("argument '-output %s': %s", output, err)
+		}
+	}
+	matcher, err := db.MatchHostPattern(hostPattern)
+	if err != nil {
+		log.Fatalf("argument '-hosts %s': %s", hostPattern, err)
+	}
+
+	var vlt *db.Vault
+	if inputVaultFile != "" {
+		vlt = db.NewVault()
+		switch {
+		case inputVaultPassword != "":
+			if err := vlt.SetPassword(inputVaultPassword); err != nil {
+				log.Fatalf("argument '-vault.key': %s", err)
+			}
+		case inputVaultPasswordFile != "":
+			if err := vlt.LoadPasswordFromFile(inputVaultPasswordFile); err != nil {
+				log.Fatalf("argument '-vault.key.file %s': %s", inputVaultPasswordFile, err)
+			}
+		}
+		if err := vlt.LoadFromFile(inputVaultFile); err != nil {
+			log.Fatalf("argument '-vault %s': %s", inputVaultFile, err)
+		}
+	}
+
+	inv := db.NewInventory()
+	if err := inv.LoadFromSources(context.Background(), inputInventoryFiles...); err != nil {
+		log.Fatalf("arguments '-inventory %s': %s", strings.Join(inputInventoryFiles, " "), err)
+	}
+
+	count := 0
+	inv.AllHosts(matcher)(func(h *db.InventoryHost) bool {
+		count++
+		if outputTmpl == nil {
+			if err := db.RenderHost(tmpl, h, vlt, os.Stdout); err != nil {
+				log.Fatalf("render failed: %s", err)
+			}
+			return true
+		}
+		var name bytes.Buffer
+		if err := outputTmpl.Execute(&name, h); err != nil {
+			log.Fatalf("argument '-output %s': %s", output, err)
+		}
+		var buf bytes.Buffer
+		if err := db.RenderHost(tmpl, h, vlt, &buf); err != nil {
+			log.Fatalf("render failed: %s", err)
+		}
+		fp := name.String()
+		if dir := filepath.Dir(fp); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				log.Fatalf("render failed: %s", err)
+			}
+		}
+		if err := os.WriteFile(fp, buf.Bytes(), 0600); err != nil {
+			log.Fatalf("render failed: %s", err)
+		}
+		log.Debugf("rendered %s: %s", h.Name, fp)
+		return true
+	})
+	if count == 0 {
+		log.Fatalf("argument '-hosts %s': no hosts matched", hostPattern)
+	}
+}
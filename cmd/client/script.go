@@ -0,0 +1,70 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"os"
+	"strings"
+)
+
+// The environment variables providing the sources of the inventory when
+// the corresponding arguments are not, e.g. when Ansible runs the client
+// as a dynamic inventory script with "--list" or "--host <name>" only.
+const (
+	envInventory     = "ANSIBLE_DB_INVENTORY"
+	envOverlay       = "ANSIBLE_DB_OVERLAY"
+	envBundle        = "ANSIBLE_DB_BUNDLE"
+	envVault         = "ANSIBLE_DB_VAULT"
+	envVaultPassword = "ANSIBLE_DB_VAULT_PASSWORD_FILE"
+)
+
+// envList returns the comma-separated items of an environment variable.
+func envList(name string) []string {
+	var items []string
+	for _, s := range strings.Split(os.Getenv(name), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
+
+// envString returns the value of an environment variable, unless the
+// provided value is set already.
+func envString(value, name string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// printHostVars prints the variables of a host in the format Ansible
+// expects from "<script> --host <name>", i.e. with typed values, the same
+// as in the "_meta.hostvars" of "--list". An unknown host has no variables.
+func printHostVars(inv *db.Inventory, name string) error {
+	vars := map[string]interface{}{}
+	if h, err := inv.GetHost(name); err == nil {
+		vars = h.TypedVariables()
+	}
+	b, err := json.MarshalIndent(vars, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(os.Stdout, "%s\n", b)
+	return err
+}
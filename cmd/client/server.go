@@ -0,0 +1,183 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// inventoryServer serves the inventory and, optionally, the credentials of
+// the vault over HTTP:
+//
+//	GET /hosts
+//	GET /hosts/{name}
+//	GET /hosts/{name}/credentials
+//	GET /groups
+//	GET /groups/{name}
+//	GET /groups/{name}/hosts
+//
+// When the server has a token, the requests carry it in the Authorization
+// header, i.e. "Bearer {token}". When the server has a certificate, it
+// serves HTTPS.
+type inventoryServer struct {
+	inv      *db.InventorySnapshot
+	vault    *db.Vault
+	token    string
+	certFile string
+	keyFile  string
+}
+
+// loadServerToken reads the bearer token of the server from a file.
+func loadServerToken(fp string) (string, error) {
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file is empty")
+	}
+	return token, nil
+}
+
+// serveInventory serves the inventory on the provided address until the
+// context is canceled.
+func serveInventory(ctx context.Context, addr string, s *inventoryServer) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if s.certFile != "" {
+			errc <- srv.ListenAndServeTLS(s.certFile, s.keyFile)
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+func (s *inventoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debugf("%s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "hosts":
+		writeResponse(w, s.inv.GetHosts())
+	case len(parts) == 2 && parts[0] == "hosts":
+		h, err := s.inv.GetHost(parts[1])
+		if err != nil {
+			writeError(w, http.StatusNotFound, "%s", err)
+			return
+		}
+		writeResponse(w, h)
+	case len(parts) == 3 && parts[0] == "hosts" && parts[2] == "credentials":
+		s.serveCredentials(w, parts[1])
+	case len(parts) == 1 && parts[0] == "groups":
+		writeResponse(w, s.inv.GetGroups())
+	case len(parts) == 2 && parts[0] == "groups":
+		g, err := s.inv.GetGroup(parts[1])
+		if err != nil {
+			writeError(w, http.StatusNotFound, "%s", err)
+			return
+		}
+		writeResponse(w, g)
+	case len(parts) == 3 && parts[0] == "groups" && parts[2] == "hosts":
+		if _, err := s.inv.GetGroup(parts[1]); err != nil {
+			writeError(w, http.StatusNotFound, "%s", err)
+			return
+		}
+		if parts[1] == "all" {
+			writeResponse(w, s.inv.GetHosts())
+			return
+		}
+		hosts, err := s.inv.GetHostsWithFilter(nil, "^"+regexp.QuoteMeta(parts[1])+"$")
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%s", err)
+			return
+		}
+		writeResponse(w, hosts)
+	default:
+		writeError(w, http.StatusNotFound, "%s not found", r.URL.Path)
+	}
+}
+
+// authorized returns true when the server has no token, or the request
+// carries it.
+func (s *inventoryServer) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// serveCredentials serves the vault credentials of a host, unless the
+// server has no vault, e.g. the credentials are disabled.
+func (s *inventoryServer) serveCredentials(w http.ResponseWriter, name string) {
+	if s.vault == nil {
+		writeError(w, http.StatusForbidden, "credentials are disabled")
+		return
+	}
+	creds, err := s.inv.GetHostCredentials(s.vault, name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "%s", err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeResponse(w, creds)
+}
+
+func writeResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, v, ""); err != nil {
+		log.Errorf("failed writing response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := writeJSON(w, map[string]string{"error": fmt.Sprintf(format, args...)}, ""); err != nil {
+		log.Errorf("failed writing response: %s", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"io"
+	"sort"
+	"strings"
+)
+
+// hostDetailSections are the sections of the "-show" argument.
+var hostDetailSections = []string{"vars", "groups", "credentials"}
+
+// parseHostDetailSections parses the comma-separated sections of the
+// "-show" argument, where "all" stands for all of them.
+func parseHostDetailSections(s string) (map[string]bool, error) {
+	sections := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			for _, section := range hostDetailSections {
+				sections[section] = true
+			}
+			continue
+		}
+		known := false
+		for _, section := range hostDetailSections {
+			if name == section {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown section %q, expected all, %s", name, strings.Join(hostDetailSections, ", "))
+		}
+		sections[name] = true
+	}
+	return sections, nil
+}
+
+// printHostDetail prints the sections of the details of a host, i.e. its
+// resolved variables with their sources, its groups and group chains, and
+// the vault credentials applicable to it, in the order they are tried.
+// The secrets of the credentials are masked, unless reveal is set. A nil
+// vault means no vault was loaded.
+func printHostDetail(w io.Writer, inv *db.Inventory, vlt *db.Vault, name string, sections map[string]bool, reveal bool) error {
+	h, err := inv.GetHost(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "host: %s\n", h.Name)
+	fmt.Fprintf(w, "parent: %s\n", h.Parent)
+	if sections["groups"] {
+		fmt.Fprintf(w, "groups: %s\n", strings.Join(h.Groups, ", "))
+		fmt.Fprintf(w, "group chains:\n")
+		for _, chain := range h.GroupChains {
+			fmt.Fprintf(w, "  %s\n", strings.ReplaceAll(chain, ",", " -> "))
+		}
+	}
+	if sections["vars"] {
+		keys := make([]string, 0, len(h.Variables))
+		for k := range h.Variables {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "variables:\n")
+		for _, k := range keys {
+			src := h.VariableSource(k)
+			if src == "" {
+				src = "unknown"
+			}
+			fmt.Fprintf(w, "  %s=%s\t# %s\n", k, h.Variables[k], src)
+		}
+	}
+	if sections["credentials"] {
+		if vlt == nil {
+			fmt.Fprintf(w, "credentials: no vault\n")
+			return nil
+		}
+		creds, err := vlt.GetCredentialsForHost(inv, h.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "credentials:\n")
+		for i, c := range creds {
+			s := c.String()
+			if reveal {
+				s = c.UnsafeString()
+			}
+			fmt.Fprintf(w, "  %d. %s\n", i+1, s)
+		}
+	}
+	return nil
+}
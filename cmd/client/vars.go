@@ -0,0 +1,80 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runVars implements the "vars" subcommand. The "vars show" command prints
+// the variables of a host and, optionally, where each value comes from.
+func runVars(args []string) {
+	var inputInventoryFiles stringSliceFlag
+	var hostName string
+	var withSource bool
+
+	fs := flag.NewFlagSet("vars", flag.ExitOnError)
+	fs.Var(&inputInventoryFiles, "inventory", "ansible inventory file, directory, http(s) url, ~/.ssh/config, or comma-separated host list (repeatable, default: hosts)")
+	fs.StringVar(&hostName, "host", "", "inventory host")
+	fs.BoolVar(&withSource, "with-source", false, "print where the value of each variable comes from")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\nUsage: %s vars show [arguments]\n\n", appName)
+		fmt.Fprintf(os.Stderr, "Prints the variables of a host.\n\n")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "show" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	fs.Parse(args[1:])
+	if hostName == "" {
+		log.Fatalf("vars show requires '-host'")
+	}
+	if len(inputInventoryFiles) == 0 {
+		inputInventoryFiles = append(inputInventoryFiles, "hosts")
+	}
+
+	inv := db.NewInventory()
+	if err := inv.LoadFromSources(context.Background(), inputInventoryFiles...); err != nil {
+		log.Fatalf("arguments '-inventory %s': %s", strings.Join(inputInventoryFiles, " "), err)
+	}
+	h, err := inv.GetHost(hostName)
+	if err != nil {
+		log.Fatalf("argument '-host %s': %s", hostName, err)
+	}
+	keys := make([]string, 0, len(h.Variables))
+	for k := range h.Variables {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !withSource {
+			fmt.Fprintf(os.Stdout, "%s=%s\n", k, h.Variables[k])
+			continue
+		}
+		src := h.VariableSource(k)
+		if src == "" {
+			src = "unknown"
+		}
+		fmt.Fprintf(os.Stdout, "%s=%s\t# %s\n", k, h.Variables[k], src)
+	}
+}
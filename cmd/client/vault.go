@@ -0,0 +1,247 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runVault implements the "vault" subcommand, the ansible-vault
+// counterpart for vault files:
+//   - "vault rekey" changes the password of vault files.
+//   - "vault view" prints the plaintext of vault files.
+//   - "vault edit" opens the plaintext of a vault file in $EDITOR, and
+//     re-encrypts the file with the changes.
+//   - "vault create" opens $EDITOR, and encrypts the content into a new
+//     vault file.
+//   - "vault export" prints the credentials of vault files as YAML, JSON,
+//     or XML, e.g. for other tooling to ingest them.
+func runVault(args []string) {
+	var inputVaultPassword string
+	var inputVaultPasswordFile string
+	var newVaultPassword string
+	var newVaultPasswordFile string
+	var vaultID string
+	var exportFormat string
+	var isRedacted bool
+
+	fs := flag.NewFlagSet("vault", flag.ExitOnError)
+	fs.StringVar(&inputVaultPassword, "vault.key", "", "current ansible vault password")
+	fs.StringVar(&inputVaultPasswordFile, "vault.key.file", "", "current ansible vault password file, or an executable printing the password")
+	fs.StringVar(&newVaultPassword, "new-vault.key", "", "new ansible vault password, for rekey")
+	fs.StringVar(&newVaultPasswordFile, "new-vault.key.file", "", "new ansible vault password file, or an executable printing the password, for rekey")
+	fs.StringVar(&vaultID, "vault.id", "", "vault id label of a new vault, for create")
+	fs.StringVar(&exportFormat, "format", "yaml", "credential format, yaml, json, or xml, for export")
+	fs.BoolVar(&isRedacted, "redact", false, "mask the secrets of the credentials, for export")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\nUsage: %s vault rekey [arguments] <vault file>...\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s vault view [arguments] <vault file>...\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s vault edit [arguments] <vault file>\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s vault create [arguments] <vault file>\n", appName)
+		fmt.Fprintf(os.Stderr, "       %s vault export [arguments] <vault file>...\n\n", appName)
+		fmt.Fprintf(os.Stderr, "Re-encrypts vault files under a new password, prints them, edits them\n")
+		fmt.Fprintf(os.Stderr, "with $EDITOR, creates a new one, or exports their credentials.\n\n")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	command := args[0]
+	switch command {
+	case "rekey", "view", "edit", "create", "export":
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() == 0 {
+		log.Fatalf("vault %s requires at least one vault file", command)
+	}
+	if (command == "edit" || command == "create") && fs.NArg() > 1 {
+		log.Fatalf("vault %s requires exactly one vault file", command)
+	}
+	password, err := readVaultPassword("vault.key", inputVaultPassword, inputVaultPasswordFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch command {
+	case "rekey":
+		newPassword, err := readVaultPassword("new-vault.key", newVaultPassword, newVaultPasswordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, fp := range fs.Args() {
+			if err := db.RekeyFile(fp, password, newPassword); err != nil {
+				log.Fatalf("vault %s: %s", fp, err)
+			}
+			fmt.Fprintf(os.Stdout, "rekeyed %s\n", fp)
+		}
+	case "view":
+		for _, fp := range fs.Args() {
+			vlt := openVaultPayload(fp, password)
+			os.Stdout.Write(vlt.Payload)
+			vlt.Close()
+		}
+	case "edit":
+		fp := fs.Arg(0)
+		vlt := openVaultPayload(fp, password)
+		defer vlt.Close()
+		b, err := editVaultPayload(vlt.Payload)
+		if err != nil {
+			log.Fatalf("vault %s: %s", fp, err)
+		}
+		if bytes.Equal(b, vlt.Payload) {
+			fmt.Fprintf(os.Stdout, "no changes to %s\n", fp)
+			return
+		}
+		saveVaultPayload(vlt, fp, b)
+		fmt.Fprintf(os.Stdout, "saved %s\n", fp)
+	case "create":
+		fp := fs.Arg(0)
+		if _, err := os.Stat(fp); err == nil {
+			log.Fatalf("vault %s: file already exists, use 'vault edit'", fp)
+		}
+		vlt := db.NewVault()
+		defer vlt.Close()
+		if err := vlt.SetPassword(password); err != nil {
+			log.Fatal(err)
+		}
+		vlt.Header.Label = vaultID
+		b, err := editVaultPayload(nil)
+		if err != nil {
+			log.Fatalf("vault %s: %s", fp, err)
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			log.Fatalf("vault %s: not created, no content", fp)
+		}
+		saveVaultPayload(vlt, fp, b)
+		fmt.Fprintf(os.Stdout, "created %s\n", fp)
+	case "export":
+		vlt := db.NewVault()
+		defer vlt.Close()
+		if err := vlt.SetPassword(password); err != nil {
+			log.Fatal(err)
+		}
+		var credentials []*db.VaultCredential
+		for _, fp := range fs.Args() {
+			if err := vlt.LoadFromFile(fp); err != nil {
+				log.Fatalf("vault %s: %s", fp, err)
+			}
+			credentials = append(credentials, vlt.Credentials...)
+		}
+		vlt.Credentials = credentials
+		var opts []db.CredentialExportOption
+		if isRedacted {
+			opts = append(opts, db.WithRedactedSecrets())
+		}
+		if err := vlt.ExportCredentials(exportFormat, os.Stdout, opts...); err != nil {
+			log.Fatalf("argument '-format %s': %s", exportFormat, err)
+		}
+	}
+}
+
+// openVaultPayload decrypts a vault file with the password.
+func openVaultPayload(fp, password string) *db.Vault {
+	vlt := db.NewVault()
+	if err := vlt.SetPassword(password); err != nil {
+		log.Fatal(err)
+	}
+	if err := vlt.LoadPayloadFromFile(fp); err != nil {
+		log.Fatalf("vault %s: %s", fp, err)
+	}
+	return vlt
+}
+
+// saveVaultPayload encrypts the plaintext into the vault file. A plaintext
+// holding credentials must be a valid credential store, so that the file
+// keeps working with the client.
+func saveVaultPayload(vlt *db.Vault, fp string, b []byte) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(b, &doc); err == nil {
+		if _, exists := doc["credentials"]; exists {
+			tv := db.NewVault()
+			tv.Password = vlt.Password
+			encrypted, err := vlt.Encrypt(b)
+			if err == nil {
+				err = tv.LoadFromBytes(encrypted)
+			}
+			if err != nil {
+				log.Fatalf("vault %s: not saved, invalid credentials: %s", fp, err)
+			}
+		}
+	}
+	if err := vlt.SavePayload(fp, b); err != nil {
+		log.Fatalf("vault %s: %s", fp, err)
+	}
+}
+
+// editVaultPayload writes the plaintext to a temporary file, readable by
+// the owner only, opens it in $EDITOR, vi by default, and returns the
+// edited content. The temporary file is erased afterwards.
+func editVaultPayload(b []byte) ([]byte, error) {
+	f, err := os.CreateTemp("", "vault-*.yml")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if fi, err := os.Stat(f.Name()); err == nil {
+			os.WriteFile(f.Name(), make([]byte, fi.Size()), 0600)
+		}
+		os.Remove(f.Name())
+	}()
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor %s failed: %s", editor[0], err)
+	}
+	return os.ReadFile(f.Name())
+}
+
+// readVaultPassword returns the password provided by either the "-<name>"
+// or the "-<name>.file" argument.
+func readVaultPassword(name, password, fp string) (string, error) {
+	switch {
+	case password != "":
+		return password, nil
+	case fp != "":
+		vlt := db.NewVault()
+		if err := vlt.LoadPasswordFromFile(fp); err != nil {
+			return "", fmt.Errorf("argument '-%s.file %s': %s", name, fp, err)
+		}
+		return string(vlt.Password), nil
+	}
+	return "", fmt.Errorf("vault requires '-%s' or '-%s.file'", name, name)
+}
@@ -3,9 +3,13 @@ module github.com/greenpau/go-ansible-db
 go 1.20
 
 require (
+	github.com/jmespath/go-jmespath v0.4.0
+	github.com/klauspost/compress v1.17.0
+	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/crypto v0.13.0
+	golang.org/x/term v0.14.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
-require golang.org/x/sys v0.12.0 // indirect
+require golang.org/x/sys v0.14.0 // indirect
@@ -0,0 +1,154 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HostAccess is the access profile of a host, i.e. where and how to log in
+// to it, merged from the connection variables of the host and its vault
+// credential.
+type HostAccess struct {
+	Host            string `xml:"host" json:"host" yaml:"host"`
+	Address         string `xml:"address" json:"address" yaml:"address"`
+	Port            int    `xml:"port" json:"port" yaml:"port"`
+	Connection      string `xml:"connection" json:"connection" yaml:"connection"`
+	Username        string `xml:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
+	Password        string `xml:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
+	EnabledPassword string `xml:"password_enable,omitempty" json:"password_enable,omitempty" yaml:"password_enable,omitempty"`
+	PrivateKey      string `xml:"private_key,omitempty" json:"private_key,omitempty" yaml:"private_key,omitempty"`
+	PrivateKeyFile  string `xml:"private_key_file,omitempty" json:"private_key_file,omitempty" yaml:"private_key_file,omitempty"`
+	Passphrase      string `xml:"passphrase,omitempty" json:"passphrase,omitempty" yaml:"passphrase,omitempty"`
+	BecomeMethod    string `xml:"become_method,omitempty" json:"become_method,omitempty" yaml:"become_method,omitempty"`
+	BecomePassword  string `xml:"become_password,omitempty" json:"become_password,omitempty" yaml:"become_password,omitempty"`
+	// Sources maps the fields above, by their JSON names, to where their
+	// values come from, i.e. a variable name, "vault", or "default".
+	Sources map[string]string `xml:"-" json:"sources,omitempty" yaml:"sources,omitempty"`
+	// Credential is the vault credential the profile is merged with, if
+	// any, i.e. the first of the credentials of the host.
+	Credential *VaultCredential `xml:"-" json:"-" yaml:"-"`
+}
+
+// ResolveHostAccess returns the access profile of a host of the Inventory.
+// The connection variables of the host, e.g. ansible_user, ansible_password,
+// and ansible_become_pass, take precedence, as Ansible would use them. The
+// first vault credential of the host, see GetCredentialsForHost, provides
+// the values the variables do not set. The Vault may be nil.
+func ResolveHostAccess(inv *Inventory, v *Vault, s string) (*HostAccess, error) {
+	if inv == nil {
+		return nil, fmt.Errorf("inventory not found")
+	}
+	h, err := inv.GetHost(s)
+	if err != nil {
+		return nil, err
+	}
+	a := &HostAccess{
+		Host:       h.Name,
+		Address:    h.AnsibleHost(),
+		Connection: h.AnsibleConnection(),
+		Sources:    make(map[string]string),
+	}
+	if v != nil {
+		if creds := v.hostCredentials(h); len(creds) > 0 {
+			a.Credential = creds[0]
+		}
+	}
+	c := a.Credential
+	if c == nil {
+		c = &VaultCredential{}
+	}
+
+	port, err := h.AnsiblePort()
+	if err != nil {
+		return nil, err
+	}
+	a.Port = port
+	switch name := h.ansibleVariableName("ansible_port", "ansible_ssh_port"); {
+	case name != "":
+		a.Sources["port"] = name
+	case c.Port > 0:
+		a.Port = c.Port
+		a.Sources["port"] = "vault"
+	default:
+		a.Sources["port"] = "default"
+	}
+
+	for _, f := range []struct {
+		field string
+		dst   *string
+		cred  string
+		names []string
+	}{
+		{"username", &a.Username, c.Username, []string{"ansible_user", "ansible_ssh_user"}},
+		{"password", &a.Password, c.Password, []string{"ansible_password", "ansible_ssh_pass", "ansible_ssh_password"}},
+		{"password_enable", &a.EnabledPassword, c.EnabledPassword, nil},
+		{"private_key", &a.PrivateKey, c.PrivateKey, nil},
+		{"private_key_file", &a.PrivateKeyFile, c.PrivateKeyFile, []string{"ansible_private_key_file", "ansible_ssh_private_key_file"}},
+		{"passphrase", &a.Passphrase, c.Passphrase, nil},
+		{"become_method", &a.BecomeMethod, c.BecomeMethod, []string{"ansible_become_method"}},
+		{"become_password", &a.BecomePassword, c.BecomePassword, []string{"ansible_become_password", "ansible_become_pass"}},
+	} {
+		if val, ok := h.ansibleVariable(f.names...); ok {
+			*f.dst = val
+			a.Sources[f.field] = h.ansibleVariableName(f.names...)
+			continue
+		}
+		if f.cred != "" {
+			*f.dst = f.cred
+			a.Sources[f.field] = "vault"
+		}
+	}
+	return a, nil
+}
+
+// String returns the access profile with the secrets masked, as the String
+// of VaultCredential.
+func (a *HostAccess) String() string {
+	secret := func(v string) string {
+		if v == "" {
+			return v
+		}
+		return redactedSecret
+	}
+	var s strings.Builder
+	s.WriteString("host=" + a.Host)
+	s.WriteString(", address=" + a.Address)
+	s.WriteString(", port=" + strconv.Itoa(a.Port))
+	s.WriteString(", connection=" + a.Connection)
+	s.WriteString(", username=" + a.Username)
+	s.WriteString(", password=" + secret(a.Password))
+	if a.EnabledPassword != "" {
+		s.WriteString(", enabled_password=" + secret(a.EnabledPassword))
+	}
+	if a.PrivateKey != "" {
+		s.WriteString(", private_key=" + secret(a.PrivateKey))
+	}
+	if a.PrivateKeyFile != "" {
+		s.WriteString(", private_key_file=" + a.PrivateKeyFile)
+	}
+	if a.Passphrase != "" {
+		s.WriteString(", passphrase=" + secret(a.Passphrase))
+	}
+	if a.BecomeMethod != "" {
+		s.WriteString(", become_method=" + a.BecomeMethod)
+	}
+	if a.BecomePassword != "" {
+		s.WriteString(", become_password=" + secret(a.BecomePassword))
+	}
+	return s.String()
+}
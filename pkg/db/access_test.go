@@ -0,0 +1,106 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveHostAccess(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromBytes([]byte(`[routers]
+rtr01 ansible_host=192.0.2.1
+rtr02 ansible_host=192.0.2.2 ansible_user=ops ansible_ssh_pass=0ps ansible_port=2222
+
+[switches]
+sw01 ansible_become_pass=b3come ansible_become_method=enable
+
+[switches:vars]
+ansible_connection=network_cli
+`)); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	vlt := NewVault()
+	vlt.Credentials = []*VaultCredential{
+		{Regex: "^rtr", Username: "admin", Password: "s3cret", EnabledPassword: "3nable", Port: 8022},
+		{Group: "switches", Username: "netops", Password: "n3t", BecomeMethod: "sudo", BecomePassword: "sud0"},
+	}
+	if err := validateCredentials(vlt.Credentials); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		host      string
+		vault     *Vault
+		expected  string
+		sources   map[string]string
+		shouldErr bool
+	}{
+		{
+			host:     "rtr01",
+			vault:    vlt,
+			expected: "host=rtr01, address=192.0.2.1, port=8022, connection=ssh, username=admin, password=****, enabled_password=****",
+			sources:  map[string]string{"port": "vault", "username": "vault", "password": "vault"},
+		},
+		{
+			host:     "rtr02",
+			vault:    vlt,
+			expected: "host=rtr02, address=192.0.2.2, port=2222, connection=ssh, username=ops, password=****, enabled_password=****",
+			sources:  map[string]string{"port": "ansible_port", "username": "ansible_user", "password": "ansible_ssh_pass"},
+		},
+		{
+			host:     "sw01",
+			vault:    vlt,
+			expected: "host=sw01, address=sw01, port=22, connection=network_cli, username=netops, password=****, become_method=enable, become_password=****",
+			sources:  map[string]string{"port": "default", "become_method": "ansible_become_method", "become_password": "ansible_become_pass"},
+		},
+		{
+			host:     "rtr01",
+			expected: "host=rtr01, address=192.0.2.1, port=22, connection=ssh, username=, password=",
+			sources:  map[string]string{"port": "default", "username": ""},
+		},
+		{host: "unknown", vault: vlt, shouldErr: true},
+	} {
+		a, err := ResolveHostAccess(inv, test.vault, test.host)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, host %s: expected error, but passed", i, test.host)
+			}
+			t.Logf("PASS: Test %d, host %s: error: %s", i, test.host, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, host %s: unexpected error: %s", i, test.host, err)
+		}
+		if a.String() != test.expected {
+			t.Fatalf("FAIL: Test %d, host %s: mismatch:\n%s (expected)\n%s (received)", i, test.host, test.expected, a.String())
+		}
+		for k, v := range test.sources {
+			if a.Sources[k] != v {
+				t.Fatalf("FAIL: Test %d, host %s: source of %s mismatch: %q (expected) vs. %q (received)", i, test.host, k, v, a.Sources[k])
+			}
+		}
+		t.Logf("PASS: Test %d, host %s: %s", i, test.host, a)
+	}
+
+	a, err := ResolveHostAccess(inv, vlt, "rtr02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Password != "0ps" || a.EnabledPassword != "3nable" || a.Credential != vlt.Credentials[0] || strings.Contains(a.String(), "0ps") {
+		t.Fatalf("unexpected access profile: %+v", a)
+	}
+}
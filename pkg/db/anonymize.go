@@ -0,0 +1,128 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+)
+
+// secretVariablePattern matches the names of the variables holding
+// secret-ish values, e.g. ansible_become_password or api_token.
+var secretVariablePattern = regexp.MustCompile(`(?i)(pass|secret|token|key|credential|community)`)
+
+var ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+type anonymizer struct {
+	key   []byte
+	hosts map[string]string
+}
+
+func (a *anonymizer) hash(kind, s string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + ":" + s))
+	return mac.Sum(nil)
+}
+
+func (a *anonymizer) hostname(s string) string {
+	if localhostNames[s] {
+		return s
+	}
+	return "host-" + hex.EncodeToString(a.hash("host", s)[:4])
+}
+
+func (a *anonymizer) ip(ip net.IP) string {
+	if ip.IsLoopback() {
+		return ip.String()
+	}
+	h := a.hash("ip", ip.String())
+	if ip.To4() != nil {
+		return net.IPv4(10, h[0], h[1], h[2]).String()
+	}
+	v6 := make(net.IP, net.IPv6len)
+	v6[0] = 0xfd
+	copy(v6[1:], h[:15])
+	return v6.String()
+}
+
+func (a *anonymizer) value(k, v string) string {
+	if v == "" || IsTemplate(v) {
+		return v
+	}
+	if secretVariablePattern.MatchString(k) {
+		return "redacted-" + hex.EncodeToString(a.hash("secret", v)[:4])
+	}
+	if ip := net.ParseIP(v); ip != nil {
+		return a.ip(ip)
+	}
+	if name, exists := a.hosts[v]; exists {
+		return name
+	}
+	if k == "ansible_host" || k == "ansible_ssh_host" {
+		return a.hostname(v)
+	}
+	return ipv4Pattern.ReplaceAllStringFunc(v, func(s string) string {
+		if ip := net.ParseIP(s); ip != nil {
+			return a.ip(ip)
+		}
+		return s
+	})
+}
+
+// Anonymize returns a copy of the Inventory with pseudonymized host names,
+// IP addresses, and the values of secret-ish variables, e.g. passwords and
+// tokens. The groups and the variable names are preserved. The pseudonyms
+// are derived from the provided key, i.e. the same key always produces the
+// same pseudonyms, so that the anonymized inventories are comparable.
+func (inv *Inventory) Anonymize(key []byte) (*Inventory, error) {
+	var buf bytes.Buffer
+	if err := inv.Encode(&buf); err != nil {
+		return nil, err
+	}
+	out := NewInventory()
+	if err := out.Decode(&buf); err != nil {
+		return nil, err
+	}
+	a := &anonymizer{
+		key:   key,
+		hosts: make(map[string]string),
+	}
+	for _, h := range out.Hosts {
+		a.hosts[h.Name] = a.hostname(h.Name)
+	}
+	out.Raw = nil
+	out.HostsRef = make(map[string]string)
+	for _, h := range out.Hosts {
+		h.Name = a.hosts[h.Name]
+		if _, exists := out.HostsRef[h.Name]; exists {
+			return nil, fmt.Errorf("pseudonym collision for host %s", h.Name)
+		}
+		out.HostsRef[h.Name] = h.Parent
+		for k, v := range h.Variables {
+			h.Variables[k] = a.value(k, v)
+		}
+	}
+	for _, g := range out.Groups {
+		for k, v := range g.Variables {
+			g.Variables[k] = a.value(k, v)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	data := []byte(`[web]
+web01.example.com ansible_host=192.0.2.10 ansible_become_password=s3cret
+web02.example.com ansible_host=2001:db8::10 http_port=80
+localhost ansible_connection=local
+
+[web:vars]
+api_token=abc123
+syslog_servers=192.0.2.1,192.0.2.2
+proxy=web01.example.com
+`)
+	inv := NewInventory()
+	if err := inv.LoadFromBytes(data); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	key := []byte("bug-report")
+	anon, err := inv.Anonymize(key)
+	if err != nil {
+		t.Fatalf("error anonymizing inventory: %s", err)
+	}
+	again, err := inv.Anonymize(key)
+	if err != nil {
+		t.Fatalf("error anonymizing inventory: %s", err)
+	}
+	if anon.Size() != inv.Size() {
+		t.Fatalf("inventory size mismatch: %d (expected) vs. %d (received)", inv.Size(), anon.Size())
+	}
+	for i, h := range anon.Hosts {
+		if h.Name != again.Hosts[i].Name {
+			t.Fatalf("FAIL: Test %d, pseudonyms are not deterministic: %s vs. %s", i, h.Name, again.Hosts[i].Name)
+		}
+		if _, err := anon.GetHost(h.Name); err != nil {
+			t.Fatalf("FAIL: Test %d, %s", i, err)
+		}
+		for k, v := range h.Variables {
+			for _, s := range []string{"example.com", "192.0.2.", "2001:db8", "s3cret", "abc123"} {
+				if strings.Contains(v, s) {
+					t.Fatalf("FAIL: Test %d, host %s variable %s leaks %s: %s", i, h.Name, k, s, v)
+				}
+			}
+		}
+		t.Logf("PASS: Test %d, host %s: %v", i, h.Name, h.Variables)
+	}
+
+	if _, err := anon.GetHost("web01.example.com"); err == nil {
+		t.Fatalf("anonymized inventory has the original host name")
+	}
+	h, err := anon.GetHost("localhost")
+	if err != nil || h.Implicit {
+		t.Fatalf("anonymized inventory should preserve localhost")
+	}
+	web01 := anon.Hosts[0]
+	if web01.Variables["proxy"] != web01.Name {
+		t.Fatalf("host references are not consistent: %s vs. %s", web01.Variables["proxy"], web01.Name)
+	}
+	if web01.Variables["http_port"] != "" || anon.Hosts[1].Variables["http_port"] != "80" {
+		t.Fatalf("non-sensitive variables should be preserved")
+	}
+	if _, err := inv.GetHost("web01.example.com"); err != nil {
+		t.Fatalf("original inventory was modified: %s", err)
+	}
+}
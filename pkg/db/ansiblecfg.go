@@ -0,0 +1,154 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AnsibleConfig holds the settings of an Ansible configuration file, i.e.
+// ansible.cfg, relevant to the inventory and the vault.
+type AnsibleConfig struct {
+	// Path is the configuration file the settings come from. It is empty
+	// when no configuration file was found.
+	Path string
+	// Inventory holds the inventory sources of the "inventory" setting of
+	// the [defaults] section.
+	Inventory []string
+	// VaultPasswordFile is the "vault_password_file" setting of the
+	// [defaults] section.
+	VaultPasswordFile string
+}
+
+// ansibleConfigPaths returns the locations of the Ansible configuration
+// file, in the order Ansible looks them up.
+func ansibleConfigPaths() []string {
+	var paths []string
+	if fp := os.Getenv("ANSIBLE_CONFIG"); fp != "" {
+		fp = expandFilePath(fp)
+		if fi, err := os.Stat(fp); err == nil && fi.IsDir() {
+			fp = filepath.Join(fp, "ansible.cfg")
+		}
+		paths = append(paths, fp)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		paths = append(paths, filepath.Join(wd, "ansible.cfg"))
+	}
+	return append(paths, expandFilePath("~/.ansible.cfg"), "/etc/ansible/ansible.cfg")
+}
+
+// LoadAnsibleConfig reads the first Ansible configuration file found, the
+// way Ansible does, i.e. the file in the ANSIBLE_CONFIG environment
+// variable, ansible.cfg in the current directory, ~/.ansible.cfg, or
+// /etc/ansible/ansible.cfg. As in Ansible, the ANSIBLE_INVENTORY and the
+// ANSIBLE_VAULT_PASSWORD_FILE environment variables take precedence over
+// the settings of the file. Without a configuration file, the settings
+// come from the environment variables only.
+func LoadAnsibleConfig() (*AnsibleConfig, error) {
+	cfg := &AnsibleConfig{}
+	for _, fp := range ansibleConfigPaths() {
+		if _, err := os.Stat(fp); err != nil {
+			continue
+		}
+		var err error
+		if cfg, err = LoadAnsibleConfigFromFile(fp); err != nil {
+			return nil, err
+		}
+		break
+	}
+	if s := os.Getenv("ANSIBLE_INVENTORY"); s != "" {
+		cfg.Inventory = splitAnsibleConfigList(s, "")
+	}
+	if s := os.Getenv("ANSIBLE_VAULT_PASSWORD_FILE"); s != "" {
+		cfg.VaultPasswordFile = expandFilePath(s)
+	}
+	return cfg, nil
+}
+
+// LoadAnsibleConfigFromFile reads the settings of an Ansible configuration
+// file. The relative paths of the settings are relative to the directory
+// of the file, as in Ansible.
+func LoadAnsibleConfigFromFile(fp string) (*AnsibleConfig, error) {
+	fp = expandFilePath(fp)
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &AnsibleConfig{Path: fp}
+	dir := filepath.Dir(fp)
+	var section string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for lc := 1; scanner.Scan(); lc++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 1 {
+			return nil, fmt.Errorf("ansible config %s, line %d: invalid setting: %s", fp, lc, line)
+		}
+		if section != "defaults" {
+			continue
+		}
+		k, v := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		// The inline comments start with a semicolon after a whitespace.
+		if j := strings.Index(v, " ;"); j >= 0 {
+			v = strings.TrimSpace(v[:j])
+		}
+		switch k {
+		case "inventory", "hostfile":
+			cfg.Inventory = splitAnsibleConfigList(v, dir)
+		case "vault_password_file":
+			cfg.VaultPasswordFile = resolveAnsibleConfigPath(v, dir)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ansible config %s: %s", fp, err)
+	}
+	return cfg, nil
+}
+
+// splitAnsibleConfigList returns the paths of a comma-separated list.
+func splitAnsibleConfigList(s, dir string) []string {
+	var paths []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, resolveAnsibleConfigPath(p, dir))
+		}
+	}
+	return paths
+}
+
+// resolveAnsibleConfigPath expands the home directory of a path, and makes
+// a relative path relative to the provided directory, unless it is a URL.
+func resolveAnsibleConfigPath(s, dir string) string {
+	if s == "" {
+		return s
+	}
+	s = expandFilePath(s)
+	if dir == "" || filepath.IsAbs(s) || strings.Contains(s, "://") {
+		return s
+	}
+	return filepath.Join(dir, s)
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadAnsibleConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "ansible.cfg")
+	for i, test := range []struct {
+		input     string
+		env       map[string]string
+		inventory []string
+		password  string
+		shouldErr bool
+	}{
+		{
+			input: `# ansible.cfg
+[defaults]
+inventory = hosts, /etc/ansible/hosts ; the inventories
+vault_password_file = .vault_pass
+remote_user = admin
+
+[ssh_connection]
+inventory = ignored
+`,
+			inventory: []string{filepath.Join(dir, "hosts"), "/etc/ansible/hosts"},
+			password:  filepath.Join(dir, ".vault_pass"),
+		},
+		{
+			input:     "[defaults]\nhostfile: https://example.com/hosts\n",
+			inventory: []string{"https://example.com/hosts"},
+		},
+		{
+			input:     "[defaults]\ninventory = hosts\nvault_password_file = /etc/ansible/vault_pass\n",
+			env:       map[string]string{"ANSIBLE_INVENTORY": "prod,stage", "ANSIBLE_VAULT_PASSWORD_FILE": "/run/vault_pass"},
+			inventory: []string{"prod", "stage"},
+			password:  "/run/vault_pass",
+		},
+		{
+			input:     "[defaults]\ninventory\n",
+			shouldErr: true,
+		},
+	} {
+		if err := os.WriteFile(cfgFile, []byte(test.input), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("ANSIBLE_CONFIG", dir)
+		for _, k := range []string{"ANSIBLE_INVENTORY", "ANSIBLE_VAULT_PASSWORD_FILE"} {
+			t.Setenv(k, test.env[k])
+		}
+		cfg, err := LoadAnsibleConfig()
+		if err != nil {
+			if !test.shouldErr {
+				t.Fatalf("FAIL: Test %d: expected to pass, but threw error: %v", i, err)
+			}
+			t.Logf("PASS: Test %d: expected to fail, failed: %s", i, err)
+			continue
+		}
+		if test.shouldErr {
+			t.Fatalf("FAIL: Test %d: expected to throw error, but passed", i)
+		}
+		if cfg.Path != cfgFile {
+			t.Fatalf("FAIL: Test %d: config path mismatch: %s (expected) vs. %s (received)", i, cfgFile, cfg.Path)
+		}
+		if !reflect.DeepEqual(cfg.Inventory, test.inventory) {
+			t.Fatalf("FAIL: Test %d: inventory mismatch: %v (expected) vs. %v (received)", i, test.inventory, cfg.Inventory)
+		}
+		if cfg.VaultPasswordFile != test.password {
+			t.Fatalf("FAIL: Test %d: vault password file mismatch: %s (expected) vs. %s (received)", i, test.password, cfg.VaultPasswordFile)
+		}
+		t.Logf("PASS: Test %d: inventory: %v, vault password file: %s", i, cfg.Inventory, cfg.VaultPasswordFile)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ToAnsibleJSON returns the Inventory in the JSON format of
+// "ansible-inventory --list", i.e. the host variables, including the
+// inherited ones, under _meta.hostvars and an object per group with its
+// direct hosts, its child groups, and its variables. The hosts without a
+// group are members of the "ungrouped" group. The values of the variables
+// are typed, e.g. the lists and the dictionaries of the variables files
+// are JSON arrays and objects, see InventoryHost.TypedVariables. The
+// output may be used as the output of an Ansible dynamic inventory script.
+func (inv *Inventory) ToAnsibleJSON() ([]byte, error) {
+	if err := inv.Precompute(); err != nil {
+		return nil, err
+	}
+	hostVars := make(map[string]map[string]interface{})
+	groups := make(map[string]*ansibleGroup)
+	groups["ungrouped"] = &ansibleGroup{}
+	for _, g := range inv.Groups {
+		ag := &ansibleGroup{}
+		if len(g.Variables) > 0 {
+			ag.Vars = typedVariables(g.Variables)
+		}
+		groups[g.Name] = ag
+	}
+	children, members := inv.groupMembers()
+	for name, ag := range groups {
+		ag.Children = children[name]
+		ag.Hosts = members[name]
+	}
+	for _, h := range inv.Hosts {
+		hostVars[h.Name] = typedVariables(h.Variables)
+	}
+
+	doc := make(map[string]interface{})
+	for name, g := range groups {
+		doc[name] = g
+	}
+	doc["_meta"] = map[string]interface{}{
+		"hostvars": hostVars,
+	}
+	b, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("failed encoding inventory: %s", err)
+	}
+	return b, nil
+}
+
+// groupMembers returns the sorted child groups and the sorted direct hosts
+// of each group. The top-level groups are the children of "all", and the
+// hosts without a group are the members of the "ungrouped" group, as in
+// Ansible. The hosts are expected to be resolved, see Precompute.
+func (inv *Inventory) groupMembers() (map[string][]string, map[string][]string) {
+	children := make(map[string][]string)
+	hosts := make(map[string][]string)
+	for _, g := range inv.Groups {
+		if g.Name == "all" {
+			continue
+		}
+		topLevel := true
+		for _, a := range g.Ancestors {
+			if a == "all" {
+				continue
+			}
+			topLevel = false
+			if inv.GroupsRef[a] {
+				children[a] = append(children[a], g.Name)
+			}
+		}
+		if topLevel {
+			children["all"] = append(children["all"], g.Name)
+		}
+	}
+	if !inv.GroupsRef["ungrouped"] {
+		children["all"] = append(children["all"], "ungrouped")
+	}
+	for _, h := range inv.Hosts {
+		direct := hostDirectGroups(h)
+		if len(direct) == 0 {
+			direct = []string{"ungrouped"}
+		}
+		for _, g := range direct {
+			if inv.GroupsRef[g] || g == "ungrouped" {
+				hosts[g] = append(hosts[g], h.Name)
+			}
+		}
+	}
+	for _, m := range []map[string][]string{children, hosts} {
+		for _, names := range m {
+			sort.Strings(names)
+		}
+	}
+	return children, hosts
+}
+
+// hostDirectGroups returns the groups a host is a direct member of, i.e.
+// the last groups of its group chains, except "all".
+func hostDirectGroups(h *InventoryHost) []string {
+	var groups []string
+	seen := make(map[string]bool)
+	for _, c := range h.GroupChains {
+		chain := strings.Split(c, ",")
+		g := chain[len(chain)-1]
+		if g == "all" || seen[g] {
+			continue
+		}
+		seen[g] = true
+		groups = append(groups, g)
+	}
+	if len(groups) == 0 && h.Parent != "" && h.Parent != "all" {
+		groups = append(groups, h.Parent)
+	}
+	return groups
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToAnsibleJSON(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	b, err := inv.ToAnsibleJSON()
+	if err != nil {
+		t.Fatalf("error encoding inventory: %s", err)
+	}
+	ai, err := parseAnsibleInventory(b)
+	if err != nil {
+		t.Fatalf("error parsing inventory: %s", err)
+	}
+	for i, test := range []struct {
+		group    string
+		hosts    string
+		children string
+		vars     map[string]string
+	}{
+		{group: "all", children: "arista,cisco,ungrouped,us", vars: map[string]string{"ansible_connection": "local"}},
+		{group: "ungrouped", hosts: "controller"},
+		{group: "ny", children: "ny4,ny5"},
+		{group: "ny4", children: "ny4-arista,ny4-cisco", vars: map[string]string{"datacenter": "ny4"}},
+		{group: "cisco", children: "ny4-cisco,ny5-cisco", vars: map[string]string{"vendor": "Cisco Systems"}},
+		{group: "ny4-cisco", hosts: "ny-sw01"},
+	} {
+		g, exists := ai.groups[test.group]
+		if !exists {
+			t.Fatalf("FAIL: Test %d, group %s not found", i, test.group)
+		}
+		if s := strings.Join(g.Hosts, ","); s != test.hosts {
+			t.Fatalf("FAIL: Test %d, group %s hosts mismatch: %s (expected) vs. %s (received)", i, test.group, test.hosts, s)
+		}
+		if s := strings.Join(g.Children, ","); s != test.children {
+			t.Fatalf("FAIL: Test %d, group %s children mismatch: %s (expected) vs. %s (received)", i, test.group, test.children, s)
+		}
+		for k, v := range test.vars {
+			if g.Vars[k] != v {
+				t.Fatalf("FAIL: Test %d, group %s variable %s mismatch: %s (expected) vs. %v (received)", i, test.group, k, v, g.Vars[k])
+			}
+		}
+		t.Logf("PASS: Test %d, group %s", i, test.group)
+	}
+	if ai.hostVars["ny-sw01"]["vendor"] != "Cisco Systems" {
+		t.Fatalf("host ny-sw01 inherited variable mismatch: %v", ai.hostVars["ny-sw01"])
+	}
+	if divergences := inv.compareAnsibleInventory(ai); len(divergences) > 0 {
+		t.Fatalf("inventory diverges from its ansible-inventory output: %v", divergences)
+	}
+}
+
+func TestToAnsibleJSONTypedVariables(t *testing.T) {
+	dir := t.TempDir()
+	for fp, b := range map[string][]byte{
+		"hosts":                 []byte("[ny4]\nny-sw01\n"),
+		"group_vars/ny4.yml":    []byte("ntp: [10.0.0.1, 10.0.0.2]\nsnmp:\n  community: public\n  port: 161\n"),
+		"host_vars/ny-sw01.yml": []byte("vlans: [10, 20]\nos: ios\n"),
+	} {
+		fp = filepath.Join(dir, fp)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatalf("error creating directory: %s", err)
+		}
+		if err := os.WriteFile(fp, b, 0600); err != nil {
+			t.Fatalf("error writing %s: %s", fp, err)
+		}
+	}
+	inv := NewInventory()
+	if err := inv.LoadFromDir(dir); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	b, err := inv.ToAnsibleJSON()
+	if err != nil {
+		t.Fatalf("error encoding inventory: %s", err)
+	}
+	ai, err := parseAnsibleInventory(b)
+	if err != nil {
+		t.Fatalf("error parsing inventory: %s", err)
+	}
+	hostVars := ai.hostVars["ny-sw01"]
+	for i, test := range []struct {
+		name   string
+		value  interface{}
+		expect interface{}
+	}{
+		{name: "group ntp", value: ai.groups["ny4"].Vars["ntp"], expect: []interface{}{"10.0.0.1", "10.0.0.2"}},
+		{name: "group snmp", value: ai.groups["ny4"].Vars["snmp"], expect: map[string]interface{}{"community": "public", "port": float64(161)}},
+		{name: "host ntp", value: hostVars["ntp"], expect: []interface{}{"10.0.0.1", "10.0.0.2"}},
+		{name: "host snmp", value: hostVars["snmp"], expect: map[string]interface{}{"community": "public", "port": float64(161)}},
+		{name: "host vlans", value: hostVars["vlans"], expect: []interface{}{float64(10), float64(20)}},
+		{name: "host os", value: hostVars["os"], expect: "ios"},
+	} {
+		if !reflect.DeepEqual(test.value, test.expect) {
+			t.Fatalf("FAIL: Test %d, %s mismatch: %v (expected) vs. %v (received)", i, test.name, test.expect, test.value)
+		}
+		t.Logf("PASS: Test %d, %s", i, test.name)
+	}
+	if divergences := inv.compareAnsibleInventory(ai); len(divergences) > 0 {
+		t.Fatalf("inventory diverges from its ansible-inventory output: %v", divergences)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// BrokerRequest is a request to a CredentialBroker, one JSON object per
+// line.
+type BrokerRequest struct {
+	Host string `json:"host"`
+}
+
+// BrokerResponse is the response of a CredentialBroker to a BrokerRequest.
+type BrokerResponse struct {
+	Credentials []*VaultCredential `json:"credentials,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// peerCredentials identify the process on the other end of a Unix socket.
+type peerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// CredentialBroker answers the requests for the credentials of a host from
+// the co-located processes, e.g. exporters and collectors, over a Unix
+// domain socket, so that only the broker holds the vault password. The
+// broker checks the user and the group of the peer process, as reported by
+// the kernel, before answering. The peer checks are supported on Linux
+// only, elsewhere every connection is refused.
+type CredentialBroker struct {
+	Vault *Vault
+	// Provider serves the credentials instead of Vault, when set, e.g.
+	// the credentials of a secrets store.
+	Provider CredentialProvider
+	// AllowedUIDs are the users of the processes allowed to request the
+	// credentials. It defaults to the user of the broker.
+	AllowedUIDs []uint32
+	// AllowedGIDs are the groups of the processes allowed to request the
+	// credentials, in addition to AllowedUIDs.
+	AllowedGIDs []uint32
+	// Timeout limits the duration of a connection.
+	Timeout time.Duration
+	Logger  Logger
+
+	wg sync.WaitGroup
+}
+
+// NewCredentialBroker returns an instance of CredentialBroker.
+func NewCredentialBroker(v *Vault) *CredentialBroker {
+	return &CredentialBroker{
+		Vault:       v,
+		AllowedUIDs: []uint32{uint32(os.Getuid())},
+		Timeout:     10 * time.Second,
+		Logger:      nopLogger{},
+	}
+}
+
+// provider returns the source of the credentials.
+func (b *CredentialBroker) provider() CredentialProvider {
+	if b.Provider != nil {
+		return b.Provider
+	}
+	if b.Vault == nil {
+		return nil
+	}
+	return b.Vault
+}
+
+// ListenAndServe listens on the Unix socket at the provided path and
+// serves the requests until the context is canceled. A stale socket at the
+// path is removed. The socket is accessible by the owner only, so that the
+// other users must be granted access via the file system, too.
+func (b *CredentialBroker) ListenAndServe(ctx context.Context, fp string) error {
+	fp = expandFilePath(fp)
+	if fi, err := os.Lstat(fp); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("credential broker socket %s exists and is not a socket", fp)
+		}
+		if err := os.Remove(fp); err != nil {
+			return fmt.Errorf("failed removing stale credential broker socket: %s", err)
+		}
+	}
+	l, err := net.Listen("unix", fp)
+	if err != nil {
+		return fmt.Errorf("credential broker failed listening: %s", err)
+	}
+	if err := os.Chmod(fp, 0600); err != nil {
+		l.Close()
+		return fmt.Errorf("credential broker failed listening: %s", err)
+	}
+	return b.Serve(ctx, l)
+}
+
+// Serve accepts the connections of the listener until the context is
+// canceled, then closes the listener and waits for the open connections.
+func (b *CredentialBroker) Serve(ctx context.Context, l net.Listener) error {
+	if b.provider() == nil {
+		l.Close()
+		return fmt.Errorf("vault not found")
+	}
+	if b.Logger == nil {
+		b.Logger = nopLogger{}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		l.Close()
+	}()
+	defer b.wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return fmt.Errorf("credential broker failed accepting connection: %s", err)
+		}
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			defer conn.Close()
+			b.handle(conn)
+		}()
+	}
+}
+
+// authorized returns true when the peer is one of the allowed users, or a
+// member of one of the allowed groups.
+func (b *CredentialBroker) authorized(p *peerCredentials) bool {
+	for _, uid := range b.AllowedUIDs {
+		if p.UID == uid {
+			return true
+		}
+	}
+	for _, gid := range b.AllowedGIDs {
+		if p.GID == gid {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *CredentialBroker) handle(conn net.Conn) {
+	if b.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(b.Timeout))
+	}
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		refuse(scanner, enc)
+		return
+	}
+	peer, err := getPeerCredentials(uc)
+	if err != nil {
+		b.Logger.Warnf("credential broker refused connection: %s", err)
+		refuse(scanner, enc)
+		return
+	}
+	if !b.authorized(peer) {
+		b.Logger.Warnf("credential broker refused connection from pid %d, uid %d, gid %d", peer.PID, peer.UID, peer.GID)
+		refuse(scanner, enc)
+		return
+	}
+	for scanner.Scan() {
+		req := &BrokerRequest{}
+		resp := &BrokerResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), req); err != nil {
+			resp.Error = fmt.Sprintf("malformed request: %s", err)
+		} else {
+			b.Logger.Debugf("credential broker: pid %d, uid %d requested credentials for host %s", peer.PID, peer.UID, req.Host)
+			creds, err := b.provider().GetCredentials(req.Host)
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Credentials = creds
+			}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// refuse reads the request of a refused peer before answering, so that the
+// connection is not closed while the peer is still writing its request,
+// and the peer receives the refusal rather than a broken pipe.
+func refuse(scanner *bufio.Scanner, enc *json.Encoder) {
+	scanner.Scan()
+	enc.Encode(&BrokerResponse{Error: "permission denied"})
+}
+
+// RequestCredentials returns the credentials of a host from the
+// CredentialBroker listening on the Unix socket at the provided path.
+func RequestCredentials(ctx context.Context, fp, host string) ([]*VaultCredential, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", expandFilePath(fp))
+	if err != nil {
+		return nil, fmt.Errorf("failed connecting to credential broker: %s", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// The response is read even when the request fails, because the
+	// broker may have answered, e.g. refused the connection, already.
+	werr := json.NewEncoder(conn).Encode(&BrokerRequest{Host: host})
+	resp := &BrokerResponse{}
+	if err := json.NewDecoder(conn).Decode(resp); err != nil {
+		if werr != nil {
+			return nil, fmt.Errorf("failed sending request to credential broker: %s", werr)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed reading response of credential broker: %s", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("credential broker: %s", resp.Error)
+	}
+	if werr != nil {
+		return nil, fmt.Errorf("failed sending request to credential broker: %s", werr)
+	}
+	return resp.Credentials, nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// getPeerCredentials returns the credentials of the peer process via
+// SO_PEERCRED.
+func getPeerCredentials(c *net.UnixConn) (*peerCredentials, error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting peer credentials: %s", err)
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, fmt.Errorf("failed getting peer credentials: %s", err)
+	}
+	if credErr != nil {
+		return nil, fmt.Errorf("failed getting peer credentials: %s", credErr)
+	}
+	return &peerCredentials{PID: cred.Pid, UID: cred.Uid, GID: cred.Gid}, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredentialBroker(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("peer credentials are not supported on %s", runtime.GOOS)
+	}
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error reading vault key file: %s", err)
+	}
+	if err := vlt.LoadFromFile("../../testdata/inventory/vault.yml"); err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	expected, err := vlt.GetCredentials("ny-sw01")
+	if err != nil {
+		t.Fatalf("error getting credentials: %s", err)
+	}
+
+	for i, test := range []struct {
+		uids      []uint32
+		gids      []uint32
+		shouldErr bool
+		err       string
+	}{
+		{uids: nil},
+		{uids: []uint32{uint32(os.Getuid()) + 1}, gids: []uint32{uint32(os.Getgid())}},
+		{uids: []uint32{uint32(os.Getuid()) + 1}, shouldErr: true, err: "credential broker: permission denied"},
+	} {
+		fp := filepath.Join(t.TempDir(), "broker.sock")
+		b := NewCredentialBroker(vlt)
+		if test.uids != nil {
+			b.AllowedUIDs = test.uids
+		}
+		b.AllowedGIDs = test.gids
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() {
+			errc <- b.ListenAndServe(ctx, fp)
+		}()
+		for j := 0; j < 100; j++ {
+			if _, err := os.Stat(fp); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		fi, err := os.Stat(fp)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, broker socket not found: %s", i, err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Fatalf("FAIL: Test %d, broker socket mode mismatch: %o (expected) vs. %o (received)", i, 0600, fi.Mode().Perm())
+		}
+
+		reqCtx, reqCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		creds, err := RequestCredentials(reqCtx, fp, "ny-sw01")
+		reqCancel()
+		cancel()
+		if serr := <-errc; serr != nil {
+			t.Fatalf("FAIL: Test %d, broker erred: %s", i, serr)
+		}
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error, but passed", i)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("FAIL: Test %d, error mismatch: %s (expected) vs. %s (received)", i, test.err, err)
+			}
+			t.Logf("PASS: Test %d, error: %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		if len(creds) != len(expected) {
+			t.Fatalf("FAIL: Test %d, credential count mismatch: %d (expected) vs. %d (received)", i, len(expected), len(creds))
+		}
+		for j, c := range creds {
+			if c.Username != expected[j].Username || c.Password != expected[j].Password {
+				t.Fatalf("FAIL: Test %d, credential %d mismatch: %s (expected) vs. %s (received)", i, j, expected[j].Username, c.Username)
+			}
+		}
+		t.Logf("PASS: Test %d, received %d credentials", i, len(creds))
+	}
+
+	if err := NewCredentialBroker(vlt).ListenAndServe(context.Background(), "../../testdata/inventory/vault.key"); err == nil {
+		t.Fatalf("expected a broker on a regular file to fail, but passed")
+	}
+}
+
+// testProvider is a CredentialProvider other than a Vault.
+type testProvider struct {
+	creds []*VaultCredential
+}
+
+func (p *testProvider) GetCredentials(host string) ([]*VaultCredential, error) {
+	return p.creds, nil
+}
+
+func (p *testProvider) GetCredentialsForHost(inv *Inventory, host string) ([]*VaultCredential, error) {
+	return p.creds, nil
+}
+
+func TestCredentialBrokerProvider(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("peer credentials are not supported on %s", runtime.GOOS)
+	}
+	fp := filepath.Join(t.TempDir(), "broker.sock")
+	if err := NewCredentialBroker(nil).ListenAndServe(context.Background(), fp); err == nil {
+		t.Fatalf("FAIL: expected a broker without vault and provider to fail, but passed")
+	}
+	b := NewCredentialBroker(nil)
+	b.Provider = &testProvider{creds: []*VaultCredential{{Username: "netops", Regex: ".*"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- b.ListenAndServe(ctx, fp)
+	}()
+	var creds []*VaultCredential
+	var err error
+	for j := 0; j < 100; j++ {
+		reqCtx, reqCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		creds, err = RequestCredentials(reqCtx, fp, "ny-sw01")
+		reqCancel()
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if serr := <-errc; serr != nil {
+		t.Fatalf("FAIL: broker erred: %s", serr)
+	}
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	if len(creds) != 1 || creds[0].Username != "netops" {
+		t.Fatalf("FAIL: credentials mismatch: %v", creds)
+	}
+	t.Logf("PASS: received %d credentials from provider", len(creds))
+}
@@ -0,0 +1,223 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// bundleInventoryFile is the name of the inventory file inside a bundle.
+const bundleInventoryFile = "hosts"
+
+// PackBundle writes a tar.gz bundle of the inventory directory dir to w.
+// The bundle contains the hosts file, the group_vars/ and host_vars/
+// directories, and the vault files at the top of the directory. The files
+// Ansible ignores, e.g. .bak, and the signature files are skipped.
+func PackBundle(dir string, w io.Writer) error {
+	dir = expandFilePath(dir)
+	var files []string
+	err := filepath.Walk(dir, func(fp string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fp)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case isIgnoredInventoryFile(rel):
+			// e.g. the signatures of the files, see SignFile.
+			return nil
+		case rel == bundleInventoryFile:
+		case strings.HasPrefix(rel, "group_vars/"), strings.HasPrefix(rel, "host_vars/"):
+		case !strings.Contains(rel, "/"):
+			b, err := os.ReadFile(fp)
+			if err != nil {
+				return err
+			}
+			if !isVaultData(b) {
+				return nil
+			}
+		default:
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	if i := sort.SearchStrings(files, bundleInventoryFile); i == len(files) || files[i] != bundleInventoryFile {
+		return fmt.Errorf("bundle directory %s has no %s file", dir, bundleInventoryFile)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name: f,
+			Mode: 0600,
+			Size: int64(len(b)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// LoadFromBundle loads an inventory bundle, see PackBundle, from a file.
+func (inv *Inventory) LoadFromBundle(fp string) error {
+	fp = expandFilePath(fp)
+	b, err := inv.readVerifiedFile(fp)
+	if err != nil {
+		return err
+	}
+	if err := inv.loadBundle(b); err != nil {
+		return fmt.Errorf("bundle %s: %s", fp, err)
+	}
+	return nil
+}
+
+// LoadBundle loads an inventory bundle from a reader. The hosts file is
+// parsed first, then the group_vars/ and the host_vars/ files override
+// the variables of the inventory file. The credentials of the vault files
+// are loaded into the vault associated with the inventory, see SetVault.
+func (inv *Inventory) LoadBundle(r io.Reader) error {
+	if err := inv.checkUnsigned(); err != nil {
+		return err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed reading bundle: %s", err)
+	}
+	b, err = decompress(b, inv.maxFileSize)
+	if err != nil {
+		return err
+	}
+	return inv.loadBundle(b)
+}
+
+func (inv *Inventory) loadBundle(data []byte) error {
+	var hosts []byte
+	var groupVars, hostVars, vaults []string
+	files := make(map[string][]byte)
+
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed reading bundle: %s", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := checkLimit(LimitFileSize, hdr.Size, inv.maxFileSize); err != nil {
+			return fmt.Errorf("bundle file %s: %w", hdr.Name, err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed reading bundle file %s: %s", hdr.Name, err)
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case isIgnoredInventoryFile(name):
+			inv.logger.Debugf("bundle file %s ignored", name)
+			continue
+		case name == bundleInventoryFile:
+			hosts = b
+		case strings.HasPrefix(name, "group_vars/"):
+			groupVars = append(groupVars, name)
+		case strings.HasPrefix(name, "host_vars/"):
+			hostVars = append(hostVars, name)
+		case isVaultData(b):
+			vaults = append(vaults, name)
+		default:
+			inv.logger.Debugf("bundle file %s ignored", name)
+			continue
+		}
+		files[name] = b
+	}
+	if hosts == nil {
+		return fmt.Errorf("bundle has no %s file", bundleInventoryFile)
+	}
+
+	b, err := inv.decryptSource(hosts)
+	if err != nil {
+		return err
+	}
+	if err := inv.withSource(bundleInventoryFile, func() error { return inv.parseLines(string(b[:])) }); err != nil {
+		return err
+	}
+	sort.Strings(groupVars)
+	for _, f := range groupVars {
+		if err := inv.withSource(f, func() error { return inv.addGroupVars(varsFileName(f), files[f]) }); err != nil {
+			return fmt.Errorf("%s: %s", f, err)
+		}
+	}
+	sort.Strings(hostVars)
+	for _, f := range hostVars {
+		if err := inv.withSource(f, func() error { return inv.addHostVars(varsFileName(f), files[f]) }); err != nil {
+			return fmt.Errorf("%s: %s", f, err)
+		}
+	}
+	if err := inv.finalize(); err != nil {
+		return err
+	}
+
+	if len(vaults) == 0 {
+		return nil
+	}
+	if inv.vault == nil {
+		return fmt.Errorf("bundle has vault files, but the inventory has no vault")
+	}
+	sort.Strings(vaults)
+	var credentials []*VaultCredential
+	for _, f := range vaults {
+		if err := inv.vault.readVault(files[f]); err != nil {
+			return fmt.Errorf("%s: %s", f, err)
+		}
+		credentials = append(credentials, inv.vault.Credentials...)
+	}
+	inv.vault.Credentials = credentials
+	return nil
+}
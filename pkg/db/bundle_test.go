@@ -0,0 +1,104 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	dir := t.TempDir()
+	hosts, err := os.ReadFile("../../testdata/inventory/hosts")
+	if err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	vault, err := os.ReadFile("../../testdata/inventory/vault.yml")
+	if err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	for fp, b := range map[string][]byte{
+		"hosts":                    hosts,
+		"vault.yml":                vault,
+		"README.md":                []byte("not bundled"),
+		"group_vars/all.yml":       []byte("ntp_server: 10.0.0.1\n"),
+		"group_vars/ny4/main.yml":  []byte("datacenter: ny4-east\nvlans: [10, 20]\n"),
+		"host_vars/ny-sw01.yaml":   []byte("snmp_enabled: true\nos: ios\n"),
+		"host_vars/controller.yml": []byte("os: linux\n"),
+	} {
+		fp = filepath.Join(dir, filepath.FromSlash(fp))
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := PackBundle(dir, &buf); err != nil {
+		t.Fatalf("error packing bundle: %s", err)
+	}
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error loading vault password: %s", err)
+	}
+	inv := NewInventory(WithVault(vlt))
+	if err := inv.LoadBundle(&buf); err != nil {
+		t.Fatalf("error loading bundle: %s", err)
+	}
+
+	for i, test := range []struct {
+		host  string
+		key   string
+		value string
+	}{
+		{host: "ny-sw01", key: "ntp_server", value: "10.0.0.1"},
+		{host: "ny-sw01", key: "datacenter", value: "ny4-east"},
+		{host: "ny-sw01", key: "vlans", value: "[10,20]"},
+		{host: "ny-sw01", key: "snmp_enabled", value: "true"},
+		{host: "ny-sw01", key: "os", value: "ios"},
+		{host: "controller", key: "os", value: "linux"},
+		{host: "controller", key: "ansible_connection", value: "local"},
+	} {
+		host, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s: %s", i, test.host, err)
+		}
+		if v := host.Variables[test.key]; v != test.value {
+			t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)",
+				i, test.host, test.key, test.value, v)
+		}
+		t.Logf("PASS: Test %d, host %s variable %s: %s", i, test.host, test.key, test.value)
+	}
+
+	creds, err := vlt.GetCredentials("ny-sw01")
+	if err != nil {
+		t.Fatalf("error getting credentials: %s", err)
+	}
+	if len(creds) == 0 {
+		t.Fatalf("expected credentials for ny-sw01 from the bundled vault")
+	}
+
+	inv = NewInventory()
+	if err := PackBundle(dir, &buf); err != nil {
+		t.Fatalf("error packing bundle: %s", err)
+	}
+	if err := inv.LoadBundle(&buf); err == nil {
+		t.Fatalf("expected an error loading a bundle with vault files without a vault")
+	}
+}
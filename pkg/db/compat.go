@@ -0,0 +1,236 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Divergence is a difference between the output of ansible-inventory and
+// the Inventory parsed by this library.
+type Divergence struct {
+	Host string `json:"host" yaml:"host"`
+	// Field is "host", "groups", or "vars.<name>".
+	Field     string `json:"field" yaml:"field"`
+	Ansible   string `json:"ansible" yaml:"ansible"`
+	Inventory string `json:"inventory" yaml:"inventory"`
+}
+
+// String returns the string representation of a Divergence.
+func (d *Divergence) String() string {
+	return fmt.Sprintf("%s: %s: ansible %q, inventory %q", d.Host, d.Field, d.Ansible, d.Inventory)
+}
+
+// ansibleInventory is the output of "ansible-inventory --list".
+type ansibleInventory struct {
+	hostVars map[string]map[string]interface{}
+	groups   map[string]*ansibleGroup
+}
+
+type ansibleGroup struct {
+	Hosts    []string               `json:"hosts,omitempty"`
+	Children []string               `json:"children,omitempty"`
+	Vars     map[string]interface{} `json:"vars,omitempty"`
+}
+
+func parseAnsibleInventory(b []byte) (*ansibleInventory, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("failed parsing ansible-inventory output: %s", err)
+	}
+	ai := &ansibleInventory{
+		hostVars: make(map[string]map[string]interface{}),
+		groups:   make(map[string]*ansibleGroup),
+	}
+	for k, v := range raw {
+		if k == "_meta" {
+			meta := struct {
+				HostVars map[string]map[string]interface{} `json:"hostvars"`
+			}{}
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return nil, fmt.Errorf("failed parsing ansible-inventory output: %s", err)
+			}
+			if meta.HostVars != nil {
+				ai.hostVars = meta.HostVars
+			}
+			continue
+		}
+		g := &ansibleGroup{}
+		if err := json.Unmarshal(v, g); err != nil {
+			return nil, fmt.Errorf("failed parsing ansible-inventory group %s: %s", k, err)
+		}
+		ai.groups[k] = g
+	}
+	return ai, nil
+}
+
+// hostGroups returns the groups of each host, including the ancestor
+// groups, but not "all" and "ungrouped".
+func (ai *ansibleInventory) hostGroups() map[string]map[string]bool {
+	parents := make(map[string][]string)
+	for name, g := range ai.groups {
+		for _, child := range g.Children {
+			parents[child] = append(parents[child], name)
+		}
+	}
+	m := make(map[string]map[string]bool)
+	for name, g := range ai.groups {
+		for _, h := range g.Hosts {
+			if m[h] == nil {
+				m[h] = make(map[string]bool)
+			}
+			queue := []string{name}
+			for len(queue) > 0 {
+				group := queue[0]
+				queue = queue[1:]
+				if m[h][group] {
+					continue
+				}
+				m[h][group] = true
+				queue = append(queue, parents[group]...)
+			}
+		}
+	}
+	for h := range ai.hostVars {
+		if m[h] == nil {
+			m[h] = make(map[string]bool)
+		}
+	}
+	for _, groups := range m {
+		delete(groups, "all")
+		delete(groups, "ungrouped")
+	}
+	return m
+}
+
+// compareAnsibleInventory compares the host lists, the group memberships,
+// and the host variables.
+func (inv *Inventory) compareAnsibleInventory(ai *ansibleInventory) []*Divergence {
+	var divergences []*Divergence
+	ansibleGroups := ai.hostGroups()
+	var hosts []string
+	for h := range ansibleGroups {
+		hosts = append(hosts, h)
+	}
+	for _, h := range inv.Hosts {
+		if _, exists := ansibleGroups[h.Name]; !exists {
+			hosts = append(hosts, h.Name)
+		}
+	}
+	sort.Strings(hosts)
+	for _, name := range hosts {
+		groups, inAnsible := ansibleGroups[name]
+		_, exists := inv.HostsRef[name]
+		if !inAnsible || !exists {
+			d := &Divergence{Host: name, Field: "host"}
+			if inAnsible {
+				d.Ansible = "present"
+			} else {
+				d.Inventory = "present"
+			}
+			divergences = append(divergences, d)
+			continue
+		}
+		host, err := inv.GetHost(name)
+		if err != nil {
+			continue
+		}
+		var expected, received []string
+		for g := range groups {
+			expected = append(expected, g)
+		}
+		for _, g := range host.Groups {
+			if g != "all" && g != "ungrouped" {
+				received = append(received, g)
+			}
+		}
+		sort.Strings(expected)
+		sort.Strings(received)
+		if strings.Join(expected, ",") != strings.Join(received, ",") {
+			divergences = append(divergences, &Divergence{
+				Host:      name,
+				Field:     "groups",
+				Ansible:   strings.Join(expected, ","),
+				Inventory: strings.Join(received, ","),
+			})
+		}
+		vars := ai.hostVars[name]
+		keys := make(map[string]bool)
+		for k := range vars {
+			keys[k] = true
+		}
+		for k := range host.Variables {
+			keys[k] = true
+		}
+		var names []string
+		for k := range keys {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			var a string
+			av, inAnsible := vars[k]
+			if inAnsible {
+				a, _ = stringifyValue(av)
+			}
+			v, exists := host.Variables[k]
+			if inAnsible == exists && a == v {
+				continue
+			}
+			divergences = append(divergences, &Divergence{
+				Host:      name,
+				Field:     "vars." + k,
+				Ansible:   a,
+				Inventory: v,
+			})
+		}
+	}
+	return divergences
+}
+
+// CompareWithAnsible runs "ansible-inventory --list" on inventory sources
+// and reports how its output diverges from the Inventory, which should be
+// loaded from the same sources. It requires ansible-inventory in PATH.
+func (inv *Inventory) CompareWithAnsible(ctx context.Context, sources ...string) ([]*Divergence, error) {
+	bin, err := exec.LookPath("ansible-inventory")
+	if err != nil {
+		return nil, fmt.Errorf("ansible-inventory not found: %s", err)
+	}
+	var args []string
+	for _, src := range sources {
+		args = append(args, "-i", expandFilePath(src))
+	}
+	cmd := exec.CommandContext(ctx, bin, append(args, "--list")...)
+	b, err := cmd.Output()
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("ansible-inventory failed: %s: %s", err, strings.TrimSpace(string(e.Stderr)))
+		}
+		return nil, fmt.Errorf("ansible-inventory failed: %s", err)
+	}
+	ai, err := parseAnsibleInventory(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := inv.Precompute(); err != nil {
+		return nil, err
+	}
+	return inv.compareAnsibleInventory(ai), nil
+}
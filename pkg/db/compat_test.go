@@ -0,0 +1,67 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"testing"
+)
+
+func TestCompareAnsibleInventory(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromBytes([]byte(`[web]
+web01 http_port=80
+web02 http_port=8080
+
+[prod:children]
+web
+`)); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	// The output of "ansible-inventory --list" for a slightly different
+	// inventory: web02 has another port, web03 exists, and web01 is also
+	// in the canary group.
+	output := []byte(`{
+    "_meta": {
+        "hostvars": {
+            "web01": {"http_port": 80},
+            "web02": {"http_port": 8443},
+            "web03": {}
+        }
+    },
+    "all": {"children": ["ungrouped", "prod", "canary"]},
+    "prod": {"children": ["web"]},
+    "web": {"hosts": ["web01", "web02", "web03"]},
+    "canary": {"hosts": ["web01"]}
+}`)
+	ai, err := parseAnsibleInventory(output)
+	if err != nil {
+		t.Fatalf("error parsing ansible-inventory output: %s", err)
+	}
+	divergences := inv.compareAnsibleInventory(ai)
+	expected := []*Divergence{
+		{Host: "web01", Field: "groups", Ansible: "canary,prod,web", Inventory: "prod,web"},
+		{Host: "web02", Field: "vars.http_port", Ansible: "8443", Inventory: "8080"},
+		{Host: "web03", Field: "host", Ansible: "present"},
+	}
+	if len(divergences) != len(expected) {
+		t.Fatalf("divergence count mismatch: %d (expected) vs. %d (received): %v", len(expected), len(divergences), divergences)
+	}
+	for i, d := range divergences {
+		if *d != *expected[i] {
+			t.Fatalf("FAIL: Test %d, divergence mismatch: %s (expected) vs. %s (received)", i, expected[i], d)
+		}
+		t.Logf("PASS: Test %d, %s", i, d)
+	}
+}
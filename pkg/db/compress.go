@@ -0,0 +1,173 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompress returns the decompressed data when the provided data is gzip
+// or zstd compressed, and the data as is otherwise. The limit, when
+// positive, applies to the size of the decompressed data.
+func decompress(b []byte, limit int64) ([]byte, error) {
+	var r io.Reader
+	switch {
+	case bytes.HasPrefix(b, gzipMagic):
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed opening gzip data: %s", err)
+		}
+		defer zr.Close()
+		r = zr
+	case bytes.HasPrefix(b, zstdMagic):
+		zr, err := zstd.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed opening zstd data: %s", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return b, nil
+	}
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed decompressing data: %s", err)
+	}
+	if err := checkLimit(LimitFileSize, int64(len(out)), limit); err != nil {
+		return nil, fmt.Errorf("decompressed data: %w", err)
+	}
+	return out, nil
+}
+
+// decompressReader returns a reader decompressing the data of the provided
+// reader when the data is gzip or zstd compressed, and reading the data as
+// is otherwise.
+func decompressReader(r *bufio.Reader) (io.ReadCloser, error) {
+	magic, err := r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed opening gzip data: %s", err)
+		}
+		return zr, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed opening zstd data: %s", err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+type compressedFile struct {
+	io.WriteCloser
+	f *os.File
+}
+
+func (cf *compressedFile) Close() error {
+	if err := cf.WriteCloser.Close(); err != nil {
+		cf.f.Close()
+		return err
+	}
+	return cf.f.Close()
+}
+
+// compressor returns a writer compressing the data written to w with gzip
+// or zstd when the file has the .gz or .zst extension respectively, and
+// nil when the data of the file is not compressed.
+func compressor(fp string, w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(fp, ".gz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(fp, ".zst"):
+		return zstd.NewWriter(w)
+	}
+	return nil, nil
+}
+
+// createFile creates a file for writing. The data written to files with
+// .gz and .zst extensions is compressed with gzip and zstd respectively.
+func createFile(fp string) (io.WriteCloser, error) {
+	f, err := os.Create(fp)
+	if err != nil {
+		return nil, err
+	}
+	zw, err := compressor(fp, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if zw == nil {
+		return f, nil
+	}
+	return &compressedFile{WriteCloser: zw, f: f}, nil
+}
+
+// writeFile writes data to a file, compressing it according to the file
+// extension.
+func writeFile(fp string, b []byte) error {
+	w, err := createFile(fp)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// writeFileAtomicCompressed replaces the file with the provided data,
+// compressed according to the file extension, see writeFile and
+// writeFileAtomic.
+func writeFileAtomicCompressed(fp string, b []byte, perm os.FileMode) error {
+	var buf bytes.Buffer
+	zw, err := compressor(fp, &buf)
+	if err != nil {
+		return err
+	}
+	if zw != nil {
+		if _, err := zw.Write(b); err != nil {
+			zw.Close()
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		b = buf.Bytes()
+	}
+	return writeFileAtomic(fp, b, perm)
+}
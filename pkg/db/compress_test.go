@@ -0,0 +1,82 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	hosts, err := os.ReadFile("../../testdata/inventory/hosts")
+	if err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	vault, err := os.ReadFile("../../testdata/inventory/vault.yml")
+	if err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	for i, ext := range []string{".gz", ".zst"} {
+		invFile := filepath.Join(dir, "hosts"+ext)
+		vltFile := filepath.Join(dir, "vault.yml"+ext)
+		if err := writeFile(invFile, hosts); err != nil {
+			t.Fatalf("FAIL: Test %d, error writing %s: %s", i, invFile, err)
+		}
+		if err := writeFile(vltFile, vault); err != nil {
+			t.Fatalf("FAIL: Test %d, error writing %s: %s", i, vltFile, err)
+		}
+		b, err := os.ReadFile(invFile)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error reading %s: %s", i, invFile, err)
+		}
+		if bytes.Equal(b, hosts) {
+			t.Fatalf("FAIL: Test %d, file %s is not compressed", i, invFile)
+		}
+		inv := NewInventory()
+		if err := inv.LoadFromFile(invFile); err != nil {
+			t.Fatalf("FAIL: Test %d, error reading inventory %s: %s", i, invFile, err)
+		}
+		if inv.Size() != 5 {
+			t.Fatalf("FAIL: Test %d, inventory size mismatch: 5 (expected) vs. %d (received)", i, inv.Size())
+		}
+		vlt := NewVault()
+		if err := vlt.SetPassword("7f017fde-e88b-42c5-89df-a7c8f9de981d"); err != nil {
+			t.Fatalf("FAIL: Test %d, error setting vault password: %s", i, err)
+		}
+		if err := vlt.LoadFromFile(vltFile); err != nil {
+			t.Fatalf("FAIL: Test %d, error reading vault %s: %s", i, vltFile, err)
+		}
+		inv = NewInventory(WithMaxFileSize(int64(len(b) + 1)))
+		if err := inv.LoadFromFile(invFile); err == nil {
+			t.Fatalf("FAIL: Test %d, expected decompressed size limit to be enforced, but passed", i)
+		}
+		inv = NewInventory(WithCacheFile(filepath.Join(dir, "hosts.cache"+ext)))
+		if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+			t.Fatalf("FAIL: Test %d, error reading inventory: %s", i, err)
+		}
+		src, err := os.ReadFile("../../testdata/inventory/hosts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cached := NewInventory(WithCacheFile(filepath.Join(dir, "hosts.cache"+ext)))
+		if !cached.loadFromCache("../../testdata/inventory/hosts", src) {
+			t.Fatalf("FAIL: Test %d, compressed inventory cache was not used", i)
+		}
+		t.Logf("PASS: Test %d, compressed files with %s extension", i, ext)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The types of a HostDelta.
+const (
+	HostAdded   = "added"
+	HostRemoved = "removed"
+	HostChanged = "changed"
+)
+
+// The types of a GroupDelta.
+const (
+	GroupAdded   = "added"
+	GroupRemoved = "removed"
+	GroupChanged = "changed"
+)
+
+// FieldChange is a change of a single field of a host or a group.
+type FieldChange struct {
+	// Field is "parent", "groups", "tags", or "vars.<name>" for a host,
+	// and "parents", "children", "hosts", or "vars.<name>" for a group.
+	Field string `json:"field" yaml:"field"`
+	Old   string `json:"old,omitempty" yaml:"old,omitempty"`
+	New   string `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// String returns the string representation of a FieldChange.
+func (c *FieldChange) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+}
+
+// HostDelta is a host added, removed, or changed between two versions of
+// an Inventory.
+type HostDelta struct {
+	Host    string         `json:"host" yaml:"host"`
+	Type    string         `json:"type" yaml:"type"`
+	Old     *InventoryHost `json:"old,omitempty" yaml:"old,omitempty"`
+	New     *InventoryHost `json:"new,omitempty" yaml:"new,omitempty"`
+	Changes []*FieldChange `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// GroupDelta is a group added, removed, or changed between two versions of
+// an Inventory. The changes of an added or a removed group describe its
+// contents.
+type GroupDelta struct {
+	Group   string         `json:"group" yaml:"group"`
+	Type    string         `json:"type" yaml:"type"`
+	Changes []*FieldChange `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// InventoryDelta is the difference between two versions of an Inventory.
+// The hosts and the groups are sorted by name.
+type InventoryDelta struct {
+	Timestamp time.Time     `json:"timestamp" yaml:"timestamp"`
+	Hosts     []*HostDelta  `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	Groups    []*GroupDelta `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// Empty returns true when the versions of the Inventory are identical.
+func (d *InventoryDelta) Empty() bool {
+	return len(d.Hosts) == 0 && len(d.Groups) == 0
+}
+
+// Diff returns the hosts added, removed, and changed between the old and
+// the new Inventory. Either of them may be nil, i.e. empty.
+func Diff(old, new *Inventory) *InventoryDelta {
+	d := &InventoryDelta{Timestamp: time.Now().UTC(), Hosts: []*HostDelta{}}
+	oldHosts := make(map[string]*InventoryHost)
+	newHosts := make(map[string]*InventoryHost)
+	names := make(map[string]bool)
+	if old != nil {
+		old.resolveHosts()
+		for _, h := range old.Hosts {
+			oldHosts[h.Name] = h
+			names[h.Name] = true
+		}
+	}
+	if new != nil {
+		new.resolveHosts()
+		for _, h := range new.Hosts {
+			newHosts[h.Name] = h
+			names[h.Name] = true
+		}
+	}
+	for _, name := range sortedKeys(names) {
+		o, n := oldHosts[name], newHosts[name]
+		switch {
+		case o == nil:
+			d.Hosts = append(d.Hosts, &HostDelta{Host: name, Type: HostAdded, New: n})
+		case n == nil:
+			d.Hosts = append(d.Hosts, &HostDelta{Host: name, Type: HostRemoved, Old: o})
+		default:
+			if changes := diffHost(o, n); len(changes) > 0 {
+				d.Hosts = append(d.Hosts, &HostDelta{Host: name, Type: HostChanged, Old: o, New: n, Changes: changes})
+			}
+		}
+	}
+	return d
+}
+
+// DiffInventories returns the hosts added, removed, and changed between
+// two inventories, as Diff does, along with the groups added, removed, and
+// changed, i.e. their parent groups, child groups, direct hosts, and
+// variables. Either of the inventories may be nil, i.e. empty.
+func DiffInventories(a, b *Inventory) *InventoryDelta {
+	d := Diff(a, b)
+	d.Groups = []*GroupDelta{}
+	oldGroups := inventoryGroupFields(a)
+	newGroups := inventoryGroupFields(b)
+	names := make(map[string]bool)
+	for name := range oldGroups {
+		names[name] = true
+	}
+	for name := range newGroups {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		o, n := oldGroups[name], newGroups[name]
+		gd := &GroupDelta{Group: name, Type: GroupChanged}
+		switch {
+		case o == nil:
+			gd.Type = GroupAdded
+		case n == nil:
+			gd.Type = GroupRemoved
+		}
+		gd.Changes = diffFields(o, n)
+		if gd.Type != GroupChanged || len(gd.Changes) > 0 {
+			d.Groups = append(d.Groups, gd)
+		}
+	}
+	return d
+}
+
+// inventoryGroupFields returns the fields of each group of an Inventory
+// compared by DiffInventories.
+func inventoryGroupFields(inv *Inventory) map[string]map[string]string {
+	groups := make(map[string]map[string]string)
+	if inv == nil {
+		return groups
+	}
+	children, hosts := inv.groupMembers()
+	for _, g := range inv.Groups {
+		var parents []string
+		for _, a := range g.Ancestors {
+			if a != g.Name {
+				parents = append(parents, a)
+			}
+		}
+		fields := map[string]string{
+			"parents":  joinSorted(parents),
+			"children": strings.Join(children[g.Name], ","),
+			"hosts":    strings.Join(hosts[g.Name], ","),
+		}
+		for k, v := range g.Variables {
+			fields["vars."+k] = v
+		}
+		groups[g.Name] = fields
+	}
+	return groups
+}
+
+// diffFields returns the changes between two sets of fields, sorted by
+// field name, with "parents", "children", and "hosts" first.
+func diffFields(o, n map[string]string) []*FieldChange {
+	keys := make(map[string]bool)
+	for k := range o {
+		keys[k] = true
+	}
+	for k := range n {
+		keys[k] = true
+	}
+	var changes []*FieldChange
+	for _, k := range append([]string{"parents", "children", "hosts"}, sortedKeys(keys)...) {
+		if !keys[k] {
+			continue
+		}
+		delete(keys, k)
+		if o[k] != n[k] {
+			changes = append(changes, &FieldChange{Field: k, Old: o[k], New: n[k]})
+		}
+	}
+	return changes
+}
+
+func diffHost(o, n *InventoryHost) []*FieldChange {
+	var changes []*FieldChange
+	add := func(field, a, b string) {
+		if a != b {
+			changes = append(changes, &FieldChange{Field: field, Old: a, New: b})
+		}
+	}
+	add("parent", o.Parent, n.Parent)
+	add("groups", joinSorted(o.Groups), joinSorted(n.Groups))
+	add("tags", joinSorted(o.Tags), joinSorted(n.Tags))
+	keys := make(map[string]bool)
+	for k := range o.Variables {
+		keys[k] = true
+	}
+	for k := range n.Variables {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		add("vars."+k, o.Variables[k], n.Variables[k])
+	}
+	return changes
+}
+
+func joinSorted(arr []string) string {
+	s := append([]string{}, arr...)
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+// Reloader keeps the current version of an Inventory produced by a load
+// function and, on every reload, emits the delta from the previous version
+// to the subscribers.
+type Reloader struct {
+	load func(ctx context.Context) (*Inventory, error)
+
+	mu          sync.Mutex
+	current     *Inventory
+	subscribers []chan *InventoryDelta
+}
+
+// NewReloader returns an instance of Reloader. The load function returns a
+// new Inventory, e.g. one loaded with LoadFromSources.
+func NewReloader(load func(ctx context.Context) (*Inventory, error)) *Reloader {
+	return &Reloader{load: load}
+}
+
+// Current returns the last loaded version of the Inventory, or nil before
+// the first reload.
+func (r *Reloader) Current() *Inventory {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Subscribe returns a channel receiving the non-empty deltas. The channel
+// buffers the provided number of deltas. When a subscriber falls behind,
+// the deltas it cannot receive are dropped, so a slow subscriber should
+// resynchronize with Current.
+func (r *Reloader) Subscribe(buffer int) <-chan *InventoryDelta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan *InventoryDelta, buffer)
+	r.subscribers = append(r.subscribers, ch)
+	return ch
+}
+
+// Reload loads a new version of the Inventory, replaces the current one,
+// and returns the delta between them. On error, the current version is
+// kept.
+func (r *Reloader) Reload(ctx context.Context) (*InventoryDelta, error) {
+	inv, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := Diff(r.current, inv)
+	r.current = inv
+	if d.Empty() {
+		return d, nil
+	}
+	for _, ch := range r.subscribers {
+		select {
+		case ch <- d:
+		default:
+		}
+	}
+	return d, nil
+}
+
+// Close closes the subscriber channels.
+func (r *Reloader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ch := range r.subscribers {
+		close(ch)
+	}
+	r.subscribers = nil
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReloaderDelta(t *testing.T) {
+	versions := []string{
+		"[web]\nweb01 port=80\nweb02\n",
+		"[web]\nweb01 port=8080\nweb03\n",
+		"[web]\nweb01 port=8080\nweb03\n",
+		"[app]\nweb01 port=8080\n[web]\nweb03\n",
+	}
+	i := 0
+	r := NewReloader(func(ctx context.Context) (*Inventory, error) {
+		inv := NewInventory()
+		if err := inv.LoadFromBytes([]byte(versions[i])); err != nil {
+			return nil, err
+		}
+		i++
+		return inv, nil
+	})
+	events := r.Subscribe(len(versions))
+	for j, expected := range [][]string{
+		{"web01 added", "web02 added"},
+		{"web01 changed vars.port: \"80\" -> \"8080\"", "web02 removed", "web03 added"},
+		{},
+		{"web01 changed parent: \"web\" -> \"app\"", "web01 changed groups: \"all,web\" -> \"all,app\""},
+	} {
+		d, err := r.Reload(context.Background())
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, reload error: %s", j, err)
+		}
+		var received []string
+		for _, h := range d.Hosts {
+			if h.Type != HostChanged {
+				received = append(received, h.Host+" "+h.Type)
+				continue
+			}
+			for _, c := range h.Changes {
+				received = append(received, h.Host+" "+h.Type+" "+c.String())
+			}
+		}
+		if len(received) != len(expected) {
+			t.Fatalf("FAIL: Test %d, delta mismatch: %q (expected) vs. %q (received)", j, expected, received)
+		}
+		for k := range received {
+			if received[k] != expected[k] {
+				t.Fatalf("FAIL: Test %d, delta mismatch: %q (expected) vs. %q (received)", j, expected, received)
+			}
+		}
+		t.Logf("PASS: Test %d, delta: %q", j, received)
+	}
+	r.Close()
+	count := 0
+	for range events {
+		count++
+	}
+	if count != 3 {
+		t.Fatalf("FAIL: the number of emitted deltas is not 3, but %d", count)
+	}
+	if r.Current() == nil || r.Current().Size() != 2 {
+		t.Fatalf("FAIL: unexpected current inventory")
+	}
+}
+
+func TestDiffInventories(t *testing.T) {
+	a := NewInventory()
+	if err := a.LoadFromBytes([]byte("[web]\nweb01\nweb02\n\n[web:vars]\nport=80\n\n[db]\ndb01\n\n[prod:children]\nweb\ndb\n")); err != nil {
+		t.Fatalf("error loading inventory: %s", err)
+	}
+	b := NewInventory()
+	if err := b.LoadFromBytes([]byte("[web]\nweb01\nweb03\n\n[web:vars]\nport=8080\n\n[cache]\ncache01\n\n[prod:children]\nweb\ncache\n")); err != nil {
+		t.Fatalf("error loading inventory: %s", err)
+	}
+	d := DiffInventories(a, b)
+	var received []string
+	for _, g := range d.Groups {
+		received = append(received, g.Group+" "+g.Type)
+		for _, c := range g.Changes {
+			received = append(received, "  "+c.String())
+		}
+	}
+	expected := []string{
+		"cache added",
+		`  parents: "" -> "all,prod"`,
+		`  hosts: "" -> "cache01"`,
+		"db removed",
+		`  parents: "all,prod" -> ""`,
+		`  hosts: "db01" -> ""`,
+		"prod changed",
+		`  children: "db,web" -> "cache,web"`,
+		"web changed",
+		`  hosts: "web01,web02" -> "web01,web03"`,
+		`  vars.port: "80" -> "8080"`,
+	}
+	if strings.Join(received, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("group delta mismatch:\n%s\n(expected) vs.\n%s\n(received)", strings.Join(expected, "\n"), strings.Join(received, "\n"))
+	}
+	var hosts []string
+	for _, h := range d.Hosts {
+		hosts = append(hosts, h.Host+" "+h.Type)
+	}
+	if strings.Join(hosts, ",") != "cache01 added,db01 removed,web01 changed,web02 removed,web03 added" {
+		t.Fatalf("host delta mismatch: %v", hosts)
+	}
+	if !DiffInventories(a, a.Clone()).Empty() {
+		t.Fatalf("expected no changes between an inventory and its clone")
+	}
+	if d := DiffInventories(nil, a); len(d.Groups) != 4 {
+		t.Fatalf("expected 4 added groups, received %d", len(d.Groups))
+	}
+	t.Logf("PASS: group delta:\n%s", strings.Join(received, "\n"))
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+// Clone returns a deep copy of the Inventory with the same settings, vault,
+// and logger. The copy does not write the cache file, if any, and does not
+// share the resources registered for Close. The copy may be modified while
+// other goroutines read the Inventory. For a copy of the vault too, see
+// Vault.Clone and SetVault.
+func (inv *Inventory) Clone() *Inventory {
+	c := &Inventory{
+		HostsRef:          make(map[string]string, len(inv.HostsRef)),
+		GroupsRef:         make(map[string]bool, len(inv.GroupsRef)),
+		Hosts:             make([]*InventoryHost, 0, len(inv.Hosts)),
+		Groups:            make([]*InventoryGroup, 0, len(inv.Groups)),
+		preserveTemplates: inv.preserveTemplates,
+		strict:            inv.strict,
+		keepRaw:           inv.keepRaw,
+		foldHostnames:     inv.foldHostnames,
+		maxFileSize:       inv.maxFileSize,
+		maxHosts:          inv.maxHosts,
+		maxGroupDepth:     inv.maxGroupDepth,
+		logger:            inv.logger,
+		vault:             inv.vault,
+		verifyKey:         inv.verifyKey,
+		dryRun:            inv.dryRun,
+		lazy:              inv.lazy,
+	}
+	if inv.Raw != nil {
+		c.Raw = append([]byte{}, inv.Raw...)
+	}
+	for k, v := range inv.HostsRef {
+		c.HostsRef[k] = v
+	}
+	for k, v := range inv.GroupsRef {
+		c.GroupsRef[k] = v
+	}
+	for _, h := range inv.Hosts {
+		c.Hosts = append(c.Hosts, h.clone())
+	}
+	for _, g := range inv.Groups {
+		cg := &InventoryGroup{
+			Name:            g.Name,
+			Ancestors:       cloneStrings(g.Ancestors),
+			Children:        cloneStrings(g.Children),
+			Variables:       cloneStringMap(g.Variables),
+			Counters:        g.Counters,
+			Templated:       cloneBoolMap(g.Templated),
+			Ephemeral:       g.Ephemeral,
+			VariableSources: cloneStringMap(g.VariableSources),
+			inventory:       c,
+		}
+		c.Groups = append(c.Groups, cg)
+	}
+	return c
+}
+
+// clone returns a deep copy of the host.
+func (h *InventoryHost) clone() *InventoryHost {
+	return &InventoryHost{
+		Name:            h.Name,
+		Parent:          h.Parent,
+		ExtraParents:    cloneStrings(h.ExtraParents),
+		Variables:       cloneStringMap(h.Variables),
+		Groups:          cloneStrings(h.Groups),
+		GroupChains:     cloneStrings(h.GroupChains),
+		Implicit:        h.Implicit,
+		Templated:       cloneBoolMap(h.Templated),
+		Tags:            cloneStrings(h.Tags),
+		Ephemeral:       h.Ephemeral,
+		VariableSources: cloneStringMap(h.VariableSources),
+		unresolved:      h.unresolved,
+	}
+}
+
+// DryRun applies the mutations of the provided function, e.g. AddHostTag,
+// AddEphemeralHost, or AddHostFacts, to a copy of the Inventory and returns
+// the changes they would make, without modifying the Inventory. In the
+// copy, SaveStateToFile and the cache do not write files. When the function
+// fails, the error is returned and the changes are discarded.
+func (inv *Inventory) DryRun(fn func(*Inventory) error) (*InventoryDelta, error) {
+	c := inv.Clone()
+	c.dryRun = true
+	if err := fn(c); err != nil {
+		return nil, err
+	}
+	return Diff(inv, c), nil
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func cloneStrings(arr []string) []string {
+	if arr == nil {
+		return nil
+	}
+	return append([]string{}, arr...)
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func cloneBoolMap(m map[string]bool) map[string]bool {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]bool, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	fp := filepath.Join(t.TempDir(), "state.json")
+	for i, test := range []struct {
+		fn        func(*Inventory) error
+		hosts     []string
+		types     []string
+		shouldErr bool
+	}{
+		{
+			fn: func(c *Inventory) error {
+				return c.AddHostTag("ny-sw01", "maintenance")
+			},
+			hosts: []string{"ny-sw01"},
+			types: []string{HostChanged},
+		},
+		{
+			fn: func(c *Inventory) error {
+				if _, err := c.AddEphemeralHost("ny-sw05", []string{"ny4"}, nil); err != nil {
+					return err
+				}
+				return c.SaveStateToFile(fp)
+			},
+			hosts: []string{"ny-sw05"},
+			types: []string{HostAdded},
+		},
+		{
+			fn: func(c *Inventory) error {
+				return c.AddHostFacts("facts_", []*HostFacts{
+					{Host: "ny-sw02", Facts: map[string]string{"kernel": "5.10"}},
+					{Host: "ny-sw03", Facts: map[string]string{"kernel": "5.15"}},
+				})
+			},
+			hosts: []string{"ny-sw02", "ny-sw03"},
+			types: []string{HostChanged, HostChanged},
+		},
+		{
+			fn: func(c *Inventory) error {
+				return c.AddHostTag("ny-sw09", "maintenance")
+			},
+			shouldErr: true,
+		},
+	} {
+		d, err := inv.DryRun(test.fn)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error, but passed", i)
+			}
+			t.Logf("PASS: Test %d, error: %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		if len(d.Hosts) != len(test.hosts) {
+			t.Fatalf("FAIL: Test %d, delta size mismatch: %d (expected) vs. %d (received)", i, len(test.hosts), len(d.Hosts))
+		}
+		for j, h := range d.Hosts {
+			if h.Host != test.hosts[j] || h.Type != test.types[j] {
+				t.Fatalf("FAIL: Test %d, delta mismatch: %s %s (expected) vs. %s %s (received)", i, test.hosts[j], test.types[j], h.Host, h.Type)
+			}
+		}
+		t.Logf("PASS: Test %d, %d hosts would change", i, len(d.Hosts))
+	}
+
+	// The dry runs leave the inventory and the files intact.
+	if inv.Size() != 5 {
+		t.Fatalf("inventory size mismatch: 5 (expected) vs. %d (received)", inv.Size())
+	}
+	h, err := inv.GetHost("ny-sw01")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	if h.HasTag("maintenance") {
+		t.Fatalf("dry run modified host ny-sw01 tags: %v", h.Tags)
+	}
+	h, err = inv.GetHost("ny-sw02")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	if _, exists := h.Variables["facts_kernel"]; exists {
+		t.Fatalf("dry run modified host ny-sw02 variables")
+	}
+	if _, err := os.Stat(fp); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote inventory state file: %v", err)
+	}
+	if d := Diff(inv, inv.Clone()); !d.Empty() {
+		t.Fatalf("clone differs from inventory: %v", d.Hosts)
+	}
+}
+
+func TestInventoryClone(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	c := inv.Clone()
+	h, err := c.GetHost("ny-sw01")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	h.Variables["os"] = "cisco_iosxe"
+	h.Tags = append(h.Tags, "maintenance")
+	g, err := c.GetGroup("ny4")
+	if err != nil {
+		t.Fatalf("error getting group: %s", err)
+	}
+	g.Variables["datacenter"] = "ny6"
+	g.Children[0] = "ny6-cisco"
+	if err := c.RemoveHost("ny-sw02"); err != nil {
+		t.Fatalf("error removing host: %s", err)
+	}
+
+	h, err = inv.GetHost("ny-sw01")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	if h.Variables["os"] != "cisco_nxos" || len(h.Tags) != 0 {
+		t.Fatalf("FAIL: clone modified host ny-sw01: %v, %v", h.Variables["os"], h.Tags)
+	}
+	g, err = inv.GetGroup("ny4")
+	if err != nil {
+		t.Fatalf("error getting group: %s", err)
+	}
+	if g.Variables["datacenter"] != "ny4" || g.Children[0] != "ny4-cisco" {
+		t.Fatalf("FAIL: clone modified group ny4: %v, %v", g.Variables, g.Children)
+	}
+	if _, err := inv.GetHost("ny-sw02"); err != nil {
+		t.Fatalf("FAIL: clone removed host ny-sw02: %s", err)
+	}
+	t.Logf("PASS: clone changes left the inventory unchanged")
+}
@@ -0,0 +1,474 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RemoveHost removes a host from the Inventory and from the counters of
+// its groups.
+func (inv *Inventory) RemoveHost(name string) error {
+	name = inv.hostname(name)
+	if _, exists := inv.HostsRef[name]; !exists {
+		return fmt.Errorf("host %s does not exist in the inventory", name)
+	}
+	return inv.edit(func(c *Inventory) error {
+		c.removeHosts(func(h *InventoryHost) bool { return h.Name == name })
+		return nil
+	})
+}
+
+// RetainHosts removes the hosts of the Inventory other than the provided
+// ones, e.g. to print the hosts selected by a pattern along with their
+// groups. The unknown host names are ignored.
+func (inv *Inventory) RetainHosts(names ...string) error {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[inv.hostname(name)] = true
+	}
+	return inv.edit(func(c *Inventory) error {
+		c.removeHosts(func(h *InventoryHost) bool { return !keep[h.Name] })
+		return nil
+	})
+}
+
+// RenameHost renames a host, keeping its groups and its variables.
+func (inv *Inventory) RenameHost(name, newName string) error {
+	name = inv.hostname(name)
+	newName = inv.hostname(strings.TrimSpace(newName))
+	if _, exists := inv.HostsRef[name]; !exists {
+		return fmt.Errorf("host %s does not exist in the inventory", name)
+	}
+	if newName == "" {
+		return errorWithCode(ErrInvalidHost, "new name of host %s is empty", name)
+	}
+	if _, exists := inv.HostsRef[newName]; exists {
+		return errorWithCode(ErrDuplicateHost, "host %s already exists", newName)
+	}
+	return inv.edit(func(c *Inventory) error {
+		for _, h := range c.Hosts {
+			if h.Name != name {
+				continue
+			}
+			h.Name = newName
+			renameVariableSources(h.VariableSources, "host", name, newName)
+			renameVariableSources(h.VariableSources, "host_vars", name, newName)
+			c.HostsRef[newName] = h.Parent
+		}
+		delete(c.HostsRef, name)
+		c.resetIndex()
+		return nil
+	})
+}
+
+// MoveHostToGroup makes the provided group the only parent of a host. The host
+// inherits the variables of its new groups instead of the old ones. A host
+// moved to "all" becomes a member of the "ungrouped" group.
+func (inv *Inventory) MoveHostToGroup(name, groupName string) error {
+	name = inv.hostname(name)
+	if _, exists := inv.HostsRef[name]; !exists {
+		return fmt.Errorf("host %s does not exist in the inventory", name)
+	}
+	if _, exists := inv.GroupsRef[groupName]; !exists {
+		return errorWithCode(ErrInvalidGroup, "the group %s for host %s does not exist", groupName, name)
+	}
+	return inv.edit(func(c *Inventory) error {
+		h := c.lookupHost(name)
+		if h == nil {
+			return fmt.Errorf("host %s not found", name)
+		}
+		if groupName == "all" {
+			groupName = "ungrouped"
+			if err := c.AddGroup(groupName, "all"); err != nil {
+				return err
+			}
+		}
+		h.Parent = groupName
+		h.ExtraParents = nil
+		c.HostsRef[name] = groupName
+		return nil
+	})
+}
+
+// AddHostToGroup makes a host a member of another group, keeping its
+// other groups, see ExtraParents. A host of the "ungrouped" group only is
+// moved to the provided group instead.
+func (inv *Inventory) AddHostToGroup(name, groupName string) error {
+	name = inv.hostname(name)
+	if _, exists := inv.HostsRef[name]; !exists {
+		return fmt.Errorf("host %s does not exist in the inventory", name)
+	}
+	if _, exists := inv.GroupsRef[groupName]; !exists {
+		return errorWithCode(ErrInvalidGroup, "the group %s for host %s does not exist", groupName, name)
+	}
+	return inv.edit(func(c *Inventory) error {
+		h := c.lookupHost(name)
+		if h == nil {
+			return fmt.Errorf("host %s not found", name)
+		}
+		switch {
+		case groupName == "all", groupName == "ungrouped", h.hasParent(groupName):
+		case h.Parent == "ungrouped":
+			h.Parent = groupName
+			c.HostsRef[name] = groupName
+		default:
+			h.ExtraParents = append(h.ExtraParents, groupName)
+		}
+		return nil
+	})
+}
+
+// RemoveGroup removes a group from the Inventory. With cascade, the hosts
+// of the group and the sub-groups having no other parent than "all" are
+// removed too, recursively. Otherwise, the hosts and the sub-groups of the group become
+// members of its first parent group other than "all", if any. Otherwise,
+// the sub-groups become children of "all" and the hosts members of
+// "ungrouped". The "all" group cannot be removed.
+func (inv *Inventory) RemoveGroup(name string, cascade bool) error {
+	if name == "all" {
+		return errorWithCode(ErrInvalidGroup, "the group all cannot be removed")
+	}
+	if _, exists := inv.GroupsRef[name]; !exists {
+		return fmt.Errorf("Group %s does not exist in the inventory", name)
+	}
+	return inv.edit(func(c *Inventory) error {
+		g := c.lookupGroup(name)
+		if g == nil {
+			return fmt.Errorf("Group %s not found", name)
+		}
+		parent := "all"
+		for _, a := range g.Ancestors {
+			if a != name && a != "all" {
+				parent = a
+				break
+			}
+		}
+		removed := map[string]bool{name: true}
+		for cascade {
+			found := false
+			for _, sg := range c.Groups {
+				if removed[sg.Name] || !sg.hasAncestor(removed) {
+					continue
+				}
+				orphan := true
+				for _, a := range sg.Ancestors {
+					if a != "all" && !removed[a] {
+						orphan = false
+						break
+					}
+				}
+				if orphan {
+					removed[sg.Name] = true
+					found = true
+				}
+			}
+			if !found {
+				break
+			}
+		}
+		for _, h := range c.Hosts {
+			// The host of several groups stays a member of the others.
+			extra := h.ExtraParents[:0]
+			for _, p := range h.ExtraParents {
+				if !removed[p] {
+					extra = append(extra, p)
+				}
+			}
+			h.ExtraParents = extra
+			if removed[h.Parent] && len(extra) > 0 {
+				h.Parent, h.ExtraParents = extra[0], extra[1:]
+				c.HostsRef[h.Name] = h.Parent
+			}
+		}
+		if cascade {
+			c.removeHosts(func(h *InventoryHost) bool { return removed[h.Parent] })
+		}
+		for _, h := range c.Hosts {
+			if h.Parent != name {
+				continue
+			}
+			hostParent := parent
+			if hostParent == "all" && name != "ungrouped" {
+				hostParent = "ungrouped"
+				if err := c.AddGroup(hostParent, "all"); err != nil {
+					return err
+				}
+			}
+			h.Parent = hostParent
+			c.HostsRef[h.Name] = hostParent
+		}
+		groups := c.Groups[:0]
+		for _, sg := range c.Groups {
+			if removed[sg.Name] {
+				delete(c.GroupsRef, sg.Name)
+				continue
+			}
+			ancestors := sg.Ancestors[:0]
+			detached := false
+			for _, a := range sg.Ancestors {
+				if removed[a] {
+					detached = true
+					continue
+				}
+				ancestors = append(ancestors, a)
+			}
+			if detached && len(ancestors) == 0 {
+				ancestors = append(ancestors, parent)
+			}
+			sg.Ancestors = ancestors
+			groups = append(groups, sg)
+		}
+		c.Groups = groups
+		c.resetIndex()
+		return nil
+	})
+}
+
+// RenameGroup renames a group, keeping its members, its parents, and its
+// variables. The "all" group cannot be renamed.
+func (inv *Inventory) RenameGroup(name, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if name == "all" {
+		return errorWithCode(ErrInvalidGroup, "the group all cannot be renamed")
+	}
+	if _, exists := inv.GroupsRef[name]; !exists {
+		return fmt.Errorf("Group %s does not exist in the inventory", name)
+	}
+	if newName == "" {
+		return errorWithCode(ErrInvalidGroup, "new name of group %s is empty", name)
+	}
+	if _, exists := inv.GroupsRef[newName]; exists {
+		return errorWithCode(ErrInvalidGroup, "group %s already exists", newName)
+	}
+	return inv.edit(func(c *Inventory) error {
+		for _, g := range c.Groups {
+			if g.Name == name {
+				g.Name = newName
+				renameVariableSources(g.VariableSources, "group", name, newName)
+			}
+			for i, a := range g.Ancestors {
+				if a == name {
+					g.Ancestors[i] = newName
+				}
+			}
+		}
+		for _, h := range c.Hosts {
+			if h.Parent == name {
+				h.Parent = newName
+				c.HostsRef[h.Name] = newName
+			}
+			for i, p := range h.ExtraParents {
+				if p == name {
+					h.ExtraParents[i] = newName
+				}
+			}
+		}
+		delete(c.GroupsRef, name)
+		c.GroupsRef[newName] = true
+		c.resetIndex()
+		return nil
+	})
+}
+
+// SetHostVariable sets a variable of a host. The value takes precedence
+// over the value the host inherits from its groups, if any.
+func (inv *Inventory) SetHostVariable(name, k, v string) error {
+	name = inv.hostname(name)
+	if err := checkVariableName(k); err != nil {
+		return err
+	}
+	h := inv.lookupHost(name)
+	if h == nil {
+		return fmt.Errorf("host %s does not exist in the inventory", name)
+	}
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	inv.invalidateHostLocked(h)
+	if h.Variables == nil {
+		h.Variables = make(map[string]string)
+	}
+	h.Variables[k] = v
+	delete(h.Templated, k)
+	setVariableSource(&h.VariableSources, k, inv.variableSource("host", name))
+	return inv.resolveEagerlyLocked()
+}
+
+// DeleteHostVariable removes a variable the host defines. The host
+// inherits the value of its groups again, if any.
+func (inv *Inventory) DeleteHostVariable(name, k string) error {
+	name = inv.hostname(name)
+	h := inv.lookupHost(name)
+	if h == nil {
+		return fmt.Errorf("host %s does not exist in the inventory", name)
+	}
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	if _, exists := h.Variables[k]; !exists || IsInheritedSource(h.VariableSources[k]) {
+		return errorWithCode(ErrInvalidVariable, "variable %s is not defined by host %s", k, name)
+	}
+	inv.invalidateHostLocked(h)
+	delete(h.Variables, k)
+	delete(h.Templated, k)
+	delete(h.VariableSources, k)
+	return inv.resolveEagerlyLocked()
+}
+
+// SetGroupVariable sets a variable of a group. The members of the group
+// inherit the new value, unless they define the variable.
+func (inv *Inventory) SetGroupVariable(groupName, k, v string) error {
+	if err := checkVariableName(k); err != nil {
+		return err
+	}
+	g := inv.lookupGroup(groupName)
+	if g == nil {
+		return errorWithCode(ErrInvalidGroup, "the group %s does not exist", groupName)
+	}
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	inv.invalidateMembersLocked(groupName)
+	if g.Variables == nil {
+		g.Variables = make(map[string]string)
+	}
+	g.Variables[k] = v
+	delete(g.Templated, k)
+	setVariableSource(&g.VariableSources, k, inv.variableSource("group", groupName))
+	return inv.resolveEagerlyLocked()
+}
+
+// DeleteGroupVariable removes a variable of a group. The members of the
+// group inherit the value of their other groups, if any.
+func (inv *Inventory) DeleteGroupVariable(groupName, k string) error {
+	g := inv.lookupGroup(groupName)
+	if g == nil {
+		return errorWithCode(ErrInvalidGroup, "the group %s does not exist", groupName)
+	}
+	if _, exists := g.Variables[k]; !exists {
+		return errorWithCode(ErrInvalidVariable, "variable %s is not defined by group %s", k, groupName)
+	}
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	inv.invalidateMembersLocked(groupName)
+	delete(g.Variables, k)
+	delete(g.Templated, k)
+	delete(g.VariableSources, k)
+	return inv.resolveEagerlyLocked()
+}
+
+// checkVariableName returns an error when the provided name cannot be the
+// name of an inventory variable.
+func checkVariableName(k string) error {
+	if k == "" || strings.ContainsAny(k, " \t=") {
+		return errorWithCode(ErrInvalidVariable, "invalid variable name %q", k)
+	}
+	return nil
+}
+
+// invalidateHostLocked discards the variables a resolved host inherits, so
+// that they are computed again, see resolveEagerlyLocked. The caller holds
+// resolveMu.
+func (inv *Inventory) invalidateHostLocked(h *InventoryHost) {
+	if h.unresolved {
+		return
+	}
+	dropInheritedVariables(h)
+	h.unresolved = true
+}
+
+// invalidateMembersLocked invalidates the resolved hosts that are members
+// of the provided group. The caller holds resolveMu.
+func (inv *Inventory) invalidateMembersLocked(groupName string) {
+	for _, h := range inv.Hosts {
+		if !h.unresolved && stringInList(groupName, h.Groups) {
+			inv.invalidateHostLocked(h)
+		}
+	}
+}
+
+// hasAncestor returns true when one of the parents of the group is in the
+// provided set.
+func (g *InventoryGroup) hasAncestor(groups map[string]bool) bool {
+	for _, a := range g.Ancestors {
+		if groups[a] {
+			return true
+		}
+	}
+	return false
+}
+
+// removeHosts removes the hosts matching the provided function.
+func (inv *Inventory) removeHosts(fn func(*InventoryHost) bool) {
+	hosts := inv.Hosts[:0]
+	for _, h := range inv.Hosts {
+		if fn(h) {
+			delete(inv.HostsRef, h.Name)
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+	inv.Hosts = hosts
+	inv.resetIndex()
+}
+
+// renameVariableSources rewrites the variable sources of the provided kind
+// naming the renamed host or group, i.e. "<kind> <name>" and "<kind> <name>
+// (<file>)", see variableSource.
+func renameVariableSources(sources map[string]string, kind, name, newName string) {
+	prefix := kind + " " + name
+	for k, s := range sources {
+		if s == prefix || strings.HasPrefix(s, prefix+" (") {
+			sources[k] = kind + " " + newName + s[len(prefix):]
+		}
+	}
+}
+
+// edit applies the changes of the provided function to a copy of the
+// Inventory, without the variables the hosts inherit and the group
+// counters, and then computes the group memberships, the counters, and
+// the inherited variables again. When either fails, the Inventory is left
+// unchanged.
+func (inv *Inventory) edit(fn func(*Inventory) error) error {
+	c := inv.Clone()
+	for _, h := range c.Hosts {
+		dropInheritedVariables(h)
+		h.Groups = nil
+		h.GroupChains = nil
+	}
+	for _, g := range c.Groups {
+		g.Counters = InventoryGroupCounters{}
+	}
+	if err := fn(c); err != nil {
+		return err
+	}
+	if err := c.finalize(); err != nil {
+		return err
+	}
+	inv.restore(c)
+	return nil
+}
+
+// dropInheritedVariables removes the variables a host inherits from its
+// groups, leaving the variables the host defines.
+func dropInheritedVariables(h *InventoryHost) {
+	for k := range h.Variables {
+		if !IsInheritedSource(h.VariableSources[k]) {
+			continue
+		}
+		delete(h.Variables, k)
+		delete(h.Templated, k)
+		delete(h.VariableSources, k)
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInventoryEdit(t *testing.T) {
+	data := []byte(`[web]
+web01
+web02 env=test
+
+[db]
+db01
+
+[ny:children]
+web
+db
+
+[ny:vars]
+env=prod
+site=ny
+`)
+	for i, test := range []struct {
+		name      string
+		fn        func(*Inventory) error
+		shouldErr bool
+		hosts     map[string]string
+		groups    []string
+		vars      map[string]string
+		counters  map[string]InventoryGroupCounters
+	}{
+		{
+			name:     "remove host",
+			fn:       func(inv *Inventory) error { return inv.RemoveHost("web01") },
+			hosts:    map[string]string{"web02": "web", "db01": "db"},
+			counters: map[string]InventoryGroupCounters{"web": {Hosts: 1}, "ny": {Hosts: 2, Groups: 2}},
+		},
+		{
+			name:      "remove unknown host",
+			fn:        func(inv *Inventory) error { return inv.RemoveHost("web09") },
+			shouldErr: true,
+		},
+		{
+			name:     "retain hosts",
+			fn:       func(inv *Inventory) error { return inv.RetainHosts("web02", "db01", "web09") },
+			hosts:    map[string]string{"web02": "web", "db01": "db"},
+			counters: map[string]InventoryGroupCounters{"web": {Hosts: 1}, "ny": {Hosts: 2, Groups: 2}},
+		},
+		{
+			name:  "rename host",
+			fn:    func(inv *Inventory) error { return inv.RenameHost("web02", "web03") },
+			hosts: map[string]string{"web01": "web", "web03": "web", "db01": "db"},
+			vars:  map[string]string{"web03.env": "test"},
+		},
+		{
+			name:      "rename host to existing host",
+			fn:        func(inv *Inventory) error { return inv.RenameHost("web02", "db01") },
+			shouldErr: true,
+		},
+		{
+			name:     "move host",
+			fn:       func(inv *Inventory) error { return inv.MoveHostToGroup("web01", "db") },
+			hosts:    map[string]string{"web01": "db", "web02": "web", "db01": "db"},
+			vars:     map[string]string{"web01.site": "ny"},
+			counters: map[string]InventoryGroupCounters{"web": {Hosts: 1}, "db": {Hosts: 2}, "ny": {Hosts: 3, Groups: 2}},
+		},
+		{
+			name:      "move host to unknown group",
+			fn:        func(inv *Inventory) error { return inv.MoveHostToGroup("web01", "app") },
+			shouldErr: true,
+		},
+		{
+			name:     "remove group",
+			fn:       func(inv *Inventory) error { return inv.RemoveGroup("ny", false) },
+			hosts:    map[string]string{"web01": "web", "web02": "web", "db01": "db"},
+			groups:   []string{"all", "web", "db"},
+			vars:     map[string]string{"web01.site": "", "web02.env": "test"},
+			counters: map[string]InventoryGroupCounters{"all": {Hosts: 3, Groups: 2}},
+		},
+		{
+			name:   "remove group with members",
+			fn:     func(inv *Inventory) error { return inv.RemoveGroup("web", false) },
+			hosts:  map[string]string{"web01": "ny", "web02": "ny", "db01": "db"},
+			groups: []string{"all", "db", "ny"},
+			vars:   map[string]string{"web01.env": "prod"},
+		},
+		{
+			name:     "remove group cascading members",
+			fn:       func(inv *Inventory) error { return inv.RemoveGroup("ny", true) },
+			hosts:    map[string]string{},
+			groups:   []string{"all"},
+			counters: map[string]InventoryGroupCounters{"all": {}},
+		},
+		{
+			name:      "remove group all",
+			fn:        func(inv *Inventory) error { return inv.RemoveGroup("all", true) },
+			shouldErr: true,
+		},
+		{
+			name:     "rename group",
+			fn:       func(inv *Inventory) error { return inv.RenameGroup("ny", "nyc") },
+			hosts:    map[string]string{"web01": "web", "web02": "web", "db01": "db"},
+			groups:   []string{"all", "web", "db", "nyc"},
+			vars:     map[string]string{"web01.site": "ny"},
+			counters: map[string]InventoryGroupCounters{"nyc": {Hosts: 3, Groups: 2}, "all": {Hosts: 3, Groups: 3}},
+		},
+		{
+			name:      "rename group to existing group",
+			fn:        func(inv *Inventory) error { return inv.RenameGroup("web", "db") },
+			shouldErr: true,
+		},
+	} {
+		inv := NewInventory()
+		if err := inv.LoadFromBytes(data); err != nil {
+			t.Fatalf("error reading inventory: %s", err)
+		}
+		err := test.fn(inv)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, %s, expected error, but passed", i, test.name)
+			}
+			if inv.Size() != 3 {
+				t.Fatalf("FAIL: Test %d, %s, inventory modified by the failed change", i, test.name)
+			}
+			t.Logf("PASS: Test %d, %s, error: %s", i, test.name, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, %s, unexpected error: %s", i, test.name, err)
+		}
+		if len(inv.Hosts) != len(test.hosts) || len(inv.HostsRef) != len(test.hosts) {
+			t.Fatalf("FAIL: Test %d, %s, host count mismatch: %d (expected) vs. %d (received)", i, test.name, len(test.hosts), len(inv.Hosts))
+		}
+		for name, parent := range test.hosts {
+			h, err := inv.GetHost(name)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, %s, error getting host %s: %s", i, test.name, name, err)
+			}
+			if h.Parent != parent || inv.HostsRef[name] != parent {
+				t.Fatalf("FAIL: Test %d, %s, host %s parent mismatch: %s (expected) vs. %s (received)", i, test.name, name, parent, h.Parent)
+			}
+		}
+		if test.groups != nil {
+			if len(inv.Groups) != len(test.groups) || len(inv.GroupsRef) != len(test.groups) {
+				t.Fatalf("FAIL: Test %d, %s, group count mismatch: %d (expected) vs. %d (received)", i, test.name, len(test.groups), len(inv.Groups))
+			}
+			for _, name := range test.groups {
+				if _, err := inv.GetGroup(name); err != nil {
+					t.Fatalf("FAIL: Test %d, %s, error getting group %s: %s", i, test.name, name, err)
+				}
+			}
+		}
+		for k, v := range test.vars {
+			name, key, _ := strings.Cut(k, ".")
+			h, err := inv.GetHost(name)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, %s, error getting host %s: %s", i, test.name, name, err)
+			}
+			if h.Variables[key] != v {
+				t.Fatalf("FAIL: Test %d, %s, host %s variable %s mismatch: %q (expected) vs. %q (received)", i, test.name, name, key, v, h.Variables[key])
+			}
+		}
+		for name, counters := range test.counters {
+			g, err := inv.GetGroup(name)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, %s, error getting group %s: %s", i, test.name, name, err)
+			}
+			if g.Counters != counters {
+				t.Fatalf("FAIL: Test %d, %s, group %s counters mismatch: %+v (expected) vs. %+v (received)", i, test.name, name, counters, g.Counters)
+			}
+		}
+		t.Logf("PASS: Test %d, %s", i, test.name)
+	}
+}
+
+func TestInventorySetVariable(t *testing.T) {
+	data := []byte(`[web]
+web01
+web02 env=test
+
+[ny:children]
+web
+
+[ny:vars]
+env=prod
+site=ny
+`)
+	for i, test := range []struct {
+		name      string
+		fn        func(*Inventory) error
+		shouldErr bool
+		vars      map[string]string
+	}{
+		{
+			name: "set host variable",
+			fn:   func(inv *Inventory) error { return inv.SetHostVariable("web01", "env", "dev") },
+			vars: map[string]string{"web01.env": "dev", "web02.env": "test"},
+		},
+		{
+			name: "delete host variable",
+			fn:   func(inv *Inventory) error { return inv.DeleteHostVariable("web02", "env") },
+			vars: map[string]string{"web01.env": "prod", "web02.env": "prod"},
+		},
+		{
+			name:      "delete inherited host variable",
+			fn:        func(inv *Inventory) error { return inv.DeleteHostVariable("web01", "site") },
+			shouldErr: true,
+		},
+		{
+			name:      "set host variable with invalid name",
+			fn:        func(inv *Inventory) error { return inv.SetHostVariable("web01", "os name", "eos") },
+			shouldErr: true,
+		},
+		{
+			name: "set group variable",
+			fn:   func(inv *Inventory) error { return inv.SetGroupVariable("ny", "env", "stage") },
+			vars: map[string]string{"web01.env": "stage", "web02.env": "test"},
+		},
+		{
+			name: "set variable of child group",
+			fn:   func(inv *Inventory) error { return inv.SetGroupVariable("web", "site", "ny4") },
+			vars: map[string]string{"web01.site": "ny4", "web02.site": "ny4"},
+		},
+		{
+			name: "delete group variable",
+			fn:   func(inv *Inventory) error { return inv.DeleteGroupVariable("ny", "site") },
+			vars: map[string]string{"web01.site": "", "web01.env": "prod"},
+		},
+		{
+			name:      "set variable of unknown group",
+			fn:        func(inv *Inventory) error { return inv.SetGroupVariable("db", "env", "prod") },
+			shouldErr: true,
+		},
+	} {
+		inv := NewInventory()
+		if err := inv.LoadFromBytes(data); err != nil {
+			t.Fatalf("error reading inventory: %s", err)
+		}
+		err := test.fn(inv)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, %s, expected error, but passed", i, test.name)
+			}
+			t.Logf("PASS: Test %d, %s, error: %s", i, test.name, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, %s, unexpected error: %s", i, test.name, err)
+		}
+		for k, v := range test.vars {
+			name, key, _ := strings.Cut(k, ".")
+			h, err := inv.GetHost(name)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, %s, error getting host %s: %s", i, test.name, name, err)
+			}
+			if h.Variables[key] != v {
+				t.Fatalf("FAIL: Test %d, %s, host %s variable %s mismatch: %q (expected) vs. %q (received)", i, test.name, name, key, v, h.Variables[key])
+			}
+		}
+		t.Logf("PASS: Test %d, %s", i, test.name)
+	}
+}
+
+func TestInventoryRenameVariableSources(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(fp, []byte("[web]\nweb01 env=test\n\n[ny:children]\nweb\n\n[ny:vars]\nsite=ny\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		name    string
+		fn      func(*Inventory) error
+		host    string
+		old     string
+		sources map[string]string
+	}{
+		{
+			name:    "rename group",
+			fn:      func(inv *Inventory) error { return inv.RenameGroup("ny", "nyc") },
+			host:    "web01",
+			sources: map[string]string{"site": "group nyc (" + fp + ")", "env": "host web01 (" + fp + ")"},
+		},
+		{
+			name:    "rename host",
+			fn:      func(inv *Inventory) error { return inv.RenameHost("web01", "web02") },
+			host:    "web02",
+			old:     "web01",
+			sources: map[string]string{"site": "group ny (" + fp + ")", "env": "host web02 (" + fp + ")"},
+		},
+	} {
+		inv := NewInventory()
+		if err := inv.LoadFromFile(fp); err != nil {
+			t.Fatalf("error reading inventory: %s", err)
+		}
+		if err := test.fn(inv); err != nil {
+			t.Fatalf("FAIL: Test %d, %s, unexpected error: %s", i, test.name, err)
+		}
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, %s, error getting host %s: %s", i, test.name, test.host, err)
+		}
+		if test.old != "" {
+			if _, err := inv.GetHost(test.old); err == nil {
+				t.Fatalf("FAIL: Test %d, %s, host %s still exists", i, test.name, test.old)
+			}
+		}
+		for k, source := range test.sources {
+			if h.VariableSource(k) != source {
+				t.Fatalf("FAIL: Test %d, %s, host %s variable %s source mismatch: %q (expected) vs. %q (received)", i, test.name, test.host, k, source, h.VariableSource(k))
+			}
+		}
+		t.Logf("PASS: Test %d, %s", i, test.name)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// inventoryEncodingVersion is the version of the binary Inventory snapshot.
+// Increment it whenever the layout of Inventory changes.
+const inventoryEncodingVersion = 1
+
+type inventorySnapshot struct {
+	Version   int
+	Inventory *Inventory
+}
+
+// Encode writes the parsed Inventory, including the computed group chains
+// and inherited variables, to the provided writer in gob format.
+func (inv *Inventory) Encode(w io.Writer) error {
+	if err := inv.Precompute(); err != nil {
+		return err
+	}
+	snapshot := &inventorySnapshot{
+		Version:   inventoryEncodingVersion,
+		Inventory: inv,
+	}
+	if err := gob.NewEncoder(w).Encode(snapshot); err != nil {
+		return fmt.Errorf("failed encoding inventory: %s", err)
+	}
+	return nil
+}
+
+// Decode replaces the contents of the Inventory with a snapshot previously
+// written by Encode. The snapshot is not parsed again.
+func (inv *Inventory) Decode(r io.Reader) error {
+	snapshot := &inventorySnapshot{}
+	if err := gob.NewDecoder(r).Decode(snapshot); err != nil {
+		return fmt.Errorf("failed decoding inventory: %s", err)
+	}
+	if snapshot.Version != inventoryEncodingVersion {
+		return fmt.Errorf("unsupported inventory encoding version: %d", snapshot.Version)
+	}
+	if snapshot.Inventory == nil {
+		return fmt.Errorf("failed decoding inventory: empty snapshot")
+	}
+	inv.restore(snapshot.Inventory)
+	return nil
+}
+
+// restore replaces the contents of the Inventory with the decoded one and
+// rebuilds the fields not serialized.
+func (inv *Inventory) restore(src *Inventory) {
+	inv.Raw = src.Raw
+	inv.HostsRef = src.HostsRef
+	inv.GroupsRef = src.GroupsRef
+	inv.Hosts = src.Hosts
+	inv.Groups = src.Groups
+	inv.resetIndex()
+	if inv.HostsRef == nil {
+		inv.HostsRef = make(map[string]string)
+	}
+	if inv.GroupsRef == nil {
+		inv.GroupsRef = make(map[string]bool)
+	}
+	for _, h := range inv.Hosts {
+		if h.Variables == nil {
+			h.Variables = make(map[string]string)
+		}
+	}
+	for _, g := range inv.Groups {
+		if g.Variables == nil {
+			g.Variables = make(map[string]string)
+		}
+		g.inventory = inv
+	}
+	inv.linkChildGroups()
+}
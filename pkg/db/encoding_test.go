@@ -0,0 +1,67 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestInventoryEncoding(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	var b bytes.Buffer
+	if err := inv.Encode(&b); err != nil {
+		t.Fatalf("error encoding inventory: %s", err)
+	}
+	decoded := NewInventory()
+	if err := decoded.Decode(&b); err != nil {
+		t.Fatalf("error decoding inventory: %s", err)
+	}
+	if decoded.Size() != inv.Size() {
+		t.Fatalf("inventory size mismatch: %d (expected) vs. %d (received)", inv.Size(), decoded.Size())
+	}
+	for _, h := range inv.Hosts {
+		dh, err := decoded.GetHost(h.Name)
+		if err != nil {
+			t.Fatalf("error getting host %s from decoded inventory: %s", h.Name, err)
+		}
+		if !reflect.DeepEqual(h.Groups, dh.Groups) || !reflect.DeepEqual(h.GroupChains, dh.GroupChains) {
+			t.Fatalf("host %s group membership mismatch: %v %v (expected) vs. %v %v (received)", h.Name, h.Groups, h.GroupChains, dh.Groups, dh.GroupChains)
+		}
+		if !reflect.DeepEqual(h.Variables, dh.Variables) {
+			t.Fatalf("host %s variables mismatch: %v (expected) vs. %v (received)", h.Name, h.Variables, dh.Variables)
+		}
+	}
+	group, err := decoded.GetGroup("cisco")
+	if err != nil {
+		t.Fatalf("error getting group from decoded inventory: %s", err)
+	}
+	count := 0
+	group.Hosts()(func(h *InventoryHost) bool {
+		count++
+		return true
+	})
+	if count != 2 {
+		t.Fatalf("decoded group hosts count mismatch: 2 (expected) vs. %d (received)", count)
+	}
+
+	if err := decoded.Decode(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Fatalf("expected decoding garbage to fail, but passed")
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// AddEphemeralHost registers a host in the loaded Inventory at runtime,
+// the way the Ansible add_host module does, e.g. a device provisioned by
+// the running orchestration. The host becomes a member of the provided
+// groups, the first of which is its parent, or of "all" when none is
+// provided. The groups not in the Inventory are created as ephemeral
+// children of "all". The host inherits the variables of its groups, unless
+// the provided variables override them. The ephemeral hosts and groups are
+// excluded from ExportState, unless requested, and are dropped by
+// RemoveEphemeral.
+func (inv *Inventory) AddEphemeralHost(name string, groups []string, vars map[string]string) (*InventoryHost, error) {
+	name = inv.hostname(name)
+	if name == "" {
+		return nil, fmt.Errorf("ephemeral host name is empty")
+	}
+	if _, exists := inv.HostsRef[name]; exists {
+		return nil, fmt.Errorf("host %s already exists", name)
+	}
+	if len(groups) == 0 {
+		groups = []string{"all"}
+	}
+	for _, g := range groups {
+		if _, exists := inv.GroupsRef[g]; exists {
+			continue
+		}
+		if err := inv.AddGroup(g, "all"); err != nil {
+			return nil, err
+		}
+		group, err := inv.GetGroup(g)
+		if err != nil {
+			return nil, err
+		}
+		group.Ephemeral = true
+		if err := inv.AddGroupMemberCounter("group", "all"); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkLimit(LimitHosts, int64(len(inv.Hosts)+1), int64(inv.maxHosts)); err != nil {
+		return nil, err
+	}
+
+	h := &InventoryHost{
+		Name:      name,
+		Parent:    groups[0],
+		Variables: make(map[string]string),
+		Ephemeral: true,
+	}
+	for k, v := range vars {
+		h.Variables[k] = v
+		setVariableSource(&h.VariableSources, k, "ephemeral host "+name)
+	}
+	chains := make(map[string]bool)
+	members := make(map[string]bool)
+	for _, g := range groups {
+		groupChains, parents, err := inv.GetParentGroupChains(g)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range groupChains {
+			if !chains[c] {
+				chains[c] = true
+				h.GroupChains = append(h.GroupChains, c)
+			}
+		}
+		for _, p := range parents {
+			if !members[p] {
+				members[p] = true
+				h.Groups = append(h.Groups, p)
+			}
+		}
+	}
+	for _, g := range h.Groups {
+		if err := inv.AddGroupMemberCounter("host", g); err != nil {
+			return nil, err
+		}
+	}
+	if err := inv.inheritVariables(h); err != nil {
+		return nil, err
+	}
+	inv.HostsRef[name] = h.Parent
+	inv.Hosts = append(inv.Hosts, h)
+	inv.indexHost(h)
+	return h, nil
+}
+
+// RemoveEphemeral removes the ephemeral hosts and groups from the
+// Inventory, e.g. at the end of a run.
+func (inv *Inventory) RemoveEphemeral() {
+	hosts := inv.Hosts[:0]
+	for _, h := range inv.Hosts {
+		if !h.Ephemeral {
+			hosts = append(hosts, h)
+			continue
+		}
+		for _, g := range inv.hostGroups(h) {
+			if group, err := inv.GetGroup(g); err == nil {
+				atomic.AddUint64(&group.Counters.Hosts, ^uint64(0))
+			}
+		}
+		delete(inv.HostsRef, h.Name)
+	}
+	inv.Hosts = hosts
+	groups := inv.Groups[:0]
+	for _, g := range inv.Groups {
+		if !g.Ephemeral {
+			groups = append(groups, g)
+			continue
+		}
+		for _, a := range g.Ancestors {
+			if group, err := inv.GetGroup(a); err == nil {
+				atomic.AddUint64(&group.Counters.Groups, ^uint64(0))
+			}
+		}
+		delete(inv.GroupsRef, g.Name)
+	}
+	inv.Groups = groups
+	inv.resetIndex()
+	inv.linkChildGroups()
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEphemeralHosts(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	all, err := inv.GetGroup("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters := all.Counters
+	var before bytes.Buffer
+	if err := inv.ExportState(&before); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := inv.AddEphemeralHost("ny-sw05", []string{"ny4-cisco", "provisioned"}, map[string]string{"os": "cisco_iosxe"})
+	if err != nil {
+		t.Fatalf("FAIL: error adding ephemeral host: %s", err)
+	}
+	for k, v := range map[string]string{"os": "cisco_iosxe", "datacenter": "ny4", "vendor": "Cisco Systems"} {
+		if h.Variables[k] != v {
+			t.Fatalf("FAIL: variable %s mismatch: %s (expected) vs. %s (received)", k, v, h.Variables[k])
+		}
+	}
+	for _, g := range []string{"cisco", "ny", "provisioned"} {
+		if !h.memberOf(g) {
+			t.Fatalf("FAIL: host %s is not a member of %s: %v", h.Name, g, h.Groups)
+		}
+	}
+	if _, err := inv.AddEphemeralHost("ny-sw01", nil, nil); err == nil {
+		t.Fatalf("FAIL: expected error adding existing host")
+	}
+	hosts, err := inv.GetHostsWithExpression(`"provisioned" in groups`)
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("FAIL: ephemeral host not found by group: %v, %v", hosts, err)
+	}
+
+	var after, withEphemeral bytes.Buffer
+	if err := inv.ExportState(&after); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before.Bytes(), after.Bytes()) {
+		t.Fatalf("FAIL: exported state includes ephemeral hosts")
+	}
+	if err := inv.ExportState(&withEphemeral, IncludeEphemeral()); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewInventory()
+	if err := restored.ImportState(&withEphemeral); err != nil {
+		t.Fatal(err)
+	}
+	if rh, err := restored.GetHost("ny-sw05"); err != nil || !rh.Ephemeral {
+		t.Fatalf("FAIL: ephemeral host not restored: %v", err)
+	}
+
+	inv.RemoveEphemeral()
+	if _, err := inv.GetHost("ny-sw05"); err == nil {
+		t.Fatalf("FAIL: ephemeral host not removed")
+	}
+	if _, err := inv.GetGroup("provisioned"); err == nil {
+		t.Fatalf("FAIL: ephemeral group not removed")
+	}
+	if all.Counters != counters {
+		t.Fatalf("FAIL: counters mismatch: %v (expected) vs. %v (received)", counters, all.Counters)
+	}
+	t.Logf("PASS: ephemeral host lifecycle")
+}
@@ -0,0 +1,758 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MatchExpression returns a HostMatcher selecting hosts for which the
+// provided expression evaluates to true. The expressions follow a subset
+// of the Common Expression Language (CEL) syntax. The environment of an
+// expression is:
+//
+//	name    string               the name of the host
+//	parent  string               the parent group of the host
+//	groups  list(string)         the groups of the host, including ancestors
+//	tags    list(string)         the tags of the host
+//	vars    map(string, string)  the variables of the host, including inherited
+//
+// The supported operators are ==, !=, <, <=, >, >=, &&, ||, !, and in. The
+// strings holding numbers compare as numbers. The supported functions are
+// size(x), has(vars.key), and the string methods startsWith, endsWith,
+// contains, and matches, e.g.
+//
+//	"cisco" in groups && vars.datacenter == "ny4" && name.startsWith("ny-")
+//
+// As in CEL, the logical operators tolerate an error on one side when the
+// other side decides the result, e.g. vars.port > 22 || name == "a" holds
+// for host "a" without the port variable. A host, for which the evaluation
+// fails, e.g. due to mismatched types, is not selected.
+func MatchExpression(expr string) (HostMatcher, error) {
+	p := &exprParser{input: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %s", expr, err)
+	}
+	eval, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %s", expr, err)
+	}
+	return func(h *InventoryHost) bool {
+		v, err := eval(hostEnvironment(h))
+		if err != nil {
+			return false
+		}
+		b, ok := v.(bool)
+		return ok && b
+	}, nil
+}
+
+func hostEnvironment(h *InventoryHost) map[string]interface{} {
+	vars := make(map[string]interface{}, len(h.Variables))
+	for k, v := range h.Variables {
+		vars[k] = v
+	}
+	return map[string]interface{}{
+		"name":   h.Name,
+		"parent": h.Parent,
+		"groups": toValueList(h.Groups),
+		"tags":   toValueList(h.Tags),
+		"vars":   vars,
+	}
+}
+
+func toValueList(arr []string) []interface{} {
+	out := make([]interface{}, len(arr))
+	for i, s := range arr {
+		out[i] = s
+	}
+	return out
+}
+
+type exprEval func(env map[string]interface{}) (interface{}, error)
+
+type exprTokenKind int
+
+const (
+	tokenIdent exprTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type exprToken struct {
+	kind  exprTokenKind
+	value string
+	pos   int
+}
+
+// exprParser parses the expressions of MatchExpression, and the queries of
+// MatchQuery when query is set. A query is tokenized into words, i.e. the
+// fields and the globs, and the "=", "!=", and parentheses operators, and
+// is parsed with "and", "or", and "not" as the logical operators and the
+// conditions of parseCondition as the relations.
+type exprParser struct {
+	input  string
+	query  bool
+	tokens []exprToken
+	pos    int
+}
+
+var (
+	exprOperators  = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ".", ",", "-"}
+	queryOperators = []string{"!=", "=", "(", ")"}
+)
+
+func (p *exprParser) tokenize() error {
+	s := p.input
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				sb.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return fmt.Errorf("unterminated string at %d", i)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokenString, value: sb.String(), pos: i})
+			i = j + 1
+		case p.query && !isQueryOperator(s[i:]):
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && s[j] != '"' && s[j] != '\'' && !isQueryOperator(s[j:]) {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokenIdent, value: s[i:j], pos: i})
+			i = j
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokenNumber, value: s[i:j], pos: i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokenIdent, value: s[i:j], pos: i})
+			i = j
+		default:
+			operators := exprOperators
+			if p.query {
+				operators = queryOperators
+			}
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, exprToken{kind: tokenOperator, value: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+		}
+	}
+	return nil
+}
+
+// isQueryOperator returns true when the provided string starts with an
+// operator of the queries.
+func isQueryOperator(s string) bool {
+	for _, op := range queryOperators {
+		if strings.HasPrefix(s, op) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *exprParser) accept(kind exprTokenKind, value string) bool {
+	t := p.peek()
+	if t != nil && t.kind == kind && t.value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// acceptOperator consumes the next token when it is the provided operator,
+// or, in a query, the provided case-insensitive keyword, e.g. "&&" or
+// "and".
+func (p *exprParser) acceptOperator(op, keyword string) bool {
+	if p.query {
+		t := p.peek()
+		if t != nil && t.kind == tokenIdent && strings.EqualFold(t.value, keyword) {
+			p.pos++
+			return true
+		}
+	}
+	return p.accept(tokenOperator, op)
+}
+
+func (p *exprParser) unexpected(expected string) error {
+	if t := p.peek(); t != nil {
+		return fmt.Errorf("expected %s at %d, found %q", expected, t.pos, t.value)
+	}
+	return fmt.Errorf("expected %s at the end", expected)
+}
+
+func (p *exprParser) expect(value string) error {
+	if !p.accept(tokenOperator, value) {
+		if t := p.peek(); t != nil {
+			return fmt.Errorf("expected %q at %d, found %q", value, t.pos, t.value)
+		}
+		return fmt.Errorf("expected %q at the end", value)
+	}
+	return nil
+}
+
+func (p *exprParser) parse() (exprEval, error) {
+	if len(p.tokens) == 0 {
+		if p.query {
+			return nil, fmt.Errorf("empty query")
+		}
+		return nil, fmt.Errorf("empty expression")
+	}
+	eval, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+	}
+	return eval, nil
+}
+
+func (p *exprParser) parseOr() (exprEval, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOperator("||", "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env map[string]interface{}) (interface{}, error) {
+			a, errA := evalBool(l, env)
+			if errA == nil && a {
+				return true, nil
+			}
+			b, errB := evalBool(right, env)
+			if errB == nil && b {
+				return true, nil
+			}
+			if errA != nil {
+				return nil, errA
+			}
+			return b, errB
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprEval, error) {
+	left, err := p.parseRelation()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOperator("&&", "and") {
+		right, err := p.parseRelation()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env map[string]interface{}) (interface{}, error) {
+			a, errA := evalBool(l, env)
+			if errA == nil && !a {
+				return false, nil
+			}
+			b, errB := evalBool(right, env)
+			if errB == nil && !b {
+				return false, nil
+			}
+			if errA != nil {
+				return nil, errA
+			}
+			return b, errB
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseRelation() (exprEval, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t == nil || p.query {
+		return left, nil
+	}
+	if t.kind == tokenIdent && t.value == "in" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(env map[string]interface{}) (interface{}, error) {
+			a, err := left(env)
+			if err != nil {
+				return nil, err
+			}
+			b, err := right(env)
+			if err != nil {
+				return nil, err
+			}
+			return valueIn(a, b)
+		}, nil
+	}
+	if t.kind != tokenOperator {
+		return left, nil
+	}
+	op := t.value
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return func(env map[string]interface{}) (interface{}, error) {
+		a, err := left(env)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(env)
+		if err != nil {
+			return nil, err
+		}
+		return compareValues(op, a, b)
+	}, nil
+}
+
+func (p *exprParser) parseUnary() (exprEval, error) {
+	if p.acceptOperator("!", "not") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(env map[string]interface{}) (interface{}, error) {
+			b, err := evalBool(operand, env)
+			return !b, err
+		}, nil
+	}
+	if p.accept(tokenOperator, "-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(env map[string]interface{}) (interface{}, error) {
+			v, err := operand(env)
+			if err != nil {
+				return nil, err
+			}
+			n, ok := toNumber(v)
+			if !ok {
+				return nil, fmt.Errorf("cannot negate %v", v)
+			}
+			return -n, nil
+		}, nil
+	}
+	if p.query {
+		return p.parseCondition()
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprEval, error) {
+	eval, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept(tokenOperator, "."):
+			t := p.peek()
+			if t == nil || t.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a name after \".\"")
+			}
+			p.pos++
+			name := t.value
+			if p.accept(tokenOperator, "(") {
+				args, err := p.parseArgs()
+				if err != nil {
+					return nil, err
+				}
+				eval, err = newMethodCall(eval, name, args)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			eval = newIndex(eval, func(map[string]interface{}) (interface{}, error) { return name, nil })
+		case p.accept(tokenOperator, "["):
+			key, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			eval = newIndex(eval, key)
+		default:
+			return eval, nil
+		}
+	}
+}
+
+func (p *exprParser) parseArgs() ([]exprEval, error) {
+	var args []exprEval
+	if p.accept(tokenOperator, ")") {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(tokenOperator, ")") {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprEval, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case tokenString:
+		s := t.value
+		return func(map[string]interface{}) (interface{}, error) { return s, nil }, nil
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.value, t.pos)
+		}
+		return func(map[string]interface{}) (interface{}, error) { return n, nil }, nil
+	case tokenIdent:
+		switch t.value {
+		case "true", "false":
+			b := t.value == "true"
+			return func(map[string]interface{}) (interface{}, error) { return b, nil }, nil
+		case "null":
+			return func(map[string]interface{}) (interface{}, error) { return nil, nil }, nil
+		}
+		name := t.value
+		if p.accept(tokenOperator, "(") {
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			return newFunctionCall(name, args)
+		}
+		return func(env map[string]interface{}) (interface{}, error) {
+			v, exists := env[name]
+			if !exists {
+				return nil, fmt.Errorf("undeclared reference to %s", name)
+			}
+			return v, nil
+		}, nil
+	}
+	switch t.value {
+	case "(":
+		eval, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return eval, nil
+	case "[":
+		var items []exprEval
+		if !p.accept(tokenOperator, "]") {
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if p.accept(tokenOperator, "]") {
+					break
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return func(env map[string]interface{}) (interface{}, error) {
+			list := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				v, err := item(env)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+}
+
+// newIndex returns the value of a map key, or null when the key does not
+// exist, or a list element.
+func newIndex(target, key exprEval) exprEval {
+	return func(env map[string]interface{}) (interface{}, error) {
+		v, err := target(env)
+		if err != nil {
+			return nil, err
+		}
+		k, err := key(env)
+		if err != nil {
+			return nil, err
+		}
+		switch x := v.(type) {
+		case map[string]interface{}:
+			s, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid map key %v", k)
+			}
+			return x[s], nil
+		case []interface{}:
+			n, ok := toNumber(k)
+			if !ok || n < 0 || int(n) >= len(x) {
+				return nil, fmt.Errorf("invalid list index %v", k)
+			}
+			return x[int(n)], nil
+		}
+		return nil, fmt.Errorf("cannot index %v", v)
+	}
+}
+
+func newFunctionCall(name string, args []exprEval) (exprEval, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("function %s expects 1 argument, received %d", name, len(args))
+	}
+	arg := args[0]
+	switch name {
+	case "has":
+		return func(env map[string]interface{}) (interface{}, error) {
+			v, err := arg(env)
+			if err != nil {
+				return nil, err
+			}
+			return v != nil, nil
+		}, nil
+	case "size":
+		return func(env map[string]interface{}) (interface{}, error) {
+			v, err := arg(env)
+			if err != nil {
+				return nil, err
+			}
+			return valueSize(v)
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported function %s", name)
+}
+
+func newMethodCall(target exprEval, name string, args []exprEval) (exprEval, error) {
+	if name == "size" {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("method size expects no arguments")
+		}
+		return func(env map[string]interface{}) (interface{}, error) {
+			v, err := target(env)
+			if err != nil {
+				return nil, err
+			}
+			return valueSize(v)
+		}, nil
+	}
+	var fn func(s, arg string) (bool, error)
+	switch name {
+	case "startsWith":
+		fn = func(s, arg string) (bool, error) { return strings.HasPrefix(s, arg), nil }
+	case "endsWith":
+		fn = func(s, arg string) (bool, error) { return strings.HasSuffix(s, arg), nil }
+	case "contains":
+		fn = func(s, arg string) (bool, error) { return strings.Contains(s, arg), nil }
+	case "matches":
+		fn = func(s, arg string) (bool, error) { return regexp.MatchString(arg, s) }
+	default:
+		return nil, fmt.Errorf("unsupported method %s", name)
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("method %s expects 1 argument, received %d", name, len(args))
+	}
+	return func(env map[string]interface{}) (interface{}, error) {
+		v, err := target(env)
+		if err != nil {
+			return nil, err
+		}
+		a, err := args[0](env)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("method %s requires a string, received %v", name, v)
+		}
+		arg, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("method %s requires a string argument, received %v", name, a)
+		}
+		return fn(s, arg)
+	}, nil
+}
+
+func evalBool(eval exprEval, env map[string]interface{}) (bool, error) {
+	v, err := eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, received %v", v)
+	}
+	return b, nil
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func valueSize(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		return float64(len(x)), nil
+	case []interface{}:
+		return float64(len(x)), nil
+	case map[string]interface{}:
+		return float64(len(x)), nil
+	}
+	return nil, fmt.Errorf("size is undefined for %v", v)
+}
+
+func valueIn(a, b interface{}) (interface{}, error) {
+	switch x := b.(type) {
+	case []interface{}:
+		for _, item := range x {
+			if eq, err := compareValues("==", a, item); err == nil && eq.(bool) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		s, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid map key %v", a)
+		}
+		_, exists := x[s]
+		return exists, nil
+	}
+	return nil, fmt.Errorf("operator in is undefined for %v", b)
+}
+
+// compareValues compares two values. When either of the values is a
+// number, and the other one is a string holding a number, the values are
+// compared as numbers.
+func compareValues(op string, a, b interface{}) (interface{}, error) {
+	_, aNum := a.(float64)
+	_, bNum := b.(float64)
+	if aNum || bNum {
+		x, okA := toNumber(a)
+		y, okB := toNumber(b)
+		if okA && okB {
+			return compareOrdered(op, x < y, x == y), nil
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return compareOrdered(op, x < y, x == y), nil
+		}
+	case bool:
+		if y, ok := b.(bool); ok && (op == "==" || op == "!=") {
+			return compareOrdered(op, false, x == y), nil
+		}
+	case nil:
+		if op == "==" || op == "!=" {
+			return compareOrdered(op, false, b == nil), nil
+		}
+	}
+	if b == nil && (op == "==" || op == "!=") {
+		return compareOrdered(op, false, false), nil
+	}
+	return nil, fmt.Errorf("operator %s is undefined for %v and %v", op, a, b)
+}
+
+func compareOrdered(op string, less, equal bool) bool {
+	switch op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	}
+	return !less
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestMatchExpression(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error loading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		expr      string
+		hosts     []string
+		shouldErr bool
+	}{
+		{expr: `"cisco" in groups`, hosts: []string{"ny-sw01", "ny-sw04"}},
+		{expr: `vars.datacenter == "ny4" && vars.os.startsWith("arista")`, hosts: []string{"ny-sw02"}},
+		{expr: `vars.host_port > 8225 || name == 'controller'`, hosts: []string{"controller", "ny-sw03", "ny-sw04"}},
+		{expr: `!has(vars.datacenter) && name.matches("^c")`, hosts: []string{"controller"}},
+		{expr: `parent in ["ny5-cisco", "ny5-arista"] && size(groups) > 0`, hosts: []string{"ny-sw03", "ny-sw04"}},
+		{expr: `vars["vendor"].endsWith("Systems")`, hosts: []string{"ny-sw01", "ny-sw04"}},
+		{expr: `name + 1`, shouldErr: true},
+		{expr: `name ==`, shouldErr: true},
+		{expr: `name.lower()`, shouldErr: true},
+		{expr: `"unterminated`, shouldErr: true},
+		{expr: ``, shouldErr: true},
+	} {
+		m, err := MatchExpression(test.expr)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error for %s", i, test.expr)
+			}
+			t.Logf("PASS: Test %d, %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		var hosts []string
+		inv.AllHosts(m)(func(h *InventoryHost) bool {
+			hosts = append(hosts, h.Name)
+			return true
+		})
+		matched, err := inv.GetHostsWithExpression(test.expr)
+		if err != nil || len(matched) != len(hosts) {
+			t.Fatalf("FAIL: Test %d, GetHostsWithExpression mismatch: %d (expected) vs. %d (received), error: %v", i, len(hosts), len(matched), err)
+		}
+		sort.Strings(hosts)
+		if len(hosts) != len(test.hosts) {
+			t.Fatalf("FAIL: Test %d, %s: host mismatch: %v (expected) vs. %v (received)", i, test.expr, test.hosts, hosts)
+		}
+		for j := range hosts {
+			if hosts[j] != test.hosts[j] {
+				t.Fatalf("FAIL: Test %d, %s: host mismatch: %v (expected) vs. %v (received)", i, test.expr, test.hosts, hosts)
+			}
+		}
+		t.Logf("PASS: Test %d, %s: %v", i, test.expr, hosts)
+	}
+}
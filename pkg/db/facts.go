@@ -0,0 +1,243 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultFactPrefix is the prefix of the variables holding host facts.
+const DefaultFactPrefix = "facts_"
+
+// FactCommand is a command a FactGatherer runs on hosts.
+type FactCommand struct {
+	Name    string
+	Command string
+	// Parse converts the output of the command to facts, the names of
+	// which get the Name of the command as a prefix. When nil, the trimmed
+	// output is the fact with the Name of the command.
+	Parse func(output string) (map[string]string, error)
+}
+
+// ParseFactCommand parses the "name=command" notation, e.g.
+// "kernel=uname -r", of a FactCommand.
+func ParseFactCommand(s string) (*FactCommand, error) {
+	i := strings.Index(s, "=")
+	if i < 1 || strings.TrimSpace(s[i+1:]) == "" {
+		return nil, fmt.Errorf("invalid fact command %q, expected name=command", s)
+	}
+	return &FactCommand{
+		Name:    strings.TrimSpace(s[:i]),
+		Command: strings.TrimSpace(s[i+1:]),
+	}, nil
+}
+
+var factKeySanitizer = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ParseKeyValueFacts parses the "Key: Value" lines, e.g. of "show version"
+// on network devices, to facts with lowercase, underscore-separated names.
+// The lines without a colon are ignored.
+func ParseKeyValueFacts(output string) (map[string]string, error) {
+	facts := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		i := strings.Index(line, ":")
+		if i < 1 {
+			continue
+		}
+		k := strings.Trim(factKeySanitizer.ReplaceAllString(strings.ToLower(line[:i]), "_"), "_")
+		v := strings.TrimSpace(line[i+1:])
+		if k == "" || v == "" {
+			continue
+		}
+		if _, exists := facts[k]; !exists {
+			facts[k] = v
+		}
+	}
+	return facts, nil
+}
+
+// HostFacts are the facts gathered from a host.
+type HostFacts struct {
+	Host     string            `xml:"host" json:"host" yaml:"host"`
+	Username string            `xml:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
+	Facts    map[string]string `xml:"-" json:"facts,omitempty" yaml:"facts,omitempty"`
+	Errors   []string          `xml:"errors,omitempty" json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// FactGatherer connects to inventory hosts over SSH with the credentials a
+// Vault holds for them, runs a set of commands, and collects the parsed
+// output as host facts.
+type FactGatherer struct {
+	Vault *Vault
+	// HostKeyCallback verifies the host keys, e.g. the one returned by
+	// knownhosts.New.
+	HostKeyCallback ssh.HostKeyCallback
+	Commands        []*FactCommand
+	// Prefix is the prefix of the variable names AddHostFacts uses.
+	Prefix string
+	// Port is used for the hosts without the ansible_port variable.
+	Port string
+	// Timeout limits the duration of the login and of each command.
+	Timeout time.Duration
+	// Concurrency is the number of the hosts connected to in parallel.
+	Concurrency int
+}
+
+// NewFactGatherer returns an instance of FactGatherer running "uname -a",
+// unless the commands are provided.
+func NewFactGatherer(v *Vault, cb ssh.HostKeyCallback, commands ...*FactCommand) *FactGatherer {
+	if len(commands) == 0 {
+		commands = []*FactCommand{{Name: "uname", Command: "uname -a"}}
+	}
+	return &FactGatherer{
+		Vault:           v,
+		HostKeyCallback: cb,
+		Commands:        commands,
+		Prefix:          DefaultFactPrefix,
+		Port:            "22",
+		Timeout:         30 * time.Second,
+		Concurrency:     4,
+	}
+}
+
+// Gather collects the facts from the provided hosts. It logs in with the
+// first credential that authenticates, in the order of
+// GetCredentialsForHost. A failed login or command is recorded in the
+// Errors of the host, so that the other hosts and commands are not
+// affected.
+func (g *FactGatherer) Gather(ctx context.Context, hosts []*InventoryHost) ([]*HostFacts, error) {
+	if g.Vault == nil {
+		return nil, fmt.Errorf("vault not found")
+	}
+	if g.HostKeyCallback == nil {
+		return nil, fmt.Errorf("host key callback not found")
+	}
+	creds := make([][]*VaultCredential, len(hosts))
+	for i, h := range hosts {
+		creds[i] = g.Vault.hostCredentials(h)
+	}
+	results := make([]*HostFacts, len(hosts))
+	forEachConcurrently(len(hosts), g.Concurrency, func(i int) {
+		results[i] = g.gather(ctx, hosts[i], creds[i])
+	})
+	return results, ctx.Err()
+}
+
+func (g *FactGatherer) gather(ctx context.Context, h *InventoryHost, creds []*VaultCredential) *HostFacts {
+	r := &HostFacts{Host: h.Name, Facts: make(map[string]string)}
+	var client *ssh.Client
+	for _, cred := range creds {
+		if ctx.Err() != nil {
+			break
+		}
+		addr := credentialAddress(h, cred, g.Port)
+		c, err := dialSSH(ctx, addr, cred, g.HostKeyCallback, g.Timeout)
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("login %s: %s", cred.Username, err))
+			if !strings.Contains(err.Error(), "unable to authenticate") {
+				break
+			}
+			continue
+		}
+		client = c
+		r.Username = cred.Username
+		r.Errors = nil
+		break
+	}
+	if client == nil {
+		if len(r.Errors) == 0 {
+			r.Errors = append(r.Errors, "no credentials")
+		}
+		return r
+	}
+	defer client.Close()
+	for _, cmd := range g.Commands {
+		output, err := runSSHCommand(ctx, client, cmd.Command, g.Timeout)
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s: %s", cmd.Name, err))
+			continue
+		}
+		if cmd.Parse == nil {
+			r.Facts[cmd.Name] = strings.TrimSpace(output)
+			continue
+		}
+		facts, err := cmd.Parse(output)
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("%s: %s", cmd.Name, err))
+			continue
+		}
+		for k, v := range facts {
+			r.Facts[cmd.Name+"_"+k] = v
+		}
+	}
+	return r
+}
+
+// runSSHCommand runs a command in a new session and returns its standard
+// output.
+func runSSHCommand(ctx context.Context, client *ssh.Client, command string, timeout time.Duration) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		b, err := session.Output(command)
+		done <- result{b, err}
+	}()
+	select {
+	case r := <-done:
+		return string(r.output), r.err
+	case <-ctx.Done():
+		session.Close()
+		return "", ctx.Err()
+	}
+}
+
+// AddHostFacts adds the gathered facts to the variables of the hosts, with
+// the provided prefix, e.g. "facts_uname", so that they are available to
+// filters, queries, and exports.
+func (inv *Inventory) AddHostFacts(prefix string, facts []*HostFacts) error {
+	for _, f := range facts {
+		h, err := inv.GetHost(f.Host)
+		if err != nil {
+			return err
+		}
+		if h.Variables == nil {
+			h.Variables = make(map[string]string)
+		}
+		for k, v := range f.Facts {
+			h.Variables[prefix+k] = v
+			setVariableSource(&h.VariableSources, prefix+k, "facts "+h.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFactGatherer(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error reading vault key file: %s", err)
+	}
+	if err := vlt.LoadFromFile("../../testdata/inventory/vault.yml"); err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	creds, err := vlt.GetCredentials("ny-sw01")
+	if err != nil || len(creds) < 2 {
+		t.Fatalf("error getting credentials: %v", err)
+	}
+	// The second credential is the working one.
+	addr, hostKey := newTestSSHServer(t, creds[1].Password, map[string]string{
+		"uname -r":     "5.10.0\n",
+		"show version": "Cisco Nexus Operating System (NX-OS) Software\nSystem version: 9.3(8)\nHardware: cisco Nexus9000 C93180YC-EX\n",
+	})
+	host, port, _ := net.SplitHostPort(addr)
+	h, err := inv.GetHost("ny-sw01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Variables["ansible_host"] = host
+	h.Variables["ansible_port"] = port
+
+	commands := []*FactCommand{{Name: "version", Command: "show version", Parse: ParseKeyValueFacts}}
+	for _, s := range []string{"kernel=uname -r", "missing=false"} {
+		cmd, err := ParseFactCommand(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands = append(commands, cmd)
+	}
+	if _, err := ParseFactCommand("uname -a"); err == nil {
+		t.Fatalf("expected error parsing fact command without name")
+	}
+	g := NewFactGatherer(vlt, ssh.FixedHostKey(hostKey), commands...)
+	facts, err := g.Gather(context.Background(), []*InventoryHost{h})
+	if err != nil {
+		t.Fatalf("error gathering facts: %s", err)
+	}
+	if len(facts) != 1 || len(facts[0].Errors) != 1 {
+		t.Fatalf("unexpected facts: %+v", facts)
+	}
+	if err := inv.AddHostFacts(g.Prefix, facts); err != nil {
+		t.Fatalf("error adding facts: %s", err)
+	}
+	for k, v := range map[string]string{
+		"facts_kernel":                 "5.10.0",
+		"facts_version_system_version": "9.3(8)",
+		"facts_version_hardware":       "cisco Nexus9000 C93180YC-EX",
+	} {
+		if h.Variables[k] != v {
+			t.Fatalf("FAIL: fact %s mismatch: %s (expected) vs. %s (received)", k, v, h.Variables[k])
+		}
+		t.Logf("PASS: fact %s: %s", k, v)
+	}
+	hosts, err := inv.GetHostsWithExpression(`vars.facts_kernel.startsWith("5.")`)
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("FAIL: filtering by facts: %v, %v", hosts, err)
+	}
+	t.Logf("PASS: user %s, errors %v", facts[0].Username, facts[0].Errors)
+}
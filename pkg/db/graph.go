@@ -0,0 +1,128 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// InventoryGraph is the tree of the groups and the hosts of an Inventory,
+// rooted at the "all" group, see Inventory.ToGraph.
+type InventoryGraph struct {
+	Root *InventoryGraphNode
+}
+
+// InventoryGraphNode is a group or a host of an InventoryGraph. The child
+// groups of a group come first, followed by its hosts, each sorted by
+// name. A group with more than one parent appears under each of them.
+type InventoryGraphNode struct {
+	Name     string
+	Group    bool
+	Children []*InventoryGraphNode
+}
+
+// ToGraph returns the group and host tree of the Inventory, as shown by
+// "ansible-inventory --graph". The hosts without a group are members of
+// the "ungrouped" group.
+func (inv *Inventory) ToGraph() (*InventoryGraph, error) {
+	if err := inv.Precompute(); err != nil {
+		return nil, err
+	}
+	children, hosts := inv.groupMembers()
+	root, err := buildGraphNode("all", children, hosts, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return &InventoryGraph{Root: root}, nil
+}
+
+func buildGraphNode(name string, children, hosts map[string][]string, path map[string]bool) (*InventoryGraphNode, error) {
+	if path[name] {
+		return nil, errorWithCode(ErrGroupCycle, "group cycle in %s", name)
+	}
+	path[name] = true
+	defer delete(path, name)
+	node := &InventoryGraphNode{Name: name, Group: true}
+	for _, c := range children[name] {
+		child, err := buildGraphNode(c, children, hosts, path)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	for _, h := range hosts[name] {
+		node.Children = append(node.Children, &InventoryGraphNode{Name: h})
+	}
+	return node, nil
+}
+
+// ToTree returns the graph as the text tree of "ansible-inventory --graph",
+// with the group names prefixed with @.
+func (g *InventoryGraph) ToTree() []byte {
+	var b bytes.Buffer
+	var walk func(n *InventoryGraphNode, depth int)
+	walk = func(n *InventoryGraphNode, depth int) {
+		if depth > 0 {
+			b.WriteString(strings.Repeat("  |", depth) + "--")
+		}
+		if n.Group {
+			b.WriteString("@" + n.Name + ":\n")
+		} else {
+			b.WriteString(n.Name + "\n")
+		}
+		for _, c := range n.Children {
+			walk(c, depth+1)
+		}
+	}
+	walk(g.Root, 0)
+	return b.Bytes()
+}
+
+// ToDOT returns the graph in the Graphviz DOT language. The groups are
+// boxes and the hosts are ellipses. Each node appears once.
+func (g *InventoryGraph) ToDOT() []byte {
+	var b bytes.Buffer
+	b.WriteString("digraph inventory {\n")
+	b.WriteString("  rankdir=LR;\n")
+	nodes := make(map[string]bool)
+	id := func(n *InventoryGraphNode) string {
+		if n.Group {
+			return strconv.Quote("@" + n.Name)
+		}
+		return strconv.Quote(n.Name)
+	}
+	var walk func(n *InventoryGraphNode)
+	walk = func(n *InventoryGraphNode) {
+		if nodes[id(n)] {
+			return
+		}
+		nodes[id(n)] = true
+		shape := "ellipse"
+		if n.Group {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", id(n), strconv.Quote(n.Name), shape)
+		for _, c := range n.Children {
+			fmt.Fprintf(&b, "  %s -> %s;\n", id(n), id(c))
+			walk(c)
+		}
+	}
+	walk(g.Root)
+	b.WriteString("}\n")
+	return b.Bytes()
+}
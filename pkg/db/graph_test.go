@@ -0,0 +1,61 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInventoryGraph(t *testing.T) {
+	for i, test := range []struct {
+		input string
+		tree  string
+		dot   []string
+	}{
+		{
+			input: "local\n\n[web]\nweb01\nweb02\n\n[db]\ndb01\n",
+			tree:  "@all:\n  |--@db:\n  |  |--db01\n  |--@ungrouped:\n  |  |--local\n  |--@web:\n  |  |--web01\n  |  |--web02\n",
+			dot:   []string{`"@all" -> "@web";`, `"@web" -> "web01";`, `"local" [label="local", shape=ellipse];`},
+		},
+		{
+			input: "[a]\nh1\n\n[b]\nh2\n\n[c:children]\na\nb\n\n[d:children]\na\n",
+			tree:  "@all:\n  |--@c:\n  |  |--@a:\n  |  |  |--h1\n  |  |--@b:\n  |  |  |--h2\n  |--@d:\n  |  |--@a:\n  |  |  |--h1\n  |--@ungrouped:\n",
+			dot:   []string{`"@c" -> "@a";`, `"@d" -> "@a";`, `"@a" [label="a", shape=box];`},
+		},
+	} {
+		inv := NewInventory()
+		if err := inv.LoadFromBytes([]byte(test.input)); err != nil {
+			t.Fatalf("FAIL: Test %d, error loading inventory: %s", i, err)
+		}
+		graph, err := inv.ToGraph()
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error building graph: %s", i, err)
+		}
+		if tree := string(graph.ToTree()); tree != test.tree {
+			t.Fatalf("FAIL: Test %d, tree mismatch:\n%s(expected)\nvs.\n%s(received)", i, test.tree, tree)
+		}
+		dot := string(graph.ToDOT())
+		for _, s := range test.dot {
+			if !strings.Contains(dot, s) {
+				t.Fatalf("FAIL: Test %d, %q not found in:\n%s", i, s, dot)
+			}
+		}
+		if n := strings.Count(dot, `"@a" [label`); n > 1 {
+			t.Fatalf("FAIL: Test %d, node repeated %d times in:\n%s", i, n, dot)
+		}
+		t.Logf("PASS: Test %d, graph:\n%s", i, graph.ToTree())
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// localhostNames are the host names Ansible treats as the control node.
+var localhostNames = map[string]bool{
+	"localhost": true,
+	"127.0.0.1": true,
+	"::1":       true,
+}
+
+// newImplicitLocalhost returns the host Ansible creates when localhost is
+// referenced, but not defined in the inventory.
+func newImplicitLocalhost(s string) *InventoryHost {
+	return &InventoryHost{
+		Name:   s,
+		Parent: "all",
+		Variables: map[string]string{
+			"ansible_connection": "local",
+		},
+		Groups:      []string{},
+		GroupChains: []string{},
+		Implicit:    true,
+	}
+}
+
+// IsLocalhost returns true when the host is the Ansible control node, i.e.
+// localhost, 127.0.0.1, or ::1.
+func (h *InventoryHost) IsLocalhost() bool {
+	return localhostNames[h.Name]
+}
+
+// AnsibleConnection returns the connection type of the host. Unless
+// ansible_connection says otherwise, localhost uses the local connection
+// and the rest of the hosts use ssh.
+func (h *InventoryHost) AnsibleConnection() string {
+	if v, exists := h.Variables["ansible_connection"]; exists && v != "" {
+		return v
+	}
+	if h.IsLocalhost() {
+		return "local"
+	}
+	return "ssh"
+}
+
+// defaultAnsiblePort is the port of the hosts without the ansible_port
+// variable, i.e. the SSH port.
+const defaultAnsiblePort = 22
+
+// ansibleVariable returns the value of a connection variable, e.g.
+// ansible_host, or of its legacy ansible_ssh_* name. As with the ssh
+// connection plugin of Ansible, the legacy name takes precedence when both
+// are set. The empty values are ignored.
+func (h *InventoryHost) ansibleVariable(names ...string) (string, bool) {
+	if name := h.ansibleVariableName(names...); name != "" {
+		return h.Variables[name], true
+	}
+	return "", false
+}
+
+// ansibleVariableName returns the name of the connection variable
+// ansibleVariable takes the value from, if any.
+func (h *InventoryHost) ansibleVariableName(names ...string) string {
+	for i := len(names) - 1; i >= 0; i-- {
+		if v, exists := h.Variables[names[i]]; exists && v != "" {
+			return names[i]
+		}
+	}
+	return ""
+}
+
+// AnsibleHost returns the address Ansible connects to, i.e. the
+// ansible_host, or ansible_ssh_host, variable, or the name of the host.
+func (h *InventoryHost) AnsibleHost() string {
+	if v, ok := h.ansibleVariable("ansible_host", "ansible_ssh_host"); ok {
+		return v
+	}
+	return h.Name
+}
+
+// AnsiblePort returns the port Ansible connects to, i.e. the ansible_port,
+// or ansible_ssh_port, variable, or 22.
+func (h *InventoryHost) AnsiblePort() (int, error) {
+	v, ok := h.ansibleVariable("ansible_port", "ansible_ssh_port")
+	if !ok {
+		return defaultAnsiblePort, nil
+	}
+	port, err := strconv.Atoi(v)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("host %s: invalid port %q", h.Name, v)
+	}
+	return port, nil
+}
+
+// AnsibleUser returns the user Ansible logs in as, i.e. the ansible_user,
+// or ansible_ssh_user, variable. It is empty when neither is set, i.e.
+// Ansible uses the current user.
+func (h *InventoryHost) AnsibleUser() string {
+	v, _ := h.ansibleVariable("ansible_user", "ansible_ssh_user")
+	return v
+}
+
+// AnsiblePassword returns the password Ansible logs in with, i.e. the
+// ansible_password, ansible_ssh_pass, or ansible_ssh_password variable.
+func (h *InventoryHost) AnsiblePassword() string {
+	v, _ := h.ansibleVariable("ansible_password", "ansible_ssh_pass", "ansible_ssh_password")
+	return v
+}
+
+// AnsiblePrivateKeyFile returns the SSH private key file Ansible logs in
+// with, i.e. the ansible_private_key_file, or
+// ansible_ssh_private_key_file, variable.
+func (h *InventoryHost) AnsiblePrivateKeyFile() string {
+	v, _ := h.ansibleVariable("ansible_private_key_file", "ansible_ssh_private_key_file")
+	return v
+}
+
+// IsLocal returns true when the host is managed via the local connection.
+func (h *InventoryHost) IsLocal() bool {
+	return h.AnsibleConnection() == "local"
+}
+
+// memberOf returns true when the host is a member of a group, directly or
+// via the group's descendants.
+func (h *InventoryHost) memberOf(group string) bool {
+	for _, g := range h.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"testing"
+)
+
+func TestAnsibleConnectionVariables(t *testing.T) {
+	for i, test := range []struct {
+		name       string
+		vars       map[string]string
+		host       string
+		port       int
+		user       string
+		password   string
+		keyFile    string
+		connection string
+		shouldErr  bool
+	}{
+		{name: "ny-sw01", host: "ny-sw01", port: 22, connection: "ssh"},
+		{name: "localhost", host: "localhost", port: 22, connection: "local"},
+		{
+			name: "ny-sw02",
+			vars: map[string]string{
+				"ansible_host": "192.0.2.2", "ansible_port": "2222", "ansible_user": "admin",
+				"ansible_password": "s3cret", "ansible_private_key_file": "~/.ssh/id_ed25519",
+				"ansible_connection": "network_cli",
+			},
+			host: "192.0.2.2", port: 2222, user: "admin", password: "s3cret", keyFile: "~/.ssh/id_ed25519", connection: "network_cli",
+		},
+		{
+			name: "ny-sw03",
+			vars: map[string]string{
+				"ansible_ssh_host": "192.0.2.3", "ansible_ssh_port": "8022", "ansible_ssh_user": "legacy",
+				"ansible_ssh_pass": "0ld", "ansible_ssh_private_key_file": "id_rsa",
+			},
+			host: "192.0.2.3", port: 8022, user: "legacy", password: "0ld", keyFile: "id_rsa", connection: "ssh",
+		},
+		{
+			name: "ny-sw04",
+			vars: map[string]string{
+				"ansible_host": "192.0.2.4", "ansible_ssh_host": "198.51.100.4",
+				"ansible_user": "admin", "ansible_ssh_user": "",
+				"ansible_password": "s3cret", "ansible_ssh_password": "n3w",
+			},
+			host: "198.51.100.4", port: 22, user: "admin", password: "n3w", connection: "ssh",
+		},
+		{name: "ny-sw05", vars: map[string]string{"ansible_port": "ssh"}, shouldErr: true},
+		{name: "ny-sw06", vars: map[string]string{"ansible_ssh_port": "70000"}, shouldErr: true},
+	} {
+		h := &InventoryHost{Name: test.name, Variables: test.vars}
+		port, err := h.AnsiblePort()
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, host %s: expected error, but passed", i, test.name)
+			}
+			t.Logf("PASS: Test %d, host %s: error: %s", i, test.name, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, host %s: unexpected error: %s", i, test.name, err)
+		}
+		got := []interface{}{h.AnsibleHost(), port, h.AnsibleUser(), h.AnsiblePassword(), h.AnsiblePrivateKeyFile(), h.AnsibleConnection()}
+		expected := []interface{}{test.host, test.port, test.user, test.password, test.keyFile, test.connection}
+		for j := range expected {
+			if got[j] != expected[j] {
+				t.Fatalf("FAIL: Test %d, host %s: mismatch: %v (expected) vs. %v (received)", i, test.name, expected, got)
+			}
+		}
+		t.Logf("PASS: Test %d, host %s: %v", i, test.name, got)
+	}
+}
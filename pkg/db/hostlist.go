@@ -0,0 +1,69 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IsHostList returns true when an inventory argument is a comma-separated
+// list of hosts, e.g. "host1,host2" or "host1,", rather than a file path.
+// This mirrors the behavior of the Ansible host_list inventory plugin.
+func IsHostList(s string) bool {
+	if !strings.Contains(s, ",") {
+		return false
+	}
+	if _, err := os.Stat(expandFilePath(s)); err == nil {
+		return false
+	}
+	return true
+}
+
+// LoadFromHostList loads an ad-hoc inventory from a comma-separated list of
+// hosts. A host may have a port, e.g. "host1:2222" or "[2001:db8::1]:2222".
+// The hosts are members of the "ungrouped" group.
+func (inv *Inventory) LoadFromHostList(s string) error {
+	if err := inv.parseHostList(s); err != nil {
+		return err
+	}
+	return inv.finalize()
+}
+
+func (inv *Inventory) parseHostList(s string) error {
+	var count int
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.ContainsAny(entry, " \t=") {
+			return fmt.Errorf("invalid host list entry: %s", entry)
+		}
+		if !strings.HasPrefix(entry, "[") && strings.Count(entry, ":") == 1 {
+			i := strings.Index(entry, ":")
+			entry = entry[:i] + " ansible_port=" + entry[i+1:]
+		}
+		if err := inv.AddHost(entry, "all"); err != nil {
+			return err
+		}
+		count++
+	}
+	if count == 0 {
+		return fmt.Errorf("host list has no hosts: %s", s)
+	}
+	return nil
+}
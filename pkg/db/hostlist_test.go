@@ -0,0 +1,68 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"testing"
+)
+
+func TestLoadFromHostList(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		isList    bool
+		hosts     []string
+		port      string
+		shouldErr bool
+	}{
+		{input: "ny-sw01,ny-sw02", isList: true, hosts: []string{"ny-sw01", "ny-sw02"}},
+		{input: "ny-sw01,", isList: true, hosts: []string{"ny-sw01"}},
+		{input: "ny-sw01:2222, 10.0.0.1", isList: true, hosts: []string{"ny-sw01", "10.0.0.1"}, port: "2222"},
+		{input: "[2001:db8::1]:2222,2001:db8::2", isList: true, hosts: []string{"2001:db8::1", "2001:db8::2"}, port: "2222"},
+		{input: ",", isList: true, shouldErr: true},
+		{input: "../../testdata/inventory/hosts", isList: false},
+	} {
+		if IsHostList(test.input) != test.isList {
+			t.Fatalf("FAIL: Test %d, IsHostList(%s) mismatch: %t (expected)", i, test.input, test.isList)
+		}
+		if !test.isList {
+			t.Logf("PASS: Test %d, %s is not a host list", i, test.input)
+			continue
+		}
+		inv := NewInventory()
+		err := inv.LoadFromHostList(test.input)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error for %s", i, test.input)
+			}
+			t.Logf("PASS: Test %d, %s: %s", i, test.input, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error loading %s: %s", i, test.input, err)
+		}
+		if int(inv.Size()) != len(test.hosts) {
+			t.Fatalf("FAIL: Test %d, size mismatch: %d (expected) vs. %d (received)", i, len(test.hosts), inv.Size())
+		}
+		for _, name := range test.hosts {
+			if _, err := inv.GetHost(name); err != nil {
+				t.Fatalf("FAIL: Test %d, %s", i, err)
+			}
+		}
+		if test.port != "" && inv.Hosts[0].Variables["ansible_port"] != test.port {
+			t.Fatalf("FAIL: Test %d, port mismatch: %s (expected) vs. %s (received)", i, test.port, inv.Hosts[0].Variables["ansible_port"])
+		}
+		t.Logf("PASS: Test %d, %s: %v", i, test.input, test.hosts)
+	}
+}
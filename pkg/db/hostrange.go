@@ -0,0 +1,129 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hostRangePattern matches the first range of a host pattern, i.e.
+// [start:end] or [start:end:stride].
+var hostRangePattern = regexp.MustCompile(`\[([0-9]*|[a-zA-Z]):([0-9]+|[a-zA-Z])(?::([0-9]+))?\]`)
+
+// isHostRange returns true when the host name contains a range, e.g.
+// web[01:50].example.com or db-[a:f].prod.
+func isHostRange(s string) bool {
+	return hostRangePattern.MatchString(s)
+}
+
+// expandHostRange expands the numeric and alphabetic ranges of a host
+// pattern the way Ansible does, e.g. node[01:03] becomes node01, node02,
+// and node03. The leading zeros of a numeric range are preserved, and an
+// optional stride selects every n-th item, e.g. [1:9:2]. A pattern with
+// several ranges expands to every combination of them. When max is
+// positive, a pattern expanding to more hosts fails with a LimitError
+// before the hosts are generated.
+func expandHostRange(s string, max int) ([]string, error) {
+	loc := hostRangePattern.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return []string{s}, nil
+	}
+	head, tail := s[:loc[0]], s[loc[1]:]
+	start, end := s[loc[2]:loc[3]], s[loc[4]:loc[5]]
+	stride := 1
+	if loc[6] >= 0 {
+		n, err := strconv.Atoi(s[loc[6]:loc[7]])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("host range %s has invalid stride", s[loc[0]:loc[1]])
+		}
+		stride = n
+	}
+	items, err := hostRangeItems(start, end, stride, max)
+	if err != nil {
+		return nil, fmt.Errorf("host range %s: %w", s[loc[0]:loc[1]], err)
+	}
+	tails, err := expandHostRange(tail, max)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimit(LimitHosts, int64(len(items))*int64(len(tails)), int64(max)); err != nil {
+		return nil, err
+	}
+	var hosts []string
+	for _, item := range items {
+		for _, t := range tails {
+			hosts = append(hosts, head+item+t)
+		}
+	}
+	return hosts, nil
+}
+
+// hostRangeItems returns the items of a single range.
+func hostRangeItems(start, end string, stride, max int) ([]string, error) {
+	var items []string
+	if isLetter(end) {
+		if !isLetter(start) {
+			return nil, fmt.Errorf("mixed numeric and alphabetic bounds")
+		}
+		if start[0] > end[0] {
+			return nil, fmt.Errorf("start is greater than end")
+		}
+		for c := start[0]; c <= end[0]; c += byte(stride) {
+			items = append(items, string(c))
+			if int(c)+stride > 255 {
+				break
+			}
+		}
+		return items, nil
+	}
+	if isLetter(start) {
+		return nil, fmt.Errorf("mixed numeric and alphabetic bounds")
+	}
+	if start == "" {
+		start = "0"
+	}
+	width := 0
+	if len(start) > 1 && strings.HasPrefix(start, "0") {
+		if len(start) != len(end) {
+			return nil, fmt.Errorf("zero-padded start and end must have equal length")
+		}
+		width = len(start)
+	}
+	from, err := strconv.Atoi(start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := strconv.Atoi(end)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("start is greater than end")
+	}
+	if err := checkLimit(LimitHosts, int64((to-from)/stride+1), int64(max)); err != nil {
+		return nil, err
+	}
+	for i := from; i <= to; i += stride {
+		items = append(items, fmt.Sprintf("%0*d", width, i))
+	}
+	return items, nil
+}
+
+func isLetter(s string) bool {
+	return len(s) == 1 && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
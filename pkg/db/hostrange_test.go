@@ -0,0 +1,102 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandHostRange(t *testing.T) {
+	for i, test := range []struct {
+		pattern   string
+		hosts     []string
+		shouldErr bool
+	}{
+		{pattern: "web01", hosts: []string{"web01"}},
+		{pattern: "node[01:03]", hosts: []string{"node01", "node02", "node03"}},
+		{pattern: "node[8:10]", hosts: []string{"node8", "node9", "node10"}},
+		{pattern: "node[:2]", hosts: []string{"node0", "node1", "node2"}},
+		{pattern: "web[001:009:4].example.com", hosts: []string{"web001.example.com", "web005.example.com", "web009.example.com"}},
+		{pattern: "db-[a:c].prod", hosts: []string{"db-a.prod", "db-b.prod", "db-c.prod"}},
+		{pattern: "rack[1:2]-[a:b]", hosts: []string{"rack1-a", "rack1-b", "rack2-a", "rack2-b"}},
+		{pattern: "node[3:1]", shouldErr: true},
+		{pattern: "node[01:100]", shouldErr: true},
+		{pattern: "node[1:c]", shouldErr: true},
+		{pattern: "node[1:3:0]", shouldErr: true},
+	} {
+		hosts, err := expandHostRange(test.pattern, 0)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error for %s, but passed: %v", i, test.pattern, hosts)
+			}
+			t.Logf("PASS: Test %d, %s: error: %s", i, test.pattern, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error for %s: %s", i, test.pattern, err)
+		}
+		if strings.Join(hosts, ",") != strings.Join(test.hosts, ",") {
+			t.Fatalf("FAIL: Test %d, %s expansion mismatch: %v (expected) vs. %v (received)", i, test.pattern, test.hosts, hosts)
+		}
+		t.Logf("PASS: Test %d, %s: %v", i, test.pattern, hosts)
+	}
+}
+
+func TestLoadHostRanges(t *testing.T) {
+	b := []byte(`[web]
+web[01:20].example.com http_port=80
+web05.example.com http_port=8080
+
+[db]
+db-[a:c].prod ansible_user=postgres
+
+[v6]
+[2001:db8::1]:2222
+`)
+	inv := NewInventory()
+	if err := inv.LoadFromBytes(b); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if inv.Size() != 24 {
+		t.Fatalf("inventory size mismatch: 24 (expected) vs. %d (received)", inv.Size())
+	}
+	for i, test := range []struct {
+		host  string
+		key   string
+		value string
+	}{
+		{host: "web01.example.com", key: "http_port", value: "80"},
+		{host: "web05.example.com", key: "http_port", value: "8080"},
+		{host: "web20.example.com", key: "http_port", value: "80"},
+		{host: "db-b.prod", key: "ansible_user", value: "postgres"},
+		{host: "2001:db8::1", key: "ansible_port", value: "2222"},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s: %s", i, test.host, err)
+		}
+		if h.Variables[test.key] != test.value {
+			t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)", i, test.host, test.key, test.value, h.Variables[test.key])
+		}
+		t.Logf("PASS: Test %d, host %s, %s=%s", i, test.host, test.key, test.value)
+	}
+
+	inv = NewInventory(WithMaxHosts(10))
+	err := inv.LoadFromBytes([]byte("[web]\nweb[0:999999999]\n"))
+	if _, ok := IsLimitError(err); !ok {
+		t.Fatalf("expected a host limit error, received: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+// The hosts and the groups are indexed by name for constant time lookups.
+// The index is built lazily, and rebuilt when it misses an entry, e.g. a
+// host appended to Hosts directly, rather than with AddHost.
+
+// lookupHost returns the host with the provided name, or nil.
+func (inv *Inventory) lookupHost(s string) *InventoryHost {
+	inv.indexMu.Lock()
+	defer inv.indexMu.Unlock()
+	if h := inv.hostIndex[s]; h != nil && h.Name == s {
+		return h
+	}
+	inv.rebuildIndex()
+	return inv.hostIndex[s]
+}
+
+// lookupGroup returns the group with the provided name, or nil.
+func (inv *Inventory) lookupGroup(s string) *InventoryGroup {
+	inv.indexMu.Lock()
+	defer inv.indexMu.Unlock()
+	if g := inv.groupIndex[s]; g != nil && g.Name == s {
+		return g
+	}
+	inv.rebuildIndex()
+	return inv.groupIndex[s]
+}
+
+// indexHost adds a host to the index, unless the index is yet to be built.
+func (inv *Inventory) indexHost(h *InventoryHost) {
+	inv.indexMu.Lock()
+	defer inv.indexMu.Unlock()
+	if inv.hostIndex != nil {
+		inv.hostIndex[h.Name] = h
+	}
+}
+
+// indexGroup adds a group to the index, unless the index is yet to be
+// built.
+func (inv *Inventory) indexGroup(g *InventoryGroup) {
+	inv.indexMu.Lock()
+	defer inv.indexMu.Unlock()
+	if inv.groupIndex != nil {
+		inv.groupIndex[g.Name] = g
+	}
+}
+
+// resetIndex discards the index, e.g. after Hosts or Groups were replaced,
+// and the group memberships computed from Groups.
+func (inv *Inventory) resetIndex() {
+	inv.indexMu.Lock()
+	inv.hostIndex = nil
+	inv.groupIndex = nil
+	inv.indexMu.Unlock()
+	inv.resetMemberships()
+}
+
+// rebuildIndex indexes the hosts and the groups. The first of the entries
+// sharing a name wins, the way the linear search would. The caller holds
+// indexMu.
+func (inv *Inventory) rebuildIndex() {
+	inv.hostIndex = make(map[string]*InventoryHost, len(inv.Hosts))
+	for _, h := range inv.Hosts {
+		if _, exists := inv.hostIndex[h.Name]; !exists {
+			inv.hostIndex[h.Name] = h
+		}
+	}
+	inv.groupIndex = make(map[string]*InventoryGroup, len(inv.Groups))
+	for _, g := range inv.Groups {
+		if _, exists := inv.groupIndex[g.Name]; !exists {
+			inv.groupIndex[g.Name] = g
+		}
+	}
+}
+
+// existingGroup returns the group with the provided name, or nil when the
+// group does not exist, without rebuilding the index.
+func (inv *Inventory) existingGroup(s string) *InventoryGroup {
+	if !inv.GroupsRef[s] {
+		return nil
+	}
+	return inv.lookupGroup(s)
+}
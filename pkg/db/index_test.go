@@ -0,0 +1,129 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func newIndexTestInventory(tb testing.TB, hosts, groups int) *Inventory {
+	inv := NewInventory()
+	for i := 0; i < groups; i++ {
+		if err := inv.AddGroup(fmt.Sprintf("group%d", i), "all"); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	for i := 0; i < hosts; i++ {
+		if err := inv.AddHost(fmt.Sprintf("host%d", i), fmt.Sprintf("group%d", i%groups)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return inv
+}
+
+func TestInventoryIndex(t *testing.T) {
+	inv := newIndexTestInventory(t, 100, 10)
+	for i, name := range []string{"host0", "host50", "host99"} {
+		h, err := inv.GetHost(name)
+		if err != nil || h.Name != name {
+			t.Fatalf("FAIL: Test %d, unexpected host %s: %v, %v", i, name, h, err)
+		}
+		t.Logf("PASS: Test %d, host %s", i, name)
+	}
+
+	// the hosts appended directly are found, too
+	h := &InventoryHost{Name: "direct", Parent: "group0", Variables: map[string]string{}}
+	inv.Hosts = append(inv.Hosts, h)
+	inv.HostsRef[h.Name] = h.Parent
+	if found, err := inv.GetHost("direct"); err != nil || found != h {
+		t.Fatalf("expected the host appended directly to be found: %v, %v", found, err)
+	}
+
+	// the removed hosts are not found
+	if _, err := inv.AddEphemeralHost("ephemeral", []string{"group1"}, nil); err != nil {
+		t.Fatalf("error adding ephemeral host: %s", err)
+	}
+	if _, err := inv.GetHost("ephemeral"); err != nil {
+		t.Fatalf("expected the ephemeral host to be found: %s", err)
+	}
+	inv.RemoveEphemeral()
+	if _, err := inv.GetHost("ephemeral"); err == nil {
+		t.Fatalf("expected the removed ephemeral host not to be found")
+	}
+
+	// the decoded hosts replace the indexed ones
+	var buf bytes.Buffer
+	if err := newIndexTestInventory(t, 5, 1).Encode(&buf); err != nil {
+		t.Fatalf("error encoding inventory: %s", err)
+	}
+	if err := inv.Decode(&buf); err != nil {
+		t.Fatalf("error decoding inventory: %s", err)
+	}
+	found, err := inv.GetHost("host1")
+	if err != nil || found != inv.Hosts[1] {
+		t.Fatalf("expected the decoded host to be found: %v, %v", found, err)
+	}
+	if _, err := inv.GetGroup("group5"); err == nil {
+		t.Fatalf("expected the replaced group not to be found")
+	}
+}
+
+func BenchmarkGetHost(b *testing.B) {
+	inv := newIndexTestInventory(b, 40000, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := inv.GetHost(fmt.Sprintf("host%d", (i*7919)%40000)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetHostLinearScan is the baseline of BenchmarkGetHost, i.e. the
+// lookup without the index.
+func BenchmarkGetHostLinearScan(b *testing.B) {
+	inv := newIndexTestInventory(b, 40000, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		name := fmt.Sprintf("host%d", (i*7919)%40000)
+		var found *InventoryHost
+		for _, h := range inv.Hosts {
+			if h.Name == name {
+				found = h
+				break
+			}
+		}
+		if found == nil {
+			b.Fatalf("host %s not found", name)
+		}
+	}
+}
+
+func BenchmarkGetGroup(b *testing.B) {
+	inv := newIndexTestInventory(b, 40000, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := inv.GetGroup(fmt.Sprintf("group%d", (i*7919)%1000)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAddHost(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		newIndexTestInventory(b, 40000, 100)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ToINI returns the Inventory in the INI format, i.e. the hosts of the
+// "ungrouped" group first, followed by the [group], [group:children], and [group:vars]
+// sections of every group, in the order the groups were added. A host line
+// holds the variables of the host only, not the ones it inherits from its
+// groups. A host of several groups, see ExtraParents, is listed in each
+// of them, with its variables in the section of its parent group, the way
+// Ansible reads it. The ephemeral hosts and groups are omitted. The output
+// of an Inventory without such hosts loads back with LoadFromBytes into an
+// equivalent Inventory.
+func (inv *Inventory) ToINI() ([]byte, error) {
+	children := make(map[string][]string)
+	for _, g := range inv.Groups {
+		if g.Ephemeral {
+			continue
+		}
+		for _, a := range g.Ancestors {
+			if a != "all" {
+				children[a] = append(children[a], g.Name)
+			}
+		}
+	}
+	hosts := make(map[string][]*InventoryHost)
+	for _, h := range inv.Hosts {
+		if h.Ephemeral {
+			continue
+		}
+		hosts[h.Parent] = append(hosts[h.Parent], h)
+		for _, p := range h.ExtraParents {
+			hosts[p] = append(hosts[p], &InventoryHost{Name: h.Name})
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, h := range hosts["ungrouped"] {
+		line, err := iniHostLine(h)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(line + "\n")
+	}
+	for _, g := range inv.Groups {
+		if g.Ephemeral || g.Name == "all" {
+			continue
+		}
+		if g.Name == "ungrouped" && len(children[g.Name]) == 0 {
+			// The hosts of the implicit group come first, without a section.
+			if err := writeINIGroupVars(&buf, g); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "[%s]\n", g.Name)
+		for _, h := range hosts[g.Name] {
+			line, err := iniHostLine(h)
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString(line + "\n")
+		}
+		if len(children[g.Name]) > 0 {
+			fmt.Fprintf(&buf, "\n[%s:children]\n", g.Name)
+			for _, c := range children[g.Name] {
+				buf.WriteString(c + "\n")
+			}
+		}
+		if err := writeINIGroupVars(&buf, g); err != nil {
+			return nil, err
+		}
+	}
+	if group, err := inv.GetGroup("all"); err == nil {
+		if err := writeINIGroupVars(&buf, group); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteToFile writes the Inventory to a file in the INI format, see ToINI.
+// The file is replaced atomically and is compressed when it has the .gz or
+// .zst extension.
+func (inv *Inventory) WriteToFile(fp string) error {
+	fp = expandFilePath(fp)
+	b, err := inv.ToINI()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomicCompressed(fp, b, 0644); err != nil {
+		return fmt.Errorf("failed writing inventory: %s", err)
+	}
+	return nil
+}
+
+// iniHostLine returns the line of a host, with the variables the host
+// defines sorted by name.
+func iniHostLine(h *InventoryHost) (string, error) {
+	name := h.Name
+	if strings.Contains(name, ":") && net.ParseIP(name) != nil {
+		name = "[" + name + "]"
+	}
+	var keys []string
+	for k := range h.Variables {
+		if IsInheritedSource(h.VariableSources[k]) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs, err := iniKeyValuePairs(h.Variables, keys)
+	if err != nil {
+		return "", fmt.Errorf("host %s: %s", h.Name, err)
+	}
+	if len(pairs) == 0 {
+		return name, nil
+	}
+	return name + " " + strings.Join(pairs, " "), nil
+}
+
+// writeINIGroupVars writes the [group:vars] section of a group, unless the
+// group has no variables.
+func writeINIGroupVars(buf *bytes.Buffer, g *InventoryGroup) error {
+	if len(g.Variables) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(g.Variables))
+	for k := range g.Variables {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs, err := iniKeyValuePairs(g.Variables, keys)
+	if err != nil {
+		return fmt.Errorf("group %s: %s", g.Name, err)
+	}
+	if buf.Len() > 0 {
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(buf, "[%s:vars]\n", g.Name)
+	for _, p := range pairs {
+		buf.WriteString(p + "\n")
+	}
+	return nil
+}
+
+// iniKeyValuePairs returns the key=value pairs of the provided variables.
+// A value, which would not parse back as is, e.g. it has a space followed
+// by an equal sign, is quoted. A value with a line break is an error.
+func iniKeyValuePairs(m map[string]string, keys []string) ([]string, error) {
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if strings.ContainsAny(m[k], "\r\n") {
+			return nil, fmt.Errorf("variable %s cannot be represented in INI format: %q", k, m[k])
+		}
+		pair := k + "=" + m[k]
+		if kv, err := getKeyValuePairs(pair); err != nil || len(kv) != 1 || kv[k] != m[k] {
+			r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+			pair = k + `="` + r.Replace(m[k]) + `"`
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// IsInheritedSource returns true when the source of a host variable, see
+// InventoryHost.VariableSource, is a group, i.e. the host inherits the
+// variable.
+func IsInheritedSource(s string) bool {
+	return strings.HasPrefix(s, "group ") || strings.HasPrefix(s, "group_vars ")
+}
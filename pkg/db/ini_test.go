@@ -0,0 +1,153 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToINI(t *testing.T) {
+	inv := NewInventory()
+	for i, fn := range []func() error{
+		func() error { return inv.AddHost("controller ansible_connection=local", "all") },
+		func() error { return inv.AddGroup("web", "all") },
+		func() error { return inv.AddGroup("prod", "all") },
+		func() error { return inv.AddGroup("web", "prod") },
+		func() error { return inv.AddHost("web01 http_port=80", "web") },
+		func() error { return inv.AddHost("web02", "web") },
+		func() error { return inv.AddHost("[2001:db8::1]:2222", "web") },
+		func() error { return inv.AddVariable("env=prod", "prod") },
+		func() error { return inv.AddVariable("owner=Paul Greenberg", "all") },
+	} {
+		if err := fn(); err != nil {
+			t.Fatalf("FAIL: Test %d, error building inventory: %s", i, err)
+		}
+	}
+	if _, err := inv.AddEphemeralHost("web09", []string{"web"}, nil); err != nil {
+		t.Fatalf("error adding ephemeral host: %s", err)
+	}
+	expected := `controller ansible_connection=local
+
+[web]
+web01 http_port=80
+web02
+[2001:db8::1] ansible_port=2222
+
+[prod]
+
+[prod:children]
+web
+
+[prod:vars]
+env=prod
+
+[all:vars]
+owner=Paul Greenberg
+`
+	b, err := inv.ToINI()
+	if err != nil {
+		t.Fatalf("error writing inventory: %s", err)
+	}
+	if string(b) != expected {
+		t.Fatalf("INI mismatch:\n%s\n(expected) vs.\n%s\n(received)", expected, b)
+	}
+
+	inv.Hosts[0].Variables["motd"] = `say "hi" a=b`
+	b, err = inv.ToINI()
+	if err != nil {
+		t.Fatalf("error writing inventory: %s", err)
+	}
+	if !strings.HasPrefix(string(b), `controller ansible_connection=local motd="say \"hi\" a=b"`+"\n") {
+		t.Fatalf("expected quoted value, received:\n%s", b)
+	}
+	inv.Hosts[0].Variables["motd"] = "hello\nworld"
+	if _, err := inv.ToINI(); err == nil {
+		t.Fatalf("expected writing a value with a line break to fail, but passed")
+	}
+
+	// A host of several groups is listed in each of them.
+	inv = NewInventory()
+	if err := inv.LoadFromBytes([]byte("[web]\nweb01 http_port=80\n[db]\ndb01\n")); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if err := inv.AddHostToGroup("web01", "db"); err != nil {
+		t.Fatalf("error adding host to group: %s", err)
+	}
+	b, err = inv.ToINI()
+	if err != nil {
+		t.Fatalf("error writing inventory: %s", err)
+	}
+	expected = "[web]\nweb01 http_port=80\n\n[db]\nweb01\ndb01\n"
+	if string(b) != expected {
+		t.Fatalf("INI mismatch:\n%s\n(expected) vs.\n%s\n(received)", expected, b)
+	}
+}
+
+func TestWriteToFile(t *testing.T) {
+	for i, test := range []struct {
+		fp    string
+		name  string
+		magic []byte
+	}{
+		{fp: "../../testdata/inventory/hosts", name: "hosts"},
+		{fp: "../../testdata/inventory/hosts2", name: "hosts"},
+		{fp: "../../testdata/inventory/hosts", name: "hosts.gz", magic: gzipMagic},
+		{fp: "../../testdata/inventory/hosts2", name: "hosts.zst", magic: zstdMagic},
+	} {
+		fp := test.fp
+		inv := NewInventory()
+		if err := inv.LoadFromFile(fp); err != nil {
+			t.Fatalf("FAIL: Test %d, error loading %s: %s", i, fp, err)
+		}
+		out := filepath.Join(t.TempDir(), test.name)
+		if err := inv.WriteToFile(out); err != nil {
+			t.Fatalf("FAIL: Test %d, error writing %s: %s", i, out, err)
+		}
+		if test.magic != nil {
+			b, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, error reading %s: %s", i, out, err)
+			}
+			if !bytes.HasPrefix(b, test.magic) {
+				t.Fatalf("FAIL: Test %d, %s is not compressed", i, out)
+			}
+		}
+		loaded := NewInventory()
+		if err := loaded.LoadFromFile(out); err != nil {
+			t.Fatalf("FAIL: Test %d, error loading %s: %s", i, out, err)
+		}
+		if loaded.Size() != inv.Size() {
+			t.Fatalf("FAIL: Test %d, inventory size mismatch: %d (expected) vs. %d (received)", i, inv.Size(), loaded.Size())
+		}
+		for _, h := range inv.Hosts {
+			lh, err := loaded.GetHost(h.Name)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, %s", i, err)
+			}
+			if !reflect.DeepEqual(lh.Variables, h.Variables) {
+				t.Fatalf("FAIL: Test %d, host %s variables mismatch: %v (expected) vs. %v (received)", i, h.Name, h.Variables, lh.Variables)
+			}
+			if !reflect.DeepEqual(lh.GroupChains, h.GroupChains) {
+				t.Fatalf("FAIL: Test %d, host %s group chains mismatch: %v (expected) vs. %v (received)", i, h.Name, h.GroupChains, lh.GroupChains)
+			}
+		}
+		t.Logf("PASS: Test %d, %s round-trips through %s", i, fp, out)
+	}
+}
@@ -15,21 +15,59 @@
 package db
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"fmt"
+	"io"
 	//"github.com/davecgh/go-spew/spew"
-	"io/ioutil"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 )
 
 // Inventory is the contents of Ansible inventory file.
 type Inventory struct {
+	// Raw is the inventory data last loaded, when the Inventory is created
+	// with WithRawData.
 	Raw       []byte
 	HostsRef  map[string]string `json:"host_refs,omitempty" yaml:"host_refs,omitempty"`
 	GroupsRef map[string]bool   `json:"group_refs,omitempty" yaml:"group_refs,omitempty"`
 	Hosts     []*InventoryHost  `json:"hosts,omitempty" yaml:"hosts,omitempty"`
 	Groups    []*InventoryGroup `json:"groups,omitempty" yaml:"groups,omitempty"`
+
+	preserveTemplates bool
+	strict            bool
+	keepRaw           bool
+	foldHostnames     bool
+	maxFileSize       int64
+	maxHosts          int
+	maxGroupDepth     int
+	cacheFile         string
+	logger            Logger
+	vault             *Vault
+	verifyKey         ed25519.PublicKey
+	source            string
+	dryRun            bool
+	lazy              bool
+
+	lifecycleMu sync.Mutex
+	closers     []io.Closer
+	closed      bool
+
+	indexMu    sync.Mutex
+	hostIndex  map[string]*InventoryHost
+	groupIndex map[string]*InventoryGroup
+
+	// hostSources holds the source defining each host while the sources of
+	// LoadFromSources are parsed, see AddHost.
+	hostSources map[string]string
+
+	// resolveMu guards the resolution of the hosts and the memberships.
+	resolveMu   sync.Mutex
+	memberships map[string]*groupMembership
 }
 
 // InventoryHost is a host in Ansible inventory
@@ -39,14 +77,35 @@ type InventoryHost struct {
 	Variables   map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
 	Groups      []string          `json:"groups,omitempty" yaml:"groups,omitempty"`
 	GroupChains []string          `json:"group_chains,omitempty" yaml:"group_chains,omitempty"`
+	Implicit    bool              `json:"implicit,omitempty" yaml:"implicit,omitempty"`
+	Templated   map[string]bool   `json:"templated,omitempty" yaml:"templated,omitempty"`
+	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Ephemeral   bool              `json:"ephemeral,omitempty" yaml:"ephemeral,omitempty"`
+	// VariableSources holds where the value of each variable comes from,
+	// see VariableSource.
+	VariableSources map[string]string `json:"variable_sources,omitempty" yaml:"variable_sources,omitempty"`
+	// ExtraParents holds the other groups the host is a direct member of,
+	// when the inventory sources put it in several groups, see
+	// LoadFromSources.
+	ExtraParents []string `json:"extra_parent_groups,omitempty" yaml:"extra_parent_groups,omitempty"`
+	// unresolved is true until the group chains, the groups, and the
+	// inherited variables of the host are computed, see resolveHost.
+	unresolved bool
 }
 
 // InventoryGroup is an group of InventoryHost instances.
 type InventoryGroup struct {
-	Name      string                 `json:"name,omitempty" yaml:"name,omitempty"`
-	Ancestors []string               `json:"parent_groups,omitempty" yaml:"parent_groups,omitempty"`
+	Name      string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Ancestors []string `json:"parent_groups,omitempty" yaml:"parent_groups,omitempty"`
+	// Children holds the groups having the group as one of their parents.
+	Children  []string               `json:"child_groups,omitempty" yaml:"child_groups,omitempty"`
 	Variables map[string]string      `json:"variables,omitempty" yaml:"variables,omitempty"`
 	Counters  InventoryGroupCounters `json:"counters,omitempty" yaml:"counters,omitempty"`
+	Templated map[string]bool        `json:"templated,omitempty" yaml:"templated,omitempty"`
+	Ephemeral bool                   `json:"ephemeral,omitempty" yaml:"ephemeral,omitempty"`
+	// VariableSources holds where the value of each variable comes from.
+	VariableSources map[string]string `json:"variable_sources,omitempty" yaml:"variable_sources,omitempty"`
+	inventory       *Inventory
 }
 
 // InventoryGroupCounters are counters associated with InventoryGroup
@@ -56,7 +115,7 @@ type InventoryGroupCounters struct {
 }
 
 // NewInventory returns a pointer to Inventory.
-func NewInventory() *Inventory {
+func NewInventory(opts ...InventoryOption) *Inventory {
 	g := &InventoryGroup{
 		Name:      "all",
 		Variables: make(map[string]string),
@@ -65,9 +124,16 @@ func NewInventory() *Inventory {
 	inv := &Inventory{
 		HostsRef:  make(map[string]string),
 		GroupsRef: make(map[string]bool),
+		logger:    nopLogger{},
 	}
+	for _, opt := range opts {
+		opt(inv)
+	}
+	g.inventory = inv
 	inv.GroupsRef["all"] = true
 	inv.Groups = append(inv.Groups, g)
+	inv.hostIndex = make(map[string]*InventoryHost)
+	inv.groupIndex = map[string]*InventoryGroup{"all": g}
 	return inv
 }
 
@@ -77,91 +143,140 @@ func (inv *Inventory) Size() uint64 {
 }
 
 func (inv *Inventory) parseString(s string) error {
+	if err := inv.parseLines(s); err != nil {
+		return err
+	}
+	return inv.finalize()
+}
+
+// parseLines adds the hosts, groups, and variables found in the provided
+// inventory data to the Inventory.
+func (inv *Inventory) parseLines(s string) error {
+	p := newInventoryParser(inv)
+	for lc, line := range strings.Split(s, "\n") {
+		if err := p.parseLine(lc, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inventoryParser adds the lines of inventory data to an Inventory, one
+// at a time, keeping track of the section the lines belong to.
+type inventoryParser struct {
+	inv *Inventory
 	// Sections are default (0), group (1), children (2), and variables (3)
-	var sectionType int
-	groupName := "all"
-	lines := strings.Split(s, "\n")
-	for lc, line := range lines {
-		orig := line
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	sectionType int
+	groupName   string
+}
+
+func newInventoryParser(inv *Inventory) *inventoryParser {
+	return &inventoryParser{inv: inv, groupName: "all"}
+}
+
+// parseLine adds the host, group, or variables found in a line, the
+// zero-based number of which is lc, to the Inventory.
+func (p *inventoryParser) parseLine(lc int, orig string) error {
+	inv := p.inv
+	line := strings.TrimSpace(orig)
+	if line == "" {
+		return nil
+	}
+	if strings.HasPrefix(line, "#") {
+		return nil
+	}
+	if _, _, isHost := splitIPv6Literal(line); !isHost && strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+		line = strings.TrimRight(line, "]")
+		line = strings.TrimLeft(line, "[")
+		kv := strings.Split(line, ":")
+		if len(kv) > 2 {
+			return inv.newParseError(ErrInvalidSection, lc, orig, fmt.Errorf("invalid section: %s", strings.TrimSpace(orig)))
 		}
-		if strings.HasPrefix(line, "#") {
-			continue
+		p.groupName = kv[0]
+		if err := inv.AddGroup(p.groupName, "all"); err != nil {
+			return inv.newParseError(ErrInvalidGroup, lc, orig, err)
 		}
-		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			line = strings.TrimRight(line, "]")
-			line = strings.TrimLeft(line, "[")
-			kv := strings.Split(line, ":")
-			if len(kv) > 2 {
-				return fmt.Errorf("invalid section: %s", orig)
-			}
-			groupName = kv[0]
-			if err := inv.AddGroup(groupName, "all"); err != nil {
-				return fmt.Errorf("AddGroup() failed: %s, line: %d", err, lc)
-			}
-			if len(kv) == 1 {
-				sectionType = 1
-				continue
-			}
-			switch kv[1] {
-			case "children":
-				sectionType = 2
-			case "vars":
-				sectionType = 3
-			default:
-				return fmt.Errorf("invalid section: %s", orig)
-			}
-			continue
+		if len(kv) == 1 {
+			p.sectionType = 1
+			return nil
 		}
-
-		switch sectionType {
-		case 0:
-			// default, group all
-			if err := inv.AddHost(line, "all"); err != nil {
-				return fmt.Errorf("AddHost() failed: %s, line: %d", err, lc)
-			}
-		case 1:
-			// group section, contains individual hosts
-			if err := inv.AddHost(line, groupName); err != nil {
-				return fmt.Errorf("AddHost() failed: %s, line: %d", err, lc)
-			}
-		case 2:
-			// children section
-			if err := inv.AddGroup(line, groupName); err != nil {
-				return fmt.Errorf("AddGroup() failed: %s, line: %d", err, lc)
-			}
-		case 3:
-			// group variables
-			if err := inv.AddVariable(line, groupName); err != nil {
-				return fmt.Errorf("AddVariable() failed: %s, line: %d", err, lc)
-			}
+		switch kv[1] {
+		case "children":
+			p.sectionType = 2
+		case "vars":
+			p.sectionType = 3
 		default:
-			return fmt.Errorf("invalid section type: %d", sectionType)
+			return inv.newParseError(ErrInvalidSection, lc, orig, fmt.Errorf("invalid section: %s", strings.TrimSpace(orig)))
+		}
+		return nil
+	}
+
+	switch p.sectionType {
+	case 0:
+		// default, group all
+		if err := inv.AddHost(line, "all"); err != nil {
+			return inv.newParseError(ErrInvalidHost, lc, orig, err)
+		}
+	case 1:
+		// group section, contains individual hosts
+		if err := inv.AddHost(line, p.groupName); err != nil {
+			return inv.newParseError(ErrInvalidHost, lc, orig, err)
+		}
+	case 2:
+		// children section
+		if err := inv.AddGroup(line, p.groupName); err != nil {
+			return inv.newParseError(ErrInvalidGroup, lc, orig, err)
 		}
+	case 3:
+		// group variables
+		if err := inv.AddVariable(line, p.groupName); err != nil {
+			return inv.newParseError(ErrInvalidVariable, lc, orig, err)
+		}
+	default:
+		return fmt.Errorf("invalid section type: %d", p.sectionType)
 	}
+	return nil
+}
+
+// finalize computes the membership counters once all of the inventory data
+// has been parsed, and then the group chains and the inherited variables
+// of the hosts, unless they are computed on first use, see
+// WithLazyResolution.
+func (inv *Inventory) finalize() error {
+	return inv.finalizeContext(context.Background())
+}
 
+// finalizeContext is the finalize counterpart accepting a context for
+// cancellation.
+func (inv *Inventory) finalizeContext(ctx context.Context) error {
+	inv.linkChildGroups()
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
 	for _, h := range inv.Hosts {
-		groupChains, groups, err := inv.GetParentGroupChains(h.Parent)
+		m, err := inv.hostMembership(ctx, h)
 		if err != nil {
-			return fmt.Errorf("the search for parent group chains for host '%s' erred: %s", h.Name, err)
+			return fmt.Errorf("the search for parent group chains for host '%s' erred: %w", h.Name, err)
 		}
-		if len(groupChains) < 1 {
+		if len(m.chains) < 1 {
 			return fmt.Errorf("parent group for host '%s' not found", h.Name)
 		}
-		for _, g := range groups {
+		for _, g := range m.groups {
 			if err := inv.AddGroupMemberCounter("host", g); err != nil {
 				return fmt.Errorf("failed updating counters for the parent group '%s' of host '%s': %s", g, h.Name, err)
 			}
 		}
-		h.GroupChains = groupChains
-		h.Groups = groups
+		// The group chains, the groups, and the inherited variables are
+		// computed below, or when the host is first used, see
+		// resolveEagerlyLocked.
+		h.unresolved = true
 	}
 
 	for _, g := range inv.Groups {
-		if g.Counters.Hosts < 1 {
-			return fmt.Errorf("inventory group '%s' has no hosts", g.Name)
+		if g.Counters.Hosts < 1 && g.Name != "ungrouped" {
+			if inv.strict {
+				return errorWithCode(ErrEmptyGroup, "inventory group '%s' has no hosts", g.Name)
+			}
+			inv.logger.Warnf("inventory group '%s' has no hosts", g.Name)
 		}
 		for _, a := range g.Ancestors {
 			if err := inv.AddGroupMemberCounter("group", a); err != nil {
@@ -169,26 +284,76 @@ func (inv *Inventory) parseString(s string) error {
 			}
 		}
 	}
+	return inv.resolveEagerlyLocked()
+}
 
-	// inherit variables from parent groups
-	for _, h := range inv.Hosts {
-		m := make(map[string]string)
-		for _, g := range h.Groups {
-			group, err := inv.GetGroup(g)
-			if err != nil {
-				return err
+// addChildGroup adds a group to the children of its parent group, when the
+// parent exists. The children of the parents added later are linked by
+// linkChildGroups.
+func (inv *Inventory) addChildGroup(p, s string) {
+	pg := inv.existingGroup(p)
+	if pg == nil || stringInList(s, pg.Children) {
+		return
+	}
+	pg.Children = append(pg.Children, s)
+}
+
+// linkChildGroups computes the children of the groups from their parents,
+// e.g. after the groups were parsed, edited, or decoded.
+func (inv *Inventory) linkChildGroups() {
+	for _, g := range inv.Groups {
+		g.Children = nil
+	}
+	for _, g := range inv.Groups {
+		for _, a := range g.Ancestors {
+			if a == g.Name {
+				continue
 			}
-			for k, v := range group.Variables {
-				m[k] = v
+			if pg := inv.lookupGroup(a); pg != nil && !stringInList(g.Name, pg.Children) {
+				pg.Children = append(pg.Children, g.Name)
 			}
 		}
-		for k, v := range m {
-			if _, exists := h.Variables[k]; !exists {
-				h.Variables[k] = v
+	}
+}
+
+// inheritVariables adds the variables of the groups of a host, unless the
+// host defines them, and the tags they hold. When the groups define the
+// same variable, the value of the group with the highest precedence wins.
+func (inv *Inventory) inheritVariables(h *InventoryHost) error {
+	m := make(map[string]string)
+	mt := make(map[string]bool)
+	ms := make(map[string]string)
+	groups, err := inv.sortGroupsByPrecedence(h.Groups)
+	if err != nil {
+		return fmt.Errorf("failed ordering the groups of host '%s': %s", h.Name, err)
+	}
+	for _, g := range groups {
+		group, err := inv.GetGroup(g)
+		if err != nil {
+			return err
+		}
+		for k, v := range group.Variables {
+			m[k] = v
+			mt[k] = group.Templated[k]
+			ms[k] = group.VariableSource(k)
+		}
+	}
+	for k, v := range m {
+		if _, exists := h.Variables[k]; !exists {
+			h.Variables[k] = v
+			setVariableSource(&h.VariableSources, k, ms[k])
+			if !mt[k] {
+				continue
 			}
+			if h.Templated == nil {
+				h.Templated = make(map[string]bool)
+			}
+			h.Templated[k] = true
 		}
 	}
-
+	if v, exists := h.Variables[tagsVariable]; exists {
+		h.AddTag(parseTags(v)...)
+	}
 	return nil
 }
 
@@ -198,351 +363,652 @@ func (inv *Inventory) AddGroupMemberCounter(counterType, groupName string) error
 	if _, exists := inv.GroupsRef[groupName]; !exists {
 		return fmt.Errorf("group %s does not exist", groupName)
 	}
-	for _, g := range inv.Groups {
-		if g.Name == groupName {
-			if counterType == "host" {
-				atomic.AddUint64(&g.Counters.Hosts, 1)
-				return nil
-			}
-			atomic.AddUint64(&g.Counters.Groups, 1)
-			return nil
-		}
+	g := inv.lookupGroup(groupName)
+	if g == nil {
+		return fmt.Errorf("group %s was not found", groupName)
+	}
+	if counterType == "host" {
+		atomic.AddUint64(&g.Counters.Hosts, 1)
+		return nil
+	}
+	atomic.AddUint64(&g.Counters.Groups, 1)
+	return nil
+}
+
+// SetStrict controls whether parsing fails on inventory groups without
+// hosts, see WithStrictMode.
+func (inv *Inventory) SetStrict(enabled bool) {
+	inv.strict = enabled
+}
+
+// SetLogger sets the logger reporting the non-fatal events, e.g. the empty
+// groups or the overridden variables, see WithLogger. A nil logger
+// discards them.
+func (inv *Inventory) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	inv.logger = logger
+}
+
+// SetVault associates a Vault with the Inventory. The password of the vault
+// decrypts the inventory data stored in Ansible vault format.
+func (inv *Inventory) SetVault(v *Vault) {
+	inv.vault = v
+}
+
+// decryptSource returns the plaintext of the inventory data encrypted with
+// Ansible vault, and the data as is otherwise. Either is normalized to UTF-8
+// with LF line endings.
+func (inv *Inventory) decryptSource(b []byte) ([]byte, error) {
+	if err := checkLimit(LimitFileSize, int64(len(b)), inv.maxFileSize); err != nil {
+		return nil, err
+	}
+	b, err := normalizeText(b)
+	if err != nil {
+		return nil, err
+	}
+	if !isVaultData(b) {
+		return b, nil
+	}
+	if inv.vault == nil {
+		return nil, fmt.Errorf("inventory is vault-encrypted, but no vault is associated with the inventory")
+	}
+	plaintext, err := inv.vault.decryptBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed decrypting inventory: %w", err)
 	}
-	return fmt.Errorf("group %s was not found", groupName)
+	return normalizeText(plaintext)
 }
 
-// LoadFromBytes loads inventory data from an array of bytes.
+// LoadFromBytes loads inventory data from an array of bytes. The Inventory
+// with a signature verification key loads signed data only, see
+// LoadFromSignedBytes.
 func (inv *Inventory) LoadFromBytes(b []byte) error {
+	if err := inv.checkUnsigned(); err != nil {
+		return err
+	}
+	return inv.loadBytes(b)
+}
+
+func (inv *Inventory) loadBytes(b []byte) error {
+	inv.setRaw(b)
+	b, err := inv.decryptSource(b)
+	if err != nil {
+		return err
+	}
 	s := string(b[:])
 	return inv.parseString(s)
 }
 
-// LoadFromFile loads inventory data from a file.
+// LoadFromBytesContext is the LoadFromBytes counterpart accepting a context
+// for cancellation, e.g. a deadline for parsing untrusted input.
+func (inv *Inventory) LoadFromBytesContext(ctx context.Context, b []byte) error {
+	if err := inv.checkUnsigned(); err != nil {
+		return err
+	}
+	inv.setRaw(b)
+	b, err := inv.decryptSource(b)
+	if err != nil {
+		return err
+	}
+	if err := inv.parseLines(string(b[:])); err != nil {
+		return err
+	}
+	return inv.finalizeContext(ctx)
+}
+
+// LoadFromFile loads inventory data from a file. The Ansible inventory
+// plugin configuration files are dispatched to LoadFromPluginConfigBytes,
+// and the OpenSSH client configuration files to LoadFromSSHConfig.
 func (inv *Inventory) LoadFromFile(fp string) error {
 	fp = expandFilePath(fp)
-	b, err := ioutil.ReadFile(fp)
+	if IsSSHConfig(fp) {
+		return inv.LoadFromSSHConfig(fp)
+	}
+	b, err := inv.readVerifiedFile(fp)
 	if err != nil {
 		return err
 	}
+	if inv.loadFromCache(fp, b) {
+		return nil
+	}
+	src := b
+	inv.setRaw(b)
+	b, err = inv.decryptSource(b)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(b, []byte("plugin:")) && IsPluginConfig(b) {
+		if err := inv.loadPluginConfigBytes(b); err != nil {
+			return fmt.Errorf("%s: %s", fp, err)
+		}
+		inv.saveToCache(fp, src)
+		return nil
+	}
 	s := string(b[:])
-	return inv.parseString(s)
+	if err := inv.withSource(fp, func() error { return inv.parseString(s) }); err != nil {
+		return err
+	}
+	inv.saveToCache(fp, src)
+	return nil
 }
 
 // GetHosts returns a list of InventoryHost instances.
 func (inv *Inventory) GetHosts() ([]*InventoryHost, error) {
+	if err := inv.Precompute(); err != nil {
+		return nil, err
+	}
 	return inv.Hosts, nil
 }
 
 // AddGroup adds a group to the Inventory.
 func (inv *Inventory) AddGroup(s, p string) error {
-	for _, g := range inv.Groups {
-		if g.Name == s {
-			for _, a := range g.Ancestors {
-				if a == p {
-					return nil
-				}
+	if g := inv.existingGroup(s); g != nil {
+		for _, a := range g.Ancestors {
+			if a == p {
+				return nil
 			}
-			g.Ancestors = append(g.Ancestors, p)
-			return nil
 		}
+		// Every group descends from "all", so being a child of "all" never
+		// forms a cycle.
+		if p != "all" {
+			if path := inv.ancestorPath(p, s, make(map[string]bool)); path != nil {
+				return errorWithCode(ErrGroupCycle, "group cycle: %s", formatGroupCycle(path))
+			}
+		}
+		g.Ancestors = append(g.Ancestors, p)
+		inv.addChildGroup(p, s)
+		inv.resetMemberships()
+		return nil
+	}
+	if s == p {
+		return errorWithCode(ErrGroupCycle, "group cycle: %s", formatGroupCycle([]string{s}))
 	}
 	g := &InventoryGroup{
 		Name:      s,
 		Variables: make(map[string]string),
+		inventory: inv,
 	}
 	g.Ancestors = append(g.Ancestors, p)
 	inv.Groups = append(inv.Groups, g)
 	inv.GroupsRef[s] = true
+	inv.indexGroup(g)
+	inv.addChildGroup(p, s)
+	inv.resetMemberships()
 	return nil
 }
 
+// ancestorPath returns the groups from the group "from" up to its ancestor
+// "to" through the parents of the groups, or nil when "to" is not an
+// ancestor of "from". The group "all", being the parent of the top-level
+// groups, is not followed.
+func (inv *Inventory) ancestorPath(from, to string, visited map[string]bool) []string {
+	if from == to {
+		return []string{from}
+	}
+	if from == "all" || visited[from] {
+		return nil
+	}
+	visited[from] = true
+	g := inv.existingGroup(from)
+	if g == nil {
+		return nil
+	}
+	for _, a := range g.Ancestors {
+		if path := inv.ancestorPath(a, to, visited); path != nil {
+			return append([]string{from}, path...)
+		}
+	}
+	return nil
+}
+
+// formatGroupCycle describes a group cycle provided as the groups from a
+// group up to its ancestor that is also its child, in the direction of the
+// children sections, e.g. "a -> b -> a" for [a:children] holding b and
+// [b:children] holding a.
+func formatGroupCycle(path []string) string {
+	groups := make([]string, 0, len(path)+1)
+	for i := len(path) - 1; i >= 0; i-- {
+		groups = append(groups, path[i])
+	}
+	groups = append(groups, path[len(path)-1])
+	return strings.Join(groups, " -> ")
+}
+
+// getKeyValuePairs parses space-separated key-value pairs. A value is
+// either quoted, with single or double quotes, or extends up to the last
+// space before the next key, e.g. "a=hello world b=2". An equal sign not
+// preceded by a space is a part of the value, e.g. "a=b=c". The quotes are
+// removed from the value, e.g. `a="-o ProxyCommand=ssh -W %h:%p jump"`.
+// A backslash escapes a quote, a backslash, or a space, outside of single
+// quotes. Every iteration consumes a part of the input, so the parsing
+// terminates.
 func getKeyValuePairs(s string) (map[string]string, error) {
+	orig := s
 	s = strings.TrimSpace(s)
 	m := make(map[string]string)
-	size := len(s)
-	var k string
-
-	x := 10000
-	for {
-		x--
-		if x == 0 {
-			break
-		}
+	for s != "" {
 		i := strings.Index(s, "=")
 		if i < 0 {
 			break
 		}
-		k = s[:i]
-		if i >= size {
-			break
+		k := s[:i]
+		if k == "" || strings.ContainsAny(k, " \t\"'") {
+			return nil, fmt.Errorf("invalid key %q in key-value pairs: %s", k, orig)
 		}
-		s = s[i+1:]
-		nx := strings.Index(s, "=")
-		if nx < 0 {
-			// no more key value pairs
-			m[k] = strings.TrimSpace(s)
-			break
-		} else {
-			v := s[:nx]
-			vIndex := strings.LastIndex(v, " ")
-			v = s[:vIndex]
-			m[k] = strings.TrimSpace(v)
-			s = s[vIndex+1:]
+		v, n, err := scanValue(s[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of key %q in key-value pairs: %s: %s", k, err, orig)
 		}
+		m[k] = v
+		s = strings.TrimSpace(s[i+1+n:])
 	}
 	return m, nil
 }
 
-// AddHost adds a host to the Inventory.
+// scanValue returns the value at the start of the provided string, and the
+// number of bytes it spans.
+func scanValue(s string) (string, int, error) {
+	var sb strings.Builder
+	started := false
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			j := i
+			for j < len(s) && (s[j] == ' ' || s[j] == '\t') {
+				j++
+			}
+			if j == len(s) || startsKey(s[j:]) {
+				return sb.String(), j, nil
+			}
+			if started {
+				sb.WriteString(s[i:j])
+			}
+			i = j
+		case c == '"' || c == '\'':
+			v, n, err := scanQuoted(s[i:])
+			if err != nil {
+				return "", 0, err
+			}
+			sb.WriteString(v)
+			started = true
+			i += n
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(" \t\"'\\", s[i+1]) >= 0:
+			sb.WriteByte(s[i+1])
+			started = true
+			i += 2
+		default:
+			sb.WriteByte(c)
+			started = true
+			i++
+		}
+	}
+	return sb.String(), i, nil
+}
+
+// scanQuoted returns the unquoted content of the quoted string at the start
+// of the provided string, and the number of bytes it spans, including the
+// quotes. A backslash escapes a double quote or a backslash in a double
+// quoted string only.
+func scanQuoted(s string) (string, int, error) {
+	q := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if q == '"' && c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+			sb.WriteByte(s[i+1])
+			i++
+			continue
+		}
+		if c == q {
+			return sb.String(), i + 1, nil
+		}
+		sb.WriteByte(c)
+	}
+	return "", 0, fmt.Errorf("unterminated quote")
+}
+
+// startsKey returns true when the provided string starts with a key, i.e.
+// a word followed by an equal sign.
+func startsKey(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '=':
+			return i > 0
+		case ' ', '\t', '"', '\'', '\\':
+			return false
+		}
+	}
+	return false
+}
+
+// AddHost adds a host to the Inventory. A host name with a range, e.g.
+// web[01:50].example.com, adds a host per item of the range, each with the
+// variables of the line. The hosts added to "all" are the members of the
+// "ungrouped" group. A host is in a single group, except for the host put
+// in another group by another source of LoadFromSources, which is a member
+// of both, see ExtraParents.
 func (inv *Inventory) AddHost(s, groupName string) error {
+	if groupName == "all" {
+		// As in Ansible, the hosts having no other group than "all" are
+		// the members of the implicit "ungrouped" group.
+		groupName = "ungrouped"
+		if err := inv.AddGroup(groupName, "all"); err != nil {
+			return err
+		}
+	}
 	if _, exists := inv.GroupsRef[groupName]; !exists {
-		return fmt.Errorf("the group %s for host %s does not exist", groupName, s)
+		return errorWithCode(ErrInvalidGroup, "the group %s for host %s does not exist", groupName, s)
 	}
 	n := strings.Split(s, " ")[0]
-	kv, err := getKeyValuePairs(s[len(n):])
+	if _, _, ok := splitIPv6Literal(n); !ok && isHostRange(n) {
+		names, err := expandHostRange(n, inv.maxHosts)
+		if err != nil {
+			return withCode(ErrInvalidHost, err)
+		}
+		for _, name := range names {
+			if err := inv.AddHost(name+s[len(n):], groupName); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	kv, templated, err := inv.parseKeyValuePairs(s[len(n):])
 	if err != nil {
-		return err
+		return withCode(ErrInvalidVariable, err)
+	}
+	if addr, port, ok := splitIPv6Literal(n); ok {
+		n = addr
+		if _, exists := kv["ansible_port"]; !exists && port != "" {
+			kv["ansible_port"] = port
+		}
 	}
+	if v, exists := kv["ansible_host"]; exists {
+		if addr, _, ok := splitIPv6Literal(v); ok {
+			kv["ansible_host"] = addr
+		}
+	}
+	n = inv.hostname(n)
 	if g, exists := inv.HostsRef[n]; exists {
-		if g != groupName {
-			return fmt.Errorf("host %s exist in multiple groups: %s, %s", n, g, groupName)
+		h, err := inv.GetHost(n)
+		if err != nil {
+			return err
 		}
+		if !h.hasParent(groupName) {
+			// As in "ansible -i a -i b", a host put in another group by
+			// another source is a member of both groups.
+			if inv.hostSources == nil || inv.source == inv.hostSources[n] {
+				return errorWithCode(ErrDuplicateHost, "host %s exist in multiple groups: %s, %s", n, g, groupName)
+			}
+			switch {
+			case groupName == "ungrouped":
+			case h.Parent == "ungrouped":
+				h.Parent = groupName
+				inv.HostsRef[n] = groupName
+			default:
+				h.ExtraParents = append(h.ExtraParents, groupName)
+			}
+		}
+		// The host is defined again, e.g. by an overlay. The latest values
+		// of the variables take precedence.
+		for k, v := range kv {
+			if prev, exists := h.Variables[k]; exists && prev != v {
+				inv.logger.Debugf("variable %s of %s overridden", k, inv.variableSource("host", n))
+			}
+			h.Variables[k] = v
+			setVariableSource(&h.VariableSources, k, inv.variableSource("host", n))
+			if !templated[k] {
+				delete(h.Templated, k)
+				continue
+			}
+			if h.Templated == nil {
+				h.Templated = make(map[string]bool)
+			}
+			h.Templated[k] = true
+		}
+		return nil
+	}
+	if err := checkLimit(LimitHosts, int64(len(inv.Hosts)+1), int64(inv.maxHosts)); err != nil {
+		return err
 	}
 	h := &InventoryHost{
 		Name:      n,
 		Parent:    groupName,
 		Variables: kv,
+		Templated: templated,
+	}
+	for k := range kv {
+		setVariableSource(&h.VariableSources, k, inv.variableSource("host", n))
 	}
 	inv.HostsRef[n] = groupName
 	inv.Hosts = append(inv.Hosts, h)
+	inv.indexHost(h)
+	if inv.hostSources != nil {
+		inv.hostSources[n] = inv.source
+	}
 	return nil
 }
 
 // AddVariable adds a variable to an InventoryGroup.
 func (inv *Inventory) AddVariable(s, groupName string) error {
 	if _, exists := inv.GroupsRef[groupName]; !exists {
-		return fmt.Errorf("the group %s does not exist", groupName)
+		return errorWithCode(ErrInvalidGroup, "the group %s does not exist", groupName)
 	}
-	kvPairs, err := getKeyValuePairs(s)
+	kvPairs, templated, err := inv.parseKeyValuePairs(s)
 	if err != nil {
-		return err
+		return withCode(ErrInvalidVariable, err)
 	}
-	for _, g := range inv.Groups {
-		if g.Name == groupName {
-			for k, v := range kvPairs {
-				g.Variables[k] = v
-			}
-			break
+	g := inv.lookupGroup(groupName)
+	if g == nil {
+		return fmt.Errorf("the group %s was not found", groupName)
+	}
+	for k, v := range kvPairs {
+		if prev, exists := g.Variables[k]; exists && prev != v {
+			inv.logger.Debugf("variable %s of %s overridden", k, inv.variableSource("group", groupName))
+		}
+		g.Variables[k] = v
+		setVariableSource(&g.VariableSources, k, inv.variableSource("group", groupName))
+		if !templated[k] {
+			delete(g.Templated, k)
+			continue
+		}
+		if g.Templated == nil {
+			g.Templated = make(map[string]bool)
 		}
+		g.Templated[k] = true
 	}
 	return nil
 }
 
 // GetParentGroupChains gets parent inventory groups recursively for the provided one.
+// The group chains are ordered by length, then alphabetically, and the groups
+// are ordered from the top of the hierarchy to the provided group.
 func (inv *Inventory) GetParentGroupChains(s string) ([]string, []string, error) {
-	var x, max int
-	outputs := make(map[string]bool)
-	groups := make(map[string]bool)
-	groups[s] = false
-	max = 10000
-	x = max
-	for {
-		x--
-		if x == 0 {
-			return []string{}, []string{}, fmt.Errorf("failed to get parent groups: exceeded %d (max) iterations", max)
-		}
-		breakOut := true
-		for k, completed := range groups {
-			if completed {
-				continue
-			}
-			parentGroups, err := inv.GetParentGroup(k)
-			if err != nil {
-				return []string{}, []string{}, err
-			}
-			groups[k] = true
-			for _, g := range parentGroups {
-				if _, exists := groups[g]; !exists {
-					groups[g] = false
-					breakOut = false
-				}
-				if g != "all" {
-					out := fmt.Sprintf("%s,%s", g, k)
-					if _, exists := outputs[out]; !exists {
-						outputs[out] = true
-					}
-				}
-			}
+	return inv.GetParentGroupChainsContext(context.Background(), s)
+}
+
+// GetParentGroupChainsContext is the GetParentGroupChains counterpart
+// accepting a context for cancellation. A chain is a path from a top-level
+// group, i.e. a child of "all" only, down to the provided group. The chains
+// are found with a depth-first traversal of the parents of the groups,
+// visiting every group once. A group reached again while its parents are
+// being traversed forms a cycle, which is reported with the groups in it.
+func (inv *Inventory) GetParentGroupChainsContext(ctx context.Context, s string) ([]string, []string, error) {
+	if _, exists := inv.GroupsRef[s]; !exists {
+		return []string{}, []string{}, fmt.Errorf("group %s does not exist in the inventory", s)
+	}
+	t := &groupChainTraversal{
+		ctx:   ctx,
+		inv:   inv,
+		paths: make(map[string][][]string),
+		state: make(map[string]int),
+	}
+	chains := []string{"all"}
+	if s != "all" {
+		paths, err := t.visit(s, nil)
+		if err != nil {
+			return []string{}, []string{}, fmt.Errorf("failed to assemble group chains of %s: %w", s, err)
 		}
-		if breakOut {
-			break
+		for _, p := range paths {
+			chains = append(chains, strings.Join(p, ","))
 		}
 	}
+	sortGroupChains(chains)
+	return chains, orderChainGroups(chains), nil
+}
 
-	max = 10000
-	x = max
-	for {
-		x--
-		if x == 0 {
-			return []string{}, []string{}, fmt.Errorf("failed to assemble group chains: exceeded %d (max) iterations", max)
+// sortGroupChains orders group chains: "all" comes first, followed by the
+// chains ordered by length, then alphabetically.
+func sortGroupChains(chains []string) {
+	sort.SliceStable(chains, func(i, j int) bool {
+		if chains[i] == "all" || chains[j] == "all" {
+			return chains[i] == "all" && chains[j] != "all"
 		}
-		delElements := []string{}
-		continueNow := false
-		for g1 := range outputs {
-			g1arr := strings.Split(g1, ",")
-			for g2 := range outputs {
-				if g1 == g2 {
-					continue
-				}
-				g2arr := strings.Split(g2, ",")
-				// check whether the first element is last in the other outputs
-				if g1arr[0] == g2arr[len(g2arr)-1] {
-					var output string
-					if g2arr[len(g2arr)-1] == g1arr[1] {
-						output = fmt.Sprintf("%s,%s", g2arr[len(g2arr)-1], g1arr[1])
-					} else {
-						output = fmt.Sprintf("%s,%s", g2, g1arr[1])
-					}
-					delElements = append(delElements, g2)
-					outputs[output] = true
-					continueNow = true
-					break
-				}
-			}
-			if continueNow {
-				break
-			}
+		ni, nj := strings.Count(chains[i], ","), strings.Count(chains[j], ",")
+		if ni != nj {
+			return ni < nj
 		}
-		if len(delElements) == 0 {
-			break
+		return chains[i] < chains[j]
+	})
+}
+
+// groupChainTraversal finds the chains from the top-level groups down to
+// a group. The chains of every visited group are memoized.
+type groupChainTraversal struct {
+	ctx   context.Context
+	inv   *Inventory
+	paths map[string][][]string
+	// state is groupVisiting while the parents of a group are traversed,
+	// and groupVisited once its chains are known.
+	state map[string]int
+}
+
+// The states of a group in a groupChainTraversal.
+const (
+	groupVisiting = 1
+	groupVisited  = 2
+)
+
+// visit returns the chains from the top-level groups down to the provided
+// group. The stack holds the groups being visited, i.e. the descendants
+// of the group, for the cycle detection.
+func (t *groupChainTraversal) visit(name string, stack []string) ([][]string, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch t.state[name] {
+	case groupVisited:
+		return t.paths[name], nil
+	case groupVisiting:
+		i := 0
+		for stack[i] != name {
+			i++
 		}
-		for _, e := range delElements {
-			delete(outputs, e)
+		return nil, errorWithCode(ErrGroupCycle, "group cycle: %s", formatGroupCycle(stack[i:]))
+	}
+	g := t.inv.lookupGroup(name)
+	if g == nil {
+		return nil, fmt.Errorf("group %s does not exist in the inventory", name)
+	}
+	t.state[name] = groupVisiting
+	stack = append(stack, name)
+	var paths [][]string
+	parents := make(map[string]bool)
+	for _, a := range g.Ancestors {
+		if a != "all" {
+			parents[a] = true
 		}
 	}
-
-	chains := []string{}
-	chains = append(chains, "all")
-	for g := range outputs {
-		// skip the group if the first element is not a top one or that the last
-		// element is not a leaf
-		groups := strings.Split(g, ",")
-		fg, err := inv.GetGroup(groups[0])
-		if err != nil {
-			return []string{}, []string{}, err
+	for _, p := range sortedKeys(parents) {
+		if _, exists := t.inv.GroupsRef[p]; !exists {
+			return nil, fmt.Errorf("group %s does not exist in the inventory", p)
 		}
-		if len(fg.Ancestors) > 1 {
-			continue
+		pp, err := t.visit(p, stack)
+		if err != nil {
+			return nil, err
 		}
-		chains = append(chains, g)
-	}
-
-	// sort the array such that group chains with the most members appear last.
-	rc := []string{}
-	max = 1000
-	x = max
-	for {
-		x--
-		if x == 0 {
-			return []string{}, []string{}, fmt.Errorf("failed to sort group chains: exceeded %d (max) iterations", max)
-		}
-		k := 0
-		v := 10000
-		for i, chain := range chains {
-			j := len(strings.Split(chain, ","))
-			if j < v {
-				k = i
-				v = j
+		for _, path := range pp {
+			if err := checkLimit(LimitGroupDepth, int64(len(path)+1), int64(t.inv.maxGroupDepth)); err != nil {
+				return nil, err
 			}
-		}
-		rc = append(rc, chains[k])
-		chains[k] = chains[len(chains)-1]
-		chains[len(chains)-1] = ""
-		chains = chains[:len(chains)-1]
-		if len(chains) == 0 {
-			break
+			chain := make([]string, len(path), len(path)+1)
+			copy(chain, path)
+			paths = append(paths, append(chain, name))
 		}
 	}
+	if len(paths) == 0 {
+		paths = [][]string{{name}}
+	}
+	t.state[name] = groupVisited
+	t.paths[name] = paths
+	return paths, nil
+}
 
-	// create a list of unique groups
-	groupChains := make([]string, len(rc))
-	copy(groupChains, rc)
-	processedGroups := make(map[string]float64)
-	max = 10000
-	x = max
-	for {
-		x--
-		if x == 0 {
-			return []string{}, []string{}, fmt.Errorf("failed create a list of unique groups: exceeded %d (max) iterations", max)
+// orderChainGroups returns the unique groups of the chains ordered by the
+// deepest position, at which the groups appear in the chains.
+func orderChainGroups(chains []string) []string {
+	split := make([][]string, len(chains))
+	depth := 0
+	for i, c := range chains {
+		split[i] = strings.Split(c, ",")
+		if len(split[i]) > depth {
+			depth = len(split[i])
 		}
-		for i, chain := range groupChains {
-			groups := strings.Split(chain, ",")
-			if len(groups) < 2 && groups[0] == "" {
-				continue
-			}
-			processedGroups[groups[0]] = float64(x)
-			if groupChains[i] == "" {
-				continue
-			}
-			x--
-			groupChains[i] = strings.Join(groups[1:], ",")
-		}
-
-		isEmpty := true
-		for _, chain := range groupChains {
-			if chain != "" {
-				isEmpty = false
-				break
+	}
+	last := make(map[string]int)
+	n := 0
+	for d := 0; d < depth; d++ {
+		for _, groups := range split {
+			if d < len(groups) {
+				last[groups[d]] = n
+				n++
 			}
 		}
-		if isEmpty {
-			break
-		}
 	}
-
-	rg := sortStringFloatMap(processedGroups)
-
-	if len(rg) == 1 {
-		if rg[0] == "all" && s != "all" {
-			rg = append(rg, s)
-			rc = append(rc, s)
-		}
+	groups := make([]string, 0, len(last))
+	for g := range last {
+		groups = append(groups, g)
 	}
-	return rc, rg, nil
+	sort.Slice(groups, func(i, j int) bool { return last[groups[i]] < last[groups[j]] })
+	return groups
 }
 
-// GetParentGroup gets parent inventory groups for the provided one.
+// GetParentGroup gets parent inventory groups for the provided one, sorted
+// alphabetically.
 func (inv *Inventory) GetParentGroup(s string) ([]string, error) {
 	groups := make(map[string]bool)
 	if _, exists := inv.GroupsRef[s]; !exists {
 		return []string{}, fmt.Errorf("group %s does not exist in the inventory", s)
 	}
-	for _, g := range inv.Groups {
-		if g.Name == s {
-			for _, a := range g.Ancestors {
-				if _, exists := groups[a]; !exists {
-					groups[a] = false
-				}
+	if g := inv.lookupGroup(s); g != nil {
+		for _, a := range g.Ancestors {
+			if _, exists := groups[a]; !exists {
+				groups[a] = false
 			}
-			break
 		}
 	}
-	r := []string{}
-	for g := range groups {
-		r = append(r, g)
-	}
-	return r, nil
+	return sortedKeys(groups), nil
 }
 
-// GetHost returns an instance of InventoryHost.
+// GetHost returns an instance of InventoryHost. When localhost is not
+// defined in the inventory, the function returns an implicit localhost
+// with the local connection, the way Ansible does.
 func (inv *Inventory) GetHost(s string) (*InventoryHost, error) {
+	s = inv.hostname(s)
 	if _, exists := inv.HostsRef[s]; !exists {
+		if localhostNames[s] {
+			return newImplicitLocalhost(s), nil
+		}
 		return nil, fmt.Errorf("host %s does not exist in the inventory", s)
 	}
-	for _, h := range inv.Hosts {
-		if h.Name == s {
-			return h, nil
+	if h := inv.lookupHost(s); h != nil {
+		if err := inv.resolveHost(h); err != nil {
+			return nil, err
 		}
+		return h, nil
 	}
 	return nil, fmt.Errorf("host %s not found", s)
 }
@@ -552,19 +1018,88 @@ func (inv *Inventory) GetGroup(s string) (*InventoryGroup, error) {
 	if _, exists := inv.GroupsRef[s]; !exists {
 		return nil, fmt.Errorf("Group %s does not exist in the inventory", s)
 	}
-	for _, g := range inv.Groups {
-		if g.Name == s {
-			return g, nil
-		}
+	if g := inv.lookupGroup(s); g != nil {
+		return g, nil
 	}
 	return nil, fmt.Errorf("Group %s not found", s)
 }
 
+// GetHostsByGroup returns the hosts of a group, with their resolved
+// variables. When recursive is set, the hosts of the children groups are
+// included. Otherwise, only the hosts with the group as one of their
+// parents are, see ExtraParents.
+func (inv *Inventory) GetHostsByGroup(s string, recursive bool) ([]*InventoryHost, error) {
+	if _, err := inv.GetGroup(s); err != nil {
+		return nil, err
+	}
+	hosts := []*InventoryHost{}
+	for _, h := range inv.Hosts {
+		if h.hasParent(s) || (recursive && stringInList(s, inv.hostGroups(h))) {
+			hosts = append(hosts, h)
+		}
+	}
+	if err := inv.resolveHostList(hosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// CountHosts returns the number of the hosts of a group, including the
+// hosts of its children groups, without resolving them.
+func (inv *Inventory) CountHosts(s string) (int, error) {
+	if _, err := inv.GetGroup(s); err != nil {
+		return 0, err
+	}
+	var n int
+	for _, h := range inv.Hosts {
+		if h.hasParent(s) || stringInList(s, inv.hostGroups(h)) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetChildGroups returns the names of the groups having the group as one
+// of their parents. Every group is a child of the "all" group.
+func (inv *Inventory) GetChildGroups(s string) ([]string, error) {
+	g, err := inv.GetGroup(s)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{}, g.Children...), nil
+}
+
+// GetDescendantGroups returns the names of the children of the group, the
+// children of the children, and so on, closest first, without duplicates.
+func (inv *Inventory) GetDescendantGroups(s string) ([]string, error) {
+	g, err := inv.GetGroup(s)
+	if err != nil {
+		return nil, err
+	}
+	descendants := []string{}
+	seen := map[string]bool{s: true}
+	queue := []*InventoryGroup{g}
+	for len(queue) > 0 {
+		g, queue = queue[0], queue[1:]
+		for _, c := range g.Children {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			descendants = append(descendants, c)
+			if cg := inv.lookupGroup(c); cg != nil {
+				queue = append(queue, cg)
+			}
+		}
+	}
+	return descendants, nil
+}
+
 // GetHostsWithFilter returns a list of InventoryHost instances filtered by
 // input host and group patterns. Returns the host matching the patterns only.
 func (inv *Inventory) GetHostsWithFilter(hostFilter, groupFilter interface{}) ([]*InventoryHost, error) {
 	if hostFilter == nil && groupFilter == nil {
-		return inv.Hosts, nil
+		return inv.GetHosts()
 	}
 	hosts := []*InventoryHost{}
 	for _, host := range inv.Hosts {
@@ -611,7 +1146,7 @@ func (inv *Inventory) GetHostsWithFilter(hostFilter, groupFilter interface{}) ([
 					return hosts, fmt.Errorf("filter contains invalid pattern: %s, error: %s", filter, err)
 				}
 
-				for _, group := range host.Groups {
+				for _, group := range inv.hostGroups(host) {
 					if filterPattern.MatchString(group) {
 						hostMatched = true
 						break
@@ -624,5 +1159,23 @@ func (inv *Inventory) GetHostsWithFilter(hostFilter, groupFilter interface{}) ([
 			hosts = append(hosts, host)
 		}
 	}
+	if err := inv.resolveHostList(hosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// GetHostsWithExpression returns a list of InventoryHost instances for
+// which the provided expression holds. See MatchExpression for the syntax.
+func (inv *Inventory) GetHostsWithExpression(expr string) ([]*InventoryHost, error) {
+	m, err := MatchExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []*InventoryHost{}
+	inv.AllHosts(m)(func(h *InventoryHost) bool {
+		hosts = append(hosts, h)
+		return true
+	})
 	return hosts, nil
 }
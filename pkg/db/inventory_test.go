@@ -15,8 +15,13 @@
 package db
 
 import (
-	//"fmt"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	//"io/ioutil"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -106,7 +111,7 @@ func TestNewInventory(t *testing.T) {
 				testFailed++
 				continue
 			}
-			t.Logf("INFO: Test %d: host %s\n%s", i, test.host, host)
+			t.Logf("INFO: Test %d: host %s\n%v", i, test.host, host)
 		}
 
 		if test.shouldFail {
@@ -179,8 +184,8 @@ func TestGetHost(t *testing.T) {
 		{
 			host:        "controller",
 			vars:        2,
-			groups:      1,
-			groupChains: 1,
+			groups:      2,
+			groupChains: 2,
 			credentials: 2,
 		},
 	} {
@@ -285,3 +290,629 @@ func TestGetHostsWithFilter(t *testing.T) {
 
 	}
 }
+
+func TestIPv6Hosts(t *testing.T) {
+	inv := NewInventory()
+	input := []byte(`[2001:db8::1]
+
+[routers]
+[2001:db8::2]:2222 os=junos
+[2001:db8::3] ansible_port=830
+edge01 ansible_host=[2001:db8::4]
+edge02 ansible_host=2001:db8::5
+`)
+	if err := inv.LoadFromBytes(input); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		host   string
+		parent string
+		vars   map[string]string
+	}{
+		{host: "2001:db8::1", parent: "ungrouped"},
+		{host: "2001:db8::2", parent: "routers", vars: map[string]string{"ansible_port": "2222", "os": "junos"}},
+		{host: "2001:db8::3", parent: "routers", vars: map[string]string{"ansible_port": "830"}},
+		{host: "edge01", parent: "routers", vars: map[string]string{"ansible_host": "2001:db8::4"}},
+		{host: "edge02", parent: "routers", vars: map[string]string{"ansible_host": "2001:db8::5"}},
+	} {
+		host, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s from inventory: %s", i, test.host, err)
+		}
+		if host.Parent != test.parent {
+			t.Fatalf("FAIL: Test %d, host %s parent group mismatch: %s (expected) vs. %s (received)", i, test.host, test.parent, host.Parent)
+		}
+		for k, v := range test.vars {
+			if host.Variables[k] != v {
+				t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)", i, test.host, k, v, host.Variables[k])
+			}
+		}
+		t.Logf("PASS: Test %d, host %s, parent group: %s", i, host.Name, host.Parent)
+	}
+}
+
+func TestLocalhost(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts4"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		host       string
+		connection string
+		local      bool
+		implicit   bool
+	}{
+		{host: "localhost", connection: "local", local: true},
+		{host: "other1.example.com", connection: "ssh"},
+		{host: "127.0.0.1", connection: "local", local: true, implicit: true},
+		{host: "::1", connection: "local", local: true, implicit: true},
+	} {
+		host, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s from inventory: %s", i, test.host, err)
+		}
+		if host.AnsibleConnection() != test.connection {
+			t.Fatalf("FAIL: Test %d, host %s connection mismatch: %s (expected) vs. %s (received)", i, test.host, test.connection, host.AnsibleConnection())
+		}
+		if host.IsLocal() != test.local {
+			t.Fatalf("FAIL: Test %d, host %s local connection mismatch: %t (expected) vs. %t (received)", i, test.host, test.local, host.IsLocal())
+		}
+		if host.Implicit != test.implicit {
+			t.Fatalf("FAIL: Test %d, host %s implicit flag mismatch: %t (expected) vs. %t (received)", i, test.host, test.implicit, host.Implicit)
+		}
+		t.Logf("PASS: Test %d, host %s, connection: %s", i, host.Name, host.AnsibleConnection())
+	}
+	if inv.Size() != 3 {
+		t.Fatalf("implicit localhost must not be added to the inventory, size: %d", inv.Size())
+	}
+}
+
+func TestIterators(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	nameMatcher, err := MatchHostName("ny-sw0[1-3]")
+	if err != nil {
+		t.Fatalf("error creating host name matcher: %s", err)
+	}
+	group, err := inv.GetGroup("ny5")
+	if err != nil {
+		t.Fatalf("error getting group: %s", err)
+	}
+	for i, test := range []struct {
+		iterator HostIterator
+		limit    int
+		count    int
+	}{
+		{iterator: inv.AllHosts(), count: 5},
+		{iterator: inv.AllHosts(), limit: 2, count: 2},
+		{iterator: inv.AllHosts(nameMatcher), count: 3},
+		{iterator: inv.AllHosts(nameMatcher, MatchGroup("cisco")), count: 1},
+		{iterator: group.Hosts(), count: 2},
+		{iterator: group.Hosts(nameMatcher), count: 1},
+	} {
+		count := 0
+		test.iterator(func(h *InventoryHost) bool {
+			count++
+			return test.limit == 0 || count < test.limit
+		})
+		if count != test.count {
+			t.Fatalf("FAIL: Test %d, iterated hosts count mismatch: %d (expected) vs. %d (received)", i, test.count, count)
+		}
+		t.Logf("PASS: Test %d, hosts: %d", i, count)
+	}
+	groups := 0
+	inv.AllGroups()(func(g *InventoryGroup) bool {
+		groups++
+		return true
+	})
+	if groups != len(inv.Groups) {
+		t.Fatalf("iterated groups count mismatch: %d (expected) vs. %d (received)", len(inv.Groups), groups)
+	}
+}
+
+func TestVaultEncryptedInventory(t *testing.T) {
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error reading vault key file: %s", err)
+	}
+	inv := NewInventory(WithVault(vlt))
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts2.vault"); err != nil {
+		t.Fatalf("error reading vault-encrypted inventory: %s", err)
+	}
+	if inv.Size() != 6 {
+		t.Fatalf("inventory size mismatch: 6 (expected) vs. %d (received)", inv.Size())
+	}
+	if _, err := inv.GetHost("three.example.com"); err != nil {
+		t.Fatalf("error getting host from vault-encrypted inventory: %s", err)
+	}
+	if vlt.Payload != nil {
+		t.Fatalf("decrypting inventory must not alter the state of the vault")
+	}
+
+	inv = NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts2.vault"); err == nil {
+		t.Fatalf("expected loading vault-encrypted inventory without a vault to fail, but passed")
+	}
+	wrong := NewVault()
+	if err := wrong.SetPassword("wrong"); err != nil {
+		t.Fatalf("error setting vault password: %s", err)
+	}
+	inv = NewInventory(WithVault(wrong))
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts2.vault"); err == nil {
+		t.Fatalf("expected loading vault-encrypted inventory with a wrong password to fail, but passed")
+	}
+}
+
+func TestDeterministicOrdering(t *testing.T) {
+	data := []byte(`[web]
+web01
+
+[east:children]
+web
+
+[west:children]
+web
+
+[dc:children]
+east
+west
+
+[east:vars]
+region=east
+
+[west:vars]
+region=west
+`)
+	var expected string
+	for i := 0; i < 50; i++ {
+		inv := NewInventory()
+		if err := inv.LoadFromBytes(data); err != nil {
+			t.Fatalf("error reading inventory: %s", err)
+		}
+		h, err := inv.GetHost("web01")
+		if err != nil {
+			t.Fatalf("error getting host: %s", err)
+		}
+		parents, err := inv.GetParentGroup("web")
+		if err != nil {
+			t.Fatalf("error getting parent groups: %s", err)
+		}
+		received := strings.Join([]string{
+			strings.Join(h.Groups, " "),
+			strings.Join(h.GroupChains, " "),
+			strings.Join(parents, " "),
+			h.Variables["region"],
+		}, " | ")
+		if i == 0 {
+			expected = received
+			t.Logf("ordering: %s", expected)
+			continue
+		}
+		if received != expected {
+			t.Fatalf("FAIL: Test %d, ordering mismatch: %s (expected) vs. %s (received)", i, expected, received)
+		}
+	}
+}
+
+func TestGetKeyValuePairs(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		expected  map[string]string
+		shouldErr bool
+	}{
+		{input: "a=1 b=2", expected: map[string]string{"a": "1", "b": "2"}},
+		{input: "a=hello world b=2", expected: map[string]string{"a": "hello world", "b": "2"}},
+		{input: "a=b=c", expected: map[string]string{"a": "b=c"}},
+		{input: "a=x=y b=2", expected: map[string]string{"a": "x=y", "b": "2"}},
+		{input: " a=1\tb=2 ", expected: map[string]string{"a": "1", "b": "2"}},
+		{input: "", expected: map[string]string{}},
+		{input: "=1", shouldErr: true},
+		{input: "junk a=1", shouldErr: true},
+		{
+			input:    `ansible_ssh_common_args="-o ProxyCommand=ssh -W %h:%p jump" b=2`,
+			expected: map[string]string{"ansible_ssh_common_args": "-o ProxyCommand=ssh -W %h:%p jump", "b": "2"},
+		},
+		{input: `a='x y=z' b="1 2"`, expected: map[string]string{"a": "x y=z", "b": "1 2"}},
+		{input: `a="say \"hi\"" b='c:\temp'`, expected: map[string]string{"a": `say "hi"`, "b": `c:\temp`}},
+		{input: `a="it's" b='say "hi"'`, expected: map[string]string{"a": "it's", "b": `say "hi"`}},
+		{input: `a=hello\ b=2`, expected: map[string]string{"a": "hello b=2"}},
+		{input: `a=pre"fix x"post`, expected: map[string]string{"a": "prefix xpost"}},
+		{input: `a="" b=''`, expected: map[string]string{"a": "", "b": ""}},
+		{input: `a= b=2`, expected: map[string]string{"a": "", "b": "2"}},
+		{input: `a="unterminated b=2`, shouldErr: true},
+		{input: `"a"=1`, shouldErr: true},
+	} {
+		m, err := getKeyValuePairs(test.input)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error for %q", i, test.input)
+			}
+			t.Logf("PASS: Test %d, %q: %s", i, test.input, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error parsing %q: %s", i, test.input, err)
+		}
+		if len(m) != len(test.expected) {
+			t.Fatalf("FAIL: Test %d, %q mismatch: %v (expected) vs. %v (received)", i, test.input, test.expected, m)
+		}
+		for k, v := range test.expected {
+			if m[k] != v {
+				t.Fatalf("FAIL: Test %d, %q mismatch: %v (expected) vs. %v (received)", i, test.input, test.expected, m)
+			}
+		}
+		t.Logf("PASS: Test %d, %q: %v", i, test.input, m)
+	}
+}
+
+func TestGroupChainsTermination(t *testing.T) {
+	inv := NewInventory(WithStrictMode(false))
+	err := inv.LoadFromBytes([]byte("[b]\nh1\n\n[a:children]\nb\n\n[b:children]\na\n"))
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected a group cycle error, received: %v", err)
+	}
+	t.Logf("PASS: %s", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	inv = NewInventory()
+	if err := inv.LoadFromBytesContext(ctx, []byte("[b]\nh1\n")); err == nil {
+		t.Fatalf("expected a cancellation error, but passed")
+	}
+}
+
+func TestGetParentGroupChains(t *testing.T) {
+	for i, test := range []struct {
+		input  string
+		group  string
+		chains []string
+		groups []string
+		err    string
+	}{
+		{
+			input:  "[web]\nweb01\n\n[east:children]\nweb\n\n[west:children]\nweb\n\n[dc:children]\neast\nwest\n",
+			group:  "web",
+			chains: []string{"all", "dc,east,web", "dc,west,web"},
+			groups: []string{"all", "dc", "east", "west", "web"},
+		},
+		{
+			input:  "[web]\nweb01\n",
+			group:  "web",
+			chains: []string{"all", "web"},
+			groups: []string{"all", "web"},
+		},
+		{
+			input:  "[web]\nweb01\n",
+			group:  "all",
+			chains: []string{"all"},
+			groups: []string{"all"},
+		},
+		{
+			// g5 is a child of g4 and g3, the latter being a child of g4's
+			// parent g2 as well.
+			input:  "[g5]\nh5\n\n[g4:children]\ng5\n\n[g3:children]\ng5\n\n[g2:children]\ng3\ng4\n\n[g0:children]\ng2\ng3\n",
+			group:  "g5",
+			chains: []string{"all", "g0,g3,g5", "g0,g2,g3,g5", "g0,g2,g4,g5"},
+			groups: []string{"all", "g0", "g2", "g3", "g4", "g5"},
+		},
+		{
+			input: "[c]\nh1\n\n[a:children]\nb\n\n[b:children]\nc\n\n[c:children]\na\n",
+			err:   "group cycle: a -> b -> c -> a",
+		},
+	} {
+		var chains, groups []string
+		inv := NewInventory()
+		err := inv.parseString(test.input)
+		if err == nil {
+			chains, groups, err = inv.GetParentGroupChains(test.group)
+		}
+		if test.err != "" {
+			if err == nil || !errors.Is(err, ErrGroupCycle) || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("FAIL: Test %d, error mismatch: %s (expected) vs. %v (received)", i, test.err, err)
+			}
+			t.Logf("PASS: Test %d, error: %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		if !reflect.DeepEqual(chains, test.chains) {
+			t.Fatalf("FAIL: Test %d, chains mismatch: %v (expected) vs. %v (received)", i, test.chains, chains)
+		}
+		if !reflect.DeepEqual(groups, test.groups) {
+			t.Fatalf("FAIL: Test %d, groups mismatch: %v (expected) vs. %v (received)", i, test.groups, groups)
+		}
+		t.Logf("PASS: Test %d, %s: %v %v", i, test.group, chains, groups)
+	}
+}
+
+// newDeepTestInventory returns an Inventory with a chain of the provided
+// number of nested groups, the last of which holds a host.
+func newDeepTestInventory(tb testing.TB, depth int) *Inventory {
+	inv := NewInventory()
+	for i := 0; i < depth; i++ {
+		parent := "all"
+		if i > 0 {
+			parent = fmt.Sprintf("group%d", i-1)
+		}
+		if err := inv.AddGroup(fmt.Sprintf("group%d", i), parent); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := inv.AddHost("host0", fmt.Sprintf("group%d", depth-1)); err != nil {
+		tb.Fatal(err)
+	}
+	return inv
+}
+
+// newWideTestInventory returns an Inventory with a group being a child of
+// the provided number of top-level groups.
+func newWideTestInventory(tb testing.TB, width int) *Inventory {
+	inv := NewInventory()
+	for i := 0; i < width; i++ {
+		if err := inv.AddGroup(fmt.Sprintf("group%d", i), "all"); err != nil {
+			tb.Fatal(err)
+		}
+		if err := inv.AddGroup("leaf", fmt.Sprintf("group%d", i)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := inv.AddHost("host0", "leaf"); err != nil {
+		tb.Fatal(err)
+	}
+	return inv
+}
+
+func TestGetParentGroupChainsDeep(t *testing.T) {
+	inv := newDeepTestInventory(t, 500)
+	if err := inv.finalize(); err != nil {
+		t.Fatalf("error finalizing inventory: %s", err)
+	}
+	h, err := inv.GetHost("host0")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	if len(h.GroupChains) != 2 || len(h.Groups) != 501 {
+		t.Fatalf("group membership mismatch: 2 chains, 501 groups (expected) vs. %d chains, %d groups (received)", len(h.GroupChains), len(h.Groups))
+	}
+	if h.Groups[1] != "group0" || h.Groups[500] != "group499" {
+		t.Fatalf("group ordering mismatch: %v", h.Groups)
+	}
+}
+
+func BenchmarkGetParentGroupChainsDeep(b *testing.B) {
+	inv := newDeepTestInventory(b, 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := inv.GetParentGroupChains("group199"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetParentGroupChainsWide(b *testing.B) {
+	inv := newWideTestInventory(b, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := inv.GetParentGroupChains("leaf"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGroupCycles(t *testing.T) {
+	for i, test := range []struct {
+		input string
+		err   string
+	}{
+		{input: "[a:children]\nb\n\n[b:children]\na\n", err: "line 5, column 1: group cycle: a -> b -> a"},
+		{input: "[a:children]\na\n", err: "line 2, column 1: group cycle: a -> a"},
+		{input: "[a:children]\nb\n\n[b:children]\nc\n\n[c:children]\nd\nb\n", err: "line 9, column 1: group cycle: b -> c -> b"},
+		{input: "[a:children]\nall\n", err: "line 2, column 1: group cycle: all -> a -> all"},
+		{input: "[all:vars]\nx=1\n\n[all:children]\na\n\n[a:children]\nb\n"},
+	} {
+		inv := NewInventory()
+		err := inv.LoadFromBytes([]byte(test.input))
+		if test.err == "" {
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+			}
+			t.Logf("PASS: Test %d, no cycle", i)
+			continue
+		}
+		if err == nil || !errors.Is(err, ErrGroupCycle) || err.Error() != test.err {
+			t.Fatalf("FAIL: Test %d, error mismatch: %s (expected) vs. %v (received)", i, test.err, err)
+		}
+		t.Logf("PASS: Test %d, error: %s", i, err)
+	}
+
+	// the cycles of the groups added without AddGroup are found when the
+	// group chains are assembled
+	inv := NewInventory()
+	if err := inv.LoadFromBytes([]byte("[a:children]\nb\n\n[b]\nh1\n")); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	g, err := inv.GetGroup("a")
+	if err != nil {
+		t.Fatalf("error getting group: %s", err)
+	}
+	g.Ancestors = append(g.Ancestors, "b")
+	_, _, err = inv.GetParentGroupChains("b")
+	if !errors.Is(err, ErrGroupCycle) || !strings.HasSuffix(err.Error(), "group cycle: a -> b -> a") {
+		t.Fatalf("expected a group cycle error, received: %v", err)
+	}
+	t.Logf("PASS: %s", err)
+}
+
+func TestGetHostsByGroup(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		group     string
+		recursive bool
+		hosts     []string
+		shouldErr bool
+	}{
+		{group: "ny4-cisco", hosts: []string{"ny-sw01"}},
+		{group: "ny4", hosts: []string{}},
+		{group: "ny4", recursive: true, hosts: []string{"ny-sw01", "ny-sw02"}},
+		{group: "cisco", recursive: true, hosts: []string{"ny-sw01", "ny-sw04"}},
+		{group: "all", hosts: []string{}},
+		{group: "ungrouped", hosts: []string{"controller"}},
+		{group: "all", recursive: true, hosts: []string{"controller", "ny-sw01", "ny-sw02", "ny-sw03", "ny-sw04"}},
+		{group: "unknown", shouldErr: true},
+	} {
+		hosts, err := inv.GetHostsByGroup(test.group, test.recursive)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, group %s: expected error, but passed", i, test.group)
+			}
+			if _, err := inv.CountHosts(test.group); err == nil {
+				t.Fatalf("FAIL: Test %d, group %s: expected count error, but passed", i, test.group)
+			}
+			t.Logf("PASS: Test %d, group %s: error: %s", i, test.group, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, group %s: unexpected error: %s", i, test.group, err)
+		}
+		names := []string{}
+		for _, h := range hosts {
+			if h.unresolved {
+				t.Fatalf("FAIL: Test %d, group %s: host %s is not resolved", i, test.group, h.Name)
+			}
+			names = append(names, h.Name)
+		}
+		if !reflect.DeepEqual(names, test.hosts) {
+			t.Fatalf("FAIL: Test %d, group %s: hosts mismatch: %v (expected) vs. %v (received)", i, test.group, test.hosts, names)
+		}
+		if test.recursive {
+			n, err := inv.CountHosts(test.group)
+			if err != nil || n != len(test.hosts) {
+				t.Fatalf("FAIL: Test %d, group %s: count mismatch: %d (expected) vs. %d (received), %v", i, test.group, len(test.hosts), n, err)
+			}
+		}
+		t.Logf("PASS: Test %d, group %s, recursive: %t, hosts: %v", i, test.group, test.recursive, names)
+	}
+}
+
+func TestGetChildAndDescendantGroups(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		group       string
+		children    []string
+		descendants []string
+		shouldErr   bool
+	}{
+		{group: "us", children: []string{"ny"}, descendants: []string{"ny", "ny4", "ny5", "ny4-cisco", "ny4-arista", "ny5-cisco", "ny5-arista"}},
+		{group: "ny4", children: []string{"ny4-cisco", "ny4-arista"}, descendants: []string{"ny4-cisco", "ny4-arista"}},
+		{group: "cisco", children: []string{"ny4-cisco", "ny5-cisco"}, descendants: []string{"ny4-cisco", "ny5-cisco"}},
+		{group: "ny5-arista", children: []string{}, descendants: []string{}},
+		{group: "unknown", shouldErr: true},
+	} {
+		children, err := inv.GetChildGroups(test.group)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, group %s: expected error, but passed", i, test.group)
+			}
+			if _, err := inv.GetDescendantGroups(test.group); err == nil {
+				t.Fatalf("FAIL: Test %d, group %s: expected descendants error, but passed", i, test.group)
+			}
+			t.Logf("PASS: Test %d, group %s: error: %s", i, test.group, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, group %s: unexpected error: %s", i, test.group, err)
+		}
+		if !reflect.DeepEqual(children, test.children) {
+			t.Fatalf("FAIL: Test %d, group %s: children mismatch: %v (expected) vs. %v (received)", i, test.group, test.children, children)
+		}
+		descendants, err := inv.GetDescendantGroups(test.group)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, group %s: unexpected error: %s", i, test.group, err)
+		}
+		if !reflect.DeepEqual(descendants, test.descendants) {
+			t.Fatalf("FAIL: Test %d, group %s: descendants mismatch: %v (expected) vs. %v (received)", i, test.group, test.descendants, descendants)
+		}
+		t.Logf("PASS: Test %d, group %s, children: %v, descendants: %v", i, test.group, children, descendants)
+	}
+
+	// The children follow the edits of the groups.
+	if err := inv.RenameGroup("ny4-cisco", "ny4-cs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.RemoveGroup("ny5-cisco", false); err != nil {
+		t.Fatal(err)
+	}
+	children, err := inv.GetChildGroups("cisco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"ny4-cs"}; !reflect.DeepEqual(children, expected) {
+		t.Fatalf("FAIL: children mismatch after edits: %v (expected) vs. %v (received)", expected, children)
+	}
+	t.Logf("PASS: children after edits: %v", children)
+}
+
+func TestUngroupedGroup(t *testing.T) {
+	data := []byte(`local01
+[web]
+web01
+[all]
+local02 env=lab
+`)
+	inv := NewInventory(WithStrictMode(true))
+	if err := inv.LoadFromBytes(data); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	g, err := inv.GetGroup("ungrouped")
+	if err != nil {
+		t.Fatalf("FAIL: error getting group ungrouped: %s", err)
+	}
+	if !reflect.DeepEqual(g.Ancestors, []string{"all"}) || g.Counters.Hosts != 2 {
+		t.Fatalf("FAIL: group ungrouped mismatch: parents %v, hosts %d", g.Ancestors, g.Counters.Hosts)
+	}
+	for _, name := range []string{"local01", "local02"} {
+		h, err := inv.GetHost(name)
+		if err != nil {
+			t.Fatalf("FAIL: error getting host %s: %s", name, err)
+		}
+		if h.Parent != "ungrouped" || !reflect.DeepEqual(h.Groups, []string{"all", "ungrouped"}) {
+			t.Fatalf("FAIL: host %s membership mismatch: parent %s, groups %v", name, h.Parent, h.Groups)
+		}
+	}
+
+	b, err := inv.ToAnsibleJSON()
+	if err != nil {
+		t.Fatalf("FAIL: error exporting inventory: %s", err)
+	}
+	doc := make(map[string]*ansibleGroup)
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("FAIL: error decoding inventory: %s", err)
+	}
+	if !reflect.DeepEqual(doc["all"].Children, []string{"ungrouped", "web"}) || !reflect.DeepEqual(doc["ungrouped"].Hosts, []string{"local01", "local02"}) {
+		t.Fatalf("FAIL: exported groups mismatch: all %v, ungrouped %v", doc["all"], doc["ungrouped"])
+	}
+
+	// The group stays, even when empty, and takes the hosts moved to "all".
+	for _, name := range []string{"local01", "local02"} {
+		if err := inv.MoveHostToGroup(name, "web"); err != nil {
+			t.Fatalf("FAIL: error moving host %s: %s", name, err)
+		}
+	}
+	if err := inv.MoveHostToGroup("web01", "all"); err != nil {
+		t.Fatalf("FAIL: error moving host web01: %s", err)
+	}
+	hosts, err := inv.GetHostsByGroup("ungrouped", false)
+	if err != nil || len(hosts) != 1 || hosts[0].Name != "web01" {
+		t.Fatalf("FAIL: ungrouped hosts mismatch: %v, %v", hosts, err)
+	}
+	t.Logf("PASS: ungrouped hosts: %s", hosts[0].Name)
+}
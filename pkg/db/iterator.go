@@ -0,0 +1,118 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// HostIterator is a lazy sequence of InventoryHost instances. The iteration
+// stops when yield returns false. The signature matches iter.Seq, and the
+// iterator may be used in range statements with Go 1.23 and later.
+type HostIterator func(yield func(*InventoryHost) bool)
+
+// GroupIterator is a lazy sequence of InventoryGroup instances.
+type GroupIterator func(yield func(*InventoryGroup) bool)
+
+// HostMatcher decides whether an iterator yields an InventoryHost.
+type HostMatcher func(*InventoryHost) bool
+
+// MatchHostName returns a HostMatcher selecting hosts whose name matches
+// the provided regular expression.
+func MatchHostName(pattern string) (HostMatcher, error) {
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("filter contains invalid pattern: %s, error: %s", pattern, err)
+	}
+	return func(h *InventoryHost) bool {
+		return r.MatchString(h.Name)
+	}, nil
+}
+
+// MatchGroup returns a HostMatcher selecting hosts that are members of
+// the provided group, directly or via child groups.
+func MatchGroup(name string) HostMatcher {
+	return func(h *InventoryHost) bool {
+		for _, g := range h.Groups {
+			if g == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchHost(h *InventoryHost, matchers []HostMatcher) bool {
+	for _, m := range matchers {
+		if !m(h) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllHosts returns an iterator over the hosts of the Inventory satisfying
+// all of the provided matchers.
+func (inv *Inventory) AllHosts(matchers ...HostMatcher) HostIterator {
+	return func(yield func(*InventoryHost) bool) {
+		for _, h := range inv.Hosts {
+			if err := inv.resolveHost(h); err != nil {
+				inv.logger.Warnf("%s", err)
+				continue
+			}
+			if !matchHost(h, matchers) {
+				continue
+			}
+			if !yield(h) {
+				return
+			}
+		}
+	}
+}
+
+// AllGroups returns an iterator over the groups of the Inventory.
+func (inv *Inventory) AllGroups() GroupIterator {
+	return func(yield func(*InventoryGroup) bool) {
+		for _, g := range inv.Groups {
+			if !yield(g) {
+				return
+			}
+		}
+	}
+}
+
+// Hosts returns an iterator over the hosts that are members of the group,
+// directly or via child groups, and satisfy all of the provided matchers.
+func (g *InventoryGroup) Hosts(matchers ...HostMatcher) HostIterator {
+	return func(yield func(*InventoryHost) bool) {
+		if g.inventory == nil {
+			return
+		}
+		m := MatchGroup(g.Name)
+		for _, h := range g.inventory.Hosts {
+			if err := g.inventory.resolveHost(h); err != nil {
+				g.inventory.logger.Warnf("%s", err)
+				continue
+			}
+			if !m(h) || !matchHost(h, matchers) {
+				continue
+			}
+			if !yield(h) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultVaultIDLabel is the label of the vault IDs without one, as in
+// Ansible.
+const DefaultVaultIDLabel = "default"
+
+// ParseVaultID splits an Ansible vault ID, i.e. label@source, into the
+// label and the source. The label defaults to DefaultVaultIDLabel.
+func ParseVaultID(s string) (string, string) {
+	i := strings.Index(s, "@")
+	if i < 0 {
+		return DefaultVaultIDLabel, s
+	}
+	label := s[:i]
+	if label == "" {
+		label = DefaultVaultIDLabel
+	}
+	return label, s[i+1:]
+}
+
+// AddVaultID adds a password to the keyring of the Vault under a vault ID
+// label. When opening a vault, the password matching the label in the
+// vault header is tried first, followed by the password set with
+// SetPassword, followed by the other passwords in the keyring.
+func (v *Vault) AddVaultID(label, password string) error {
+	password = strings.TrimSpace(password)
+	if password == "" {
+		return fmt.Errorf("empty password for vault id %s", label)
+	}
+	if label == "" {
+		label = DefaultVaultIDLabel
+	}
+	if v.keyring == nil {
+		v.keyring = make(map[string][]byte)
+	}
+	v.keyring[label] = []byte(password)
+	return nil
+}
+
+// LoadVaultIDFromFile adds a password, read from a file, to the keyring of
+// the Vault. The first line of the file is the password, as with
+// LoadPasswordFromFile. When the file is executable, it is a script
+// printing the password. The scripts with the names ending in "-client" receive the
+// vault ID label via the --vault-id argument, as in Ansible.
+func (v *Vault) LoadVaultIDFromFile(ctx context.Context, label, fp string) error {
+	fp = expandFilePath(fp)
+	fi, err := os.Stat(fp)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&0111 == 0 {
+		b, err := readFile(fp, v.maxFileSize)
+		if err != nil {
+			return err
+		}
+		b, err = normalizeText(b)
+		if err != nil {
+			return err
+		}
+		return v.AddVaultID(label, strings.TrimSpace(strings.Split(string(b), "\n")[0]))
+	}
+	var args []string
+	name := strings.TrimSuffix(filepath.Base(fp), filepath.Ext(fp))
+	if strings.HasSuffix(name, "-client") {
+		args = append(args, "--vault-id", label)
+	}
+	password, err := runPasswordCommand(ctx, fp, args...)
+	if err != nil {
+		return err
+	}
+	return v.AddVaultID(label, password)
+}
+
+// runPasswordCommand runs a vault password script and returns the first
+// line of its output, i.e. the password.
+func runPasswordCommand(ctx context.Context, fp string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, fp, args...)
+	cmd.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("vault password script %s failed: %s: %s", fp, err, strings.TrimSpace(stderr.String()))
+	}
+	b, err = normalizeText(b)
+	if err != nil {
+		return "", fmt.Errorf("vault password script %s: %s", fp, err)
+	}
+	password := strings.TrimSpace(strings.Split(string(b), "\n")[0])
+	if password == "" {
+		return "", fmt.Errorf("vault password script %s printed no password", fp)
+	}
+	return password, nil
+}
+
+// candidatePasswords returns the passwords to try when opening a vault
+// with the provided label.
+func (v *Vault) candidatePasswords(label string) [][]byte {
+	var passwords [][]byte
+	if p, exists := v.keyring[label]; exists && label != "" {
+		passwords = append(passwords, p)
+	}
+	if v.Password != nil {
+		passwords = append(passwords, v.Password)
+	}
+	var labels []string
+	for k := range v.keyring {
+		if k != label {
+			labels = append(labels, k)
+		}
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		passwords = append(passwords, v.keyring[k])
+	}
+	return passwords
+}
+
+// VaultKeyring holds the passwords, optionally labeled by vault ID, of
+// several vaults encrypted under different keys. Each vault opened with the
+// keyring is a separate Vault, so there is no need to swap the password of
+// a Vault between the files.
+type VaultKeyring struct {
+	mu   sync.RWMutex
+	keys *Vault
+}
+
+// NewVaultKeyring returns a pointer to VaultKeyring. The options apply to
+// the vaults opened with the keyring.
+func NewVaultKeyring(opts ...VaultOption) *VaultKeyring {
+	return &VaultKeyring{keys: NewVault(opts...)}
+}
+
+// AddPassword adds a password to the keyring under a vault ID label. The
+// passwords without a label are stored under DefaultVaultIDLabel.
+func (k *VaultKeyring) AddPassword(label, password string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.keys.AddVaultID(label, password)
+}
+
+// LoadPasswordFromFile adds a password, read from a file or printed by a
+// script, to the keyring under a vault ID label. See LoadVaultIDFromFile.
+func (k *VaultKeyring) LoadPasswordFromFile(ctx context.Context, label, fp string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.keys.LoadVaultIDFromFile(ctx, label, fp)
+}
+
+// Labels returns the sorted vault ID labels of the keyring.
+func (k *VaultKeyring) Labels() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	var labels []string
+	for label := range k.keys.keyring {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// Open loads a vault file with the keyring. The password labeled with the
+// vault ID in the header of the vault is tried first, followed by the
+// other passwords of the keyring.
+func (k *VaultKeyring) Open(fp string) (*Vault, error) {
+	v := k.vault()
+	if err := v.LoadFromFile(fp); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// OpenBytes loads vault data from an array of bytes with the keyring. See
+// Open.
+func (k *VaultKeyring) OpenBytes(b []byte) (*Vault, error) {
+	v := k.vault()
+	if err := v.LoadFromBytes(b); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// vault returns an empty Vault with copies of the passwords of the keyring.
+func (k *VaultKeyring) vault() *Vault {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys.withKeys()
+}
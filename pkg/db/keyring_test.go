@@ -0,0 +1,158 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseVaultID(t *testing.T) {
+	for i, test := range []struct {
+		input  string
+		label  string
+		source string
+	}{
+		{input: "dev@~/.vault_pass", label: "dev", source: "~/.vault_pass"},
+		{input: "prod@prompt", label: "prod", source: "prompt"},
+		{input: "vault.key", label: "default", source: "vault.key"},
+		{input: "@vault.key", label: "default", source: "vault.key"},
+	} {
+		label, source := ParseVaultID(test.input)
+		if label != test.label || source != test.source {
+			t.Fatalf("FAIL: Test %d, %s mismatch: %s@%s (expected) vs. %s@%s (received)",
+				i, test.input, test.label, test.source, label, source)
+		}
+		t.Logf("PASS: Test %d, %s: %s@%s", i, test.input, label, source)
+	}
+}
+
+func TestVaultKeyring(t *testing.T) {
+	dir := t.TempDir()
+	key, err := os.ReadFile("../../testdata/inventory/vault.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "vault-pass-client.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n[ \"$1\" = \"--vault-id\" ] && [ \"$2\" = \"prod\" ] && echo "+string(key)), 0700); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "vault.key")
+	if err := os.WriteFile(keyFile, []byte(strings.TrimSpace(string(key))+"\r\n# prod\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		ids       map[string]string
+		script    bool
+		file      bool
+		shouldErr bool
+	}{
+		{ids: map[string]string{"dev": "wrong", "prod": string(key)}},
+		{ids: map[string]string{"dev": "wrong"}, script: true},
+		{ids: map[string]string{"dev": "wrong"}, file: true},
+		{ids: map[string]string{"dev": "wrong", "test": "also-wrong"}, shouldErr: true},
+	} {
+		vlt := NewVault()
+		for label, password := range test.ids {
+			if err := vlt.AddVaultID(label, password); err != nil {
+				t.Fatalf("FAIL: Test %d, error adding vault id %s: %s", i, label, err)
+			}
+		}
+		if test.script {
+			if err := vlt.LoadVaultIDFromFile(context.Background(), "prod", script); err != nil {
+				t.Fatalf("FAIL: Test %d, error running vault password script: %s", i, err)
+			}
+		}
+		if test.file {
+			if err := vlt.LoadVaultIDFromFile(context.Background(), "prod", keyFile); err != nil {
+				t.Fatalf("FAIL: Test %d, error reading vault password file: %s", i, err)
+			}
+		}
+		err := vlt.LoadFromFile("../../testdata/inventory/vault.yml")
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error opening the vault", i)
+			}
+			t.Logf("PASS: Test %d, %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error opening the vault: %s", i, err)
+		}
+		t.Logf("PASS: Test %d, opened the vault with %d credentials", i, len(vlt.Credentials))
+	}
+}
+
+func TestVaultKeyringOpen(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []struct {
+		name     string
+		label    string
+		password string
+	}{
+		{name: "prod.yml", label: "prod", password: "pr0d"},
+		{name: "dev.yml", password: "d3v"},
+	} {
+		vlt := NewVault()
+		vlt.SetPassword(f.password)
+		vlt.Header.Label = f.label
+		vlt.Credentials = []*VaultCredential{{Regex: f.name, Username: "admin", Password: f.password}}
+		if err := vlt.Save(filepath.Join(dir, f.name)); err != nil {
+			t.Fatalf("error saving vault %s: %s", f.name, err)
+		}
+	}
+	keyring := NewVaultKeyring()
+	for label, password := range map[string]string{"prod": "pr0d", "": "d3v"} {
+		if err := keyring.AddPassword(label, password); err != nil {
+			t.Fatalf("error adding password %s: %s", label, err)
+		}
+	}
+	if labels := keyring.Labels(); strings.Join(labels, ",") != "default,prod" {
+		t.Fatalf("keyring labels mismatch: %v", labels)
+	}
+	for i, test := range []struct {
+		name      string
+		shouldErr bool
+	}{
+		{name: "prod.yml"},
+		{name: "dev.yml"},
+		{name: "missing.yml", shouldErr: true},
+	} {
+		vlt, err := keyring.Open(filepath.Join(dir, test.name))
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error opening %s", i, test.name)
+			}
+			t.Logf("PASS: Test %d, %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error opening %s: %s", i, test.name, err)
+		}
+		if len(vlt.Credentials) != 1 || vlt.Credentials[0].Regex != test.name {
+			t.Fatalf("FAIL: Test %d, credentials mismatch in %s", i, test.name)
+		}
+		t.Logf("PASS: Test %d, opened %s", i, test.name)
+	}
+
+	prod := NewVaultKeyring()
+	prod.AddPassword("prod", "pr0d")
+	if _, err := prod.Open(filepath.Join(dir, "dev.yml")); err == nil {
+		t.Fatalf("expected error opening a vault without its password")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// onClose registers a resource, e.g. a watcher, to be released when the
+// Inventory is closed. The resources are released in the reverse order.
+func (inv *Inventory) onClose(c io.Closer) {
+	inv.lifecycleMu.Lock()
+	defer inv.lifecycleMu.Unlock()
+	if inv.closed {
+		c.Close()
+		return
+	}
+	inv.closers = append(inv.closers, c)
+}
+
+// Close releases the resources associated with the Inventory, e.g. the
+// watchers and the background goroutines. The hosts and the groups remain
+// available. The vault associated with the Inventory is not closed, because
+// it may be shared. Calling Close more than once is safe.
+func (inv *Inventory) Close() error {
+	inv.lifecycleMu.Lock()
+	closers := inv.closers
+	inv.closers = nil
+	inv.closed = true
+	inv.lifecycleMu.Unlock()
+	var err error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if e := closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Shutdown is the Close counterpart bounded by a context. It returns the
+// context error when the resources are not released in time.
+func (inv *Inventory) Shutdown(ctx context.Context) error {
+	return shutdown(ctx, inv)
+}
+
+// Close erases the passwords, the keys, the decrypted payload, and the
+// credentials of the Vault from memory. Calling Close more than once is
+// safe.
+func (v *Vault) Close() error {
+	secrets := [][]byte{v.Password, v.Key.Cipher, v.Key.HMAC, v.Key.InitializationVector, v.Payload}
+	for _, b := range v.keyring {
+		secrets = append(secrets, b)
+	}
+	for _, b := range secrets {
+		for i := range b {
+			b[i] = 0
+		}
+	}
+	for _, c := range v.Credentials {
+		c.Password = ""
+		c.EnabledPassword = ""
+	}
+	v.Password = nil
+	v.keyring = nil
+	v.Key = VaultKey{}
+	v.Payload = nil
+	v.Credentials = nil
+	return nil
+}
+
+// Close releases the idle connections of the HTTP client of the
+// RemoteSource, unless it is the shared http.DefaultClient. The cached data
+// remains available.
+func (s *RemoteSource) Close() error {
+	if s.Client != nil && s.Client != http.DefaultClient {
+		s.Client.CloseIdleConnections()
+	}
+	return nil
+}
+
+func shutdown(ctx context.Context, c io.Closer) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testCloser struct {
+	name   string
+	closed *[]string
+	delay  time.Duration
+}
+
+func (c *testCloser) Close() error {
+	time.Sleep(c.delay)
+	*c.closed = append(*c.closed, c.name)
+	return nil
+}
+
+func TestInventoryClose(t *testing.T) {
+	var closed []string
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	inv.onClose(&testCloser{name: "first", closed: &closed})
+	inv.onClose(&testCloser{name: "second", closed: &closed})
+	if err := inv.Close(); err != nil {
+		t.Fatalf("error closing inventory: %s", err)
+	}
+	if err := inv.Close(); err != nil {
+		t.Fatalf("error closing inventory twice: %s", err)
+	}
+	if len(closed) != 2 || closed[0] != "second" || closed[1] != "first" {
+		t.Fatalf("resources must be released once, in reverse order: %v", closed)
+	}
+	// a resource registered after Close is released immediately
+	inv.onClose(&testCloser{name: "late", closed: &closed})
+	if len(closed) != 3 {
+		t.Fatalf("late resource was not released: %v", closed)
+	}
+	if _, err := inv.GetHost("ny-sw01"); err != nil {
+		t.Fatalf("hosts must remain available after Close: %s", err)
+	}
+
+	inv = NewInventory()
+	inv.onClose(&testCloser{name: "slow", closed: &closed, delay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := inv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected shutdown deadline error, received: %v", err)
+	}
+}
+
+func TestVaultClose(t *testing.T) {
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error reading vault key: %s", err)
+	}
+	if err := vlt.LoadFromFile("../../testdata/inventory/vault.yml"); err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	password := vlt.Password
+	creds := vlt.Credentials
+	if err := vlt.Close(); err != nil {
+		t.Fatalf("error closing vault: %s", err)
+	}
+	for _, b := range password {
+		if b != 0 {
+			t.Fatalf("vault password was not erased")
+		}
+	}
+	for _, c := range creds {
+		if c.Password != "" || c.EnabledPassword != "" {
+			t.Fatalf("vault credentials were not erased")
+		}
+	}
+	if vlt.Password != nil || vlt.Credentials != nil || vlt.Payload != nil {
+		t.Fatalf("vault secrets were not released")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The resources a LimitError refers to.
+const (
+	LimitFileSize         = "file size"
+	LimitHosts            = "hosts"
+	LimitGroupDepth       = "group depth"
+	LimitVaultPayloadSize = "vault payload size"
+)
+
+// LimitError is the error returned when the input exceeds one of the
+// limits configured with WithMaxFileSize, WithMaxHosts, WithMaxGroupDepth,
+// WithVaultMaxFileSize, or WithVaultMaxPayloadSize.
+type LimitError struct {
+	// Limit is one of LimitFileSize, LimitHosts, LimitGroupDepth, or
+	// LimitVaultPayloadSize.
+	Limit string
+	Value int64
+	Max   int64
+}
+
+// Error returns the string representation of a LimitError.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %d exceeds the limit of %d", e.Limit, e.Value, e.Max)
+}
+
+// IsLimitError returns the LimitError the error is or wraps, if any.
+func IsLimitError(err error) (*LimitError, bool) {
+	var e *LimitError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// checkLimit returns a LimitError when the value exceeds the positive
+// maximum.
+func checkLimit(limit string, value, max int64) error {
+	if max > 0 && value > max {
+		return &LimitError{Limit: limit, Value: value, Max: max}
+	}
+	return nil
+}
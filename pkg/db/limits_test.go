@@ -0,0 +1,76 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"testing"
+)
+
+func TestResourceLimits(t *testing.T) {
+	for i, test := range []struct {
+		opts  []InventoryOption
+		input string
+		file  string
+		limit string
+	}{
+		{opts: []InventoryOption{WithMaxFileSize(16)}, input: "[web]\nweb01\nweb02\n", limit: LimitFileSize},
+		{opts: []InventoryOption{WithMaxFileSize(16)}, file: "../../testdata/inventory/hosts", limit: LimitFileSize},
+		{opts: []InventoryOption{WithMaxHosts(2)}, input: "[web]\nweb01\nweb02\nweb03\n", limit: LimitHosts},
+		{opts: []InventoryOption{WithMaxHosts(5)}, file: "../../testdata/inventory/hosts"},
+		{opts: []InventoryOption{WithMaxGroupDepth(2)}, file: "../../testdata/inventory/hosts", limit: LimitGroupDepth},
+		{opts: []InventoryOption{WithMaxGroupDepth(4)}, file: "../../testdata/inventory/hosts"},
+	} {
+		inv := NewInventory(test.opts...)
+		var err error
+		if test.file != "" {
+			err = inv.LoadFromFile(test.file)
+		} else {
+			err = inv.LoadFromBytes([]byte(test.input))
+		}
+		if test.limit == "" {
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+			}
+			t.Logf("PASS: Test %d, loaded %d hosts", i, inv.Size())
+			continue
+		}
+		e, ok := IsLimitError(err)
+		if !ok {
+			t.Fatalf("FAIL: Test %d, expected %s limit error, received: %v", i, test.limit, err)
+		}
+		if e.Limit != test.limit {
+			t.Fatalf("FAIL: Test %d, limit mismatch: %s (expected) vs. %s (received)", i, test.limit, e.Limit)
+		}
+		t.Logf("PASS: Test %d, %s", i, err)
+	}
+
+	for i, max := range []int64{16, 0} {
+		vlt := NewVault(WithVaultMaxPayloadSize(max))
+		if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+			t.Fatal(err)
+		}
+		err := vlt.LoadFromFile("../../testdata/inventory/vault.yml")
+		if max == 0 {
+			if err != nil {
+				t.Fatalf("FAIL: Vault Test %d, unexpected error: %s", i, err)
+			}
+			continue
+		}
+		if e, ok := IsLimitError(err); !ok || e.Limit != LimitVaultPayloadSize {
+			t.Fatalf("FAIL: Vault Test %d, expected vault payload size limit error, received: %v", i, err)
+		}
+		t.Logf("PASS: Vault Test %d, %s", i, err)
+	}
+}
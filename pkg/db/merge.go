@@ -0,0 +1,151 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+)
+
+// MergeStrategy determines how Merge resolves a variable defined with
+// different values by both inventories.
+type MergeStrategy string
+
+// The strategies of Merge.
+const (
+	// MergeKeepFirst keeps the value of the Inventory being merged into.
+	MergeKeepFirst MergeStrategy = "keep-first"
+	// MergeKeepLast keeps the value of the other Inventory, the way the
+	// later of multiple "ansible -i" sources takes precedence.
+	MergeKeepLast MergeStrategy = "keep-last"
+	// MergeError fails the merge.
+	MergeError MergeStrategy = "error"
+)
+
+// Merge combines the hosts, the groups, and the variables of another
+// Inventory into the Inventory, e.g. a static inventory and a generated
+// one. The groups are the union of the group hierarchies. A host with
+// different parent groups in the inventories is a member of all of them,
+// see ExtraParents, unless the strategy is MergeError. The provided
+// strategy resolves the variables of a host or a group defined with
+// different values by both inventories. The host variables are merged before the group
+// variables are inherited again. The other Inventory is not modified.
+// When the merge fails, the Inventory is left unchanged.
+func (inv *Inventory) Merge(other *Inventory, strategy MergeStrategy) error {
+	switch strategy {
+	case MergeKeepFirst, MergeKeepLast, MergeError:
+	default:
+		return fmt.Errorf("unsupported merge strategy: %s", strategy)
+	}
+	if other == nil {
+		return fmt.Errorf("inventory to merge is nil")
+	}
+	src := other.Clone()
+	return inv.edit(func(c *Inventory) error {
+		return c.merge(src, strategy)
+	})
+}
+
+// merge adds the hosts and the groups of another Inventory, see Merge.
+// The hosts of both inventories exclude the inherited variables.
+func (inv *Inventory) merge(src *Inventory, strategy MergeStrategy) error {
+	for _, g := range src.Groups {
+		cg := inv.existingGroup(g.Name)
+		if cg == nil {
+			g.Counters = InventoryGroupCounters{}
+			g.inventory = inv
+			inv.Groups = append(inv.Groups, g)
+			inv.GroupsRef[g.Name] = true
+			inv.indexGroup(g)
+			continue
+		}
+		for _, a := range g.Ancestors {
+			if err := inv.AddGroup(g.Name, a); err != nil {
+				return err
+			}
+		}
+		if err := mergeVariables(strategy, "group "+g.Name, &cg.Variables, &cg.Templated, &cg.VariableSources, g.Variables, g.Templated, g.VariableSources); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range src.Hosts {
+		dropInheritedVariables(h)
+		ch := inv.lookupHost(h.Name)
+		if ch == nil {
+			if err := checkLimit(LimitHosts, int64(len(inv.Hosts)+1), int64(inv.maxHosts)); err != nil {
+				return err
+			}
+			h.Groups = nil
+			h.GroupChains = nil
+			inv.Hosts = append(inv.Hosts, h)
+			inv.HostsRef[h.Name] = h.Parent
+			inv.indexHost(h)
+			continue
+		}
+		// As in "ansible -i a -i b", the host is a member of the groups of
+		// both inventories.
+		for _, p := range append([]string{h.Parent}, h.ExtraParents...) {
+			switch {
+			case p == "ungrouped", ch.hasParent(p):
+			case strategy == MergeError:
+				return errorWithCode(ErrDuplicateHost, "host '%s' is a member of group '%s' and group '%s'", h.Name, ch.Parent, p)
+			case ch.Parent == "ungrouped":
+				ch.Parent = p
+				inv.HostsRef[h.Name] = p
+			default:
+				ch.ExtraParents = append(ch.ExtraParents, p)
+			}
+		}
+		if err := mergeVariables(strategy, "host "+h.Name, &ch.Variables, &ch.Templated, &ch.VariableSources, h.Variables, h.Templated, h.VariableSources); err != nil {
+			return err
+		}
+		ch.AddTag(h.Tags...)
+		ch.Implicit = ch.Implicit && h.Implicit
+	}
+
+	return nil
+}
+
+// mergeVariables merges the variables of a host or a group of another
+// Inventory, along with whether they are templated and their sources,
+// resolving the conflicts with the provided strategy.
+func mergeVariables(strategy MergeStrategy, owner string, dst *map[string]string, dstTemplated *map[string]bool, dstSources *map[string]string, src map[string]string, srcTemplated map[string]bool, srcSources map[string]string) error {
+	if *dst == nil {
+		*dst = make(map[string]string)
+	}
+	for k, v := range src {
+		if old, exists := (*dst)[k]; exists && old != v {
+			switch strategy {
+			case MergeKeepFirst:
+				continue
+			case MergeError:
+				return errorWithCode(ErrInvalidVariable, "variable '%s' of %s has conflicting values %q and %q", k, owner, old, v)
+			}
+		}
+		(*dst)[k] = v
+		if s, exists := srcSources[k]; exists {
+			setVariableSource(dstSources, k, s)
+		}
+		if srcTemplated[k] {
+			if *dstTemplated == nil {
+				*dstTemplated = make(map[string]bool)
+			}
+			(*dstTemplated)[k] = true
+		} else {
+			delete(*dstTemplated, k)
+		}
+	}
+	return nil
+}
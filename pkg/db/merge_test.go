@@ -0,0 +1,161 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInventoryMerge(t *testing.T) {
+	static := []byte(`[web]
+web01 http_port=80
+web02 http_port=80
+
+[web:vars]
+env=dev
+log_level=debug
+`)
+	generated := []byte(`[web]
+web02 http_port=443
+web03
+
+[web:vars]
+env=prod
+
+[db]
+db01
+`)
+	load := func(b []byte) *Inventory {
+		inv := NewInventory()
+		if err := inv.LoadFromBytes(b); err != nil {
+			t.Fatalf("error reading inventory: %s", err)
+		}
+		return inv
+	}
+
+	for i, test := range []struct {
+		strategy  MergeStrategy
+		shouldErr bool
+		err       error
+		values    map[string]string
+	}{
+		{
+			strategy: MergeKeepLast,
+			values: map[string]string{
+				"web01.http_port": "80",
+				"web01.env":       "prod",
+				"web01.log_level": "debug",
+				"web02.http_port": "443",
+				"web03.env":       "prod",
+				"db01.env":        "",
+			},
+		},
+		{
+			strategy: MergeKeepFirst,
+			values: map[string]string{
+				"web01.env":       "dev",
+				"web02.http_port": "80",
+				"web03.env":       "dev",
+			},
+		},
+		{strategy: MergeError, shouldErr: true, err: ErrInvalidVariable},
+		{strategy: MergeStrategy("unknown"), shouldErr: true},
+	} {
+		inv := load(static)
+		err := inv.Merge(load(generated), test.strategy)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error, but passed", i)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Fatalf("FAIL: Test %d, error mismatch: %v (expected) vs. %v (received)", i, test.err, err)
+			}
+			if inv.Size() != 2 {
+				t.Fatalf("FAIL: Test %d, inventory modified by the failed merge, size: %d", i, inv.Size())
+			}
+			t.Logf("PASS: Test %d, strategy %s, error: %s", i, test.strategy, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		if inv.Size() != 4 {
+			t.Fatalf("FAIL: Test %d, inventory size mismatch: 4 (expected) vs. %d (received)", i, inv.Size())
+		}
+		for k, v := range test.values {
+			name, key, _ := strings.Cut(k, ".")
+			h, err := inv.GetHost(name)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, error getting host %s: %s", i, name, err)
+			}
+			if h.Variables[key] != v {
+				t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %q (expected) vs. %q (received)", i, name, key, v, h.Variables[key])
+			}
+		}
+		g, err := inv.GetGroup("web")
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting group web: %s", i, err)
+		}
+		if g.Counters.Hosts != 3 {
+			t.Fatalf("FAIL: Test %d, group web host counter mismatch: 3 (expected) vs. %d (received)", i, g.Counters.Hosts)
+		}
+		t.Logf("PASS: Test %d, strategy %s", i, test.strategy)
+	}
+}
+
+func TestInventoryMergeParentConflict(t *testing.T) {
+	for i, test := range []struct {
+		strategy  MergeStrategy
+		parent    string
+		shouldErr bool
+	}{
+		{strategy: MergeKeepFirst, parent: "web"},
+		{strategy: MergeKeepLast, parent: "web"},
+		{strategy: MergeError, shouldErr: true},
+	} {
+		a := NewInventory()
+		if err := a.LoadFromBytes([]byte("[web]\nhost01\n")); err != nil {
+			t.Fatalf("error reading inventory: %s", err)
+		}
+		b := NewInventory()
+		if err := b.LoadFromBytes([]byte("[db]\nhost01\n")); err != nil {
+			t.Fatalf("error reading inventory: %s", err)
+		}
+		err := a.Merge(b, test.strategy)
+		if test.shouldErr {
+			if !errors.Is(err, ErrDuplicateHost) {
+				t.Fatalf("FAIL: Test %d, error mismatch: %v (expected) vs. %v (received)", i, ErrDuplicateHost, err)
+			}
+			t.Logf("PASS: Test %d, strategy %s, error: %s", i, test.strategy, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		h, err := a.GetHost("host01")
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host: %s", i, err)
+		}
+		if h.Parent != test.parent {
+			t.Fatalf("FAIL: Test %d, parent mismatch: %s (expected) vs. %s (received)", i, test.parent, h.Parent)
+		}
+		if !stringInList("db", h.Groups) || !stringInList("web", h.Groups) {
+			t.Fatalf("FAIL: Test %d, groups mismatch: [web db] (expected) vs. %v (received)", i, h.Groups)
+		}
+		t.Logf("PASS: Test %d, strategy %s, parent %s, groups %v", i, test.strategy, h.Parent, h.Groups)
+	}
+}
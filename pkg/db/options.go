@@ -0,0 +1,329 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// InventoryOption configures an Inventory created by NewInventory.
+type InventoryOption func(*Inventory)
+
+// VaultOption configures a Vault created by NewVault.
+type VaultOption func(*Vault)
+
+// WithStrictMode controls whether parsing fails on inventory groups without
+// hosts. When disabled, such groups are reported via the logger, as Ansible
+// tolerates them, e.g. placeholder groups in [x:children] trees. The strict
+// mode is disabled by default, see Inventory.SetStrict.
+func WithStrictMode(enabled bool) InventoryOption {
+	return func(inv *Inventory) {
+		inv.strict = enabled
+	}
+}
+
+// WithStrictGroups is the shorthand for WithStrictMode(true).
+func WithStrictGroups() InventoryOption {
+	return WithStrictMode(true)
+}
+
+// WithMaxFileSize limits the size, in bytes, of the files the Inventory
+// loads. Zero means no limit.
+func WithMaxFileSize(n int64) InventoryOption {
+	return func(inv *Inventory) {
+		inv.maxFileSize = n
+	}
+}
+
+// WithMaxHosts limits the number of hosts in the Inventory. Zero means no
+// limit.
+func WithMaxHosts(n int) InventoryOption {
+	return func(inv *Inventory) {
+		inv.maxHosts = n
+	}
+}
+
+// WithMaxGroupDepth limits the number of groups in a group chain, i.e. the
+// nesting of the children groups. Zero means no limit.
+func WithMaxGroupDepth(n int) InventoryOption {
+	return func(inv *Inventory) {
+		inv.maxGroupDepth = n
+	}
+}
+
+// WithMaxDepth is the shorthand for WithMaxGroupDepth.
+func WithMaxDepth(n int) InventoryOption {
+	return WithMaxGroupDepth(n)
+}
+
+// WithCaseInsensitiveHostnames makes the Inventory store and look up host
+// names in lower case.
+func WithCaseInsensitiveHostnames() InventoryOption {
+	return func(inv *Inventory) {
+		inv.foldHostnames = true
+	}
+}
+
+// WithLazyResolution makes the Inventory resolve the group chains, the
+// groups, and the inherited variables of a host when the host is first
+// looked up, e.g. with GetHost, instead of when the inventory is loaded,
+// so that loading a large inventory to query a few hosts does not pay for
+// the others. The Hosts field holds unresolved hosts until Precompute.
+func WithLazyResolution() InventoryOption {
+	return func(inv *Inventory) {
+		inv.lazy = true
+	}
+}
+
+// WithPreservedTemplates is the option form of SetPreserveTemplates.
+func WithPreservedTemplates() InventoryOption {
+	return func(inv *Inventory) {
+		inv.preserveTemplates = true
+	}
+}
+
+// WithRawData makes the Inventory keep the data it loads, as read, in Raw.
+// By default, the data is discarded once parsed.
+func WithRawData() InventoryOption {
+	return func(inv *Inventory) {
+		inv.keepRaw = true
+	}
+}
+
+// WithoutRawRetention makes the Inventory discard the data it loads once
+// parsed, the default, overriding a WithRawData option provided earlier,
+// e.g. by a shared set of options.
+func WithoutRawRetention() InventoryOption {
+	return func(inv *Inventory) {
+		inv.keepRaw = false
+	}
+}
+
+// WithLogger sets the logger of the Inventory.
+func WithLogger(logger Logger) InventoryOption {
+	return func(inv *Inventory) {
+		if logger != nil {
+			inv.logger = logger
+		}
+	}
+}
+
+// WithVault is the option form of SetVault.
+func WithVault(v *Vault) InventoryOption {
+	return func(inv *Inventory) {
+		inv.vault = v
+	}
+}
+
+// WithCacheFile makes LoadFromFile keep a binary snapshot of the parsed
+// inventory in the provided file. The snapshot is used instead of parsing
+// when it was created from the same inventory file with the same content,
+// i.e. the path and the SHA-256 digest of the file match the ones recorded
+// in the snapshot. The snapshot is not used with WithSignatureVerification.
+func WithCacheFile(fp string) InventoryOption {
+	return func(inv *Inventory) {
+		inv.cacheFile = expandFilePath(fp)
+	}
+}
+
+// WithSignatureVerification makes the Inventory verify the Ed25519
+// signature of the files it loads, see SignFile, before using them. The
+// signature of a file is expected in the file with the ".sig" suffix.
+func WithSignatureVerification(key ed25519.PublicKey) InventoryOption {
+	return func(inv *Inventory) {
+		inv.verifyKey = key
+	}
+}
+
+// WithVaultVersions limits the vault format versions the Vault accepts.
+// By default, the Vault accepts the 1.1 and 1.2 formats.
+func WithVaultVersions(versions ...string) VaultOption {
+	return func(v *Vault) {
+		v.versions = newVaultVersions(versions...)
+	}
+}
+
+// WithVaultMaxFileSize limits the size, in bytes, of the files the Vault
+// loads. Zero means no limit.
+func WithVaultMaxFileSize(n int64) VaultOption {
+	return func(v *Vault) {
+		v.maxFileSize = n
+	}
+}
+
+// WithVaultMaxPayloadSize limits the size, in bytes, of the encrypted
+// payload the Vault decrypts, e.g. of a vault-encrypted inventory. Zero
+// means no limit.
+func WithVaultMaxPayloadSize(n int64) VaultOption {
+	return func(v *Vault) {
+		v.maxPayloadSize = n
+	}
+}
+
+// WithVaultLogger sets the logger of the Vault.
+func WithVaultLogger(logger Logger) VaultOption {
+	return func(v *Vault) {
+		if logger != nil {
+			v.logger = logger
+		}
+	}
+}
+
+// WatchOption configures a WatchedInventory created by
+// NewWatchedInventory.
+type WatchOption func(*WatchedInventory)
+
+// WithWatchInterval sets how often the WatchedInventory checks its files
+// for changes. The default interval is 2 seconds.
+func WithWatchInterval(d time.Duration) WatchOption {
+	return func(w *WatchedInventory) {
+		if d > 0 {
+			w.interval = d
+		}
+	}
+}
+
+// WithWatchedVault makes the WatchedInventory load, and reload, the vault
+// file with the passwords of the provided Vault. The vault is associated
+// with the inventory, e.g. to decrypt inline vault values.
+func WithWatchedVault(v *Vault, fp string) WatchOption {
+	return func(w *WatchedInventory) {
+		w.vaultKeys = v
+		w.vaultFile = expandFilePath(fp)
+	}
+}
+
+// WithWatchInventoryOptions sets the options of the inventories the
+// WatchedInventory loads.
+func WithWatchInventoryOptions(opts ...InventoryOption) WatchOption {
+	return func(w *WatchedInventory) {
+		w.inventoryOpts = append(w.inventoryOpts, opts...)
+	}
+}
+
+// WithWatchLogger sets the logger of the WatchedInventory, e.g. reporting
+// the failed reloads.
+func WithWatchLogger(logger Logger) WatchOption {
+	return func(w *WatchedInventory) {
+		if logger != nil {
+			w.logger = logger
+		}
+	}
+}
+
+// readFile reads a file, unless it exceeds the provided size limit. The
+// gzip and zstd compressed files are decompressed transparently.
+func readFile(fp string, limit int64) ([]byte, error) {
+	b, err := readRawFile(fp, limit)
+	if err != nil {
+		return nil, err
+	}
+	b, err = decompress(b, limit)
+	if err != nil {
+		return nil, fmt.Errorf("file %s: %w", fp, err)
+	}
+	return b, nil
+}
+
+// readRawFile reads a file as stored, i.e. without decompressing it,
+// unless it exceeds the provided size limit.
+func readRawFile(fp string, limit int64) ([]byte, error) {
+	if limit > 0 {
+		fi, err := os.Stat(fp)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkLimit(LimitFileSize, fi.Size(), limit); err != nil {
+			return nil, fmt.Errorf("file %s: %w", fp, err)
+		}
+	}
+	return os.ReadFile(fp)
+}
+
+// hostname returns the name under which the Inventory stores a host.
+func (inv *Inventory) hostname(s string) string {
+	if inv.foldHostnames {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// cacheHeader returns the first line of the cache file of an inventory
+// file, i.e. the absolute path and the SHA-256 digest of the content the
+// cache was created from.
+func cacheHeader(fp string, b []byte) string {
+	if abs, err := filepath.Abs(fp); err == nil {
+		fp = abs
+	}
+	return fmt.Sprintf("source %s sha256 %x\n", fp, sha256.Sum256(b))
+}
+
+// loadFromCache loads the Inventory from the cache file, when the cache
+// was created from the provided content of the inventory file. The cache
+// is not used when the Inventory verifies the signature of its files,
+// because the cache is not signed.
+func (inv *Inventory) loadFromCache(fp string, src []byte) bool {
+	if inv.cacheFile == "" || inv.verifyKey != nil {
+		return false
+	}
+	b, err := readFile(inv.cacheFile, 0)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			inv.logger.Warnf("failed opening inventory cache %s: %s", inv.cacheFile, err)
+		}
+		return false
+	}
+	header := cacheHeader(fp, src)
+	if !bytes.HasPrefix(b, []byte(header)) {
+		inv.logger.Debugf("inventory cache %s is not the cache of %s", inv.cacheFile, fp)
+		return false
+	}
+	if err := inv.Decode(bytes.NewReader(b[len(header):])); err != nil {
+		inv.logger.Warnf("failed reading inventory cache %s: %s", inv.cacheFile, err)
+		return false
+	}
+	inv.logger.Debugf("loaded inventory %s from cache %s", fp, inv.cacheFile)
+	return true
+}
+
+// saveToCache writes the Inventory to the cache file, with the header
+// identifying the content of the inventory file, see loadFromCache.
+func (inv *Inventory) saveToCache(fp string, src []byte) {
+	if inv.cacheFile == "" || inv.dryRun || inv.verifyKey != nil {
+		return
+	}
+	f, err := createFile(inv.cacheFile)
+	if err != nil {
+		inv.logger.Warnf("failed creating inventory cache %s: %s", inv.cacheFile, err)
+		return
+	}
+	defer f.Close()
+	if _, err := io.WriteString(f, cacheHeader(fp, src)); err != nil {
+		inv.logger.Warnf("failed writing inventory cache %s: %s", inv.cacheFile, err)
+		return
+	}
+	if err := inv.Encode(f); err != nil {
+		inv.logger.Warnf("failed writing inventory cache %s: %s", inv.cacheFile, err)
+	}
+}
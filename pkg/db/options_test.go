@@ -0,0 +1,297 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	warnings []string
+	debugs   []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.debugs = append(l.debugs, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestInventoryOptions(t *testing.T) {
+	logger := &testLogger{}
+	for i, test := range []struct {
+		opts      []InventoryOption
+		input     []byte
+		inputFile string
+		host      string
+		warnings  int
+		shouldErr bool
+	}{
+		{
+			opts:      []InventoryOption{WithStrictMode(true)},
+			input:     []byte("[web]\nweb01\n\n[db]\n"),
+			shouldErr: true,
+		},
+		{
+			opts:     []InventoryOption{WithLogger(logger)},
+			input:    []byte("[web]\nweb01\n\n[db]\n"),
+			host:     "web01",
+			warnings: 1,
+		},
+		{
+			opts:     []InventoryOption{WithStrictMode(false), WithLogger(logger)},
+			input:    []byte("[web]\nweb01\n\n[db]\n"),
+			host:     "web01",
+			warnings: 1,
+		},
+		{
+			opts:      []InventoryOption{WithStrictGroups()},
+			input:     []byte("[web]\nweb01\n\n[db]\n"),
+			shouldErr: true,
+		},
+		{
+			opts:      []InventoryOption{WithMaxDepth(2)},
+			inputFile: "../../testdata/inventory/hosts",
+			shouldErr: true,
+		},
+		{
+			opts:      []InventoryOption{WithMaxDepth(32)},
+			inputFile: "../../testdata/inventory/hosts",
+			host:      "ny-sw01",
+		},
+		{
+			opts:      []InventoryOption{WithMaxFileSize(16)},
+			inputFile: "../../testdata/inventory/hosts",
+			shouldErr: true,
+		},
+		{
+			opts:      []InventoryOption{WithCaseInsensitiveHostnames()},
+			inputFile: "../../testdata/inventory/hosts",
+			host:      "NY-SW01",
+		},
+	} {
+		logger.warnings = nil
+		inv := NewInventory(test.opts...)
+		var err error
+		if test.inputFile == "" {
+			err = inv.LoadFromBytes(test.input)
+		} else {
+			err = inv.LoadFromFile(test.inputFile)
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Fatalf("FAIL: Test %d: expected to pass, but threw error: %v", i, err)
+			}
+			t.Logf("PASS: Test %d: expected to fail, failed: %s", i, err)
+			continue
+		}
+		if test.shouldErr {
+			t.Fatalf("FAIL: Test %d: expected to throw error, but passed", i)
+		}
+		if _, err := inv.GetHost(test.host); err != nil {
+			t.Fatalf("FAIL: Test %d: error getting host %s: %s", i, test.host, err)
+		}
+		if len(logger.warnings) != test.warnings {
+			t.Fatalf("FAIL: Test %d: warnings count mismatch: %d (expected) vs. %d (received): %v", i, test.warnings, len(logger.warnings), logger.warnings)
+		}
+		t.Logf("PASS: Test %d: host %s found", i, test.host)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	logger := &testLogger{}
+	inv := NewInventory()
+	inv.SetLogger(logger)
+	if err := inv.LoadFromBytes([]byte("[web]\nweb01 env=dev\nweb01 env=test\n\n[db]\n\n[web:vars]\nsite=ny\nsite=nj\n")); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	expected := []string{"variable env of host web01 overridden", "variable site of group web overridden"}
+	if !reflect.DeepEqual(logger.debugs, expected) {
+		t.Fatalf("FAIL: inventory debug messages mismatch: %v (expected) vs. %v (received)", expected, logger.debugs)
+	}
+	if len(logger.warnings) != 1 || logger.warnings[0] != "inventory group 'db' has no hosts" {
+		t.Fatalf("FAIL: inventory warnings mismatch: %v", logger.warnings)
+	}
+	inv.SetLogger(nil)
+	if err := inv.AddVariable("site=ca", "web"); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.debugs) != 2 {
+		t.Fatalf("FAIL: inventory logged after its logger was unset: %v", logger.debugs)
+	}
+	t.Logf("PASS: inventory messages: %v, %v", logger.debugs, logger.warnings)
+
+	logger = &testLogger{}
+	b, err := encryptVault([]byte("credentials: []\n"), []byte("secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vlt := NewVault()
+	vlt.SetLogger(logger)
+	if err := vlt.SetPassword("other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vlt.AddVaultID("prod", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vlt.LoadFromBytes(b); err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	if !reflect.DeepEqual(logger.debugs, []string{"vault unlocked with candidate password 2 of 2"}) || !reflect.DeepEqual(logger.warnings, []string{"vault has no credentials"}) {
+		t.Fatalf("FAIL: vault messages mismatch: %v, %v", logger.debugs, logger.warnings)
+	}
+	t.Logf("PASS: vault messages: %v, %v", logger.debugs, logger.warnings)
+}
+
+func TestInventoryRawRetention(t *testing.T) {
+	input := []byte("[web]\nweb01\n")
+	for i, test := range []struct {
+		opts []InventoryOption
+		raw  bool
+	}{
+		{},
+		{opts: []InventoryOption{WithRawData()}, raw: true},
+		{opts: []InventoryOption{WithRawData(), WithoutRawRetention()}},
+	} {
+		inv := NewInventory(test.opts...)
+		if err := inv.LoadFromBytes(input); err != nil {
+			t.Fatalf("FAIL: Test %d: unexpected error: %s", i, err)
+		}
+		if (inv.Raw != nil) != test.raw {
+			t.Fatalf("FAIL: Test %d: raw data retention mismatch: %t (expected) vs. %t (received)", i, test.raw, inv.Raw != nil)
+		}
+		t.Logf("PASS: Test %d: raw data retained: %t", i, test.raw)
+	}
+}
+
+func TestInventorySetStrict(t *testing.T) {
+	input := []byte("[web]\nweb01\n\n[db]\n")
+	inv := NewInventory()
+	inv.SetStrict(true)
+	if err := inv.LoadFromBytes(input); err == nil {
+		t.Fatalf("expected error for an empty group in strict mode, but passed")
+	}
+	inv = NewInventory(WithStrictMode(true))
+	inv.SetStrict(false)
+	if err := inv.LoadFromBytes(input); err != nil {
+		t.Fatalf("unexpected error for an empty group in lenient mode: %s", err)
+	}
+}
+
+func TestInventoryCacheFile(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "hosts.cache")
+	inv := NewInventory(WithCacheFile(cacheFile))
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if _, err := os.Stat(cacheFile); err != nil {
+		t.Fatalf("inventory cache file was not created: %s", err)
+	}
+	cached := NewInventory(WithCacheFile(cacheFile), WithStrictMode(true))
+	if err := cached.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory from cache: %s", err)
+	}
+	if cached.Size() != inv.Size() {
+		t.Fatalf("cached inventory size mismatch: %d (expected) vs. %d (received)", inv.Size(), cached.Size())
+	}
+	if !cached.strict {
+		t.Fatalf("loading from cache must not reset inventory options")
+	}
+}
+
+func TestInventoryCacheFileSource(t *testing.T) {
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, "hosts.cache")
+	fp := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(fp, []byte("[web]\nweb01\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewInventory(WithCacheFile(cacheFile)).LoadFromFile(fp); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	other := filepath.Join(dir, "hosts2")
+	if err := os.WriteFile(other, []byte("[web]\nweb01\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range []struct {
+		name   string
+		fp     string
+		src    string
+		opts   []InventoryOption
+		cached bool
+	}{
+		{name: "same content", fp: fp, src: "[web]\nweb01\n", cached: true},
+		{name: "changed content", fp: fp, src: "[web]\nweb02\n"},
+		{name: "other file", fp: other, src: "[web]\nweb01\n"},
+		{name: "signature verification", fp: fp, src: "[web]\nweb01\n", opts: []InventoryOption{WithSignatureVerification(pub)}},
+	} {
+		inv := NewInventory(append([]InventoryOption{WithCacheFile(cacheFile)}, test.opts...)...)
+		if cached := inv.loadFromCache(test.fp, []byte(test.src)); cached != test.cached {
+			t.Fatalf("FAIL: Test %d, %s: cache use mismatch: %t (expected) vs. %t (received)", i, test.name, test.cached, cached)
+		}
+		t.Logf("PASS: Test %d, %s: cache used: %t", i, test.name, test.cached)
+	}
+
+	// The cache older than the inventory file is not used when the
+	// content of the file changes, whatever the modification times.
+	if err := os.WriteFile(fp, []byte("[web]\nweb02\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(fp, past, past); err != nil {
+		t.Fatal(err)
+	}
+	inv := NewInventory(WithCacheFile(cacheFile))
+	if err := inv.LoadFromFile(fp); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if _, err := inv.GetHost("web02"); err != nil {
+		t.Fatalf("inventory loaded from a stale cache: %s", err)
+	}
+}
+
+func TestVaultOptions(t *testing.T) {
+	for i, test := range []struct {
+		opts      []VaultOption
+		shouldErr bool
+	}{
+		{},
+		{opts: []VaultOption{WithVaultVersions("1.2")}, shouldErr: true},
+		{opts: []VaultOption{WithVaultMaxFileSize(64)}, shouldErr: true},
+	} {
+		vlt := NewVault(test.opts...)
+		if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+			t.Fatalf("error reading vault key file: %s", err)
+		}
+		err := vlt.LoadFromFile("../../testdata/inventory/vault.yml")
+		if (err != nil) != test.shouldErr {
+			t.Fatalf("FAIL: Test %d: error mismatch, expected error: %t, error: %v", i, test.shouldErr, err)
+		}
+		t.Logf("PASS: Test %d: error: %v", i, err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+)
+
+// LoadWithOverlays loads a base inventory file followed by overlay files,
+// e.g. per environment (dev, staging, prod). The overlays may add hosts and
+// groups, and override the variables of existing hosts and groups. The
+// precedence is base < first overlay < ... < last overlay. Host variables
+// still take precedence over group variables.
+func (inv *Inventory) LoadWithOverlays(base string, overlays ...string) error {
+	for i, fp := range append([]string{base}, overlays...) {
+		fp = expandFilePath(fp)
+		b, err := inv.readVerifiedFile(fp)
+		if err != nil {
+			return err
+		}
+		b, err = inv.decryptSource(b)
+		if err != nil {
+			return err
+		}
+		if err := inv.withSource(fp, func() error { return inv.parseLines(string(b[:])) }); err != nil {
+			if i == 0 {
+				return fmt.Errorf("base inventory %s: %s", fp, err)
+			}
+			return fmt.Errorf("overlay inventory %s: %s", fp, err)
+		}
+		inv.logger.Debugf("loaded inventory layer %d from %s", i, fp)
+	}
+	return inv.finalize()
+}
+
+// LoadFromBytesWithOverlays is the LoadWithOverlays counterpart operating
+// on arrays of bytes.
+func (inv *Inventory) LoadFromBytesWithOverlays(base []byte, overlays ...[]byte) error {
+	if err := inv.checkUnsigned(); err != nil {
+		return err
+	}
+	for i, b := range append([][]byte{base}, overlays...) {
+		b, err := inv.decryptSource(b)
+		if err != nil {
+			return err
+		}
+		var source string
+		if i > 0 {
+			source = fmt.Sprintf("overlay %d", i)
+		}
+		if err := inv.withSource(source, func() error { return inv.parseLines(string(b[:])) }); err != nil {
+			if i == 0 {
+				return fmt.Errorf("base inventory: %s", err)
+			}
+			return fmt.Errorf("overlay inventory %d: %s", i, err)
+		}
+	}
+	return inv.finalize()
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"testing"
+)
+
+func TestLoadWithOverlays(t *testing.T) {
+	base := []byte(`[web]
+web01 http_port=80
+web02 http_port=80
+
+[web:vars]
+env=dev
+log_level=debug
+`)
+	prod := []byte(`[web]
+web02 http_port=443
+web03
+
+[web:vars]
+env=prod
+
+[db]
+db01
+`)
+	inv := NewInventory()
+	if err := inv.LoadFromBytesWithOverlays(base, prod); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if inv.Size() != 4 {
+		t.Fatalf("inventory size mismatch: 4 (expected) vs. %d (received)", inv.Size())
+	}
+	for i, test := range []struct {
+		host  string
+		key   string
+		value string
+	}{
+		{host: "web01", key: "http_port", value: "80"},
+		{host: "web01", key: "env", value: "prod"},
+		{host: "web01", key: "log_level", value: "debug"},
+		{host: "web02", key: "http_port", value: "443"},
+		{host: "web03", key: "env", value: "prod"},
+	} {
+		host, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s: %s", i, test.host, err)
+		}
+		if host.Variables[test.key] != test.value {
+			t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)", i, test.host, test.key, test.value, host.Variables[test.key])
+		}
+		t.Logf("PASS: Test %d, host %s, %s=%s", i, test.host, test.key, test.value)
+	}
+
+	inv = NewInventory()
+	if err := inv.LoadFromBytesWithOverlays(base, []byte("[db]\nweb01\n")); err == nil {
+		t.Fatalf("expected moving a host to another group in an overlay to fail, but passed")
+	}
+
+	inv = NewInventory()
+	if err := inv.LoadWithOverlays("../../testdata/inventory/hosts", "../../testdata/inventory/hosts5"); err != nil {
+		t.Fatalf("error reading inventory files: %s", err)
+	}
+	if inv.Size() != 6 {
+		t.Fatalf("inventory size mismatch: 6 (expected) vs. %d (received)", inv.Size())
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidInventory is the root of the inventory error codes, i.e.
+// errors.Is(err, ErrInvalidInventory) holds for the errors with any of the
+// codes below.
+var ErrInvalidInventory = errors.New("invalid inventory")
+
+// The codes of the inventory errors, e.g. of a ParseError. The codes are
+// matched with errors.Is.
+var (
+	ErrInvalidSection  error = &inventoryErrorCode{"invalid section"}
+	ErrInvalidHost     error = &inventoryErrorCode{"invalid host"}
+	ErrDuplicateHost   error = &inventoryErrorCode{"duplicate host"}
+	ErrInvalidGroup    error = &inventoryErrorCode{"invalid group"}
+	ErrEmptyGroup      error = &inventoryErrorCode{"empty group"}
+	ErrGroupCycle      error = &inventoryErrorCode{"group cycle"}
+	ErrInvalidVariable error = &inventoryErrorCode{"invalid variable"}
+)
+
+// inventoryErrorCode is an inventory error code, a kind of
+// ErrInvalidInventory.
+type inventoryErrorCode struct {
+	s string
+}
+
+func (c *inventoryErrorCode) Error() string {
+	return c.s
+}
+
+func (c *inventoryErrorCode) Unwrap() error {
+	return ErrInvalidInventory
+}
+
+// ParseError is the error returned when a line of an inventory file fails
+// to parse.
+type ParseError struct {
+	// File is the inventory file, or overlay, when known.
+	File string
+	// Line and Column are the position of the offending text, starting
+	// with 1.
+	Line   int
+	Column int
+	// Text is the offending text, i.e. the line without the surrounding
+	// whitespace.
+	Text string
+	// Code is one of the error codes, e.g. ErrInvalidSection.
+	Code error
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the string representation of a ParseError, prefixed with
+// the position of the offending text, e.g. hosts:12:1.
+func (e *ParseError) Error() string {
+	var s strings.Builder
+	if e.File != "" {
+		fmt.Fprintf(&s, "%s:%d:%d: ", e.File, e.Line, e.Column)
+	} else {
+		fmt.Fprintf(&s, "line %d, column %d: ", e.Line, e.Column)
+	}
+	if e.Err != nil {
+		s.WriteString(e.Err.Error())
+	} else {
+		s.WriteString(e.Code.Error())
+	}
+	return s.String()
+}
+
+// Unwrap returns the code and the underlying error of a ParseError, so
+// that both errors.Is(err, ErrDuplicateHost) and errors.As(err,
+// &limitErr) hold for the corresponding errors.
+func (e *ParseError) Unwrap() []error {
+	return []error{e.Code, e.Err}
+}
+
+// IsParseError returns the ParseError the error is or wraps, if any.
+func IsParseError(err error) (*ParseError, bool) {
+	var e *ParseError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// codedError is an error with an inventory error code, retaining the
+// message of the underlying error.
+type codedError struct {
+	code error
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() []error {
+	return []error{e.code, e.err}
+}
+
+// errorWithCode formats an error, with %w support, and assigns it an
+// inventory error code.
+func errorWithCode(code error, format string, args ...interface{}) error {
+	return &codedError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// withCode assigns an inventory error code to an error, unless it has one.
+func withCode(code error, err error) error {
+	if err == nil || errors.Is(err, ErrInvalidInventory) {
+		return err
+	}
+	return &codedError{code: code, err: err}
+}
+
+// errorCode returns the inventory error code of an error, or the provided
+// default code.
+func errorCode(err error, def error) error {
+	for _, code := range []error{
+		ErrInvalidSection, ErrInvalidHost, ErrDuplicateHost, ErrInvalidGroup,
+		ErrEmptyGroup, ErrGroupCycle, ErrInvalidVariable,
+	} {
+		if errors.Is(err, code) {
+			return code
+		}
+	}
+	return def
+}
+
+// newParseError returns a ParseError for the line of the inventory file
+// being parsed, with lc being the index of the line.
+func (inv *Inventory) newParseError(code error, lc int, line string, err error) *ParseError {
+	text := strings.TrimSpace(line)
+	return &ParseError{
+		File:   inv.source,
+		Line:   lc + 1,
+		Column: strings.Index(line, text) + 1,
+		Text:   text,
+		Code:   errorCode(err, code),
+		Err:    err,
+	}
+}
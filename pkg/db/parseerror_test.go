@@ -0,0 +1,104 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	for i, test := range []struct {
+		input  string
+		code   error
+		line   int
+		column int
+		text   string
+	}{
+		{input: "[web:vars:extra]\n", code: ErrInvalidSection, line: 1, column: 1, text: "[web:vars:extra]"},
+		{input: "[web]\nweb01\n\n  [web:hosts]\n", code: ErrInvalidSection, line: 4, column: 3, text: "[web:hosts]"},
+		{input: "[web]\nweb01\n[db]\nweb01\n", code: ErrDuplicateHost, line: 4, column: 1, text: "web01"},
+		{input: "[web]\n\tweb01 os=\"nxos\n", code: ErrInvalidVariable, line: 2, column: 2, text: "web01 os=\"nxos"},
+		{input: "[web:vars]\nos='eos\n", code: ErrInvalidVariable, line: 2, column: 1, text: "os='eos"},
+		{input: "[web]\nweb[05:01]\n", code: ErrInvalidHost, line: 2, column: 1, text: "web[05:01]"},
+	} {
+		inv := NewInventory()
+		err := inv.LoadFromBytes([]byte(test.input))
+		if err == nil {
+			t.Fatalf("FAIL: Test %d, expected error, but passed", i)
+		}
+		pe, ok := IsParseError(err)
+		if !ok {
+			t.Fatalf("FAIL: Test %d, expected ParseError, received: %T: %s", i, err, err)
+		}
+		if !errors.Is(err, test.code) || !errors.Is(err, ErrInvalidInventory) {
+			t.Fatalf("FAIL: Test %d, error code mismatch: %s (expected) vs. %s (received)", i, test.code, pe.Code)
+		}
+		if pe.Line != test.line || pe.Column != test.column || pe.Text != test.text {
+			t.Fatalf("FAIL: Test %d, position mismatch: %d:%d %q (expected) vs. %d:%d %q (received)",
+				i, test.line, test.column, test.text, pe.Line, pe.Column, pe.Text)
+		}
+		t.Logf("PASS: Test %d, %s", i, err)
+	}
+}
+
+func TestParseErrorFile(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(fp, []byte("[web]\nweb01\n[web:other]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	inv := NewInventory()
+	err := inv.LoadFromFile(fp)
+	pe, ok := IsParseError(err)
+	if !ok {
+		t.Fatalf("expected ParseError, received: %v", err)
+	}
+	if pe.File != fp || pe.Line != 3 {
+		t.Fatalf("position mismatch: %s:%d", pe.File, pe.Line)
+	}
+	if err.Error() != fp+":3:1: invalid section: [web:other]" {
+		t.Fatalf("error message mismatch: %s", err)
+	}
+	t.Logf("PASS: %s", err)
+}
+
+func TestInventoryErrorCodes(t *testing.T) {
+	for i, test := range []struct {
+		input  string
+		strict bool
+		code   error
+	}{
+		{input: "[web]\nweb01\n[db]\n", strict: true, code: ErrEmptyGroup},
+		{input: "[b]\nh1\n\n[a:children]\nb\n\n[b:children]\na\n", code: ErrGroupCycle},
+	} {
+		inv := NewInventory(WithStrictMode(test.strict))
+		err := inv.LoadFromBytes([]byte(test.input))
+		if !errors.Is(err, test.code) || !errors.Is(err, ErrInvalidInventory) {
+			t.Fatalf("FAIL: Test %d, error code mismatch: %s (expected), received: %v", i, test.code, err)
+		}
+		t.Logf("PASS: Test %d, %s", i, err)
+	}
+
+	inv := NewInventory(WithMaxHosts(2))
+	err := inv.LoadFromBytes([]byte("[web]\nweb[01:05]\n"))
+	if _, ok := IsLimitError(err); !ok {
+		t.Fatalf("expected a LimitError, received: %v", err)
+	}
+	if _, ok := IsParseError(err); !ok {
+		t.Fatalf("expected a ParseError, received: %v", err)
+	}
+}
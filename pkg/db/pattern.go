@@ -0,0 +1,267 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GetHostsByPattern returns the hosts matching an Ansible host pattern, the
+// way ansible-playbook --limit does. The pattern is a list of terms
+// separated by commas, or colons when there are no commas. A term is one
+// of the following:
+//
+//   - "all" or "*", i.e. every host
+//   - the name of a group, e.g. "webservers", or of a host
+//   - a glob matching the names of groups or hosts, e.g. "web*"
+//   - a regular expression, prefixed with "~", e.g. "~web0[1-3]"
+//
+// A term may end with a subscript selecting a part of its hosts, e.g.
+// "webservers[0]", "webservers[-1]", or "webservers[0:2]", with the end
+// included. The hosts of the terms are combined, unless a term starts with
+// "&", i.e. the hosts must match it too, or with "!", i.e. the hosts must
+// not match it, e.g. "webservers:&staging:!excluded". When the pattern has
+// intersections or exclusions only, they apply to all of the hosts.
+func (inv *Inventory) GetHostsByPattern(pattern string) ([]*InventoryHost, error) {
+	terms := splitHostPattern(pattern)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty host pattern")
+	}
+	var union, intersections, exclusions []string
+	for _, term := range terms {
+		switch {
+		case strings.HasPrefix(term, "&"):
+			intersections = append(intersections, term[1:])
+		case strings.HasPrefix(term, "!"):
+			exclusions = append(exclusions, term[1:])
+		default:
+			union = append(union, term)
+		}
+	}
+	if len(union) == 0 {
+		union = []string{"all"}
+	}
+
+	hosts := []*InventoryHost{}
+	seen := make(map[*InventoryHost]bool)
+	for _, term := range union {
+		matched, err := inv.matchHostPatternTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range matched {
+			if !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	for _, term := range intersections {
+		matched, err := inv.matchHostPatternTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		hosts = filterHosts(hosts, matched, true)
+	}
+	for _, term := range exclusions {
+		matched, err := inv.matchHostPatternTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		hosts = filterHosts(hosts, matched, false)
+	}
+	if err := inv.resolveHostList(hosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// splitHostPattern splits a host pattern into terms. The colons within
+// subscripts, e.g. "webservers[0:2]", and IPv6 addresses do not separate
+// terms.
+func splitHostPattern(pattern string) []string {
+	pattern = strings.TrimSpace(pattern)
+	sep := byte(':')
+	if strings.Contains(pattern, ",") {
+		sep = ','
+	} else if _, _, ok := splitIPv6Literal("[" + strings.TrimLeft(pattern, "&!") + "]"); ok {
+		return []string{pattern}
+	}
+	var terms []string
+	depth := 0
+	start := 0
+	for i := 0; i <= len(pattern); i++ {
+		if i < len(pattern) {
+			switch pattern[i] {
+			case '[':
+				depth++
+				continue
+			case ']':
+				if depth > 0 {
+					depth--
+				}
+				continue
+			}
+			if pattern[i] != sep || depth > 0 {
+				continue
+			}
+		}
+		if term := strings.TrimSpace(pattern[start:i]); term != "" {
+			terms = append(terms, term)
+		}
+		start = i + 1
+	}
+	return terms
+}
+
+// hostPatternSubscript is the subscript at the end of a host pattern term.
+var hostPatternSubscript = regexp.MustCompile(`^(.+)\[(-?\d*)(?::(-?\d*))?\]$`)
+
+// matchHostPatternTerm returns the hosts matching a term of a host pattern,
+// in the order of the inventory.
+func (inv *Inventory) matchHostPatternTerm(term string) ([]*InventoryHost, error) {
+	if m := hostPatternSubscript.FindStringSubmatch(term); m != nil && !strings.HasPrefix(term, "~") {
+		hosts, err := inv.matchHostPatternTerm(m[1])
+		if err != nil {
+			return nil, err
+		}
+		return subscriptHosts(hosts, term, m[2], m[3], strings.Contains(term[len(m[1]):], ":"))
+	}
+
+	var match func(string) bool
+	switch {
+	case term == "all" || term == "*":
+		return inv.Hosts, nil
+	case strings.HasPrefix(term, "~"):
+		r, err := regexp.Compile(term[1:])
+		if err != nil {
+			return nil, fmt.Errorf("host pattern contains invalid regular expression: %s, error: %s", term, err)
+		}
+		match = r.MatchString
+	case strings.ContainsAny(term, "*?["):
+		if _, err := path.Match(term, ""); err != nil {
+			return nil, fmt.Errorf("host pattern contains invalid glob: %s, error: %s", term, err)
+		}
+		match = func(s string) bool {
+			ok, _ := path.Match(term, s)
+			return ok
+		}
+	default:
+		name := inv.hostname(term)
+		if _, exists := inv.GroupsRef[term]; !exists && localhostNames[name] {
+			if _, exists := inv.HostsRef[name]; !exists {
+				return []*InventoryHost{newImplicitLocalhost(name)}, nil
+			}
+		}
+		match = func(s string) bool {
+			return s == term || s == name
+		}
+	}
+
+	groups := make(map[string]bool)
+	for _, g := range inv.Groups {
+		if match(g.Name) {
+			groups[g.Name] = true
+		}
+	}
+	if match("ungrouped") {
+		groups["ungrouped"] = true
+	}
+	hosts := []*InventoryHost{}
+	for _, h := range inv.Hosts {
+		if match(h.Name) || hostInGroups(inv.hostGroups(h), h.Parent, groups) {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts, nil
+}
+
+// hostInGroups returns true when a host, with the provided groups and
+// parent group, is a member of any of the groups.
+func hostInGroups(hostGroups []string, parent string, groups map[string]bool) bool {
+	if len(groups) == 0 {
+		return false
+	}
+	if groups["all"] || groups[parent] || (groups["ungrouped"] && parent == "all") {
+		return true
+	}
+	for _, g := range hostGroups {
+		if groups[g] {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriptHosts returns the hosts selected by the subscript of a term,
+// i.e. a host by its index, or a range of hosts, with the end included.
+// Negative indexes count from the end.
+func subscriptHosts(hosts []*InventoryHost, term, start, end string, isRange bool) ([]*InventoryHost, error) {
+	index := func(s string, def int) (int, error) {
+		if s == "" {
+			return def, nil
+		}
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("host pattern contains invalid subscript: %s", term)
+		}
+		if i < 0 {
+			i += len(hosts)
+		}
+		return i, nil
+	}
+	if !isRange && start == "" {
+		return nil, fmt.Errorf("host pattern contains invalid subscript: %s", term)
+	}
+	i, err := index(start, 0)
+	if err != nil {
+		return nil, err
+	}
+	j := i
+	if isRange {
+		if j, err = index(end, len(hosts)-1); err != nil {
+			return nil, err
+		}
+	}
+	if i < 0 {
+		i = 0
+	}
+	if j >= len(hosts) {
+		j = len(hosts) - 1
+	}
+	if i > j {
+		return []*InventoryHost{}, nil
+	}
+	return hosts[i : j+1], nil
+}
+
+// filterHosts returns the hosts, which are, or are not, in the other list.
+func filterHosts(hosts, other []*InventoryHost, keep bool) []*InventoryHost {
+	m := make(map[*InventoryHost]bool)
+	for _, h := range other {
+		m[h] = true
+	}
+	filtered := []*InventoryHost{}
+	for _, h := range hosts {
+		if m[h] == keep {
+			filtered = append(filtered, h)
+		}
+	}
+	return filtered
+}
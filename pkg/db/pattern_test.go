@@ -0,0 +1,96 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetHostsByPattern(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error loading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		pattern   string
+		expected  string
+		shouldErr bool
+	}{
+		{pattern: "all", expected: "controller,ny-sw01,ny-sw02,ny-sw03,ny-sw04"},
+		{pattern: "*", expected: "controller,ny-sw01,ny-sw02,ny-sw03,ny-sw04"},
+		{pattern: "ny4", expected: "ny-sw01,ny-sw02"},
+		{pattern: "ny4:ny5-cisco", expected: "ny-sw01,ny-sw02,ny-sw04"},
+		{pattern: "ny5-cisco,ny4", expected: "ny-sw04,ny-sw01,ny-sw02"},
+		{pattern: "ny:&cisco", expected: "ny-sw01,ny-sw04"},
+		{pattern: "ny:!ny-sw03", expected: "ny-sw01,ny-sw02,ny-sw04"},
+		{pattern: "us:&arista:!ny5", expected: "ny-sw02"},
+		{pattern: "!ny", expected: "controller"},
+		{pattern: "ungrouped", expected: "controller"},
+		{pattern: "controller:ny-sw03", expected: "controller,ny-sw03"},
+		{pattern: "ny-sw0*", expected: "ny-sw01,ny-sw02,ny-sw03,ny-sw04"},
+		{pattern: "*-arista", expected: "ny-sw02,ny-sw03"},
+		{pattern: "~ny-sw0[13]", expected: "ny-sw01,ny-sw03"},
+		{pattern: "ny[0]", expected: "ny-sw01"},
+		{pattern: "ny[-1]", expected: "ny-sw04"},
+		{pattern: "ny[1:2]", expected: "ny-sw02,ny-sw03"},
+		{pattern: "ny[2:]:controller", expected: "ny-sw03,ny-sw04,controller"},
+		{pattern: "ny[9]", expected: ""},
+		{pattern: "unknown", expected: ""},
+		{pattern: "localhost", expected: "localhost"},
+		{pattern: "", shouldErr: true},
+		{pattern: "~ny[", shouldErr: true},
+		{pattern: "ny-sw[", shouldErr: true},
+	} {
+		hosts, err := inv.GetHostsByPattern(test.pattern)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error for %q, but passed", i, test.pattern)
+			}
+			t.Logf("PASS: Test %d, %q: %s", i, test.pattern, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error matching %q: %s", i, test.pattern, err)
+		}
+		var names []string
+		for _, h := range hosts {
+			names = append(names, h.Name)
+		}
+		if received := strings.Join(names, ","); received != test.expected {
+			t.Fatalf("FAIL: Test %d, %q mismatch: %s (expected) vs. %s (received)", i, test.pattern, test.expected, received)
+		}
+		t.Logf("PASS: Test %d, %q: %s", i, test.pattern, test.expected)
+	}
+}
+
+func TestSplitHostPattern(t *testing.T) {
+	for i, test := range []struct {
+		pattern  string
+		expected string
+	}{
+		{pattern: "a:b:&c:!d", expected: "a|b|&c|!d"},
+		{pattern: "a, b[0:2] ,!c", expected: "a|b[0:2]|!c"},
+		{pattern: "a[0:2]:b", expected: "a[0:2]|b"},
+		{pattern: "2001:db8::1", expected: "2001:db8::1"},
+		{pattern: "::", expected: "::"},
+		{pattern: "web::db", expected: "web|db"},
+	} {
+		if received := strings.Join(splitHostPattern(test.pattern), "|"); received != test.expected {
+			t.Fatalf("FAIL: Test %d, %q mismatch: %s (expected) vs. %s (received)", i, test.pattern, test.expected, received)
+		}
+		t.Logf("PASS: Test %d, %q: %s", i, test.pattern, test.expected)
+	}
+}
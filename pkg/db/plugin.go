@@ -0,0 +1,320 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// InventoryPlugin adds the hosts, groups, and variables described by the
+// configuration file of an Ansible inventory plugin, e.g. "plugin:
+// generator", to the Inventory. The caller computes the group chains and
+// the inherited variables afterwards.
+type InventoryPlugin func(inv *Inventory, config []byte) error
+
+// constructedPlugin is the name of the plugin operating on the hosts
+// already loaded into the Inventory, after the group chains and the
+// inherited variables are computed.
+const constructedPlugin = "constructed"
+
+var (
+	inventoryPluginsMu sync.RWMutex
+	inventoryPlugins   = map[string]InventoryPlugin{
+		"generator": loadGeneratorPlugin,
+		"host_list": loadHostListPlugin,
+	}
+)
+
+// RegisterInventoryPlugin registers an implementation of an Ansible
+// inventory plugin, replacing the existing one with the same name.
+func RegisterInventoryPlugin(name string, p InventoryPlugin) {
+	inventoryPluginsMu.Lock()
+	defer inventoryPluginsMu.Unlock()
+	inventoryPlugins[name] = p
+}
+
+type pluginConfig struct {
+	Plugin string `yaml:"plugin"`
+}
+
+// getPluginName returns the name of the plugin a configuration file is for,
+// without the ansible.builtin. prefix, or an empty string when the data is
+// not an inventory plugin configuration.
+func getPluginName(b []byte) string {
+	cfg := &pluginConfig{}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return ""
+	}
+	name := strings.TrimPrefix(cfg.Plugin, "ansible.builtin.")
+	return strings.TrimPrefix(name, "community.general.")
+}
+
+// IsPluginConfig returns true when the data is an Ansible inventory plugin
+// configuration, i.e. a YAML document with the "plugin" key.
+func IsPluginConfig(b []byte) bool {
+	return getPluginName(b) != ""
+}
+
+// LoadFromPluginConfig loads an Ansible inventory plugin configuration
+// file and dispatches it to the corresponding plugin implementation. The
+// supported plugins are generator, host_list, and constructed. The latter
+// operates on the hosts already loaded into the Inventory.
+func (inv *Inventory) LoadFromPluginConfig(fp string) error {
+	fp = expandFilePath(fp)
+	b, err := inv.readVerifiedFile(fp)
+	if err != nil {
+		return err
+	}
+	b, err = inv.decryptSource(b)
+	if err != nil {
+		return err
+	}
+	if err := inv.loadPluginConfigBytes(b); err != nil {
+		return fmt.Errorf("%s: %s", fp, err)
+	}
+	return nil
+}
+
+// LoadFromPluginConfigBytes is the LoadFromPluginConfig counterpart
+// operating on an array of bytes.
+func (inv *Inventory) LoadFromPluginConfigBytes(b []byte) error {
+	if err := inv.checkUnsigned(); err != nil {
+		return err
+	}
+	return inv.loadPluginConfigBytes(b)
+}
+
+func (inv *Inventory) loadPluginConfigBytes(b []byte) error {
+	name := getPluginName(b)
+	if name == constructedPlugin {
+		return loadConstructedPlugin(inv, b)
+	}
+	if err := inv.parsePluginConfig(b); err != nil {
+		return err
+	}
+	return inv.finalize()
+}
+
+// parsePluginConfig dispatches a plugin configuration, other than the
+// constructed one, to the plugin implementation.
+func (inv *Inventory) parsePluginConfig(b []byte) error {
+	name := getPluginName(b)
+	if name == "" {
+		return fmt.Errorf("not an inventory plugin configuration")
+	}
+	inventoryPluginsMu.RLock()
+	p, exists := inventoryPlugins[name]
+	inventoryPluginsMu.RUnlock()
+	if !exists {
+		return fmt.Errorf("unsupported inventory plugin: %s", name)
+	}
+	inv.logger.Debugf("loading inventory with plugin %s", name)
+	return p(inv, b)
+}
+
+// loadHostListPlugin loads the hosts from the "hosts" key, either a
+// comma-separated string or a list.
+func loadHostListPlugin(inv *Inventory, b []byte) error {
+	cfg := struct {
+		Hosts interface{} `yaml:"hosts"`
+	}{}
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+	switch hosts := cfg.Hosts.(type) {
+	case string:
+		return inv.parseHostList(hosts)
+	case []interface{}:
+		var entries []string
+		for _, h := range hosts {
+			entries = append(entries, fmt.Sprint(h))
+		}
+		return inv.parseHostList(strings.Join(entries, ","))
+	}
+	return fmt.Errorf("host_list plugin requires hosts")
+}
+
+var generatorTemplatePattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+type generatorGroup struct {
+	Name    string            `yaml:"name"`
+	Parents []*generatorGroup `yaml:"parents"`
+	Vars    map[string]string `yaml:"vars"`
+}
+
+// loadGeneratorPlugin creates the hosts from the cartesian product of the
+// layers, e.g. "{{ env }}-{{ app }}" for layers env: [dev, prod] and
+// app: [web, db].
+func loadGeneratorPlugin(inv *Inventory, b []byte) error {
+	cfg := struct {
+		Hosts  *generatorGroup     `yaml:"hosts"`
+		Layers map[string][]string `yaml:"layers"`
+	}{}
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+	if cfg.Hosts == nil || cfg.Hosts.Name == "" {
+		return fmt.Errorf("generator plugin requires hosts.name")
+	}
+	if len(cfg.Hosts.Parents) > 1 {
+		return fmt.Errorf("generator plugin hosts with multiple parents are not supported")
+	}
+	var keys []string
+	for k := range cfg.Layers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	combinations := []map[string]string{{}}
+	for _, k := range keys {
+		var next []map[string]string
+		for _, c := range combinations {
+			for _, v := range cfg.Layers[k] {
+				m := map[string]string{k: v}
+				for ck, cv := range c {
+					m[ck] = cv
+				}
+				next = append(next, m)
+			}
+		}
+		combinations = next
+	}
+	render := func(s string, m map[string]string) string {
+		return generatorTemplatePattern.ReplaceAllStringFunc(s, func(t string) string {
+			return m[generatorTemplatePattern.FindStringSubmatch(t)[1]]
+		})
+	}
+	var addGroup func(g *generatorGroup, child string, m map[string]string) error
+	addGroup = func(g *generatorGroup, child string, m map[string]string) error {
+		name := render(g.Name, m)
+		if err := inv.AddGroup(name, "all"); err != nil {
+			return err
+		}
+		if child != "" {
+			if err := inv.AddGroup(child, name); err != nil {
+				return err
+			}
+		}
+		group, err := inv.GetGroup(name)
+		if err != nil {
+			return err
+		}
+		for k, v := range g.Vars {
+			group.Variables[k] = render(v, m)
+			setVariableSource(&group.VariableSources, k, inv.variableSource("group", name))
+		}
+		for _, p := range g.Parents {
+			if err := addGroup(p, name, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, m := range combinations {
+		parent := "all"
+		if len(cfg.Hosts.Parents) == 1 {
+			if err := addGroup(cfg.Hosts.Parents[0], "", m); err != nil {
+				return err
+			}
+			parent = render(cfg.Hosts.Parents[0].Name, m)
+		}
+		if err := inv.AddHost(render(cfg.Hosts.Name, m), parent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var groupNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+type keyedGroup struct {
+	Key              string  `yaml:"key"`
+	Prefix           string  `yaml:"prefix"`
+	Separator        *string `yaml:"separator"`
+	LeadingSeparator *bool   `yaml:"leading_separator"`
+	Parent           string  `yaml:"parent_group"`
+}
+
+// loadConstructedPlugin adds the hosts already in the Inventory to the
+// groups built from their variables, i.e. keyed_groups. The Jinja-based
+// groups and compose options are not supported and are reported via the
+// logger.
+func loadConstructedPlugin(inv *Inventory, b []byte) error {
+	cfg := struct {
+		KeyedGroups []*keyedGroup          `yaml:"keyed_groups"`
+		Groups      map[string]interface{} `yaml:"groups"`
+		Compose     map[string]interface{} `yaml:"compose"`
+	}{}
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+	if len(cfg.Groups) > 0 {
+		inv.logger.Warnf("constructed plugin option groups is not supported")
+	}
+	if len(cfg.Compose) > 0 {
+		inv.logger.Warnf("constructed plugin option compose is not supported")
+	}
+	if err := inv.Precompute(); err != nil {
+		return err
+	}
+	for _, kg := range cfg.KeyedGroups {
+		if kg.Key == "" {
+			return fmt.Errorf("constructed plugin keyed_groups entry requires key")
+		}
+		sep := "_"
+		if kg.Separator != nil {
+			sep = *kg.Separator
+		}
+		parent := "all"
+		if kg.Parent != "" {
+			parent = kg.Parent
+			if err := inv.AddGroup(parent, "all"); err != nil {
+				return err
+			}
+		}
+		for _, h := range inv.Hosts {
+			v, exists := h.Variables[kg.Key]
+			if !exists || v == "" {
+				continue
+			}
+			name := kg.Prefix + sep + v
+			if kg.Prefix == "" && kg.LeadingSeparator != nil && !*kg.LeadingSeparator {
+				name = v
+			}
+			name = groupNameSanitizer.ReplaceAllString(name, "_")
+			if err := inv.AddGroup(name, "all"); err != nil {
+				return err
+			}
+			if err := inv.AddGroup(name, parent); err != nil {
+				return err
+			}
+			for _, g := range []string{name, parent} {
+				if h.memberOf(g) {
+					continue
+				}
+				h.Groups = append(h.Groups, g)
+				if err := inv.AddGroupMemberCounter("host", g); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestInventoryPlugins(t *testing.T) {
+	generator := []byte(`plugin: ansible.builtin.generator
+hosts:
+  name: "{{ env }}-{{ app }}-01"
+  parents:
+    - name: "{{ env }}_{{ app }}"
+      parents:
+        - name: "{{ app }}"
+          vars:
+            app_name: "{{ app }}"
+        - name: "{{ env }}"
+layers:
+  env: [dev, prod]
+  app: [web, db]
+`)
+	inv := NewInventory()
+	if err := inv.LoadFromPluginConfigBytes(generator); err != nil {
+		t.Fatalf("error loading generator plugin config: %s", err)
+	}
+	if inv.Size() != 4 {
+		t.Fatalf("inventory size mismatch: 4 (expected) vs. %d (received)", inv.Size())
+	}
+	for i, test := range []struct {
+		host   string
+		groups string
+		key    string
+		value  string
+	}{
+		{host: "dev-web-01", groups: "all,dev,dev_web,web", key: "app_name", value: "web"},
+		{host: "prod-db-01", groups: "all,db,prod,prod_db", key: "app_name", value: "db"},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, %s", i, err)
+		}
+		if groups := strings.Join(sortedCopy(h.Groups), ","); groups != test.groups {
+			t.Fatalf("FAIL: Test %d, host %s groups mismatch: %s (expected) vs. %s (received)", i, test.host, test.groups, groups)
+		}
+		if h.Variables[test.key] != test.value {
+			t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)",
+				i, test.host, test.key, test.value, h.Variables[test.key])
+		}
+		t.Logf("PASS: Test %d, host %s groups: %s", i, test.host, test.groups)
+	}
+
+	constructed := []byte(`plugin: constructed
+keyed_groups:
+  - key: os
+    prefix: os
+  - key: site
+    leading_separator: false
+`)
+	inv = NewInventory()
+	if err := inv.LoadFromBytes([]byte("[web]\nweb01 os=linux site=ny4\nweb02 os=linux\n")); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if err := inv.LoadFromPluginConfigBytes(constructed); err != nil {
+		t.Fatalf("error loading constructed plugin config: %s", err)
+	}
+	groups := inv.GetGroupsMap()
+	if strings.Join(groups["os_linux"], ",") != "web01,web02" || strings.Join(groups["ny4"], ",") != "web01" {
+		t.Fatalf("keyed groups mismatch: %v", groups)
+	}
+
+	inv = NewInventory()
+	if err := inv.LoadFromPluginConfigBytes([]byte("plugin: host_list\nhosts: [sw01, sw02]\n")); err != nil {
+		t.Fatalf("error loading host_list plugin config: %s", err)
+	}
+	if inv.Size() != 2 {
+		t.Fatalf("inventory size mismatch: 2 (expected) vs. %d (received)", inv.Size())
+	}
+	for _, b := range []string{"plugin: aws_ec2\n", "[web]\nweb01\n"} {
+		if err := NewInventory().LoadFromPluginConfigBytes([]byte(b)); err == nil {
+			t.Fatalf("expected error loading %q", b)
+		}
+	}
+}
+
+func sortedCopy(arr []string) []string {
+	out := append([]string{}, arr...)
+	sort.Strings(out)
+	return out
+}
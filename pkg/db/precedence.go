@@ -0,0 +1,93 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GetHostVariables returns the variables of a host resolved following the
+// Ansible precedence, i.e. the variables of the host override those of
+// its groups, and the variables of child groups override those of their
+// parents. See sortGroupsByPrecedence for the order of the groups.
+func (inv *Inventory) GetHostVariables(s string) (map[string]string, error) {
+	h, err := inv.GetHost(s)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(h.Variables))
+	for k, v := range h.Variables {
+		m[k] = v
+	}
+	return m, nil
+}
+
+// sortGroupsByPrecedence returns the groups ordered from the lowest to the
+// highest variable precedence. The groups are sorted by depth, i.e. the
+// length of the longest path from the "all" group, with the groups of the
+// same depth sorted by name.
+func (inv *Inventory) sortGroupsByPrecedence(groups []string) ([]string, error) {
+	depths := make(map[string]int)
+	for _, g := range groups {
+		if _, err := inv.groupDepth(g, depths, make(map[string]bool)); err != nil {
+			return nil, err
+		}
+	}
+	sorted := make([]string, len(groups))
+	copy(sorted, groups)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if depths[sorted[i]] != depths[sorted[j]] {
+			return depths[sorted[i]] < depths[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted, nil
+}
+
+// groupDepth returns the length of the longest path from the "all" group
+// to the provided group. An undefined group is a child of "all".
+func (inv *Inventory) groupDepth(s string, depths map[string]int, visiting map[string]bool) (int, error) {
+	if d, exists := depths[s]; exists {
+		return d, nil
+	}
+	if s == "all" {
+		depths[s] = 0
+		return 0, nil
+	}
+	if visiting[s] {
+		return 0, fmt.Errorf("group %s is its own ancestor", s)
+	}
+	visiting[s] = true
+	defer delete(visiting, s)
+	depth := 1
+	g, err := inv.GetGroup(s)
+	if err != nil {
+		// the group is implied, e.g. only referenced as a parent
+		depths[s] = depth
+		return depth, nil
+	}
+	for _, a := range g.Ancestors {
+		d, err := inv.groupDepth(a, depths, visiting)
+		if err != nil {
+			return 0, err
+		}
+		if d+1 > depth {
+			depth = d + 1
+		}
+	}
+	depths[s] = depth
+	return depth, nil
+}
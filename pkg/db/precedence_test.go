@@ -0,0 +1,113 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"testing"
+)
+
+func TestGetHostVariables(t *testing.T) {
+	data := []byte(`[ny4]
+ny-sw01 role=switch
+ny-sw02
+
+[leaf]
+ny-rt01
+
+[ny:children]
+ny4
+
+[us:children]
+ny
+
+[b:children]
+leaf
+
+[a:children]
+leaf
+
+[zz:children]
+leaf
+
+[ny4:children]
+leaf
+
+[ny4:vars]
+role=access
+site=ny4
+
+[ny:vars]
+site=ny
+region=ny
+
+[us:vars]
+site=us
+region=us
+country=us
+
+[b:vars]
+zone=b
+
+[a:vars]
+zone=a
+owner=a
+
+[zz:vars]
+site=zz
+region=zz
+
+[all:vars]
+site=all
+owner=all
+ntp=10.0.0.1
+`)
+	for i, test := range []struct {
+		host string
+		want map[string]string
+	}{
+		{host: "ny-sw01", want: map[string]string{
+			"role": "switch", "site": "ny4", "region": "ny", "country": "us", "owner": "all", "ntp": "10.0.0.1",
+		}},
+		{host: "ny-sw02", want: map[string]string{
+			"role": "access", "site": "ny4", "region": "ny", "country": "us", "owner": "all", "ntp": "10.0.0.1",
+		}},
+		{host: "ny-rt01", want: map[string]string{
+			"zone": "b", "owner": "a", "site": "ny4", "region": "ny", "ntp": "10.0.0.1",
+		}},
+	} {
+		// the precedence does not depend on the order of the inventory
+		// sections, nor on the iteration order of maps
+		for j := 0; j < 10; j++ {
+			inv := NewInventory()
+			if err := inv.LoadFromBytes(data); err != nil {
+				t.Fatalf("FAIL: Test %d, error reading inventory: %s", i, err)
+			}
+			m, err := inv.GetHostVariables(test.host)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, error getting variables of host %s: %s", i, test.host, err)
+			}
+			for k, v := range test.want {
+				if m[k] != v {
+					t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)", i, test.host, k, v, m[k])
+				}
+			}
+		}
+		t.Logf("PASS: Test %d, host %s variables: %v", i, test.host, test.want)
+	}
+
+	if _, err := NewInventory().GetHostVariables("ny-sw01"); err == nil {
+		t.Fatalf("expected getting the variables of an unknown host to fail, but passed")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+)
+
+// VariableSource returns where the value of a host variable comes from,
+// e.g. "host ny-sw01 (hosts)" for the host line, "group ny4 (hosts)" for
+// the variables section of a group, or "group_vars ny4 (group_vars/ny4.yml)".
+// The file, in parentheses, is omitted when the inventory was not loaded
+// from a file. An empty string is returned when the variable is not set or
+// its source is unknown.
+func (h *InventoryHost) VariableSource(k string) string {
+	if _, exists := h.Variables[k]; !exists {
+		return ""
+	}
+	return h.VariableSources[k]
+}
+
+// VariableSource returns where the value of a group variable comes from,
+// or "group <name>" when it is unknown, e.g. the variable was set
+// programmatically.
+func (g *InventoryGroup) VariableSource(k string) string {
+	if s, exists := g.VariableSources[k]; exists {
+		return s
+	}
+	return "group " + g.Name
+}
+
+// variableSource describes the current source of the variables of a host
+// or group.
+func (inv *Inventory) variableSource(kind, name string) string {
+	if inv.source == "" {
+		return kind + " " + name
+	}
+	return fmt.Sprintf("%s %s (%s)", kind, name, inv.source)
+}
+
+// withSource runs the function with the provided file, or overlay, as the
+// source of the variables it adds.
+func (inv *Inventory) withSource(s string, fn func() error) error {
+	prev := inv.source
+	inv.source = s
+	defer func() {
+		inv.source = prev
+	}()
+	return fn()
+}
+
+func setVariableSource(m *map[string]string, k, s string) {
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[k] = s
+}
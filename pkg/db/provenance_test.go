@@ -0,0 +1,88 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"testing"
+)
+
+func TestVariableSource(t *testing.T) {
+	base := []byte(`[web]
+web01 http_port=80
+web02 http_port=80
+
+[web:vars]
+env=dev
+log_level=debug
+
+[all:vars]
+ntp=10.0.0.1
+`)
+	prod := []byte(`[web]
+web02 http_port=443
+
+[web:vars]
+env=prod
+`)
+	inv := NewInventory()
+	if err := inv.LoadFromBytesWithOverlays(base, prod); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if _, err := inv.AddEphemeralHost("web09", []string{"web"}, map[string]string{"http_port": "8080"}); err != nil {
+		t.Fatalf("error adding ephemeral host: %s", err)
+	}
+	for i, test := range []struct {
+		host   string
+		key    string
+		source string
+	}{
+		{host: "web01", key: "http_port", source: "host web01"},
+		{host: "web01", key: "log_level", source: "group web"},
+		{host: "web01", key: "env", source: "group web (overlay 1)"},
+		{host: "web01", key: "ntp", source: "group all"},
+		{host: "web02", key: "http_port", source: "host web02 (overlay 1)"},
+		{host: "web09", key: "http_port", source: "ephemeral host web09"},
+		{host: "web09", key: "env", source: "group web (overlay 1)"},
+		{host: "web01", key: "undefined", source: ""},
+	} {
+		host, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s: %s", i, test.host, err)
+		}
+		if src := host.VariableSource(test.key); src != test.source {
+			t.Fatalf("FAIL: Test %d, host %s variable %s source mismatch: %q (expected) vs. %q (received)", i, test.host, test.key, test.source, src)
+		}
+		t.Logf("PASS: Test %d, host %s, %s from %q", i, test.host, test.key, test.source)
+	}
+
+	inv = NewInventory()
+	fp := "../../testdata/inventory/hosts"
+	if err := inv.LoadFromFile(fp); err != nil {
+		t.Fatalf("error reading inventory file: %s", err)
+	}
+	host, err := inv.GetHost("ny-sw01")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	for k, want := range map[string]string{
+		"os":         "host ny-sw01 (" + fp + ")",
+		"datacenter": "group ny4 (" + fp + ")",
+		"vendor":     "group cisco (" + fp + ")",
+	} {
+		if src := host.VariableSource(k); src != want {
+			t.Fatalf("FAIL: host ny-sw01 variable %s source mismatch: %q (expected) vs. %q (received)", k, want, src)
+		}
+	}
+}
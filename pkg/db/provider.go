@@ -0,0 +1,47 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+// CredentialProvider is a source of the credentials of the hosts, e.g. a
+// Vault, a VaultSet, or a secrets store holding the credentials of a
+// vault file, so that the consumers of the credentials do not depend on
+// where the credentials are kept. The credentials are ordered as by
+// Vault.GetCredentials.
+type CredentialProvider interface {
+	// GetCredentials returns the credentials applicable to a host name,
+	// without the credentials targeting the groups of the host.
+	GetCredentials(host string) ([]*VaultCredential, error)
+	// GetCredentialsForHost returns the credentials applicable to a host
+	// of the provided Inventory, including the credentials targeting the
+	// groups of the host.
+	GetCredentialsForHost(inv *Inventory, host string) ([]*VaultCredential, error)
+}
+
+var (
+	_ CredentialProvider = (*Vault)(nil)
+	_ CredentialProvider = (*VaultSet)(nil)
+)
+
+// NewVaultFromCredentials returns a Vault holding the provided credentials,
+// e.g. read from a secrets store rather than a vault file, after checking
+// them as the credentials of a vault file are checked.
+func NewVaultFromCredentials(creds []*VaultCredential, opts ...VaultOption) (*Vault, error) {
+	if err := validateCredentials(creds); err != nil {
+		return nil, err
+	}
+	v := NewVault(opts...)
+	v.Credentials = creds
+	return v, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewVaultFromCredentials(t *testing.T) {
+	for i, test := range []struct {
+		creds     []*VaultCredential
+		host      string
+		want      []string
+		shouldErr bool
+		err       string
+	}{
+		{
+			creds: []*VaultCredential{
+				{Username: "admin", Default: true},
+				{Username: "netops", Regex: "^ny-sw"},
+			},
+			host: "ny-sw01",
+			want: []string{"netops", "admin"},
+		},
+		{
+			creds:     []*VaultCredential{{Username: "netops"}},
+			shouldErr: true,
+			err:       "invalid vault entry, non-default and empty regex pattern and group",
+		},
+		{
+			creds:     []*VaultCredential{{Username: "netops", Regex: "("}},
+			shouldErr: true,
+			err:       "invalid vault entry, regex compilation for '(', failed",
+		},
+	} {
+		vlt, err := NewVaultFromCredentials(test.creds)
+		if test.shouldErr {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Fatalf("FAIL: Test %d: expected error %q, got: %v", i, test.err, err)
+			}
+			t.Logf("PASS: Test %d: error: %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d: %s", i, err)
+		}
+		var p CredentialProvider = vlt
+		creds, err := p.GetCredentials(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d: %s", i, err)
+		}
+		got := []string{}
+		for _, c := range creds {
+			got = append(got, c.Username)
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Fatalf("FAIL: Test %d: credentials mismatch: %v (expected) vs. %v (received)", i, test.want, got)
+		}
+		t.Logf("PASS: Test %d: host %s: %v", i, test.host, got)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Query returns the hosts, with their resolved variables, selected by a
+// query, see MatchQuery.
+func (inv *Inventory) Query(expr string) ([]*InventoryHost, error) {
+	match, err := MatchQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := inv.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+	selected := []*InventoryHost{}
+	for _, h := range hosts {
+		if match(h) {
+			selected = append(selected, h)
+		}
+	}
+	return selected, nil
+}
+
+// MatchQuery returns a HostMatcher selecting hosts matching a query. A
+// query is a list of conditions joined with "and", "or", and "not", and
+// grouped with parentheses, e.g.
+//
+//	group=nyc* and vars.os=cisco_nxos and not host=ny-sw0[1-2]
+//
+// A condition compares a field of the host with a glob, with "=" or "!=".
+// The fields are:
+//
+//	host, name  the name of the host
+//	parent      the parent group of the host
+//	group       any of the groups of the host, including ancestors
+//	tag         any of the tags of the host
+//	vars.<key>  the variable of the host, including inherited
+//
+// A glob with spaces or parentheses is quoted, e.g. vars.site="ny 4", and
+// a backslash escapes the next character of a quoted glob, as in the
+// strings of MatchExpression. A host without the variable matches no glob. Unlike MatchExpression, the
+// query is meant for the command line.
+func MatchQuery(expr string) (HostMatcher, error) {
+	p := &exprParser{input: expr, query: true}
+	if err := p.tokenize(); err != nil {
+		return nil, fmt.Errorf("invalid query %q: %s", expr, err)
+	}
+	eval, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %q: %s", expr, err)
+	}
+	return func(h *InventoryHost) bool {
+		v, err := eval(hostEnvironment(h))
+		if err != nil {
+			return false
+		}
+		b, ok := v.(bool)
+		return ok && b
+	}, nil
+}
+
+// parseCondition parses a condition of a query, i.e. a field compared with
+// a glob, or a query in parentheses.
+func (p *exprParser) parseCondition() (exprEval, error) {
+	if t := p.peek(); t != nil && t.kind == tokenOperator && t.value == "(" {
+		return p.parsePrimary()
+	}
+	t := p.peek()
+	if t == nil || t.kind != tokenIdent {
+		return nil, p.unexpected("field")
+	}
+	p.pos++
+	field, err := queryField(t.value)
+	if err != nil {
+		return nil, fmt.Errorf("%s at %d", err, t.pos)
+	}
+	var negate bool
+	switch {
+	case p.accept(tokenOperator, "="):
+	case p.accept(tokenOperator, "!="):
+		negate = true
+	default:
+		return nil, p.unexpected("\"=\" or \"!=\"")
+	}
+	v := p.peek()
+	if v == nil || (v.kind != tokenIdent && v.kind != tokenString) {
+		return nil, p.unexpected("glob")
+	}
+	p.pos++
+	if _, err := path.Match(v.value, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q at %d: %s", v.value, v.pos, err)
+	}
+	glob := v.value
+	return func(env map[string]interface{}) (interface{}, error) {
+		for _, s := range field(env) {
+			if ok, _ := path.Match(glob, s); ok {
+				return !negate, nil
+			}
+		}
+		return negate, nil
+	}, nil
+}
+
+// queryField returns the function returning the values of a query field
+// from the environment of a host, see hostEnvironment.
+func queryField(name string) (func(map[string]interface{}) []string, error) {
+	var key string
+	switch name {
+	case "host", "name":
+		key = "name"
+	case "parent":
+		key = "parent"
+	case "group":
+		key = "groups"
+	case "tag":
+		key = "tags"
+	default:
+		v := strings.TrimPrefix(name, "vars.")
+		if v == name || v == "" {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		return func(env map[string]interface{}) []string {
+			vars, _ := env["vars"].(map[string]interface{})
+			if s, ok := vars[v].(string); ok {
+				return []string{s}
+			}
+			return nil
+		}, nil
+	}
+	return func(env map[string]interface{}) []string {
+		switch x := env[key].(type) {
+		case string:
+			return []string{x}
+		case []interface{}:
+			values := make([]string, 0, len(x))
+			for _, item := range x {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+			return values
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		query     string
+		hosts     string
+		shouldErr bool
+	}{
+		{query: "group=ny* and vars.os=cisco_nxos and not host=ny-sw0[1-2]", hosts: "ny-sw04"},
+		{query: "group=ny4 or host=controller", hosts: "controller,ny-sw01,ny-sw02"},
+		{query: "GROUP=arista", shouldErr: true},
+		{query: "group=arista AND NOT (vars.datacenter=ny4)", hosts: "ny-sw03"},
+		{query: "vars.vendor='Cisco Systems'", hosts: "ny-sw01,ny-sw04"},
+		{query: "vars.vendor!=Cisco*", hosts: "controller,ny-sw02,ny-sw03"},
+		{query: "parent=ny5-*", hosts: "ny-sw03,ny-sw04"},
+		{query: "vars.os!=*", hosts: "controller"},
+		{query: "not not host=controller", hosts: "controller"},
+		{query: "host=controller or group=ny4 and host=ny-sw02", hosts: "controller,ny-sw02"},
+		{query: "(host=controller or group=ny4) and not vars.os=*", hosts: "controller"},
+		{query: "host=unknown", hosts: ""},
+		{query: "", shouldErr: true},
+		{query: "host", shouldErr: true},
+		{query: "host=", shouldErr: true},
+		{query: "vars.=x", shouldErr: true},
+		{query: "host=[", shouldErr: true},
+		{query: "(host=a", shouldErr: true},
+		{query: "host=a or", shouldErr: true},
+		{query: "host=a host=b", shouldErr: true},
+		{query: "host='a", shouldErr: true},
+	} {
+		hosts, err := inv.Query(test.query)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, query %q: expected error, but passed", i, test.query)
+			}
+			t.Logf("PASS: Test %d, query %q: error: %s", i, test.query, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, query %q: unexpected error: %s", i, test.query, err)
+		}
+		var names []string
+		for _, h := range hosts {
+			names = append(names, h.Name)
+		}
+		if strings.Join(names, ",") != test.hosts {
+			t.Fatalf("FAIL: Test %d, query %q: hosts mismatch: %s (expected) vs. %s (received)", i, test.query, test.hosts, strings.Join(names, ","))
+		}
+		t.Logf("PASS: Test %d, query %q: hosts: %v", i, test.query, names)
+	}
+
+	hosts, err := inv.Query("host=ny-sw01")
+	if err != nil || len(hosts) != 1 || hosts[0].Variables["datacenter"] != "ny4" {
+		t.Fatalf("expected the host with its inherited variables: %v, %v", hosts, err)
+	}
+}
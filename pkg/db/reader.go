@@ -0,0 +1,138 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxInventoryLineSize limits the length of a line of the inventory data
+// LoadFromReader parses.
+const maxInventoryLineSize = 16 << 20
+
+// LoadFromReader loads inventory data from a reader line by line, e.g. a
+// generated inventory of hundreds of megabytes. The memory used for the
+// parsing is bounded by the longest line, rather than by the size of the
+// data. The gzip and zstd compressed data are decompressed as they are
+// read. The vault-encrypted and UTF-16 data are read in full, as they are
+// decoded as a whole.
+func (inv *Inventory) LoadFromReader(r io.Reader) error {
+	if err := inv.checkUnsigned(); err != nil {
+		return err
+	}
+	zr, err := decompressReader(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	br := bufio.NewReader(&sizeLimitedReader{r: zr, limit: inv.maxFileSize})
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	if isUTF16(head) || isVaultData(head) {
+		b, err := io.ReadAll(br)
+		if err != nil {
+			return err
+		}
+		return inv.loadBytes(b)
+	}
+
+	var raw *bytes.Buffer
+	src := io.Reader(br)
+	if inv.keepRaw {
+		raw = &bytes.Buffer{}
+		src = io.TeeReader(br, raw)
+	}
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxInventoryLineSize)
+	scanner.Split(scanInventoryLines)
+	p := newInventoryParser(inv)
+	lc := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if lc == 0 {
+			line = strings.TrimPrefix(line, string(utf8BOM))
+		}
+		if err := p.parseLine(lc, line); err != nil {
+			return err
+		}
+		lc++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed reading inventory line %d: %w", lc+1, err)
+	}
+	if raw != nil {
+		inv.Raw = raw.Bytes()
+	}
+	return inv.finalize()
+}
+
+// setRaw keeps the loaded inventory data in Raw, when the Inventory is
+// created with WithRawData.
+func (inv *Inventory) setRaw(b []byte) {
+	if inv.keepRaw {
+		inv.Raw = b
+	}
+}
+
+// scanInventoryLines is a bufio.SplitFunc splitting the data into lines
+// ending with LF, CRLF, or CR, the line endings normalizeText converts.
+func scanInventoryLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// CR is the last byte read, LF may follow.
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// sizeLimitedReader fails the reads once the data read exceeds the limit,
+// when the limit is positive.
+type sizeLimitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (r *sizeLimitedReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	if limitErr := checkLimit(LimitFileSize, r.n, r.limit); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadFromReader(t *testing.T) {
+	hosts, err := os.ReadFile("../../testdata/inventory/hosts")
+	if err != nil {
+		t.Fatalf("error reading inventory file: %s", err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(hosts)
+	zw.Close()
+	encrypted, err := os.ReadFile("../../testdata/inventory/hosts2.vault")
+	if err != nil {
+		t.Fatalf("error reading inventory file: %s", err)
+	}
+	plaintext, err := os.ReadFile("../../testdata/inventory/hosts2")
+	if err != nil {
+		t.Fatalf("error reading inventory file: %s", err)
+	}
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error reading vault key file: %s", err)
+	}
+
+	for i, test := range []struct {
+		name      string
+		input     []byte
+		expected  []byte
+		opts      []InventoryOption
+		shouldErr bool
+		err       error
+		limit     bool
+	}{
+		{name: "plain text", input: hosts},
+		{name: "gzip compressed", input: gz.Bytes(), expected: hosts},
+		{name: "crlf line endings", input: bytes.ReplaceAll(hosts, []byte("\n"), []byte("\r\n")), expected: hosts},
+		{name: "cr line endings", input: bytes.ReplaceAll(hosts, []byte("\n"), []byte("\r")), expected: hosts},
+		{name: "byte order mark", input: append(append([]byte{}, utf8BOM...), hosts...), expected: hosts},
+		{name: "vault encrypted", input: encrypted, expected: plaintext, opts: []InventoryOption{WithVault(vlt)}},
+		{name: "size limit", input: hosts, opts: []InventoryOption{WithMaxFileSize(100)}, shouldErr: true, limit: true},
+		{name: "invalid line", input: []byte("[web]\nweb01\n[a:b:c]\n"), shouldErr: true, err: ErrInvalidSection},
+		{name: "line too long", input: []byte("[web]\n" + strings.Repeat("a", maxInventoryLineSize+1)), shouldErr: true},
+	} {
+		inv := NewInventory(test.opts...)
+		err := inv.LoadFromReader(bytes.NewReader(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, %s, expected error, but passed", i, test.name)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Fatalf("FAIL: Test %d, %s, error mismatch: %v (expected) vs. %v (received)", i, test.name, test.err, err)
+			}
+			if _, ok := IsLimitError(err); ok != test.limit {
+				t.Fatalf("FAIL: Test %d, %s, limit error mismatch: %t (expected) vs. %t (received)", i, test.name, test.limit, ok)
+			}
+			t.Logf("PASS: Test %d, %s, error: %s", i, test.name, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, %s, unexpected error: %s", i, test.name, err)
+		}
+		expected := test.expected
+		if expected == nil {
+			expected = test.input
+		}
+		ref := NewInventory()
+		if err := ref.LoadFromBytes(expected); err != nil {
+			t.Fatalf("FAIL: Test %d, %s, error reading reference inventory: %s", i, test.name, err)
+		}
+		if !reflect.DeepEqual(inv.Hosts, ref.Hosts) || !reflect.DeepEqual(inv.HostsRef, ref.HostsRef) {
+			t.Fatalf("FAIL: Test %d, %s, hosts mismatch", i, test.name)
+		}
+		if len(inv.Groups) != len(ref.Groups) {
+			t.Fatalf("FAIL: Test %d, %s, group count mismatch: %d (expected) vs. %d (received)", i, test.name, len(ref.Groups), len(inv.Groups))
+		}
+		if inv.Raw != nil {
+			t.Fatalf("FAIL: Test %d, %s, expected no raw data without WithRawData", i, test.name)
+		}
+		t.Logf("PASS: Test %d, %s, %d hosts", i, test.name, inv.Size())
+	}
+}
+
+func TestWithRawData(t *testing.T) {
+	data := []byte("[web]\nweb01\nweb02\n")
+	for i, load := range []func(*Inventory) error{
+		func(inv *Inventory) error { return inv.LoadFromBytes(data) },
+		func(inv *Inventory) error { return inv.LoadFromReader(bytes.NewReader(data)) },
+	} {
+		inv := NewInventory(WithRawData())
+		if err := load(inv); err != nil {
+			t.Fatalf("FAIL: Test %d, error reading inventory: %s", i, err)
+		}
+		if !bytes.Equal(inv.Raw, data) {
+			t.Fatalf("FAIL: Test %d, raw data mismatch: %q (expected) vs. %q (received)", i, data, inv.Raw)
+		}
+		t.Logf("PASS: Test %d, raw data: %q", i, inv.Raw)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Rekey changes the password of a loaded vault, as "ansible-vault rekey"
+// does. The payload of the vault is encrypted with a fresh salt under the
+// new password, and returned in the Ansible vault format. The vault ID
+// label, if any, is kept. The old password must be the one the vault was
+// encrypted with.
+func (v *Vault) Rekey(oldPassword, newPassword string) ([]byte, error) {
+	if len(v.Key.HMAC) == 0 {
+		return nil, fmt.Errorf("vault is not loaded")
+	}
+	if !v.checkPassword([]byte(strings.TrimSpace(oldPassword))) {
+		return nil, fmt.Errorf("invalid old vault password")
+	}
+	newPassword = strings.TrimSpace(newPassword)
+	if newPassword == "" {
+		return nil, fmt.Errorf("empty password is unsupported")
+	}
+	tv := v.withKeys()
+	tv.Password = []byte(newPassword)
+	b, err := encryptVault(v.Payload, tv.Password, v.Header.Label)
+	if err != nil {
+		return nil, err
+	}
+	if v.Header.Label != "" {
+		tv.keyring[v.Header.Label] = tv.Password
+	}
+	if err := tv.open(b); err != nil {
+		return nil, fmt.Errorf("error reopening rekeyed vault: %s", err)
+	}
+	v.Header = tv.Header
+	v.Body = tv.Body
+	v.Key = tv.Key
+	v.Password = tv.Password
+	v.keyring = tv.keyring
+	return b, nil
+}
+
+// RekeyFile changes the password of a vault file, see Rekey. The file is
+// replaced atomically, keeps its permissions, and stays compressed when it
+// has the .gz or .zst extension.
+func RekeyFile(fp, oldPassword, newPassword string, opts ...VaultOption) error {
+	fp = expandFilePath(fp)
+	fi, err := os.Stat(fp)
+	if err != nil {
+		return err
+	}
+	v := NewVault(opts...)
+	if err := v.SetPassword(oldPassword); err != nil {
+		return err
+	}
+	b, err := readFile(fp, v.maxFileSize)
+	if err != nil {
+		return err
+	}
+	if err := v.open(b); err != nil {
+		return err
+	}
+	b, err = v.Rekey(oldPassword, newPassword)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomicCompressed(fp, b, fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed saving vault: %s", err)
+	}
+	return nil
+}
+
+// checkPassword returns true when the password unlocks the body of the
+// vault, i.e. derives the HMAC key the vault was opened with.
+func (v *Vault) checkPassword(password []byte) bool {
+	key := deriveVaultKey(password, v.Body.Salt)
+	return hmac.Equal(key[vaultKeyLength:(vaultKeyLength*2)], v.Key.HMAC)
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVaultRekey(t *testing.T) {
+	for i, test := range []struct {
+		name        string
+		label       string
+		oldPassword string
+		newPassword string
+		shouldErr   bool
+	}{
+		{oldPassword: "0ld", newPassword: "n3w"},
+		{label: "prod", oldPassword: "0ld", newPassword: "n3w"},
+		{oldPassword: "wrong", newPassword: "n3w", shouldErr: true},
+		{oldPassword: "0ld", newPassword: " ", shouldErr: true},
+		{name: "vars.yml.gz", oldPassword: "0ld", newPassword: "n3w"},
+		{name: "vars.yml.zst", label: "prod", oldPassword: "0ld", newPassword: "n3w"},
+	} {
+		if test.name == "" {
+			test.name = "vars.yml"
+		}
+		fp := filepath.Join(t.TempDir(), test.name)
+		src := NewVault()
+		src.SetPassword("0ld")
+		src.Header.Label = test.label
+		b, err := src.Encrypt([]byte("# comments are kept\nntp_server: 192.0.2.1\n"))
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error encrypting vault: %s", i, err)
+		}
+		if err := writeFile(fp, b); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(fp, 0640); err != nil {
+			t.Fatal(err)
+		}
+		err = RekeyFile(fp, test.oldPassword, test.newPassword)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error, but passed", i)
+			}
+			t.Logf("PASS: Test %d, error: %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		rb, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.name != "vars.yml" && !bytes.HasPrefix(rb, gzipMagic) && !bytes.HasPrefix(rb, zstdMagic) {
+			t.Fatalf("FAIL: Test %d, rekeyed vault %s is not compressed", i, test.name)
+		}
+		if rb, err = decompress(rb, 0); err != nil {
+			t.Fatalf("FAIL: Test %d, error decompressing rekeyed vault: %s", i, err)
+		}
+		if string(rb) == string(b) {
+			t.Fatalf("FAIL: Test %d, vault unchanged", i)
+		}
+		header, err := ParseVaultHeader(rb)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error parsing header: %s", i, err)
+		}
+		if header.Label != test.label {
+			t.Fatalf("FAIL: Test %d, vault id mismatch: %s (expected) vs. %s (received)", i, test.label, header.Label)
+		}
+		if fi, _ := os.Stat(fp); fi.Mode().Perm() != 0640 {
+			t.Fatalf("FAIL: Test %d, file mode mismatch: %o", i, fi.Mode().Perm())
+		}
+		old := NewVault()
+		old.SetPassword(test.oldPassword)
+		if _, err := old.Decrypt(rb); err == nil {
+			t.Fatalf("FAIL: Test %d, rekeyed vault opens with the old password", i)
+		}
+		vlt := NewVault()
+		vlt.SetPassword(test.newPassword)
+		payload, err := vlt.Decrypt(rb)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error decrypting rekeyed vault: %s", i, err)
+		}
+		if !strings.HasPrefix(string(payload), "# comments are kept\n") {
+			t.Fatalf("FAIL: Test %d, payload mismatch: %s", i, payload)
+		}
+		t.Logf("PASS: Test %d, rekeyed vault %s", i, strings.SplitN(string(rb), "\n", 2)[0])
+	}
+}
+
+func TestVaultRekeyNotLoaded(t *testing.T) {
+	vlt := NewVault()
+	if _, err := vlt.Rekey("0ld", "n3w"); err == nil {
+		t.Fatalf("expected error rekeying a vault not loaded")
+	}
+}
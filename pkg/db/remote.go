@@ -0,0 +1,207 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// SourceMetadata is the freshness metadata of a remote inventory.
+type SourceMetadata struct {
+	URL          string    `json:"url" yaml:"url"`
+	ETag         string    `json:"etag,omitempty" yaml:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty" yaml:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at" yaml:"fetched_at"`
+	// Modified is false when the last fetch got "304 Not Modified" and the
+	// cached data was used.
+	Modified bool `json:"modified" yaml:"modified"`
+}
+
+// RemoteSource fetches inventory data over HTTP(S), e.g. from a web server
+// or a pre-signed S3 URL. It sends conditional requests, i.e. If-None-Match
+// and If-Modified-Since, so that the unchanged data is not downloaded again.
+type RemoteSource struct {
+	URL    string
+	Client *http.Client
+	// CacheFile, when set, keeps the fetched data and its metadata, the
+	// latter in the file with the ".json" suffix, across restarts.
+	CacheFile string
+	// MaxSize limits the size, in bytes, of the fetched data.
+	MaxSize int64
+
+	mu       sync.Mutex
+	data     []byte
+	metadata SourceMetadata
+}
+
+// NewRemoteSource returns an instance of RemoteSource.
+func NewRemoteSource(url string) *RemoteSource {
+	return &RemoteSource{
+		URL:    url,
+		Client: http.DefaultClient,
+	}
+}
+
+// Metadata returns the freshness metadata of the last fetch.
+func (s *RemoteSource) Metadata() SourceMetadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.metadata
+}
+
+// Fetch returns the remote data, either downloaded or, when unchanged,
+// cached.
+func (s *RemoteSource) Fetch(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil && s.CacheFile != "" {
+		s.loadCache()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.data != nil {
+		if s.metadata.ETag != "" {
+			req.Header.Set("If-None-Match", s.metadata.ETag)
+		}
+		if s.metadata.LastModified != "" {
+			req.Header.Set("If-Modified-Since", s.metadata.LastModified)
+		}
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching %s: %s", s.URL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if s.data == nil {
+			return nil, fmt.Errorf("failed fetching %s: not modified, but nothing is cached", s.URL)
+		}
+		s.metadata.FetchedAt = time.Now().UTC()
+		s.metadata.Modified = false
+		return s.data, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("failed fetching %s: %s", s.URL, resp.Status)
+	}
+
+	var r io.Reader = resp.Body
+	if s.MaxSize > 0 {
+		r = io.LimitReader(resp.Body, s.MaxSize+1)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching %s: %s", s.URL, err)
+	}
+	if s.MaxSize > 0 && int64(len(b)) > s.MaxSize {
+		return nil, fmt.Errorf("failed fetching %s: exceeds the limit of %d bytes", s.URL, s.MaxSize)
+	}
+	s.data = b
+	s.metadata = SourceMetadata{
+		URL:          s.URL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+		Modified:     true,
+	}
+	if s.CacheFile != "" {
+		if err := s.saveCache(); err != nil {
+			return nil, err
+		}
+	}
+	return s.data, nil
+}
+
+func (s *RemoteSource) loadCache() {
+	b, err := os.ReadFile(s.CacheFile + ".json")
+	if err != nil {
+		return
+	}
+	var m SourceMetadata
+	if err := json.Unmarshal(b, &m); err != nil || m.URL != s.URL {
+		return
+	}
+	data, err := os.ReadFile(s.CacheFile)
+	if err != nil {
+		return
+	}
+	s.data = data
+	s.metadata = m
+}
+
+func (s *RemoteSource) saveCache() error {
+	if err := os.WriteFile(s.CacheFile, s.data, 0600); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s.metadata)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.CacheFile+".json", b, 0600)
+}
+
+// LoadFromRemote loads inventory data from a remote source. When the
+// Inventory has a signature verification key, the signature is fetched
+// from the URL with the ".sig" suffix.
+func (inv *Inventory) LoadFromRemote(ctx context.Context, s *RemoteSource) error {
+	if s.MaxSize == 0 {
+		s.MaxSize = inv.maxFileSize
+	}
+	b, err := inv.fetchRemote(ctx, s)
+	if err != nil {
+		return err
+	}
+	return inv.loadBytes(b)
+}
+
+// fetchRemote fetches, verifies, and decompresses the data of a remote
+// source.
+func (inv *Inventory) fetchRemote(ctx context.Context, s *RemoteSource) ([]byte, error) {
+	b, err := s.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if inv.verifyKey != nil {
+		sig := NewRemoteSource(s.URL + SignatureFileSuffix)
+		sig.Client = s.Client
+		sig.MaxSize = 1024
+		sb, err := sig.Fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := Verify(b, sb, inv.verifyKey); err != nil {
+			return nil, fmt.Errorf("%s: %s", s.URL, err)
+		}
+	}
+	b, err = decompress(b, inv.maxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", s.URL, err)
+	}
+	return b, nil
+}
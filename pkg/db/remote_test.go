@@ -0,0 +1,77 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoteSource(t *testing.T) {
+	hosts, err := os.ReadFile("../../testdata/inventory/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := `"v1"`
+	var downloads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write(hosts)
+	}))
+	defer srv.Close()
+
+	cacheFile := filepath.Join(t.TempDir(), "hosts.cache")
+	var src *RemoteSource
+	for i, test := range []struct {
+		newSource bool
+		etag      string
+		modified  bool
+		downloads int
+	}{
+		{newSource: true, etag: `"v1"`, modified: true, downloads: 1},
+		{etag: `"v1"`, modified: false, downloads: 1},
+		{newSource: true, etag: `"v1"`, modified: false, downloads: 1},
+		{etag: `"v2"`, modified: true, downloads: 2},
+	} {
+		etag = test.etag
+		if test.newSource {
+			src = NewRemoteSource(srv.URL + "/hosts")
+			src.CacheFile = cacheFile
+		}
+		inv := NewInventory()
+		if err := inv.LoadFromRemote(context.Background(), src); err != nil {
+			t.Fatalf("FAIL: Test %d, error loading remote inventory: %s", i, err)
+		}
+		if _, err := inv.GetHost("ny-sw01"); err != nil {
+			t.Fatalf("FAIL: Test %d, %s", i, err)
+		}
+		m := src.Metadata()
+		if m.Modified != test.modified || m.ETag != test.etag || downloads != test.downloads {
+			t.Fatalf("FAIL: Test %d, metadata mismatch: modified %t, etag %s, downloads %d (expected) vs. modified %t, etag %s, downloads %d (received)",
+				i, test.modified, test.etag, test.downloads, m.Modified, m.ETag, downloads)
+		}
+		t.Logf("PASS: Test %d, modified %t, etag %s, downloads %d", i, m.Modified, m.ETag, downloads)
+	}
+}
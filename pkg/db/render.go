@@ -0,0 +1,165 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// HostContext is the data a template renders per host.
+type HostContext struct {
+	Name        string
+	Parent      string
+	Groups      []string
+	Tags        []string
+	Variables   map[string]string
+	Credentials []*VaultCredential
+}
+
+// NewHostContext returns the template data of a host, with the credentials
+// from the provided Vault, when not nil.
+func NewHostContext(h *InventoryHost, v *Vault) (*HostContext, error) {
+	c := &HostContext{
+		Name:        h.Name,
+		Parent:      h.Parent,
+		Groups:      h.Groups,
+		Tags:        h.Tags,
+		Variables:   h.Variables,
+		Credentials: []*VaultCredential{},
+	}
+	if v != nil {
+		c.Credentials = v.hostCredentials(h)
+	}
+	return c, nil
+}
+
+// RenderHost executes the template with the HostContext of a host.
+func RenderHost(t *template.Template, h *InventoryHost, v *Vault, w io.Writer) error {
+	c, err := NewHostContext(h, v)
+	if err != nil {
+		return err
+	}
+	if err := t.Execute(w, c); err != nil {
+		return fmt.Errorf("failed rendering host %s: %s", h.Name, err)
+	}
+	return nil
+}
+
+// MatchHostPattern returns a HostMatcher for an Ansible host pattern, i.e.
+// a comma- or colon-separated list of host names, group names, globs,
+// e.g. "ny-sw*", and regular expressions prefixed with "~". The terms
+// prefixed with "&" must match too, and the terms prefixed with "!"
+// exclude hosts, e.g. "ny4:&cisco:!ny-sw01". The "all" and "*" terms match
+// every host.
+func MatchHostPattern(pattern string) (HostMatcher, error) {
+	sep := ","
+	if !strings.Contains(pattern, ",") && strings.Contains(pattern, ":") && !strings.Contains(pattern, "::") {
+		sep = ":"
+	}
+	var union, intersection, exclusion []HostMatcher
+	for _, term := range strings.Split(pattern, sep) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		list := &union
+		switch term[0] {
+		case '&':
+			list = &intersection
+			term = term[1:]
+		case '!':
+			list = &exclusion
+			term = term[1:]
+		}
+		m, err := matchPatternTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		*list = append(*list, m)
+	}
+	if len(union) == 0 {
+		if len(intersection) == 0 && len(exclusion) == 0 {
+			return nil, fmt.Errorf("empty host pattern")
+		}
+		// As in Ansible, the exclusions and intersections apply to all
+		// hosts when the pattern has no other terms.
+		union = append(union, func(*InventoryHost) bool { return true })
+	}
+	return func(h *InventoryHost) bool {
+		matched := false
+		for _, m := range union {
+			if m(h) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+		for _, m := range intersection {
+			if !m(h) {
+				return false
+			}
+		}
+		for _, m := range exclusion {
+			if m(h) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// matchPatternTerm returns a HostMatcher selecting the hosts whose name or
+// groups match a single term of a host pattern.
+func matchPatternTerm(term string) (HostMatcher, error) {
+	var match func(s string) bool
+	switch {
+	case term == "all" || term == "*":
+		return func(*InventoryHost) bool { return true }, nil
+	case strings.HasPrefix(term, "~"):
+		r, err := regexp.Compile(term[1:])
+		if err != nil {
+			return nil, fmt.Errorf("host pattern contains invalid regular expression: %s, error: %s", term, err)
+		}
+		match = r.MatchString
+	case strings.ContainsAny(term, "*?["):
+		if _, err := path.Match(term, ""); err != nil {
+			return nil, fmt.Errorf("host pattern contains invalid glob: %s, error: %s", term, err)
+		}
+		match = func(s string) bool {
+			ok, _ := path.Match(term, s)
+			return ok
+		}
+	default:
+		match = func(s string) bool { return s == term }
+	}
+	return func(h *InventoryHost) bool {
+		if match(h.Name) {
+			return true
+		}
+		for _, g := range h.Groups {
+			if match(g) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"text/template"
+)
+
+func TestMatchHostPattern(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		pattern   string
+		hosts     []string
+		shouldErr bool
+	}{
+		{pattern: "ny-sw*", hosts: []string{"ny-sw01", "ny-sw02", "ny-sw03", "ny-sw04"}},
+		{pattern: "ny4:&cisco", hosts: []string{"ny-sw01"}},
+		{pattern: "cisco,controller,!ny-sw04", hosts: []string{"controller", "ny-sw01"}},
+		{pattern: "~sw0[23]$", hosts: []string{"ny-sw02", "ny-sw03"}},
+		{pattern: "all:!ny", hosts: []string{"controller"}},
+		{pattern: "!ny", hosts: []string{"controller"}},
+		{pattern: " , ", shouldErr: true},
+		{pattern: "~(", shouldErr: true},
+	} {
+		m, err := MatchHostPattern(test.pattern)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error for %s", i, test.pattern)
+			}
+			t.Logf("PASS: Test %d, %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		var hosts []string
+		inv.AllHosts(m)(func(h *InventoryHost) bool {
+			hosts = append(hosts, h.Name)
+			return true
+		})
+		sort.Strings(hosts)
+		if len(hosts) != len(test.hosts) {
+			t.Fatalf("FAIL: Test %d, %s: host mismatch: %v (expected) vs. %v (received)", i, test.pattern, test.hosts, hosts)
+		}
+		for j := range hosts {
+			if hosts[j] != test.hosts[j] {
+				t.Fatalf("FAIL: Test %d, %s: host mismatch: %v (expected) vs. %v (received)", i, test.pattern, test.hosts, hosts)
+			}
+		}
+		t.Logf("PASS: Test %d, %s: %v", i, test.pattern, hosts)
+	}
+}
+
+func TestRenderHost(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error reading vault key file: %s", err)
+	}
+	if err := vlt.LoadFromFile("../../testdata/inventory/vault.yml"); err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	h, err := inv.GetHost("ny-sw01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := template.Must(template.New("config").Parse(
+		"hostname {{ .Name }}\n! {{ .Variables.vendor }} in {{ .Variables.datacenter }}\nusername {{ (index .Credentials 0).Username }}\n"))
+	var buf bytes.Buffer
+	if err := RenderHost(tmpl, h, vlt, &buf); err != nil {
+		t.Fatalf("error rendering: %s", err)
+	}
+	expected := "hostname ny-sw01\n! Cisco Systems in ny4\nusername admin\n"
+	if buf.String() != expected {
+		t.Fatalf("FAIL: output mismatch: %q (expected) vs. %q (received)", expected, buf.String())
+	}
+	if err := RenderHost(template.Must(template.New("bad").Parse("{{ .Missing }}")), h, nil, &buf); err == nil {
+		t.Fatalf("FAIL: expected error rendering a missing field")
+	}
+	t.Logf("PASS: %q", buf.String())
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// groupMembership is what the members of a group have in common, i.e. the
+// group chains and the groups, see GetParentGroupChains.
+type groupMembership struct {
+	chains []string
+	groups []string
+}
+
+// membership returns the group chains and the groups of the members of the
+// provided group. They are computed once per group, until the groups of
+// the Inventory change. The caller holds resolveMu.
+func (inv *Inventory) membership(ctx context.Context, name string) (*groupMembership, error) {
+	if m, exists := inv.memberships[name]; exists {
+		return m, nil
+	}
+	chains, groups, err := inv.GetParentGroupChainsContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	m := &groupMembership{chains: chains, groups: groups}
+	if inv.memberships == nil {
+		inv.memberships = make(map[string]*groupMembership)
+	}
+	inv.memberships[name] = m
+	return m, nil
+}
+
+// hostMembership returns the group chains and the groups of a host, i.e.
+// the membership of its parent group, merged with the memberships of its
+// other groups, if any. The caller holds resolveMu.
+func (inv *Inventory) hostMembership(ctx context.Context, h *InventoryHost) (*groupMembership, error) {
+	m, err := inv.membership(ctx, h.Parent)
+	if err != nil || len(h.ExtraParents) == 0 {
+		return m, err
+	}
+	chains := cloneStrings(m.chains)
+	for _, name := range h.ExtraParents {
+		em, err := inv.membership(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range em.chains {
+			if !stringInList(c, chains) {
+				chains = append(chains, c)
+			}
+		}
+	}
+	sortGroupChains(chains)
+	return &groupMembership{chains: chains, groups: orderChainGroups(chains)}, nil
+}
+
+// hasParent returns true when the host is a direct member of the group,
+// see ExtraParents.
+func (h *InventoryHost) hasParent(name string) bool {
+	return h.Parent == name || stringInList(name, h.ExtraParents)
+}
+
+// resetMemberships discards the group memberships computed so far, e.g.
+// after a group was added to another one.
+func (inv *Inventory) resetMemberships() {
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	inv.memberships = nil
+}
+
+// Precompute resolves the group chains, the groups, and the inherited
+// variables of all of the hosts. By default, they are resolved when the
+// inventory is loaded or edited. With WithLazyResolution, they are
+// resolved when a host is first looked up, e.g. with GetHost, and the
+// callers accessing the Hosts field directly call Precompute first.
+func (inv *Inventory) Precompute() error {
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	for _, h := range inv.Hosts {
+		if err := inv.resolveHostLocked(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveEagerlyLocked resolves the hosts loaded or invalidated by a
+// change right away, unless the Inventory resolves the hosts lazily, see
+// WithLazyResolution. The caller holds resolveMu.
+func (inv *Inventory) resolveEagerlyLocked() error {
+	if inv.lazy {
+		return nil
+	}
+	for _, h := range inv.Hosts {
+		if err := inv.resolveHostLocked(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveHosts is Precompute for the callers without an error to return.
+// The hosts failing to resolve are reported by the logger, and by GetHost.
+func (inv *Inventory) resolveHosts() {
+	if err := inv.Precompute(); err != nil {
+		inv.logger.Warnf("%s", err)
+	}
+}
+
+// resolveHost computes the group chains, the groups, and the inherited
+// variables of a host, unless they are computed already.
+func (inv *Inventory) resolveHost(h *InventoryHost) error {
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	return inv.resolveHostLocked(h)
+}
+
+// resolveHostList resolves the provided hosts, e.g. the hosts a query
+// returns.
+func (inv *Inventory) resolveHostList(hosts []*InventoryHost) error {
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	for _, h := range hosts {
+		if err := inv.resolveHostLocked(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostGroups returns the groups of a host, without resolving the host.
+func (inv *Inventory) hostGroups(h *InventoryHost) []string {
+	inv.resolveMu.Lock()
+	defer inv.resolveMu.Unlock()
+	if !h.unresolved {
+		return h.Groups
+	}
+	m, err := inv.hostMembership(context.Background(), h)
+	if err != nil {
+		return h.Groups
+	}
+	return m.groups
+}
+
+// resolveHostLocked is resolveHost for the callers holding resolveMu.
+func (inv *Inventory) resolveHostLocked(h *InventoryHost) error {
+	if !h.unresolved {
+		return nil
+	}
+	m, err := inv.hostMembership(context.Background(), h)
+	if err != nil {
+		return fmt.Errorf("the search for parent group chains for host '%s' erred: %w", h.Name, err)
+	}
+	h.GroupChains = cloneStrings(m.chains)
+	h.Groups = cloneStrings(m.groups)
+	if err := inv.inheritVariables(h); err != nil {
+		return err
+	}
+	h.unresolved = false
+	return nil
+}
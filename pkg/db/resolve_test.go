@@ -0,0 +1,207 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLazyHostResolution(t *testing.T) {
+	data := []byte(`[web]
+web01
+web02 env=test
+
+[ny:children]
+web
+
+[ny:vars]
+env=prod
+site=ny
+`)
+	inv := NewInventory(WithLazyResolution())
+	if err := inv.LoadFromBytes(data); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for _, h := range inv.Hosts {
+		if !h.unresolved || h.Groups != nil || h.Variables["site"] != "" {
+			t.Fatalf("expected host %s to be resolved on first use, groups: %v, variables: %v", h.Name, h.Groups, h.Variables)
+		}
+	}
+	g, err := inv.GetGroup("ny")
+	if err != nil {
+		t.Fatalf("error getting group: %s", err)
+	}
+	if g.Counters.Hosts != 2 {
+		t.Fatalf("group ny host counter mismatch: 2 (expected) vs. %d (received)", g.Counters.Hosts)
+	}
+
+	for i, test := range []struct {
+		host   string
+		groups []string
+		vars   map[string]string
+	}{
+		{host: "web01", groups: []string{"all", "ny", "web"}, vars: map[string]string{"env": "prod", "site": "ny"}},
+		{host: "web02", groups: []string{"all", "ny", "web"}, vars: map[string]string{"env": "test", "site": "ny"}},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s: %s", i, test.host, err)
+		}
+		if h.unresolved || !reflect.DeepEqual(h.Groups, test.groups) {
+			t.Fatalf("FAIL: Test %d, host %s groups mismatch: %v (expected) vs. %v (received)", i, test.host, test.groups, h.Groups)
+		}
+		for k, v := range test.vars {
+			if h.Variables[k] != v {
+				t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)", i, test.host, k, v, h.Variables[k])
+			}
+		}
+		t.Logf("PASS: Test %d, host %s resolved on lookup", i, test.host)
+	}
+
+	inv = NewInventory(WithLazyResolution())
+	if err := inv.LoadFromBytes(data); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	hosts, err := inv.GetHostsWithFilter("web01", nil)
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("unexpected filter result: %v, %v", hosts, err)
+	}
+	if h := inv.lookupHost("web02"); !h.unresolved {
+		t.Fatalf("expected the host not matching the filter to be unresolved")
+	}
+	if err := inv.Precompute(); err != nil {
+		t.Fatalf("error resolving hosts: %s", err)
+	}
+	for _, h := range inv.Hosts {
+		if h.unresolved || h.Variables["site"] != "ny" {
+			t.Fatalf("expected host %s to be resolved by Precompute", h.Name)
+		}
+	}
+}
+
+func TestEagerHostResolution(t *testing.T) {
+	data := []byte(`[web]
+web01
+web02 env=test
+
+[ny:children]
+web
+
+[ny:vars]
+env=prod
+site=ny
+`)
+	inv := NewInventory()
+	if err := inv.LoadFromBytes(data); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		name   string
+		fn     func() error
+		groups []string
+		vars   map[string]string
+	}{
+		{
+			name:   "load",
+			fn:     func() error { return nil },
+			groups: []string{"all", "ny", "web"},
+			vars:   map[string]string{"site": "ny"},
+		},
+		{
+			name:   "set group variable",
+			fn:     func() error { return inv.SetGroupVariable("ny", "site", "nyc") },
+			groups: []string{"all", "ny", "web"},
+			vars:   map[string]string{"site": "nyc"},
+		},
+		{
+			name:   "set host variable",
+			fn:     func() error { return inv.SetHostVariable("web01", "site", "lab") },
+			groups: []string{"all", "ny", "web"},
+			vars:   map[string]string{"site": "lab"},
+		},
+		{
+			name:   "delete host variable",
+			fn:     func() error { return inv.DeleteHostVariable("web01", "site") },
+			groups: []string{"all", "ny", "web"},
+			vars:   map[string]string{"site": "nyc"},
+		},
+	} {
+		if err := test.fn(); err != nil {
+			t.Fatalf("FAIL: Test %d, %s, unexpected error: %s", i, test.name, err)
+		}
+		// The Hosts field holds resolved hosts without any lookup.
+		for _, h := range inv.Hosts {
+			if h.Name != "web01" {
+				continue
+			}
+			if h.unresolved || !reflect.DeepEqual(h.Groups, test.groups) || len(h.GroupChains) == 0 {
+				t.Fatalf("FAIL: Test %d, %s, host %s is not resolved, groups: %v, chains: %v", i, test.name, h.Name, h.Groups, h.GroupChains)
+			}
+			for k, v := range test.vars {
+				if h.Variables[k] != v {
+					t.Fatalf("FAIL: Test %d, %s, host %s variable %s mismatch: %s (expected) vs. %s (received)", i, test.name, h.Name, k, v, h.Variables[k])
+				}
+			}
+		}
+		t.Logf("PASS: Test %d, %s", i, test.name)
+	}
+}
+
+// newLargeTestInventory returns the data of an inventory with the provided
+// number of hosts spread over nested groups.
+func newLargeTestInventory(hosts, groups int) []byte {
+	var sb strings.Builder
+	for g := 0; g < groups; g++ {
+		fmt.Fprintf(&sb, "[group%d]\n", g)
+		for h := g; h < hosts; h += groups {
+			fmt.Fprintf(&sb, "host%d port=%d\n", h, 8000+h)
+		}
+		fmt.Fprintf(&sb, "[group%d:vars]\nrole=role%d\n", g, g)
+	}
+	fmt.Fprintf(&sb, "[dc:children]\n")
+	for g := 0; g < groups; g++ {
+		fmt.Fprintf(&sb, "group%d\n", g)
+	}
+	sb.WriteString("[dc:vars]\nsite=ny\n")
+	return []byte(sb.String())
+}
+
+func BenchmarkLoadFromBytesLazy(b *testing.B) {
+	data := newLargeTestInventory(20000, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inv := NewInventory(WithLazyResolution())
+		if err := inv.LoadFromBytes(data); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := inv.GetHost("host100"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadFromBytes(b *testing.B) {
+	data := newLargeTestInventory(20000, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inv := NewInventory()
+		if err := inv.LoadFromBytes(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
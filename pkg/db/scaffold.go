@@ -0,0 +1,97 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const scaffoldHosts = `#
+# Managed devices
+#
+
+[switches]
+sw01 ansible_host=192.0.2.11
+sw02 ansible_host=192.0.2.12
+
+[routers]
+rtr01 ansible_host=192.0.2.1
+
+[network:children]
+switches
+routers
+
+[network:vars]
+ansible_connection=network_cli
+`
+
+const scaffoldGroupVars = `---
+# Variables applied to all hosts. Group-specific variables go to
+# group_vars/<group>.yml, host-specific ones to host_vars/<host>.yml.
+ntp_server: 192.0.2.123
+`
+
+const scaffoldVault = `---
+credentials:
+  - description: default network credentials
+    default: true
+    username: admin
+    password: changeme
+    password_enable: changeme
+  - description: switch credentials
+    regex: "^sw"
+    username: netops
+    password: changeme
+    priority: 1
+`
+
+// InitInventory creates a starter inventory in a directory: a hosts file,
+// the group_vars/ and host_vars/ directories, and a vault.yml with
+// placeholder credentials, encrypted with the password of the provided
+// Vault. The existing files are never overwritten.
+func InitInventory(dir string, v *Vault) error {
+	dir = expandFilePath(dir)
+	vault, err := v.encryptBytes([]byte(scaffoldVault))
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data []byte
+		mode os.FileMode
+	}{
+		{name: "hosts", data: []byte(scaffoldHosts), mode: 0644},
+		{name: filepath.Join("group_vars", "all.yml"), data: []byte(scaffoldGroupVars), mode: 0644},
+		{name: filepath.Join("host_vars", ".keep"), mode: 0644},
+		{name: "vault.yml", data: vault, mode: 0600},
+	}
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f.name)); err == nil {
+			return fmt.Errorf("file %s already exists", filepath.Join(dir, f.name))
+		}
+	}
+	for _, f := range files {
+		fp := filepath.Join(dir, f.name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(fp, f.data, f.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
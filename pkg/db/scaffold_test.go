@@ -0,0 +1,73 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitInventory(t *testing.T) {
+	dir := t.TempDir()
+	vlt := NewVault()
+	if err := vlt.SetPassword("init-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitInventory(dir, vlt); err != nil {
+		t.Fatalf("error initializing inventory: %s", err)
+	}
+	if err := InitInventory(dir, vlt); err == nil {
+		t.Fatalf("expected an error initializing inventory twice")
+	}
+
+	inv := NewInventory()
+	if err := inv.LoadFromFile(filepath.Join(dir, "hosts")); err != nil {
+		t.Fatalf("error loading scaffolded inventory: %s", err)
+	}
+	if inv.Size() != 3 {
+		t.Fatalf("inventory size mismatch: 3 (expected) vs. %d (received)", inv.Size())
+	}
+
+	v := NewVault()
+	if err := v.SetPassword("init-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.LoadFromFile(filepath.Join(dir, "vault.yml")); err != nil {
+		t.Fatalf("error loading scaffolded vault: %s", err)
+	}
+	for i, test := range []struct {
+		host     string
+		username string
+	}{
+		{host: "sw01", username: "netops"},
+		{host: "rtr01", username: "admin"},
+	} {
+		creds, err := v.GetCredentials(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting credentials for %s: %s", i, test.host, err)
+		}
+		if creds[0].Username != test.username {
+			t.Fatalf("FAIL: Test %d, %s username mismatch: %s (expected) vs. %s (received)",
+				i, test.host, test.username, creds[0].Username)
+		}
+		t.Logf("PASS: Test %d, %s: %s", i, test.host, creds[0].Username)
+	}
+
+	var buf bytes.Buffer
+	if err := PackBundle(dir, &buf); err != nil {
+		t.Fatalf("error packing scaffolded inventory: %s", err)
+	}
+}
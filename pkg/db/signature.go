@@ -0,0 +1,174 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// SignatureFileSuffix is appended to the name of a file to get the name of
+// the file holding its signature.
+const SignatureFileSuffix = ".sig"
+
+// Sign returns the base64-encoded Ed25519 signature of the data.
+func Sign(b []byte, key ed25519.PrivateKey) []byte {
+	sig := ed25519.Sign(key, b)
+	s := base64.StdEncoding.EncodeToString(sig)
+	return []byte(s + "\n")
+}
+
+// Verify checks the base64-encoded Ed25519 signature of the data.
+func Verify(b, sig []byte, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid signature verification key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil {
+		return fmt.Errorf("malformed signature: %s", err)
+	}
+	if !ed25519.Verify(key, b, raw) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// SignFile signs a file, e.g. an inventory file or a bundle, and writes
+// the signature to the file with the SignatureFileSuffix suffix.
+func SignFile(fp string, key ed25519.PrivateKey) error {
+	fp = expandFilePath(fp)
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fp+SignatureFileSuffix, Sign(b, key), 0644)
+}
+
+// readVerifiedFile reads a file and, when the Inventory has a signature
+// verification key, checks the signature of the data read, so that the
+// data parsed is the data verified. The signature covers the file content
+// as stored, see SignFile, i.e. the data is verified before it is
+// decompressed, as by fetchRemote.
+func (inv *Inventory) readVerifiedFile(fp string) ([]byte, error) {
+	b, err := readRawFile(fp, inv.maxFileSize)
+	if err != nil {
+		return nil, err
+	}
+	if inv.verifyKey != nil {
+		sig, err := os.ReadFile(fp + SignatureFileSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("file %s is not signed: %s", fp, err)
+		}
+		if err := Verify(b, sig, inv.verifyKey); err != nil {
+			return nil, fmt.Errorf("file %s: %s", fp, err)
+		}
+		inv.logger.Debugf("verified signature of %s", fp)
+	}
+	b, err = decompress(b, inv.maxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("file %s: %w", fp, err)
+	}
+	return b, nil
+}
+
+// checkUnsigned returns an error when the Inventory has a signature
+// verification key, for the data loaded without a signature to check.
+func (inv *Inventory) checkUnsigned() error {
+	if inv.verifyKey != nil {
+		return fmt.Errorf("inventory has a signature verification key, and the data has no signature, see LoadFromSignedBytes")
+	}
+	return nil
+}
+
+// LoadFromSignedBytes loads inventory data from an array of bytes after
+// verifying its signature with the signature verification key of the
+// Inventory.
+func (inv *Inventory) LoadFromSignedBytes(b, sig []byte) error {
+	if inv.verifyKey == nil {
+		return fmt.Errorf("inventory has no signature verification key")
+	}
+	if err := Verify(b, sig, inv.verifyKey); err != nil {
+		return err
+	}
+	return inv.loadBytes(b)
+}
+
+// LoadSigningKeyFromFile loads a PEM-encoded PKCS #8 Ed25519 private key.
+func LoadSigningKeyFromFile(fp string) (ed25519.PrivateKey, error) {
+	block, err := readPEMFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("file %s has unsupported PEM block type %s", fp, block.Type)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("file %s: %s", fp, err)
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("file %s has no Ed25519 private key", fp)
+	}
+	return key, nil
+}
+
+// LoadVerificationKeyFromFile loads an Ed25519 public key from a PEM-encoded
+// PKIX public key or an x509 certificate.
+func LoadVerificationKeyFromFile(fp string) (ed25519.PublicKey, error) {
+	block, err := readPEMFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	var k interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		k, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			k = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("file %s has unsupported PEM block type %s", fp, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file %s: %s", fp, err)
+	}
+	key, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("file %s has no Ed25519 public key", fp)
+	}
+	return key, nil
+}
+
+func readPEMFile(fp string) (*pem.Block, error) {
+	fp = expandFilePath(fp)
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("file %s has no PEM data", fp)
+	}
+	return block, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM := func(name, blockType string, der []byte) string {
+		fp := filepath.Join(dir, name)
+		b := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := os.WriteFile(fp, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privFile := writePEM("signing.pem", "PRIVATE KEY", der)
+	der, err = x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubFile := writePEM("verify.pem", "PUBLIC KEY", der)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "inventory"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err = x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM("verify.crt", "CERTIFICATE", der)
+
+	key, err := LoadSigningKeyFromFile(privFile)
+	if err != nil {
+		t.Fatalf("error loading signing key: %s", err)
+	}
+	hosts, err := os.ReadFile("../../testdata/inventory/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := filepath.Join(dir, "hosts")
+	unsigned := filepath.Join(dir, "hosts.unsigned")
+	tampered := filepath.Join(dir, "hosts.tampered")
+	for _, fp := range []string{signed, unsigned, tampered} {
+		if err := os.WriteFile(fp, hosts, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fp := range []string{signed, tampered} {
+		if err := SignFile(fp, key); err != nil {
+			t.Fatalf("error signing %s: %s", fp, err)
+		}
+	}
+	if err := os.WriteFile(tampered, append(hosts, []byte("\n[rogue]\nevil01\n")...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		keyFile   string
+		inputFile string
+		shouldErr bool
+	}{
+		{keyFile: pubFile, inputFile: signed},
+		{keyFile: certFile, inputFile: signed},
+		{keyFile: pubFile, inputFile: unsigned, shouldErr: true},
+		{keyFile: pubFile, inputFile: tampered, shouldErr: true},
+	} {
+		verifyKey, err := LoadVerificationKeyFromFile(test.keyFile)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error loading verification key %s: %s", i, test.keyFile, err)
+		}
+		inv := NewInventory(WithSignatureVerification(verifyKey))
+		err = inv.LoadFromFile(test.inputFile)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error loading %s", i, test.inputFile)
+			}
+			t.Logf("PASS: Test %d, %s: %s", i, test.inputFile, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error loading %s: %s", i, test.inputFile, err)
+		}
+		t.Logf("PASS: Test %d, %s verified with %s", i, test.inputFile, test.keyFile)
+	}
+
+	inv := NewInventory(WithSignatureVerification(pub))
+	if err := inv.LoadFromSignedBytes(hosts, Sign(hosts, priv)); err != nil {
+		t.Fatalf("error loading signed bytes: %s", err)
+	}
+	// The data without a signature is refused.
+	if err := NewInventory(WithSignatureVerification(pub)).LoadFromBytes(hosts); err == nil {
+		t.Fatalf("FAIL: expected error loading unsigned bytes")
+	}
+	if err := NewInventory(WithSignatureVerification(pub)).LoadFromReader(bytes.NewReader(hosts)); err == nil {
+		t.Fatalf("FAIL: expected error loading unsigned reader")
+	}
+	if err := NewInventory(WithSignatureVerification(pub)).LoadFromBytesWithOverlays(hosts, []byte("[db]\ndb01\n")); err == nil {
+		t.Fatalf("FAIL: expected error loading unsigned overlays")
+	}
+
+	// The group_vars and host_vars files of a directory are verified too.
+	src := filepath.Join(dir, "inventory")
+	if err := os.MkdirAll(filepath.Join(src, "group_vars"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "hosts"), []byte("[web]\nweb01\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SignFile(filepath.Join(src, "hosts"), key); err != nil {
+		t.Fatal(err)
+	}
+	varsFile := filepath.Join(src, "group_vars", "web.yml")
+	if err := os.WriteFile(varsFile, []byte("env: prod\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewInventory(WithSignatureVerification(pub)).LoadFromSources(context.Background(), src); err == nil {
+		t.Fatalf("FAIL: expected error loading unsigned group_vars file")
+	}
+	if err := SignFile(varsFile, key); err != nil {
+		t.Fatal(err)
+	}
+	inv = NewInventory(WithSignatureVerification(pub))
+	if err := inv.LoadFromSources(context.Background(), src); err != nil {
+		t.Fatalf("FAIL: error loading signed inventory directory: %s", err)
+	}
+	h, err := inv.GetHost("web01")
+	if err != nil || h.Variables["env"] != "prod" {
+		t.Fatalf("FAIL: host web01 mismatch: %v, %v", h, err)
+	}
+
+	// The signature of a compressed file covers the compressed data.
+	gz := filepath.Join(dir, "hosts.gz")
+	if err := writeFile(gz, hosts); err != nil {
+		t.Fatal(err)
+	}
+	if err := SignFile(gz, key); err != nil {
+		t.Fatal(err)
+	}
+	inv = NewInventory(WithSignatureVerification(pub))
+	if err := inv.LoadFromFile(gz); err != nil {
+		t.Fatalf("FAIL: error loading signed compressed inventory: %s", err)
+	}
+	if inv.Size() == 0 {
+		t.Fatalf("FAIL: signed compressed inventory has no hosts")
+	}
+	bundle := filepath.Join(dir, "bundle.tar.gz")
+	f, err := os.Create(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := PackBundle(src, f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SignFile(bundle, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewInventory(WithSignatureVerification(pub)).LoadFromBundle(bundle); err != nil {
+		t.Fatalf("FAIL: error loading signed bundle: %s", err)
+	}
+}
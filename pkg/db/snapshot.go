@@ -0,0 +1,97 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+// InventorySnapshot is a read-only copy of an Inventory, safe for use by
+// concurrent goroutines, e.g. the handlers of a long-running exporter,
+// while the Inventory it was taken from is reloaded. The hosts and the
+// groups returned by the snapshot must not be modified.
+type InventorySnapshot struct {
+	inv *Inventory
+}
+
+// Snapshot returns a read-only copy of the Inventory. Taking a snapshot
+// reads the Inventory, so it must not run concurrently with its changes,
+// e.g. the goroutine reloading the Inventory takes a new snapshot once the
+// reload completes and publishes it to the readers.
+func (inv *Inventory) Snapshot() *InventorySnapshot {
+	c := inv.Clone()
+	// The readers share the snapshot, so the hosts are resolved upfront.
+	c.resolveHosts()
+	return &InventorySnapshot{inv: c}
+}
+
+// Size returns the number of hosts in the snapshot.
+func (s *InventorySnapshot) Size() uint64 {
+	return s.inv.Size()
+}
+
+// GetHosts returns the hosts of the snapshot.
+func (s *InventorySnapshot) GetHosts() []*InventoryHost {
+	return append([]*InventoryHost{}, s.inv.Hosts...)
+}
+
+// GetHost returns a host of the snapshot, see Inventory.GetHost.
+func (s *InventorySnapshot) GetHost(name string) (*InventoryHost, error) {
+	return s.inv.GetHost(name)
+}
+
+// GetGroup returns a group of the snapshot, see Inventory.GetGroup.
+func (s *InventorySnapshot) GetGroup(name string) (*InventoryGroup, error) {
+	return s.inv.GetGroup(name)
+}
+
+// GetGroups returns the groups of the snapshot.
+func (s *InventorySnapshot) GetGroups() []*InventoryGroup {
+	return append([]*InventoryGroup{}, s.inv.Groups...)
+}
+
+// GetHostsWithFilter returns the hosts of the snapshot matching the host
+// and group patterns, see Inventory.GetHostsWithFilter.
+func (s *InventorySnapshot) GetHostsWithFilter(hostFilter, groupFilter interface{}) ([]*InventoryHost, error) {
+	hosts, err := s.inv.GetHostsWithFilter(hostFilter, groupFilter)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*InventoryHost{}, hosts...), nil
+}
+
+// GetHostsWithExpression returns the hosts of the snapshot for which the
+// expression holds, see Inventory.GetHostsWithExpression.
+func (s *InventorySnapshot) GetHostsWithExpression(expr string) ([]*InventoryHost, error) {
+	return s.inv.GetHostsWithExpression(expr)
+}
+
+// GetHostsByPattern returns the hosts of the snapshot matching an Ansible
+// host pattern, see Inventory.GetHostsByPattern.
+func (s *InventorySnapshot) GetHostsByPattern(pattern string) ([]*InventoryHost, error) {
+	hosts, err := s.inv.GetHostsByPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*InventoryHost{}, hosts...), nil
+}
+
+// GetHostVariables returns the resolved variables of a host of the
+// snapshot, see Inventory.GetHostVariables.
+func (s *InventorySnapshot) GetHostVariables(name string) (map[string]string, error) {
+	return s.inv.GetHostVariables(name)
+}
+
+// GetHostCredentials returns the credentials of a host of the snapshot from
+// the provided Vault, see Vault.GetCredentialsForHost.
+func (s *InventorySnapshot) GetHostCredentials(v *Vault, name string) ([]*VaultCredential, error) {
+	return v.GetCredentialsForHost(s.inv, name)
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInventorySnapshot(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error loading inventory: %s", err)
+	}
+	var current atomic.Pointer[InventorySnapshot]
+	current.Store(inv.Snapshot())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s := current.Load()
+				if _, err := s.GetHost("ny-sw01"); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := s.GetHostsWithFilter("ny-sw0[1-2]", nil); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := s.GetHostVariables("ny-sw03"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	// the changes to the inventory do not affect the published snapshots
+	for i := 0; i < 20; i++ {
+		if _, err := inv.AddEphemeralHost(fmt.Sprintf("web%02d", i), []string{"ny4"}, map[string]string{"role": "web"}); err != nil {
+			t.Fatalf("error adding ephemeral host: %s", err)
+		}
+		current.Store(inv.Snapshot())
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("error reading snapshot: %s", err)
+	}
+
+	s := inv.Snapshot()
+	inv.RemoveEphemeral()
+	if s.Size() != 25 {
+		t.Fatalf("snapshot size mismatch: 25 (expected) vs. %d (received)", s.Size())
+	}
+	if _, err := s.GetHost("web19"); err != nil {
+		t.Fatalf("expected the snapshot to keep the removed host: %s", err)
+	}
+	if _, err := inv.GetHost("web19"); err == nil {
+		t.Fatalf("expected the inventory not to have the removed host")
+	}
+	hosts, err := s.GetHostsByPattern("ny4:&web*")
+	if err != nil || len(hosts) != 20 {
+		t.Fatalf("unexpected snapshot hosts: %d, %v", len(hosts), err)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoredInventoryExtensions are the extensions of the files skipped in
+// inventory directories, as in the Ansible INVENTORY_IGNORE_EXTS setting.
+var ignoredInventoryExtensions = []string{
+	"~", ".orig", ".bak", ".cfg", ".retry", ".pyc", ".pyo", ".md", SignatureFileSuffix,
+}
+
+// LoadFromSources loads and merges inventory sources, the way
+// "ansible -i a -i b" does. A source is a file, a directory of files, an
+// http(s) URL, or a comma-separated host list. The files may be INI
+// inventories, inventory plugin configurations, or OpenSSH client
+// configurations, see IsSSHConfig. The later sources take
+// precedence over the earlier ones, see LoadWithOverlays, and a host put
+// in different groups by the sources is a member of all of them, see
+// ExtraParents. The constructed
+// plugin configurations are applied after all of the other sources.
+func (inv *Inventory) LoadFromSources(ctx context.Context, sources ...string) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("no inventory sources")
+	}
+	p := &pendingSources{}
+	inv.hostSources = make(map[string]string)
+	defer func() {
+		inv.hostSources = nil
+	}()
+	for _, src := range sources {
+		if err := inv.loadSource(ctx, src, p); err != nil {
+			return err
+		}
+		inv.logger.Debugf("loaded inventory source %s", src)
+	}
+	if err := inv.loadVarsFiles(p.varsFiles); err != nil {
+		return err
+	}
+	if err := inv.finalizeContext(ctx); err != nil {
+		return err
+	}
+	for _, b := range p.constructed {
+		if err := loadConstructedPlugin(inv, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFromDir loads the inventory files of a directory and of its
+// subdirectories in alphabetical order, the way "ansible -i dir/" does.
+// The files with the extensions Ansible ignores, e.g. .retry, .orig, and
+// ~, and the hidden files are skipped. The group_vars and host_vars
+// subdirectories hold the variables of the groups and the hosts, see
+// LoadFromBundle. The later files take precedence over the earlier ones.
+func (inv *Inventory) LoadFromDir(fp string) error {
+	fi, err := os.Stat(expandFilePath(fp))
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("inventory source %s is not a directory", fp)
+	}
+	return inv.LoadFromSources(context.Background(), fp)
+}
+
+// pendingSources are the parts of the inventory sources applied once all
+// of the sources are parsed.
+type pendingSources struct {
+	constructed [][]byte
+	varsFiles   []*varsFileRef
+}
+
+// varsFileRef is a file of a group_vars or host_vars directory.
+type varsFileRef struct {
+	fp string
+	// rel is the path relative to the parent of the group_vars or
+	// host_vars directory, e.g. group_vars/ny4.yml.
+	rel string
+}
+
+// loadSource parses an inventory source without computing the group chains
+// and the inherited variables.
+func (inv *Inventory) loadSource(ctx context.Context, src string, p *pendingSources) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(src, "http://"), strings.HasPrefix(src, "https://"):
+		s := NewRemoteSource(src)
+		s.MaxSize = inv.maxFileSize
+		b, err := inv.fetchRemote(ctx, s)
+		if err != nil {
+			return err
+		}
+		b, err = inv.decryptSource(b)
+		if err != nil {
+			return fmt.Errorf("%s: %s", src, err)
+		}
+		return inv.withSource(src, func() error { return inv.parseSource(b, p) })
+	case IsHostList(src):
+		return inv.withSource(src, func() error { return inv.parseHostList(src) })
+	}
+	fp := expandFilePath(src)
+	fi, err := os.Stat(fp)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return inv.loadSourceFile(fp, p)
+	}
+	return inv.loadSourceDir(ctx, fp, p)
+}
+
+// loadSourceDir parses the files of an inventory directory and of its
+// subdirectories in alphabetical order. The files of the group_vars and
+// host_vars subdirectories are deferred.
+func (inv *Inventory) loadSourceDir(ctx context.Context, dir string, p *pendingSources) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || isIgnoredInventoryFile(name) {
+			continue
+		}
+		fp := filepath.Join(dir, name)
+		if !entry.IsDir() {
+			if err := inv.loadSourceFile(fp, p); err != nil {
+				return err
+			}
+			continue
+		}
+		switch name {
+		case "group_vars", "host_vars":
+			files, err := findVarsFiles(fp)
+			if err != nil {
+				return err
+			}
+			p.varsFiles = append(p.varsFiles, files...)
+		case "vars_plugins":
+		default:
+			if err := inv.loadSourceDir(ctx, fp, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findVarsFiles returns the files of a group_vars or host_vars directory,
+// i.e. the files named after a group or a host, and the files of the
+// directories named after a group or a host.
+func findVarsFiles(dir string) ([]*varsFileRef, error) {
+	var files []*varsFileRef
+	base := filepath.Dir(dir)
+	err := filepath.WalkDir(dir, func(fp string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if fp != dir && (strings.HasPrefix(name, ".") || isIgnoredInventoryFile(name)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(base, fp)
+		if err != nil {
+			return err
+		}
+		files = append(files, &varsFileRef{fp: fp, rel: filepath.ToSlash(rel)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// loadVarsFiles adds the variables of the group_vars and host_vars files to
+// the groups and the hosts. The files of the groups and the hosts not in
+// the inventory are skipped, as in Ansible.
+func (inv *Inventory) loadVarsFiles(files []*varsFileRef) error {
+	for _, f := range files {
+		name := varsFileName(f.rel)
+		b, err := inv.readVerifiedFile(f.fp)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(f.rel, "group_vars/") {
+			if _, exists := inv.GroupsRef[name]; !exists {
+				inv.logger.Debugf("%s skipped, group %s not found", f.fp, name)
+				continue
+			}
+			err = inv.withSource(f.fp, func() error { return inv.addGroupVars(name, b) })
+		} else {
+			if _, exists := inv.HostsRef[inv.hostname(name)]; !exists {
+				inv.logger.Debugf("%s skipped, host %s not found", f.fp, name)
+				continue
+			}
+			err = inv.withSource(f.fp, func() error { return inv.addHostVars(inv.hostname(name), b) })
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", f.fp, err)
+		}
+	}
+	return nil
+}
+
+func (inv *Inventory) loadSourceFile(fp string, p *pendingSources) error {
+	b, err := inv.readVerifiedFile(fp)
+	if err != nil {
+		return err
+	}
+	b, err = inv.decryptSource(b)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fp, err)
+	}
+	err = inv.withSource(fp, func() error {
+		if IsSSHConfig(fp) {
+			return inv.parseSSHConfig(string(b))
+		}
+		return inv.parseSource(b, p)
+	})
+	var pe *ParseError
+	if err == nil || (errors.As(err, &pe) && pe.File != "") {
+		// The parse errors hold the path already.
+		return err
+	}
+	return fmt.Errorf("%s: %s", fp, err)
+}
+
+// parseSource parses the data of an INI inventory or an inventory plugin
+// configuration. The constructed plugin configurations are deferred.
+func (inv *Inventory) parseSource(b []byte, p *pendingSources) error {
+	if !bytes.Contains(b, []byte("plugin:")) || !IsPluginConfig(b) {
+		return inv.parseLines(string(b[:]))
+	}
+	if getPluginName(b) == constructedPlugin {
+		p.constructed = append(p.constructed, b)
+		return nil
+	}
+	return inv.parsePluginConfig(b)
+}
+
+func isIgnoredInventoryFile(name string) bool {
+	for _, ext := range ignoredInventoryExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
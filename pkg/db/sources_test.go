@@ -0,0 +1,208 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFromSources(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"01-web":         "[web]\nweb01 http_port=80\nweb02 http_port=80\n",
+		"02-web-prod":    "[web]\nweb02 http_port=443\n",
+		"03-keyed.yml":   "plugin: constructed\nkeyed_groups:\n  - key: http_port\n    prefix: port\n",
+		"04-web.bak":     "[broken\n",
+		"05-hosts.retry": "web01\n",
+		".hidden":        "[broken\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[db]\ndb01\n"))
+	}))
+	defer srv.Close()
+
+	inv := NewInventory()
+	if err := inv.LoadFromSources(context.Background(), dir, srv.URL+"/hosts", "sw01,sw02"); err != nil {
+		t.Fatalf("error loading inventory sources: %s", err)
+	}
+	if inv.Size() != 5 {
+		t.Fatalf("inventory size mismatch: 5 (expected) vs. %d (received)", inv.Size())
+	}
+	for i, test := range []struct {
+		host  string
+		key   string
+		value string
+	}{
+		{host: "web01", key: "http_port", value: "80"},
+		{host: "web02", key: "http_port", value: "443"},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, %s", i, err)
+		}
+		if h.Variables[test.key] != test.value {
+			t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)",
+				i, test.host, test.key, test.value, h.Variables[test.key])
+		}
+		t.Logf("PASS: Test %d, host %s variable %s: %s", i, test.host, test.key, test.value)
+	}
+	groups := inv.GetGroupsMap()
+	if strings.Join(groups["port_443"], ",") != "web02" || strings.Join(groups["db"], ",") != "db01" {
+		t.Fatalf("groups mismatch: %v", groups)
+	}
+
+	if err := NewInventory().LoadFromSources(context.Background(), filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("expected error loading a missing source")
+	}
+}
+
+func TestLoadFromDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"01-web":                  "[web]\nweb01\nweb02 http_port=8080\n",
+		"01-web~":                 "[broken\n",
+		"02-web.orig":             "[broken\n",
+		"sub/02-db":               "[db]\ndb01\n",
+		"group_vars/web.yml":      "http_port: 80\nenv: prod\n",
+		"group_vars/all/ntp.yml":  "ntp: 10.0.0.1\n",
+		"group_vars/missing.yml":  "env: test\n",
+		"host_vars/web01.yml":     "env: staging\n",
+		"host_vars/.web02.yml":    "env: [broken\n",
+		"vars_plugins/plugin.cfg": "[broken\n",
+	} {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inv := NewInventory()
+	if err := inv.LoadFromDir(dir); err != nil {
+		t.Fatalf("error loading inventory directory: %s", err)
+	}
+	if inv.Size() != 3 {
+		t.Fatalf("inventory size mismatch: 3 (expected) vs. %d (received)", inv.Size())
+	}
+	for i, test := range []struct {
+		host   string
+		key    string
+		value  string
+		source string
+	}{
+		{host: "web01", key: "http_port", value: "80", source: "group_vars web (" + filepath.Join(dir, "group_vars", "web.yml") + ")"},
+		{host: "web01", key: "env", value: "staging", source: "host_vars web01 (" + filepath.Join(dir, "host_vars", "web01.yml") + ")"},
+		{host: "web02", key: "http_port", value: "8080"},
+		{host: "web02", key: "env", value: "prod"},
+		{host: "db01", key: "ntp", value: "10.0.0.1"},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s: %s", i, test.host, err)
+		}
+		if h.Variables[test.key] != test.value {
+			t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)", i, test.host, test.key, test.value, h.Variables[test.key])
+		}
+		if test.source != "" && h.VariableSource(test.key) != test.source {
+			t.Fatalf("FAIL: Test %d, host %s variable %s source mismatch: %s (expected) vs. %s (received)", i, test.host, test.key, test.source, h.VariableSource(test.key))
+		}
+		t.Logf("PASS: Test %d, host %s, %s=%s", i, test.host, test.key, test.value)
+	}
+
+	if err := NewInventory().LoadFromDir(filepath.Join(dir, "01-web")); err == nil {
+		t.Fatalf("expected loading a file as a directory to fail, but passed")
+	}
+}
+
+func TestLoadFromSourcesGroupUnion(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a":      "[web]\nweb01 http_port=80\n[web:vars]\nrole=web\n",
+		"b":      "[db]\nweb01\ndb01\n[db:vars]\nbackup=true\n",
+		"c":      "web01\n",
+		"broken": "[web]\nweb01\n[db]\nweb01\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inv := NewInventory()
+	if err := inv.LoadFromSources(context.Background(), filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")); err != nil {
+		t.Fatalf("error loading inventory sources: %s", err)
+	}
+	h, err := inv.GetHost("web01")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	if h.Parent != "web" || strings.Join(h.ExtraParents, ",") != "db" {
+		t.Fatalf("FAIL: parents mismatch: web, [db] (expected) vs. %s, %v (received)", h.Parent, h.ExtraParents)
+	}
+	for i, test := range []struct {
+		key   string
+		value string
+	}{
+		{key: "http_port", value: "80"},
+		{key: "role", value: "web"},
+		{key: "backup", value: "true"},
+	} {
+		if h.Variables[test.key] != test.value {
+			t.Fatalf("FAIL: Test %d, variable %s mismatch: %s (expected) vs. %s (received)", i, test.key, test.value, h.Variables[test.key])
+		}
+		t.Logf("PASS: Test %d, variable %s: %s", i, test.key, test.value)
+	}
+	hosts, err := inv.GetHostsByGroup("db", false)
+	if err != nil {
+		t.Fatalf("error getting hosts: %s", err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("FAIL: db hosts mismatch: 2 (expected) vs. %d (received)", len(hosts))
+	}
+	g, err := inv.GetGroup("db")
+	if err != nil {
+		t.Fatalf("error getting group: %s", err)
+	}
+	if g.Counters.Hosts != 2 {
+		t.Fatalf("FAIL: db host counter mismatch: 2 (expected) vs. %d (received)", g.Counters.Hosts)
+	}
+	if names := inv.GetGroupsMap()["ungrouped"]; len(names) != 0 {
+		t.Fatalf("FAIL: ungrouped hosts mismatch: none (expected) vs. %v (received)", names)
+	}
+
+	// A host in different groups of the same source is an error, reported
+	// with the path of the source once.
+	fp := filepath.Join(dir, "broken")
+	err = NewInventory().LoadFromSources(context.Background(), fp)
+	if !errors.Is(err, ErrDuplicateHost) {
+		t.Fatalf("FAIL: error mismatch: %v (expected) vs. %v (received)", ErrDuplicateHost, err)
+	}
+	if n := strings.Count(err.Error(), fp); n != 1 {
+		t.Fatalf("FAIL: path count mismatch: 1 (expected) vs. %d (received): %s", n, err)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The statuses of a CredentialCheckResult.
+const (
+	CredentialValid       = "valid"
+	CredentialInvalid     = "invalid"
+	CredentialUnreachable = "unreachable"
+	CredentialSkipped     = "skipped"
+)
+
+// CredentialCheckResult is the outcome of an SSH login attempt to a host
+// with one of the credentials a Vault returns for it.
+type CredentialCheckResult struct {
+	Host        string `xml:"host" json:"host" yaml:"host"`
+	Address     string `xml:"address" json:"address" yaml:"address"`
+	Username    string `xml:"username" json:"username" yaml:"username"`
+	Description string `xml:"description,omitempty" json:"description,omitempty" yaml:"description,omitempty"`
+	Status      string `xml:"status" json:"status" yaml:"status"`
+	Error       string `xml:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func (r *CredentialCheckResult) String() string {
+	s := fmt.Sprintf("%s (%s): %s", r.Host, r.Address, r.Username)
+	if r.Description != "" {
+		s += " (" + r.Description + ")"
+	}
+	s += ": " + r.Status
+	if r.Error != "" {
+		s += ": " + r.Error
+	}
+	return s
+}
+
+// CredentialChecker attempts SSH authentication to inventory hosts with the
+// credentials a Vault holds for them, so that the credentials no longer
+// working, e.g. after a password rotation, surface before they are needed.
+// The checker authenticates only, it does not open a session.
+type CredentialChecker struct {
+	Vault *Vault
+	// HostKeyCallback verifies the host keys, e.g. the one returned by
+	// knownhosts.New. It is required, because the check sends passwords.
+	HostKeyCallback ssh.HostKeyCallback
+	// Port is used for the hosts without the ansible_port variable.
+	Port string
+	// Timeout limits the duration of a single login attempt.
+	Timeout time.Duration
+	// Concurrency is the number of the hosts checked in parallel.
+	Concurrency int
+	// Interval is the minimum time between two consecutive login attempts
+	// across all hosts.
+	Interval time.Duration
+	// DryRun reports the attempts that would be made, without connecting.
+	DryRun bool
+}
+
+// NewCredentialChecker returns an instance of CredentialChecker.
+func NewCredentialChecker(v *Vault, cb ssh.HostKeyCallback) *CredentialChecker {
+	return &CredentialChecker{
+		Vault:           v,
+		HostKeyCallback: cb,
+		Port:            "22",
+		Timeout:         10 * time.Second,
+		Concurrency:     4,
+	}
+}
+
+// hostAddress returns the address Ansible connects to, i.e. the
+// ansible_host and ansible_port variables, when set, see AnsibleHost.
+func hostAddress(h *InventoryHost, port string) string {
+	if v, ok := h.ansibleVariable("ansible_port", "ansible_ssh_port"); ok {
+		port = v
+	}
+	return net.JoinHostPort(h.AnsibleHost(), port)
+}
+
+// credentialAddress returns the address to connect to a host with a
+// credential. The port of the credential applies to the hosts without the
+// ansible_port variable.
+func credentialAddress(h *InventoryHost, cred *VaultCredential, port string) string {
+	if cred.Port > 0 {
+		port = strconv.Itoa(cred.Port)
+	}
+	return hostAddress(h, port)
+}
+
+// Check attempts SSH authentication to the provided hosts with each of
+// their credentials. The results are ordered by host, then by the
+// credential order of GetCredentialsForHost.
+func (c *CredentialChecker) Check(ctx context.Context, hosts []*InventoryHost) ([]*CredentialCheckResult, error) {
+	if c.Vault == nil {
+		return nil, fmt.Errorf("vault not found")
+	}
+	if c.HostKeyCallback == nil && !c.DryRun {
+		return nil, fmt.Errorf("host key callback not found")
+	}
+	type job struct {
+		host  *InventoryHost
+		creds []*VaultCredential
+	}
+	var jobs []*job
+	for _, h := range hosts {
+		jobs = append(jobs, &job{host: h, creds: c.Vault.hostCredentials(h)})
+	}
+
+	var throttle <-chan time.Time
+	if c.Interval > 0 && !c.DryRun {
+		ticker := time.NewTicker(c.Interval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+	wait := func() error {
+		if throttle == nil {
+			return ctx.Err()
+		}
+		select {
+		case <-throttle:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	results := make([][]*CredentialCheckResult, len(jobs))
+	forEachConcurrently(len(jobs), c.Concurrency, func(i int) {
+		j := jobs[i]
+		for _, cred := range j.creds {
+			addr := credentialAddress(j.host, cred, c.Port)
+			r := &CredentialCheckResult{
+				Host:        j.host.Name,
+				Address:     addr,
+				Username:    cred.Username,
+				Description: cred.Description,
+			}
+			results[i] = append(results[i], r)
+			if c.DryRun {
+				r.Status = CredentialSkipped
+				continue
+			}
+			if err := wait(); err != nil {
+				r.Status = CredentialSkipped
+				r.Error = err.Error()
+				continue
+			}
+			r.Status, r.Error = c.login(ctx, addr, cred)
+		}
+	})
+
+	out := []*CredentialCheckResult{}
+	for _, r := range results {
+		out = append(out, r...)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Host < out[j].Host
+	})
+	return out, ctx.Err()
+}
+
+// login authenticates with the credential and reports the outcome as a
+// CredentialCheckResult status and error.
+func (c *CredentialChecker) login(ctx context.Context, addr string, cred *VaultCredential) (string, string) {
+	if _, err := sshAuthMethods(cred); err != nil {
+		return CredentialInvalid, err.Error()
+	}
+	client, err := dialSSH(ctx, addr, cred, c.HostKeyCallback, c.Timeout)
+	if err != nil {
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return CredentialInvalid, err.Error()
+		}
+		return CredentialUnreachable, err.Error()
+	}
+	client.Close()
+	return CredentialValid, ""
+}
+
+// dialSSH connects to a host and authenticates with the private key of the
+// credential, when set, and with the password of the credential, either via
+// the password or the keyboard-interactive method, the latter being common
+// on network devices. The timeout applies to the connection and the
+// authentication.
+func dialSSH(ctx context.Context, addr string, cred *VaultCredential, cb ssh.HostKeyCallback, timeout time.Duration) (*ssh.Client, error) {
+	auth, err := sshAuthMethods(cred)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ssh.ClientConfig{
+		User:            cred.Username,
+		Auth:            auth,
+		HostKeyCallback: cb,
+		Timeout:         timeout,
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// sshAuthMethods returns the SSH authentication methods of a credential.
+// The password methods are omitted for a key-only credential.
+func sshAuthMethods(cred *VaultCredential) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	key := []byte(cred.PrivateKey)
+	if cred.PrivateKeyFile != "" {
+		b, err := os.ReadFile(expandFilePath(cred.PrivateKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed reading private key: %s", err)
+		}
+		key = b
+	}
+	if len(key) > 0 {
+		var signer ssh.Signer
+		var err error
+		if cred.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(cred.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing private key: %s", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if cred.Password != "" || len(methods) == 0 {
+		methods = append(methods,
+			ssh.Password(cred.Password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = cred.Password
+				}
+				return answers, nil
+			}),
+		)
+	}
+	return methods, nil
+}
+
+// forEachConcurrently calls fn for each index in [0, n) with at most the
+// provided number of the calls in parallel.
+func forEachConcurrently(n, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+}
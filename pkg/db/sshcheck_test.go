@@ -0,0 +1,231 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestSSHServer returns the address of an SSH server accepting the
+// provided password only and replying to the provided commands.
+func newTestSSHServer(t *testing.T, password string, commands map[string]string) (string, ssh.PublicKey) {
+	return newTestSSHServerWithConfig(t, &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, p []byte) (*ssh.Permissions, error) {
+			if string(p) == password {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}, commands)
+}
+
+// newTestSSHServerWithConfig returns the address of an SSH server with the
+// provided authentication config, replying to the provided commands.
+func newTestSSHServerWithConfig(t *testing.T, cfg *ssh.ServerConfig, commands map[string]string) (string, ssh.PublicKey) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, chans, reqs, err := ssh.NewServerConn(conn, cfg); err == nil {
+					go ssh.DiscardRequests(reqs)
+					for ch := range chans {
+						go serveTestSSHSession(ch, commands)
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), signer.PublicKey()
+}
+
+func serveTestSSHSession(newCh ssh.NewChannel, commands map[string]string) {
+	if newCh.ChannelType() != "session" {
+		newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" || len(req.Payload) < 4 {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		status := uint32(0)
+		output, exists := commands[string(req.Payload[4:])]
+		if !exists {
+			status = 127
+		}
+		ch.Write([]byte(output))
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+func TestCredentialChecker(t *testing.T) {
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error reading vault key file: %s", err)
+	}
+	if err := vlt.LoadFromFile("../../testdata/inventory/vault.yml"); err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	creds, err := vlt.GetCredentials("ny-sw01")
+	if err != nil || len(creds) < 2 {
+		t.Fatalf("error getting credentials: %v", err)
+	}
+	addr, hostKey := newTestSSHServer(t, creds[0].Password, nil)
+	host, port, _ := net.SplitHostPort(addr)
+	hosts := []*InventoryHost{
+		{Name: "ny-sw01", Variables: map[string]string{"ansible_host": host, "ansible_port": port}},
+	}
+	for i, test := range []struct {
+		dryRun    bool
+		hostKey   ssh.PublicKey
+		shouldErr bool
+	}{
+		{hostKey: hostKey},
+		{dryRun: true},
+		{hostKey: nil, shouldErr: true},
+	} {
+		var cb ssh.HostKeyCallback
+		if test.hostKey != nil {
+			cb = ssh.FixedHostKey(test.hostKey)
+		}
+		checker := NewCredentialChecker(vlt, cb)
+		checker.DryRun = test.dryRun
+		results, err := checker.Check(context.Background(), hosts)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error", i)
+			}
+			t.Logf("PASS: Test %d, %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		if len(results) != len(creds) {
+			t.Fatalf("FAIL: Test %d, result count mismatch: %d (expected) vs. %d (received)", i, len(creds), len(results))
+		}
+		for j, r := range results {
+			expected := CredentialSkipped
+			if !test.dryRun {
+				expected = CredentialInvalid
+				if creds[j].Password == creds[0].Password {
+					expected = CredentialValid
+				}
+			}
+			if r.Status != expected || r.Address != addr {
+				t.Fatalf("FAIL: Test %d, result %d mismatch: %s (expected) vs. %s", i, j, expected, r)
+			}
+			t.Logf("PASS: Test %d, %s", i, r)
+		}
+	}
+}
+
+func TestCredentialCheckerPrivateKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	encBlock, err := x509.EncryptPEMBlock(rand.Reader, block.Type, der, []byte("s3cret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(encBlock), 0600); err != nil {
+		t.Fatal(err)
+	}
+	addr, hostKey := newTestSSHServerWithConfig(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(k.Marshal(), signer.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}, nil)
+	host, port, _ := net.SplitHostPort(addr)
+	portNumber, _ := strconv.Atoi(port)
+	hosts := []*InventoryHost{
+		{Name: "srv01", Variables: map[string]string{"ansible_host": host}},
+	}
+	for i, test := range []struct {
+		cred   *VaultCredential
+		status string
+	}{
+		{cred: &VaultCredential{Username: "deploy", PrivateKey: string(pem.EncodeToMemory(block)), Port: portNumber}, status: CredentialValid},
+		{cred: &VaultCredential{Username: "deploy", PrivateKeyFile: keyFile, Passphrase: "s3cret", Port: portNumber}, status: CredentialValid},
+		{cred: &VaultCredential{Username: "deploy", PrivateKeyFile: keyFile, Passphrase: "wrong", Port: portNumber}, status: CredentialInvalid},
+		{cred: &VaultCredential{Username: "deploy", Password: "secret", Port: portNumber}, status: CredentialInvalid},
+	} {
+		test.cred.Default = true
+		vlt := NewVault()
+		vlt.Credentials = []*VaultCredential{test.cred}
+		checker := NewCredentialChecker(vlt, ssh.FixedHostKey(hostKey))
+		results, err := checker.Check(context.Background(), hosts)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		if len(results) != 1 || results[0].Status != test.status || results[0].Address != addr {
+			t.Fatalf("FAIL: Test %d, result mismatch: %s (expected) vs. %v", i, test.status, results)
+		}
+		t.Logf("PASS: Test %d, %s", i, results[0])
+	}
+}
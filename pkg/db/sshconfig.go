@@ -0,0 +1,210 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sshConfigVariables maps the OpenSSH client configuration keywords, in
+// lower case, to the Ansible connection variables.
+var sshConfigVariables = map[string]string{
+	"hostname":     "ansible_host",
+	"user":         "ansible_user",
+	"port":         "ansible_port",
+	"identityfile": "ansible_ssh_private_key_file",
+}
+
+// sshConfigArgs are the keywords passed to ssh via ansible_ssh_common_args.
+var sshConfigArgs = []string{"proxyjump", "proxycommand"}
+
+var sshConfigArgNames = map[string]string{
+	"proxyjump":    "ProxyJump",
+	"proxycommand": "ProxyCommand",
+}
+
+type sshConfigBlock struct {
+	patterns []string
+	options  map[string]string
+}
+
+// matches returns true when the host matches one of the patterns of the
+// block and none of its negated patterns.
+func (b *sshConfigBlock) matches(host string) bool {
+	matched := false
+	for _, p := range b.patterns {
+		negated := strings.HasPrefix(p, "!")
+		ok, _ := path.Match(strings.TrimPrefix(p, "!"), host)
+		if !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// IsSSHConfig returns true when the file path is an OpenSSH client
+// configuration, i.e. ~/.ssh/config or a file named ssh_config.
+func IsSSHConfig(fp string) bool {
+	base := filepath.Base(fp)
+	if base == "ssh_config" {
+		return true
+	}
+	return base == "config" && filepath.Base(filepath.Dir(fp)) == ".ssh"
+}
+
+// LoadFromSSHConfig loads the hosts of an OpenSSH client configuration
+// file, e.g. ~/.ssh/config.
+func (inv *Inventory) LoadFromSSHConfig(fp string) error {
+	fp = expandFilePath(fp)
+	b, err := inv.readVerifiedFile(fp)
+	if err != nil {
+		return err
+	}
+	b, err = inv.decryptSource(b)
+	if err != nil {
+		return err
+	}
+	if err := inv.withSource(fp, func() error { return inv.parseSSHConfig(string(b)) }); err != nil {
+		return fmt.Errorf("%s: %s", fp, err)
+	}
+	return inv.finalize()
+}
+
+// LoadFromSSHConfigBytes is the LoadFromSSHConfig counterpart operating on
+// an array of bytes.
+func (inv *Inventory) LoadFromSSHConfigBytes(b []byte) error {
+	if err := inv.checkUnsigned(); err != nil {
+		return err
+	}
+	b, err := inv.decryptSource(b)
+	if err != nil {
+		return err
+	}
+	if err := inv.parseSSHConfig(string(b)); err != nil {
+		return err
+	}
+	return inv.finalize()
+}
+
+// parseSSHConfig adds a host to the "ungrouped" group for every Host pattern
+// without wildcards. As in ssh, the first value of a keyword found in the
+// matching blocks wins, so "Host *" provides the defaults. The HostName,
+// User, Port, and IdentityFile keywords become the Ansible connection
+// variables, and ProxyJump and ProxyCommand become ansible_ssh_common_args.
+// The Match and Include keywords are not supported and are reported via
+// the logger.
+func (inv *Inventory) parseSSHConfig(s string) error {
+	var blocks []*sshConfigBlock
+	var hosts []string
+	seen := make(map[string]bool)
+	current := &sshConfigBlock{patterns: []string{"*"}, options: make(map[string]string)}
+	blocks = append(blocks, current)
+	skip := false
+	for lc, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v := splitSSHConfigLine(line)
+		if v == "" {
+			return fmt.Errorf("invalid ssh config line %d: %s", lc+1, line)
+		}
+		switch strings.ToLower(k) {
+		case "host":
+			skip = false
+			current = &sshConfigBlock{patterns: strings.Fields(v), options: make(map[string]string)}
+			blocks = append(blocks, current)
+			for _, p := range current.patterns {
+				if strings.ContainsAny(p, "*?!") || seen[p] {
+					continue
+				}
+				seen[p] = true
+				hosts = append(hosts, p)
+			}
+			continue
+		case "match":
+			inv.logger.Warnf("ssh config keyword Match is not supported, line %d", lc+1)
+			skip = true
+			continue
+		case "include":
+			inv.logger.Warnf("ssh config keyword Include is not supported, line %d", lc+1)
+			continue
+		}
+		if skip {
+			continue
+		}
+		k = strings.ToLower(k)
+		if _, exists := current.options[k]; !exists {
+			current.options[k] = strings.Trim(v, `"`)
+		}
+	}
+	for _, name := range hosts {
+		options := make(map[string]string)
+		for _, b := range blocks {
+			if !b.matches(name) {
+				continue
+			}
+			for k, v := range b.options {
+				if _, exists := options[k]; !exists {
+					options[k] = v
+				}
+			}
+		}
+		if err := inv.AddHost(name, "all"); err != nil {
+			return err
+		}
+		h, err := inv.GetHost(inv.hostname(name))
+		if err != nil {
+			return err
+		}
+		for k, variable := range sshConfigVariables {
+			if v, exists := options[k]; exists {
+				h.Variables[variable] = strings.ReplaceAll(v, "%h", name)
+				setVariableSource(&h.VariableSources, variable, inv.variableSource("host", h.Name))
+			}
+		}
+		var args []string
+		for _, k := range sshConfigArgs {
+			if v, exists := options[k]; exists && strings.ToLower(v) != "none" {
+				args = append(args, fmt.Sprintf("-o %s=%q", sshConfigArgNames[k], v))
+			}
+		}
+		if len(args) > 0 {
+			h.Variables["ansible_ssh_common_args"] = strings.Join(args, " ")
+			setVariableSource(&h.VariableSources, "ansible_ssh_common_args", inv.variableSource("host", h.Name))
+		}
+	}
+	return nil
+}
+
+// splitSSHConfigLine splits a configuration line into the keyword and the
+// arguments, separated by whitespace or an equal sign.
+func splitSSHConfigLine(line string) (string, string) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return line, ""
+	}
+	k := line[:i]
+	v := strings.TrimSpace(line[i:])
+	v = strings.TrimSpace(strings.TrimPrefix(v, "="))
+	return k, v
+}
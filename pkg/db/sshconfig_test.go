@@ -0,0 +1,84 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFromSSHConfig(t *testing.T) {
+	config := `# personal jump-host setup
+Host bastion
+    HostName bastion.example.com
+    User ops
+
+Host db01 db02
+    HostName %h.internal
+    ProxyJump bastion
+
+Host web01
+    HostName=10.0.0.5
+    Port 2222
+    IdentityFile ~/.ssh/web.pem
+
+Match host db01
+    User nobody
+
+Host !bastion *
+    User deploy
+`
+	dir := filepath.Join(t.TempDir(), ".ssh")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	fp := filepath.Join(dir, "config")
+	if err := os.WriteFile(fp, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !IsSSHConfig(fp) || IsSSHConfig("../../testdata/inventory/hosts") {
+		t.Fatalf("FAIL: IsSSHConfig mismatch")
+	}
+	inv := NewInventory()
+	if err := inv.LoadFromFile(fp); err != nil {
+		t.Fatalf("FAIL: error loading ssh config: %s", err)
+	}
+	if inv.Size() != 4 {
+		t.Fatalf("FAIL: size mismatch: 4 (expected) vs. %d (received)", inv.Size())
+	}
+	for i, test := range []struct {
+		host string
+		vars map[string]string
+	}{
+		{host: "bastion", vars: map[string]string{"ansible_host": "bastion.example.com", "ansible_user": "ops"}},
+		{host: "db01", vars: map[string]string{"ansible_host": "db01.internal", "ansible_user": "deploy", "ansible_ssh_common_args": `-o ProxyJump="bastion"`}},
+		{host: "web01", vars: map[string]string{"ansible_host": "10.0.0.5", "ansible_port": "2222", "ansible_ssh_private_key_file": "~/.ssh/web.pem"}},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, %s", i, err)
+		}
+		for k, v := range test.vars {
+			if h.Variables[k] != v {
+				t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %q (expected) vs. %q (received)", i, test.host, k, v, h.Variables[k])
+			}
+		}
+		t.Logf("PASS: Test %d, host %s: %v", i, test.host, h.Variables)
+	}
+	if err := NewInventory().LoadFromSSHConfigBytes([]byte("Host\n")); err == nil {
+		t.Fatalf("FAIL: expected error for Host without patterns")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// inventoryStateVersion is the version of the state ExportState writes.
+// Increment it whenever the layout of inventoryState changes.
+const inventoryStateVersion = 1
+
+type inventoryStateSettings struct {
+	Strict            bool `json:"strict,omitempty"`
+	FoldHostnames     bool `json:"fold_hostnames,omitempty"`
+	PreserveTemplates bool `json:"preserve_templates,omitempty"`
+}
+
+type inventoryState struct {
+	Version   int                    `json:"version"`
+	Settings  inventoryStateSettings `json:"settings"`
+	Raw       []byte                 `json:"raw,omitempty"`
+	HostsRef  map[string]string      `json:"host_refs,omitempty"`
+	GroupsRef map[string]bool        `json:"group_refs,omitempty"`
+	Hosts     []*InventoryHost       `json:"hosts,omitempty"`
+	Groups    []*InventoryGroup      `json:"groups,omitempty"`
+}
+
+// StateOption configures ExportState.
+type StateOption func(*stateConfig)
+
+type stateConfig struct {
+	ephemeral bool
+}
+
+// IncludeEphemeral makes ExportState write the ephemeral hosts and groups,
+// see AddEphemeralHost, too.
+func IncludeEphemeral() StateOption {
+	return func(c *stateConfig) {
+		c.ephemeral = true
+	}
+}
+
+// ExportState writes the complete state of the Inventory, i.e. the hosts
+// and groups, including the ones added or modified programmatically after
+// the inventory was loaded, and the parser settings, to the provided
+// writer in JSON format. Unlike Encode, the state is meant to survive
+// restarts and upgrades of the application. The ephemeral hosts and
+// groups are excluded, unless IncludeEphemeral is provided.
+func (inv *Inventory) ExportState(w io.Writer, opts ...StateOption) error {
+	if err := inv.Precompute(); err != nil {
+		return err
+	}
+	cfg := &stateConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	state := &inventoryState{
+		Version: inventoryStateVersion,
+		Settings: inventoryStateSettings{
+			Strict:            inv.strict,
+			FoldHostnames:     inv.foldHostnames,
+			PreserveTemplates: inv.preserveTemplates,
+		},
+		Raw:       inv.Raw,
+		HostsRef:  inv.HostsRef,
+		GroupsRef: inv.GroupsRef,
+		Hosts:     inv.Hosts,
+		Groups:    inv.Groups,
+	}
+	if !cfg.ephemeral {
+		state.HostsRef = make(map[string]string)
+		state.GroupsRef = make(map[string]bool)
+		state.Hosts = []*InventoryHost{}
+		state.Groups = []*InventoryGroup{}
+		// The counters and the children of the exported groups do not
+		// include the ephemeral members.
+		hostCounts := make(map[string]uint64)
+		groupCounts := make(map[string]uint64)
+		ephemeral := make(map[string]bool)
+		for _, h := range inv.Hosts {
+			if !h.Ephemeral {
+				state.Hosts = append(state.Hosts, h)
+				state.HostsRef[h.Name] = inv.HostsRef[h.Name]
+				continue
+			}
+			for _, g := range h.Groups {
+				hostCounts[g]++
+			}
+		}
+		for _, g := range inv.Groups {
+			if g.Ephemeral {
+				ephemeral[g.Name] = true
+				for _, a := range g.Ancestors {
+					groupCounts[a]++
+				}
+			}
+		}
+		for _, g := range inv.Groups {
+			if g.Ephemeral {
+				continue
+			}
+			if hostCounts[g.Name] > 0 || groupCounts[g.Name] > 0 {
+				c := *g
+				c.Counters.Hosts -= hostCounts[g.Name]
+				c.Counters.Groups -= groupCounts[g.Name]
+				if groupCounts[g.Name] > 0 {
+					c.Children = []string{}
+					for _, child := range g.Children {
+						if !ephemeral[child] {
+							c.Children = append(c.Children, child)
+						}
+					}
+				}
+				g = &c
+			}
+			state.Groups = append(state.Groups, g)
+			state.GroupsRef[g.Name] = true
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(state); err != nil {
+		return fmt.Errorf("failed exporting inventory state: %s", err)
+	}
+	return nil
+}
+
+// ImportState replaces the contents and the parser settings of the
+// Inventory with the state previously written by ExportState.
+func (inv *Inventory) ImportState(r io.Reader) error {
+	state := &inventoryState{}
+	if err := json.NewDecoder(r).Decode(state); err != nil {
+		return fmt.Errorf("failed importing inventory state: %s", err)
+	}
+	if state.Version != inventoryStateVersion {
+		return fmt.Errorf("unsupported inventory state version: %d", state.Version)
+	}
+	inv.strict = state.Settings.Strict
+	inv.foldHostnames = state.Settings.FoldHostnames
+	inv.preserveTemplates = state.Settings.PreserveTemplates
+	inv.restore(&Inventory{
+		Raw:       state.Raw,
+		HostsRef:  state.HostsRef,
+		GroupsRef: state.GroupsRef,
+		Hosts:     state.Hosts,
+		Groups:    state.Groups,
+	})
+	return nil
+}
+
+// SaveStateToFile writes the state of the Inventory to a file. The file is
+// replaced atomically, so that a crash does not leave a partial state.
+// Within DryRun, the file is not written.
+func (inv *Inventory) SaveStateToFile(fp string, opts ...StateOption) error {
+	fp = expandFilePath(fp)
+	if inv.dryRun {
+		inv.logger.Debugf("dry run, skipped saving inventory state to %s", fp)
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(fp), "."+filepath.Base(fp)+".*")
+	if err != nil {
+		return fmt.Errorf("failed saving inventory state: %s", err)
+	}
+	defer os.Remove(f.Name())
+	if err := inv.ExportState(f, opts...); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed saving inventory state: %s", err)
+	}
+	if err := os.Rename(f.Name(), fp); err != nil {
+		return fmt.Errorf("failed saving inventory state: %s", err)
+	}
+	return nil
+}
+
+// LoadStateFromFile restores the state of the Inventory from a file
+// written by SaveStateToFile.
+func (inv *Inventory) LoadStateFromFile(fp string) error {
+	f, err := os.Open(expandFilePath(fp))
+	if err != nil {
+		return fmt.Errorf("failed loading inventory state: %s", err)
+	}
+	defer f.Close()
+	return inv.ImportState(f)
+}
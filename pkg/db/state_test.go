@@ -0,0 +1,69 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInventoryState(t *testing.T) {
+	inv := NewInventory(WithCaseInsensitiveHostnames())
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	// The mutations made after the inventory was loaded.
+	if err := inv.AddHost("runtime01 role=cache", "ny4-cisco"); err != nil {
+		t.Fatalf("error adding host: %s", err)
+	}
+	h, err := inv.GetHost("ny-sw02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Variables["maintenance"] = "true"
+
+	fp := filepath.Join(t.TempDir(), "state.json")
+	if err := inv.SaveStateToFile(fp); err != nil {
+		t.Fatalf("error saving state: %s", err)
+	}
+	restored := NewInventory()
+	if err := restored.LoadStateFromFile(fp); err != nil {
+		t.Fatalf("error loading state: %s", err)
+	}
+	if !restored.foldHostnames {
+		t.Fatalf("FAIL: the settings were not restored")
+	}
+	if restored.Size() != inv.Size() {
+		t.Fatalf("FAIL: inventory size mismatch: %d (expected) vs. %d (received)", inv.Size(), restored.Size())
+	}
+	for _, h := range inv.Hosts {
+		rh, err := restored.GetHost(strings.ToUpper(h.Name))
+		if err != nil {
+			t.Fatalf("FAIL: error getting host %s from restored inventory: %s", h.Name, err)
+		}
+		if !reflect.DeepEqual(h.Variables, rh.Variables) || !reflect.DeepEqual(h.Groups, rh.Groups) {
+			t.Fatalf("FAIL: host %s mismatch: %v (expected) vs. %v (received)", h.Name, h, rh)
+		}
+	}
+	if _, err := restored.GetGroup("cisco"); err != nil {
+		t.Fatalf("FAIL: %s", err)
+	}
+	if err := restored.ImportState(strings.NewReader(`{"version": 2}`)); err == nil {
+		t.Fatalf("FAIL: expected error importing unsupported state version")
+	}
+	t.Logf("PASS: restored %d hosts", restored.Size())
+}
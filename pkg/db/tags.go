@@ -0,0 +1,136 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"sort"
+	"strings"
+)
+
+// tagsVariable is the host variable holding comma-separated host tags.
+const tagsVariable = "tags"
+
+// parseTags splits a comma-separated list of tags.
+func parseTags(s string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// AddTag adds tags to the host. The tags are kept sorted and unique.
+func (h *InventoryHost) AddTag(tags ...string) {
+	m := make(map[string]bool)
+	for _, tag := range h.Tags {
+		m[tag] = true
+	}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || m[tag] {
+			continue
+		}
+		m[tag] = true
+		h.Tags = append(h.Tags, tag)
+	}
+	sort.Strings(h.Tags)
+}
+
+// RemoveTag removes a tag from the host.
+func (h *InventoryHost) RemoveTag(tag string) {
+	for i, t := range h.Tags {
+		if t == tag {
+			h.Tags = append(h.Tags[:i], h.Tags[i+1:]...)
+			return
+		}
+	}
+}
+
+// HasTag returns true when the host has the tag.
+func (h *InventoryHost) HasTag(tag string) bool {
+	for _, t := range h.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// TagLabels returns the tags of the host as labels, e.g. for metrics or
+// service discovery. The label names are the tags prefixed with the
+// provided prefix, with characters other than letters, digits, and
+// underscores replaced by underscores. The label values are "true".
+func (h *InventoryHost) TagLabels(prefix string) map[string]string {
+	m := make(map[string]string)
+	for _, tag := range h.Tags {
+		m[toLabelName(prefix+tag)] = "true"
+	}
+	return m
+}
+
+func toLabelName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// MatchTag returns a HostMatcher selecting hosts having the tag.
+func MatchTag(tag string) HostMatcher {
+	return func(h *InventoryHost) bool {
+		return h.HasTag(tag)
+	}
+}
+
+// AddHostTag adds tags to a host of the Inventory.
+func (inv *Inventory) AddHostTag(s string, tags ...string) error {
+	h, err := inv.GetHost(s)
+	if err != nil {
+		return err
+	}
+	h.AddTag(tags...)
+	return nil
+}
+
+// RemoveHostTag removes a tag from a host of the Inventory.
+func (inv *Inventory) RemoveHostTag(s, tag string) error {
+	h, err := inv.GetHost(s)
+	if err != nil {
+		return err
+	}
+	h.RemoveTag(tag)
+	return nil
+}
+
+// GetHostsByTag returns the hosts having all of the provided tags.
+func (inv *Inventory) GetHostsByTag(tags ...string) []*InventoryHost {
+	matchers := []HostMatcher{}
+	for _, tag := range tags {
+		matchers = append(matchers, MatchTag(tag))
+	}
+	hosts := []*InventoryHost{}
+	inv.AllHosts(matchers...)(func(h *InventoryHost) bool {
+		hosts = append(hosts, h)
+		return true
+	})
+	return hosts
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHostTags(t *testing.T) {
+	inv := NewInventory()
+	input := []byte(`[web]
+web01 tags=prod,frontend
+web02 tags=staging
+
+[web:vars]
+tags=http
+`)
+	if err := inv.LoadFromBytes(input); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if err := inv.AddHostTag("web02", "canary", "frontend"); err != nil {
+		t.Fatalf("error adding host tags: %s", err)
+	}
+	if err := inv.AddHostTag("web03", "canary"); err == nil {
+		t.Fatalf("expected adding tags to a non-existing host to fail, but passed")
+	}
+	for i, test := range []struct {
+		tags  []string
+		hosts int
+	}{
+		{tags: []string{"frontend"}, hosts: 2},
+		{tags: []string{"frontend", "prod"}, hosts: 1},
+		{tags: []string{"canary"}, hosts: 1},
+		{tags: []string{"http"}, hosts: 0},
+	} {
+		hosts := inv.GetHostsByTag(test.tags...)
+		if len(hosts) != test.hosts {
+			t.Fatalf("FAIL: Test %d, tags %v, hosts count mismatch: %d (expected) vs. %d (received)", i, test.tags, test.hosts, len(hosts))
+		}
+		t.Logf("PASS: Test %d, tags %v, hosts: %d", i, test.tags, len(hosts))
+	}
+	if err := inv.RemoveHostTag("web02", "canary"); err != nil {
+		t.Fatalf("error removing host tag: %s", err)
+	}
+	host, err := inv.GetHost("web02")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	if !reflect.DeepEqual(host.Tags, []string{"frontend", "staging"}) {
+		t.Fatalf("host tags mismatch: %v", host.Tags)
+	}
+	labels := host.TagLabels("tag_")
+	expected := map[string]string{"tag_frontend": "true", "tag_staging": "true"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("host tag labels mismatch: %v (expected) vs. %v (received)", expected, labels)
+	}
+	if name := toLabelName("tag_us-east.1"); name != "tag_us_east_1" {
+		t.Fatalf("label name mismatch: tag_us_east_1 (expected) vs. %s (received)", name)
+	}
+}
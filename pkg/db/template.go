@@ -0,0 +1,128 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// templateDelimiters are the opening and closing delimiters of Jinja
+// expressions, statements, and comments.
+var templateDelimiters = [][2]string{
+	{"{{", "}}"},
+	{"{%", "%}"},
+	{"{#", "#}"},
+}
+
+// IsTemplate returns true when the provided value contains a Jinja
+// expression, statement, or comment.
+func IsTemplate(s string) bool {
+	for _, d := range templateDelimiters {
+		i := strings.Index(s, d[0])
+		if i < 0 {
+			continue
+		}
+		if strings.Contains(s[i+len(d[0]):], d[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskTemplates replaces Jinja blocks with placeholders free of spaces and
+// equal signs, so that key-value parsing leaves the blocks untouched.
+func maskTemplates(s string) (string, []string) {
+	var templates []string
+	var sb strings.Builder
+	for {
+		start := -1
+		var end string
+		for _, d := range templateDelimiters {
+			i := strings.Index(s, d[0])
+			if i >= 0 && (start < 0 || i < start) {
+				start = i
+				end = d[1]
+			}
+		}
+		if start < 0 {
+			break
+		}
+		j := strings.Index(s[start+2:], end)
+		if j < 0 {
+			break
+		}
+		j += start + 2 + len(end)
+		sb.WriteString(s[:start])
+		sb.WriteString(fmt.Sprintf("\x00%d\x00", len(templates)))
+		templates = append(templates, s[start:j])
+		s = s[j:]
+	}
+	sb.WriteString(s)
+	return sb.String(), templates
+}
+
+// unmaskTemplates restores Jinja blocks replaced by maskTemplates.
+func unmaskTemplates(s string, templates []string) string {
+	for i, tmpl := range templates {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), tmpl, 1)
+	}
+	return s
+}
+
+// SetPreserveTemplates instructs the Inventory to keep the values
+// containing Jinja blocks, e.g. {{ }} or {% %}, untouched by key-value
+// parsing and flag the corresponding variables as templated.
+func (inv *Inventory) SetPreserveTemplates(enabled bool) {
+	inv.preserveTemplates = enabled
+}
+
+// parseKeyValuePairs parses key-value pairs and returns them along with the
+// keys of the templated values.
+func (inv *Inventory) parseKeyValuePairs(s string) (map[string]string, map[string]bool, error) {
+	if !inv.preserveTemplates {
+		m, err := getKeyValuePairs(s)
+		return m, nil, err
+	}
+	masked, templates := maskTemplates(s)
+	m, err := getKeyValuePairs(masked)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(templates) == 0 {
+		return m, nil, nil
+	}
+	templated := make(map[string]bool)
+	for k, v := range m {
+		if !strings.Contains(v, "\x00") {
+			continue
+		}
+		m[k] = unmaskTemplates(v, templates)
+		templated[k] = true
+	}
+	return m, templated, nil
+}
+
+// IsTemplated returns true when the value of the variable was preserved as
+// a Jinja template.
+func (h *InventoryHost) IsTemplated(k string) bool {
+	return h.Templated[k]
+}
+
+// IsTemplated returns true when the value of the variable was preserved as
+// a Jinja template.
+func (g *InventoryGroup) IsTemplated(k string) bool {
+	return g.Templated[k]
+}
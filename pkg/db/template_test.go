@@ -0,0 +1,74 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"testing"
+)
+
+func TestPreserveTemplates(t *testing.T) {
+	input := []byte(`web01 motd="{{ lookup('file', '/etc/motd') }}" port=8080
+
+[web]
+web02 greeting={{ 'hi' if a == b else 'bye' }} role=frontend
+
+[web:vars]
+url=http://{{ inventory_hostname }}:{{ port }}/
+`)
+	inv := NewInventory()
+	inv.SetPreserveTemplates(true)
+	if err := inv.LoadFromBytes(input); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		host      string
+		key       string
+		value     string
+		templated bool
+	}{
+		{host: "web01", key: "motd", value: `{{ lookup('file', '/etc/motd') }}`, templated: true},
+		{host: "web01", key: "port", value: "8080"},
+		{host: "web02", key: "greeting", value: `{{ 'hi' if a == b else 'bye' }}`, templated: true},
+		{host: "web02", key: "role", value: "frontend"},
+		{host: "web02", key: "url", value: "http://{{ inventory_hostname }}:{{ port }}/", templated: true},
+	} {
+		host, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting host %s: %s", i, test.host, err)
+		}
+		if host.Variables[test.key] != test.value {
+			t.Fatalf("FAIL: Test %d, host %s variable %s mismatch: %s (expected) vs. %s (received)", i, test.host, test.key, test.value, host.Variables[test.key])
+		}
+		if host.IsTemplated(test.key) != test.templated {
+			t.Fatalf("FAIL: Test %d, host %s variable %s templated flag mismatch: %t (expected) vs. %t (received)", i, test.host, test.key, test.templated, host.IsTemplated(test.key))
+		}
+		if IsTemplate(test.value) != test.templated {
+			t.Fatalf("FAIL: Test %d, IsTemplate(%s) mismatch", i, test.value)
+		}
+		t.Logf("PASS: Test %d, host %s, %s=%s", i, test.host, test.key, test.value)
+	}
+
+	inv = NewInventory()
+	if err := inv.LoadFromBytes([]byte(`web02 url=http://{{ inventory_hostname }}/`)); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	host, err := inv.GetHost("web02")
+	if err != nil {
+		t.Fatalf("error getting host: %s", err)
+	}
+	if host.IsTemplated("url") {
+		t.Fatalf("templated flag must not be set unless templates are preserved")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// normalizeText converts the text, e.g. an inventory or a vault edited on
+// Windows, to UTF-8 without the byte order mark and with LF line endings.
+// The UTF-16 text is detected by its byte order mark or, without one, by
+// the zero bytes of the ASCII characters.
+func normalizeText(b []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(b, utf8BOM):
+		b = b[len(utf8BOM):]
+	case bytes.HasPrefix(b, utf16LEBOM):
+		s, err := decodeUTF16(b[len(utf16LEBOM):], false)
+		if err != nil {
+			return nil, err
+		}
+		b = s
+	case bytes.HasPrefix(b, utf16BEBOM):
+		s, err := decodeUTF16(b[len(utf16BEBOM):], true)
+		if err != nil {
+			return nil, err
+		}
+		b = s
+	case len(b) >= 4 && b[0] != 0 && b[1] == 0 && b[2] != 0 && b[3] == 0:
+		s, err := decodeUTF16(b, false)
+		if err != nil {
+			return nil, err
+		}
+		b = s
+	case len(b) >= 4 && b[0] == 0 && b[1] != 0 && b[2] == 0 && b[3] != 0:
+		s, err := decodeUTF16(b, true)
+		if err != nil {
+			return nil, err
+		}
+		b = s
+	}
+	if bytes.IndexByte(b, '\r') < 0 {
+		return b, nil
+	}
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(b, []byte("\r"), []byte("\n")), nil
+}
+
+// isUTF16 returns true when the text is UTF-16, as detected by
+// normalizeText.
+func isUTF16(b []byte) bool {
+	switch {
+	case bytes.HasPrefix(b, utf16LEBOM), bytes.HasPrefix(b, utf16BEBOM):
+		return true
+	case len(b) >= 4 && b[0] != 0 && b[1] == 0 && b[2] != 0 && b[3] == 0:
+		return true
+	case len(b) >= 4 && b[0] == 0 && b[1] != 0 && b[2] == 0 && b[3] != 0:
+		return true
+	}
+	return false
+}
+
+func decodeUTF16(b []byte, bigEndian bool) ([]byte, error) {
+	if len(b)%2 != 0 {
+		return nil, fmt.Errorf("invalid UTF-16 text: odd number of bytes")
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			units[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	out := make([]byte, 0, len(units))
+	for _, r := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, r)
+	}
+	return out, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+func encodeUTF16(s string, bigEndian, bom bool) []byte {
+	var out []byte
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xfeff}, units...)
+	}
+	for _, u := range units {
+		if bigEndian {
+			out = append(out, byte(u>>8), byte(u))
+		} else {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out
+}
+
+func TestNormalizeText(t *testing.T) {
+	for i, test := range []struct {
+		input     []byte
+		output    string
+		shouldErr bool
+	}{
+		{input: []byte("a=1\nb=2\n"), output: "a=1\nb=2\n"},
+		{input: []byte("\xef\xbb\xbfa=1\r\nb=2\r\n"), output: "a=1\nb=2\n"},
+		{input: []byte("a=1\rb=2"), output: "a=1\nb=2"},
+		{input: encodeUTF16("[sw]\r\nny-sw01 é\r\n", false, true), output: "[sw]\nny-sw01 é\n"},
+		{input: encodeUTF16("[sw]\r\nny-sw01\r\n", true, true), output: "[sw]\nny-sw01\n"},
+		{input: encodeUTF16("[sw]\nny-sw01\n", false, false), output: "[sw]\nny-sw01\n"},
+		{input: append(utf16LEBOM, 'a'), shouldErr: true},
+	} {
+		b, err := normalizeText(test.input)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error", i)
+			}
+			t.Logf("PASS: Test %d, %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		if string(b) != test.output {
+			t.Fatalf("FAIL: Test %d, output mismatch: %q (expected) vs. %q (received)", i, test.output, b)
+		}
+		t.Logf("PASS: Test %d, %q", i, b)
+	}
+}
+
+func TestWindowsEncodedFiles(t *testing.T) {
+	dir := t.TempDir()
+	hosts, err := os.ReadFile("../../testdata/inventory/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, err := os.ReadFile("../../testdata/inventory/vault.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf := func(b []byte) []byte { return bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n")) }
+	hostsFile := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(hostsFile, encodeUTF16(string(crlf(hosts)), false, true), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vaultFile := filepath.Join(dir, "vault.yml")
+	if err := os.WriteFile(vaultFile, append(append([]byte{}, utf8BOM...), crlf(vault)...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	inv := NewInventory()
+	if err := inv.LoadFromFile(hostsFile); err != nil {
+		t.Fatalf("FAIL: error loading UTF-16 inventory: %s", err)
+	}
+	h, err := inv.GetHost("ny-sw01")
+	if err != nil || h.Variables["host_port"] != "8224" {
+		t.Fatalf("FAIL: unexpected host: %v, %v", h, err)
+	}
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vlt.LoadFromFile(vaultFile); err != nil {
+		t.Fatalf("FAIL: error loading vault with BOM and CRLF: %s", err)
+	}
+	t.Logf("PASS: loaded %d hosts and %d credentials", inv.Size(), len(vlt.Credentials))
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The variables are stored as strings. The lists and the dictionaries,
+// e.g. from YAML variables files, are stored encoded as JSON. The helpers
+// below convert the values back to the types Ansible would see.
+
+// typedValue returns the value of a variable as a bool, an int, a float64,
+// a list, a dictionary, or a string, in this order of preference. A number
+// with leading zeros, e.g. a zip code, remains a string.
+func typedValue(s string) interface{} {
+	if b, err := parseAnsibleBool(s); err == nil {
+		return b
+	}
+	if n := strings.TrimPrefix(s, "-"); len(n) > 1 && n[0] == '0' && n[1] != '.' {
+		return s
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXnN") {
+		return f
+	}
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// parseAnsibleBool parses the boolean values recognized by Ansible, e.g.
+// "yes", "on", and "true", case-insensitively.
+func parseAnsibleBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes", "on", "true":
+		return true, nil
+	case "no", "off", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean value: %q", s)
+}
+
+func typedVariables(m map[string]string) map[string]interface{} {
+	vars := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		vars[k] = typedValue(v)
+	}
+	return vars
+}
+
+func getIntVariable(m map[string]string, k string) (int, error) {
+	v, exists := m[k]
+	if !exists {
+		return 0, fmt.Errorf("variable %s not found", k)
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("variable %s is not an integer: %q", k, v)
+	}
+	return i, nil
+}
+
+func getBoolVariable(m map[string]string, k string) (bool, error) {
+	v, exists := m[k]
+	if !exists {
+		return false, fmt.Errorf("variable %s not found", k)
+	}
+	b, err := parseAnsibleBool(strings.TrimSpace(v))
+	if err != nil {
+		if i, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && (i == 0 || i == 1) {
+			return i == 1, nil
+		}
+		return false, fmt.Errorf("variable %s is not a boolean: %q", k, v)
+	}
+	return b, nil
+}
+
+func getStringSliceVariable(m map[string]string, k string) ([]string, error) {
+	v, exists := m[k]
+	if !exists {
+		return nil, fmt.Errorf("variable %s not found", k)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(v), "[") {
+		return parseTags(v), nil
+	}
+	var items []interface{}
+	if err := json.Unmarshal([]byte(v), &items); err != nil {
+		return nil, fmt.Errorf("variable %s is not a list: %s", k, err)
+	}
+	arr := make([]string, 0, len(items))
+	for _, item := range items {
+		s, err := stringifyValue(item)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s has invalid item: %s", k, err)
+		}
+		arr = append(arr, s)
+	}
+	return arr, nil
+}
+
+// TypedVariables returns the variables of the host with the values
+// converted to booleans, integers, floats, lists, and dictionaries, when
+// they parse as such, and strings otherwise.
+func (h *InventoryHost) TypedVariables() map[string]interface{} {
+	return typedVariables(h.Variables)
+}
+
+// GetString returns the value of a host variable, and whether it is set.
+func (h *InventoryHost) GetString(k string) (string, bool) {
+	v, exists := h.Variables[k]
+	return v, exists
+}
+
+// GetInt returns the value of a host variable as an integer.
+func (h *InventoryHost) GetInt(k string) (int, error) {
+	return getIntVariable(h.Variables, k)
+}
+
+// GetBool returns the value of a host variable as a boolean. The values
+// recognized by Ansible, e.g. "yes", "on", "true", and "1", are true, and
+// "no", "off", "false", and "0" are false.
+func (h *InventoryHost) GetBool(k string) (bool, error) {
+	return getBoolVariable(h.Variables, k)
+}
+
+// GetStringSlice returns the value of a host variable as a list of strings.
+// The value is either a list, e.g. from a YAML variables file, or a
+// comma-separated string.
+func (h *InventoryHost) GetStringSlice(k string) ([]string, error) {
+	return getStringSliceVariable(h.Variables, k)
+}
+
+// TypedVariables returns the variables of the group, see
+// InventoryHost.TypedVariables.
+func (g *InventoryGroup) TypedVariables() map[string]interface{} {
+	return typedVariables(g.Variables)
+}
+
+// GetString returns the value of a group variable, and whether it is set.
+func (g *InventoryGroup) GetString(k string) (string, bool) {
+	v, exists := g.Variables[k]
+	return v, exists
+}
+
+// GetInt returns the value of a group variable as an integer.
+func (g *InventoryGroup) GetInt(k string) (int, error) {
+	return getIntVariable(g.Variables, k)
+}
+
+// GetBool returns the value of a group variable as a boolean, see
+// InventoryHost.GetBool.
+func (g *InventoryGroup) GetBool(k string) (bool, error) {
+	return getBoolVariable(g.Variables, k)
+}
+
+// GetStringSlice returns the value of a group variable as a list of
+// strings, see InventoryHost.GetStringSlice.
+func (g *InventoryGroup) GetStringSlice(k string) ([]string, error) {
+	return getStringSliceVariable(g.Variables, k)
+}
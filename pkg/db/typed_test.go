@@ -0,0 +1,97 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypedVariables(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromBytes([]byte(`[web]
+web01 ansible_port=22 enabled=yes debug=0 zip=02134 ratio=0.5 tags=a,b
+
+[web:vars]
+env=prod
+`)); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if err := inv.addHostVars("web01", []byte("ntp:\n  - 10.0.0.1\n  - 10.0.0.2\nlimits:\n  cpu: 2\nbackup: true\n")); err != nil {
+		t.Fatalf("error adding host variables: %s", err)
+	}
+	h, err := inv.GetHost("web01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	typed := h.TypedVariables()
+	for i, test := range []struct {
+		key  string
+		want interface{}
+	}{
+		{key: "ansible_port", want: 22},
+		{key: "enabled", want: true},
+		{key: "backup", want: true},
+		{key: "debug", want: 0},
+		{key: "zip", want: "02134"},
+		{key: "ratio", want: 0.5},
+		{key: "env", want: "prod"},
+		{key: "ntp", want: []interface{}{"10.0.0.1", "10.0.0.2"}},
+		{key: "limits", want: map[string]interface{}{"cpu": float64(2)}},
+	} {
+		if !reflect.DeepEqual(typed[test.key], test.want) {
+			t.Fatalf("FAIL: Test %d, variable %s mismatch: %#v (expected) vs. %#v (received)", i, test.key, test.want, typed[test.key])
+		}
+		t.Logf("PASS: Test %d, variable %s: %#v", i, test.key, test.want)
+	}
+
+	if v, err := h.GetInt("ansible_port"); err != nil || v != 22 {
+		t.Fatalf("unexpected ansible_port: %d, %v", v, err)
+	}
+	if _, err := h.GetInt("env"); err == nil {
+		t.Fatalf("expected a non-integer variable to fail, but passed")
+	}
+	if _, err := h.GetInt("undefined"); err == nil {
+		t.Fatalf("expected an undefined variable to fail, but passed")
+	}
+	for k, want := range map[string]bool{"enabled": true, "backup": true, "debug": false} {
+		if v, err := h.GetBool(k); err != nil || v != want {
+			t.Fatalf("unexpected %s: %t, %v", k, v, err)
+		}
+	}
+	if _, err := h.GetBool("env"); err == nil {
+		t.Fatalf("expected a non-boolean variable to fail, but passed")
+	}
+	for k, want := range map[string][]string{"ntp": {"10.0.0.1", "10.0.0.2"}, "tags": {"a", "b"}} {
+		if v, err := h.GetStringSlice(k); err != nil || !reflect.DeepEqual(v, want) {
+			t.Fatalf("unexpected %s: %v, %v", k, v, err)
+		}
+	}
+	if v, ok := h.GetString("env"); !ok || v != "prod" {
+		t.Fatalf("unexpected env: %s, %t", v, ok)
+	}
+
+	g, err := inv.GetGroup("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.GetString("env"); !ok || v != "prod" {
+		t.Fatalf("unexpected group env: %s, %t", v, ok)
+	}
+	if _, err := g.GetInt("env"); err == nil {
+		t.Fatalf("expected a non-integer group variable to fail, but passed")
+	}
+}
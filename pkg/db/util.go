@@ -15,39 +15,32 @@
 package db
 
 import (
+	"net"
+	"os"
 	"os/user"
+	"path/filepath"
 	"sort"
 	"strings"
 )
 
-type stringFloatMap struct {
-	m map[string]float64
-	s []string
-}
-
-func (sfm *stringFloatMap) Len() int {
-	return len(sfm.m)
-}
-
-func (sfm *stringFloatMap) Less(i, j int) bool {
-	return sfm.m[sfm.s[i]] > sfm.m[sfm.s[j]]
-}
-
-func (sfm *stringFloatMap) Swap(i, j int) {
-	sfm.s[i], sfm.s[j] = sfm.s[j], sfm.s[i]
+// sortedKeys returns the keys of a map in alphabetical order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-func sortStringFloatMap(m map[string]float64) []string {
-	sfm := new(stringFloatMap)
-	sfm.m = m
-	sfm.s = make([]string, len(m))
-	i := 0
-	for k := range m {
-		sfm.s[i] = k
-		i++
+// stringInList returns true when the list holds the string.
+func stringInList(s string, arr []string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
 	}
-	sort.Sort(sfm)
-	return sfm.s
+	return false
 }
 
 func expandFilePath(s string) string {
@@ -60,3 +53,54 @@ func expandFilePath(s string) string {
 	}
 	return s
 }
+
+// splitIPv6Literal splits a bracketed IPv6 literal, e.g. [2001:db8::1] or
+// [2001:db8::1]:2222, into the address and the optional port.
+func splitIPv6Literal(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return "", "", false
+	}
+	i := strings.Index(s, "]")
+	if i < 0 {
+		return "", "", false
+	}
+	addr := s[1:i]
+	if !strings.Contains(addr, ":") || net.ParseIP(addr) == nil {
+		return "", "", false
+	}
+	rest := s[i+1:]
+	if rest == "" {
+		return addr, "", true
+	}
+	if !strings.HasPrefix(rest, ":") || len(rest) < 2 {
+		return "", "", false
+	}
+	for _, c := range rest[1:] {
+		if c < '0' || c > '9' {
+			return "", "", false
+		}
+	}
+	return addr, rest[1:], true
+}
+
+// writeFileAtomic replaces the file with the provided data, so that the
+// readers see either the previous or the new content of the file.
+func writeFileAtomic(fp string, b []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(fp), "."+filepath.Base(fp)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fp)
+}
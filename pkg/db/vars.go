@@ -0,0 +1,81 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"sort"
+	"strings"
+)
+
+// GetGroupsMap returns the names of the hosts in each of the groups of the
+// Inventory, i.e. the value of the Ansible groups magic variable.
+func (inv *Inventory) GetGroupsMap() map[string][]string {
+	m := make(map[string][]string)
+	for _, g := range inv.Groups {
+		m[g.Name] = []string{}
+	}
+	for _, h := range inv.Hosts {
+		for _, g := range inv.hostGroups(h) {
+			m[g] = append(m[g], h.Name)
+		}
+	}
+	return m
+}
+
+// GetMagicVariables returns the Ansible magic variables of a host, i.e.
+// inventory_hostname, inventory_hostname_short, group_names, and groups.
+func (inv *Inventory) GetMagicVariables(s string) (map[string]interface{}, error) {
+	h, err := inv.GetHost(s)
+	if err != nil {
+		return nil, err
+	}
+	groupNames := []string{}
+	for _, g := range h.Groups {
+		if g == "all" {
+			continue
+		}
+		groupNames = append(groupNames, g)
+	}
+	sort.Strings(groupNames)
+	m := map[string]interface{}{
+		"inventory_hostname":       h.Name,
+		"inventory_hostname_short": strings.SplitN(h.Name, ".", 2)[0],
+		"group_names":              groupNames,
+		"groups":                   inv.GetGroupsMap(),
+	}
+	return m, nil
+}
+
+// GetEffectiveVariables returns the variables of a host, including the
+// inherited ones, merged with the Ansible magic variables. The magic
+// variables take precedence, as they do in Ansible.
+func (inv *Inventory) GetEffectiveVariables(s string) (map[string]interface{}, error) {
+	h, err := inv.GetHost(s)
+	if err != nil {
+		return nil, err
+	}
+	magic, err := inv.GetMagicVariables(h.Name)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	for k, v := range h.Variables {
+		m[k] = v
+	}
+	for k, v := range magic {
+		m[k] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetEffectiveVariables(t *testing.T) {
+	inv := NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	for i, test := range []struct {
+		host       string
+		short      string
+		groupNames []string
+		vars       int
+	}{
+		{
+			host:       "ny-sw01",
+			short:      "ny-sw01",
+			groupNames: []string{"cisco", "ny", "ny4", "ny4-cisco", "us"},
+			vars:       11,
+		},
+		{
+			host:       "controller",
+			short:      "controller",
+			groupNames: []string{"ungrouped"},
+			vars:       6,
+		},
+	} {
+		vars, err := inv.GetEffectiveVariables(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error getting variables for host %s: %s", i, test.host, err)
+		}
+		if len(vars) != test.vars {
+			t.Fatalf("FAIL: Test %d, the number of variables for host %s is not %d, but %d", i, test.host, test.vars, len(vars))
+		}
+		if vars["inventory_hostname"] != test.host || vars["inventory_hostname_short"] != test.short {
+			t.Fatalf("FAIL: Test %d, host %s name variables mismatch: %v, %v", i, test.host, vars["inventory_hostname"], vars["inventory_hostname_short"])
+		}
+		if !reflect.DeepEqual(vars["group_names"], test.groupNames) {
+			t.Fatalf("FAIL: Test %d, host %s group_names mismatch: %v (expected) vs. %v (received)", i, test.host, test.groupNames, vars["group_names"])
+		}
+		groups := vars["groups"].(map[string][]string)
+		if len(groups["all"]) != 5 || len(groups["cisco"]) != 2 {
+			t.Fatalf("FAIL: Test %d, host %s groups mismatch: %v", i, test.host, groups)
+		}
+		t.Logf("PASS: Test %d, host %s, group_names: %v", i, test.host, vars["group_names"])
+	}
+
+	inv = NewInventory()
+	if err := inv.LoadFromBytes([]byte(`web01.example.com`)); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	vars, err := inv.GetEffectiveVariables("web01.example.com")
+	if err != nil {
+		t.Fatalf("error getting variables: %s", err)
+	}
+	if vars["inventory_hostname_short"] != "web01" {
+		t.Fatalf("inventory_hostname_short mismatch: web01 (expected) vs. %v (received)", vars["inventory_hostname_short"])
+	}
+}
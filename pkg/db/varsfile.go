@@ -0,0 +1,212 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// varsFileExtensions are the extensions of group_vars and host_vars files.
+var varsFileExtensions = []string{".yml", ".yaml", ".json"}
+
+// varsFileName returns the name of the group or the host a group_vars or
+// host_vars file, e.g. group_vars/web.yml or group_vars/web/main.yml, is
+// for.
+func varsFileName(fp string) string {
+	parts := strings.Split(path.Clean(fp), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	name := parts[1]
+	if len(parts) > 2 {
+		return name
+	}
+	for _, ext := range varsFileExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// parseVarsFile parses a YAML or JSON variables file. The scalar values are
+// converted to strings, and the lists and dictionaries are encoded as JSON.
+// The values encrypted inline with "!vault |" are decrypted with the vault
+// of the Inventory.
+func (inv *Inventory) parseVarsFile(b []byte) (map[string]string, error) {
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("failed parsing variables file: %s", err)
+	}
+	m := make(map[string]string)
+	for k, v := range raw {
+		v, err := inv.decryptInlineValue(k, v)
+		if err != nil {
+			return nil, err
+		}
+		s, err := stringifyValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing variable %s: %s", k, err)
+		}
+		m[k] = s
+	}
+	return m, nil
+}
+
+// decryptInlineValue decrypts the strings in Ansible vault format found in
+// the value of a variable, including the items of lists and dictionaries.
+// Without a vault associated with the Inventory, the value is left
+// encrypted.
+func (inv *Inventory) decryptInlineValue(k string, v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		if !isVaultData([]byte(x)) {
+			return x, nil
+		}
+		if inv.vault == nil {
+			inv.logger.Warnf("variable %s is vault-encrypted, but no vault is associated with the inventory", k)
+			return x, nil
+		}
+		plaintext, err := inv.vault.decryptBytes([]byte(x))
+		if err != nil {
+			return nil, fmt.Errorf("failed decrypting variable %s: %w", k, err)
+		}
+		return string(plaintext), nil
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(x))
+		for mk, mv := range x {
+			dv, err := inv.decryptInlineValue(k, mv)
+			if err != nil {
+				return nil, err
+			}
+			m[mk] = dv
+		}
+		return m, nil
+	case []interface{}:
+		arr := make([]interface{}, len(x))
+		for i, item := range x {
+			dv, err := inv.decryptInlineValue(k, item)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = dv
+		}
+		return arr, nil
+	}
+	return v, nil
+}
+
+func stringifyValue(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return x, nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int:
+		return strconv.Itoa(x), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case uint64:
+		return strconv.FormatUint(x, 10), nil
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	}
+	b, err := json.Marshal(normalizeYAML(v))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// normalizeYAML converts the maps produced by the YAML decoder, which are
+// keyed by interface{}, into maps keyed by strings.
+func normalizeYAML(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, val := range x {
+			m[fmt.Sprint(k)] = normalizeYAML(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, val := range x {
+			m[k] = normalizeYAML(val)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(x))
+		for i, val := range x {
+			arr[i] = normalizeYAML(val)
+		}
+		return arr
+	}
+	return v
+}
+
+// addGroupVars adds the variables of a group_vars file to a group. The
+// variables take precedence over the ones from the inventory file.
+func (inv *Inventory) addGroupVars(name string, b []byte) error {
+	b, err := inv.decryptSource(b)
+	if err != nil {
+		return err
+	}
+	m, err := inv.parseVarsFile(b)
+	if err != nil {
+		return err
+	}
+	g, err := inv.GetGroup(name)
+	if err != nil {
+		return err
+	}
+	for k, v := range m {
+		g.Variables[k] = v
+		setVariableSource(&g.VariableSources, k, inv.variableSource("group_vars", name))
+	}
+	return nil
+}
+
+// addHostVars adds the variables of a host_vars file to a host. The
+// variables take precedence over the ones from the inventory file.
+func (inv *Inventory) addHostVars(name string, b []byte) error {
+	b, err := inv.decryptSource(b)
+	if err != nil {
+		return err
+	}
+	m, err := inv.parseVarsFile(b)
+	if err != nil {
+		return err
+	}
+	h, err := inv.GetHost(name)
+	if err != nil {
+		return err
+	}
+	if h.Implicit {
+		return fmt.Errorf("host %s does not exist in the inventory", name)
+	}
+	for k, v := range m {
+		h.Variables[k] = v
+		setVariableSource(&h.VariableSources, k, inv.variableSource("host_vars", name))
+	}
+	return nil
+}
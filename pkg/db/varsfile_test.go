@@ -0,0 +1,85 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineVaultVariables(t *testing.T) {
+	vlt := NewVault()
+	if err := vlt.SetPassword("secret"); err != nil {
+		t.Fatalf("error setting vault password: %s", err)
+	}
+	indent := func(b []byte) string {
+		return "  " + strings.ReplaceAll(strings.TrimSpace(string(b)), "\n", "\n  ")
+	}
+	password, err := vlt.Encrypt([]byte("s3cr3t"))
+	if err != nil {
+		t.Fatalf("error encrypting value: %s", err)
+	}
+	token, err := vlt.Encrypt([]byte("t0k3n"))
+	if err != nil {
+		t.Fatalf("error encrypting value: %s", err)
+	}
+	vars := []byte("ansible_password: !vault |\n" + indent(password) + "\n" +
+		"api:\n  user: admin\n  token: !vault |\n  " + strings.ReplaceAll(indent(token), "\n", "\n  ") + "\n" +
+		"env: prod\n")
+
+	for i, test := range []struct {
+		vault     *Vault
+		password  string
+		api       string
+		shouldErr bool
+	}{
+		{vault: vlt, password: "s3cr3t", api: `{"token":"t0k3n","user":"admin"}`},
+		{password: strings.TrimSpace(string(password))},
+		{vault: NewVault(), shouldErr: true},
+	} {
+		inv := NewInventory()
+		if test.vault != nil {
+			inv.SetVault(test.vault)
+		}
+		if err := inv.LoadFromBytes([]byte("[web]\nweb01\n")); err != nil {
+			t.Fatalf("FAIL: Test %d, error reading inventory: %s", i, err)
+		}
+		err := inv.addGroupVars("web", vars)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error, but passed", i)
+			}
+			t.Logf("PASS: Test %d, error: %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error adding group variables: %s", i, err)
+		}
+		g, err := inv.GetGroup("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(g.Variables["ansible_password"]) != test.password {
+			t.Fatalf("FAIL: Test %d, ansible_password mismatch: %s (expected) vs. %s (received)", i, test.password, g.Variables["ansible_password"])
+		}
+		if test.api != "" && g.Variables["api"] != test.api {
+			t.Fatalf("FAIL: Test %d, api mismatch: %s (expected) vs. %s (received)", i, test.api, g.Variables["api"])
+		}
+		if g.Variables["env"] != "prod" {
+			t.Fatalf("FAIL: Test %d, env mismatch: prod (expected) vs. %s (received)", i, g.Variables["env"])
+		}
+		t.Logf("PASS: Test %d, ansible_password=%q", i, g.Variables["ansible_password"])
+	}
+}
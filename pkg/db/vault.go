@@ -15,16 +15,20 @@
 package db
 
 import (
+	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
 	//"github.com/davecgh/go-spew/spew"
 	"golang.org/x/crypto/pbkdf2"
 	"gopkg.in/yaml.v2"
-	"io/ioutil"
+	"os"
 	"regexp"
 	"sort"
 	"strconv"
@@ -38,6 +42,9 @@ const (
 	vaultSaltLength                 = 32
 )
 
+// redactedSecret replaces the secrets of a VaultCredential in its String.
+const redactedSecret = "****"
+
 // Vault is the contents of Ansible vault file.
 type Vault struct {
 	Header      VaultHeader        `xml:"-" json:"-" yaml:"-"`
@@ -46,16 +53,69 @@ type Vault struct {
 	Password    []byte             `xml:"-" json:"-" yaml:"-"`
 	Payload     []byte             `xml:"-" json:"-" yaml:"-"`
 	Credentials []*VaultCredential `xml:"credentials" json:"credentials" yaml:"credentials"`
+
+	versions       map[string]bool
+	maxFileSize    int64
+	maxPayloadSize int64
+	logger         Logger
+	keyring        map[string][]byte
+	keys           *vaultKeyCache
 }
 
-// VaultHeader is the header of a Vault.
+// VaultHeader is the header of a Vault, e.g. $ANSIBLE_VAULT;1.1;AES256,
+// or $ANSIBLE_VAULT;1.2;AES256;prod for a vault encrypted with a vault ID.
 type VaultHeader struct {
 	Format  string `xml:"-" json:"-" yaml:"-"`
 	Version string `xml:"-" json:"-" yaml:"-"`
 	Cipher  string `xml:"-" json:"-" yaml:"-"`
+	// Label is the vault ID label of the vault 1.2 format.
+	Label string `xml:"-" json:"-" yaml:"-"`
+}
+
+// defaultVaultVersions are the vault format versions accepted unless
+// WithVaultVersions says otherwise.
+var defaultVaultVersions = []string{"1.1", "1.2"}
+
+// ParseVaultHeader parses the header of vault data, i.e. its first line,
+// without decrypting the data, e.g. to find the vault ID it requires.
+func ParseVaultHeader(b []byte) (*VaultHeader, error) {
+	b, err := normalizeText(b)
+	if err != nil {
+		return nil, err
+	}
+	first, _ := splitVaultHeader(b)
+	line := strings.TrimSpace(string(first))
+	fields := strings.Split(line, ";")
+	if len(fields) != 3 && len(fields) != 4 {
+		return nil, fmt.Errorf("invalid vault header: %s", line)
+	}
+	if fields[0] != "$ANSIBLE_VAULT" {
+		return nil, fmt.Errorf("invalid vault header: %s", line)
+	}
+	h := &VaultHeader{
+		Format:  fields[0],
+		Version: fields[1],
+		Cipher:  fields[2],
+	}
+	if len(fields) == 4 {
+		h.Label = strings.TrimSpace(fields[3])
+	}
+	if h.Version == "1.2" && h.Label == "" {
+		return nil, fmt.Errorf("invalid vault header, version 1.2 without vault id: %s", line)
+	}
+	return h, nil
 }
 
-// VaultBody is the body of a Vault.
+func newVaultVersions(versions ...string) map[string]bool {
+	m := make(map[string]bool)
+	for _, version := range versions {
+		m[version] = true
+	}
+	return m
+}
+
+// VaultBody is the body of a Vault. The encrypted data is decoded and
+// decrypted as a stream when the vault is opened, and Data is not kept.
 type VaultBody struct {
 	Salt []byte `xml:"-" json:"-" yaml:"-"`
 	HMAC []byte `xml:"-" json:"-" yaml:"-"`
@@ -78,111 +138,323 @@ type VaultCredential struct {
 	EnabledPassword string `xml:"password_enable,omitempty" json:"password_enable,omitempty" yaml:"password_enable,omitempty"`
 	Priority        int    `xml:"priority,omitempty" json:"priority,omitempty" yaml:"priority,omitempty"`
 	Default         bool   `xml:"default,omitempty" json:"default,omitempty" yaml:"default,omitempty"`
+	// Group and GroupRegex target the hosts of an inventory group, and of
+	// its child groups, by the name or by a regular expression. When more
+	// than one of Regex, Group, and GroupRegex is set, a host must match
+	// all of them.
+	Group      string `xml:"group,omitempty" json:"group,omitempty" yaml:"group,omitempty"`
+	GroupRegex string `xml:"group_regex,omitempty" json:"group_regex,omitempty" yaml:"group_regex,omitempty"`
+	// PrivateKey is a PEM-encoded SSH private key, and PrivateKeyFile the
+	// path to one. Passphrase decrypts the key, when encrypted.
+	PrivateKey     string `xml:"private_key,omitempty" json:"private_key,omitempty" yaml:"private_key,omitempty"`
+	PrivateKeyFile string `xml:"private_key_file,omitempty" json:"private_key_file,omitempty" yaml:"private_key_file,omitempty"`
+	Passphrase     string `xml:"passphrase,omitempty" json:"passphrase,omitempty" yaml:"passphrase,omitempty"`
+	// Port is the SSH port for the hosts without the ansible_port variable.
+	Port int `xml:"port,omitempty" json:"port,omitempty" yaml:"port,omitempty"`
+	// BecomeMethod and BecomePassword are for the privilege escalation,
+	// e.g. sudo or enable, as the become settings of Ansible.
+	BecomeMethod   string `xml:"become_method,omitempty" json:"become_method,omitempty" yaml:"become_method,omitempty"`
+	BecomePassword string `xml:"become_password,omitempty" json:"become_password,omitempty" yaml:"become_password,omitempty"`
+
+	// regex and groupRegex are the compiled Regex and GroupRegex patterns,
+	// set when the credentials are validated.
+	regex      *regexp.Regexp
+	groupRegex *regexp.Regexp
 }
 
 // NewVault returns a pointer to Vault.
-func NewVault() *Vault {
-	v := &Vault{}
+func NewVault(opts ...VaultOption) *Vault {
+	v := &Vault{
+		versions: newVaultVersions(defaultVaultVersions...),
+		logger:   nopLogger{},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
 	return v
 }
 
 func (v *Vault) readVault(b []byte) error {
-	if v.Password == nil {
-		return fmt.Errorf("vault password not found")
+	if err := v.open(b); err != nil {
+		return err
 	}
-	lines := strings.Split(string(b[:]), "\n")
-	if len(lines) < 2 {
-		return fmt.Errorf("invalid vault payload")
+	payload, err := normalizeText(v.Payload)
+	if err != nil {
+		return err
 	}
-	header := strings.Split(strings.TrimSpace(lines[0]), ";")
-	if len(header) != 3 {
-		return fmt.Errorf("invalid vault header: %s", lines[0])
+	tv := NewVault()
+	if err := yaml.Unmarshal(payload, tv); err != nil {
+		return fmt.Errorf("error parsing YAML content of the vault: %s", err)
 	}
-	// Capture vault header
-	v.Header.Format = header[0]
-	v.Header.Version = header[1]
-	v.Header.Cipher = header[2]
-	if v.Header.Version != "1.1" {
-		return fmt.Errorf("unsupported vault version: %s", v.Header.Version)
+	if err := validateCredentials(tv.Credentials); err != nil {
+		return err
+	}
+	if len(tv.Credentials) == 0 {
+		v.logger.Warnf("vault has no credentials")
 	}
+	v.Credentials = tv.Credentials
+	return nil
+}
 
-	if v.Header.Cipher != "AES256" {
-		return fmt.Errorf("unsupported vault cipher: %s", v.Header.Cipher)
+// validateCredentials checks the regular expressions of the credentials
+// for their validity, and keeps the compiled ones for the host lookups.
+func validateCredentials(creds []*VaultCredential) error {
+	for _, c := range creds {
+		targeted := c.Regex != "" || c.Group != "" || c.GroupRegex != ""
+		if !c.Default && !targeted {
+			return fmt.Errorf("invalid vault entry, non-default and empty regex pattern and group")
+		}
+		if c.Default && targeted {
+			return fmt.Errorf("invalid vault entry, default and non-empty regex pattern or group")
+		}
+		if c.Port < 0 || c.Port > 65535 {
+			return fmt.Errorf("invalid vault entry, port %d out of range", c.Port)
+		}
+		if c.PrivateKey != "" && c.PrivateKeyFile != "" {
+			return fmt.Errorf("invalid vault entry, both private key and private key file")
+		}
+		if c.Default {
+			continue
+		}
+		r, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid vault entry, regex compilation for '%s', failed: %s", c.Regex, err)
+		}
+		gr, err := regexp.Compile(c.GroupRegex)
+		if err != nil {
+			return fmt.Errorf("invalid vault entry, group regex compilation for '%s', failed: %s", c.GroupRegex, err)
+		}
+		c.regex, c.groupRegex = r, gr
 	}
-	// Capture vault body
-	var bb strings.Builder
-	for _, line := range lines[1:] {
-		bb.WriteString(strings.TrimSpace(line))
+	return nil
+}
+
+// open decrypts vault data and stores the header, the body, the key, and
+// the plaintext payload of the vault.
+func (v *Vault) open(b []byte) error {
+	if v.versions == nil {
+		v.versions = newVaultVersions(defaultVaultVersions...)
 	}
-	body, err := hex.DecodeString(bb.String())
-	if err != nil {
-		return fmt.Errorf("vault hex decoding error: %s", err)
+	if v.logger == nil {
+		v.logger = nopLogger{}
 	}
-	// Split the body into 3 parts: Salt, HMAC, and Data
-	parts := strings.SplitN(string(body[:]), "\n", 3)
-	if len(parts) != 3 {
-		return fmt.Errorf("invalid vault body")
+	passwords := v.candidatePasswords("")
+	if len(passwords) == 0 {
+		return fmt.Errorf("vault password not found")
 	}
-	saltPart, err := hex.DecodeString(parts[0])
+	b, err := normalizeText(b)
 	if err != nil {
-		return fmt.Errorf("invalid vault body (salt): %s", err)
+		return err
 	}
-	v.Body.Salt = saltPart
-	hmacPart, err := hex.DecodeString(parts[1])
+	// Capture vault header
+	header, err := ParseVaultHeader(b)
 	if err != nil {
-		return fmt.Errorf("invalid vault body (hmac): %s", err)
+		return err
+	}
+	v.Header = *header
+	if v.Header.Label != "" {
+		passwords = v.candidatePasswords(v.Header.Label)
+	}
+	if !v.versions[v.Header.Version] {
+		return fmt.Errorf("unsupported vault version: %s", v.Header.Version)
+	}
+
+	if v.Header.Cipher != "AES256" {
+		return fmt.Errorf("unsupported vault cipher: %s", v.Header.Cipher)
+	}
+	// Capture vault body, i.e. the hex-encoded lines following the header
+	_, body := splitVaultHeader(b)
+	if body == nil {
+		return fmt.Errorf("invalid vault payload")
+	}
+	if err := checkLimit(LimitVaultPayloadSize, int64(hexLength(body)/2), v.maxPayloadSize); err != nil {
+		return err
 	}
-	v.Body.HMAC = hmacPart
-	dataPart, err := hex.DecodeString(parts[2])
+	salt, mac, _, err := openVaultBody(body)
 	if err != nil {
-		return fmt.Errorf("invalid vault body (data): %s", err)
+		return err
+	}
+	v.Body = VaultBody{Salt: salt, HMAC: mac}
+	// Generate a key for each of the candidate passwords, and compute the
+	// HMAC of the data in chunks. The data is decrypted only with the key
+	// the HMAC validates.
+	var unlocked bool
+	for i, password := range passwords {
+		key := v.keys.derive(password, v.Body.Salt)
+		v.Key.Cipher = key[:vaultKeyLength]
+		v.Key.HMAC = key[vaultKeyLength:(vaultKeyLength * 2)]
+		v.Key.InitializationVector = key[(vaultKeyLength * 2) : (vaultKeyLength*2)+vaultInitializationVectorLength]
+		keyHash := hmac.New(sha256.New, v.Key.HMAC)
+		_, _, data, _ := openVaultBody(body)
+		if _, err := io.Copy(keyHash, data); err != nil {
+			v.Key = VaultKey{}
+			return fmt.Errorf("invalid vault body (data): %s", err)
+		}
+		if hmac.Equal(keyHash.Sum(nil), v.Body.HMAC) {
+			if len(passwords) > 1 {
+				v.logger.Debugf("vault unlocked with candidate password %d of %d", i+1, len(passwords))
+			}
+			unlocked = true
+			break
+		}
 	}
-	v.Body.Data = dataPart
-	// Generate a decryption key
-	key := pbkdf2.Key(v.Password, v.Body.Salt, vaultOperations, 2*vaultKeyLength*vaultInitializationVectorLength, sha256.New)
-	v.Key.Cipher = key[:vaultKeyLength]
-	v.Key.HMAC = key[vaultKeyLength:(vaultKeyLength * 2)]
-	v.Key.InitializationVector = key[(vaultKeyLength * 2) : (vaultKeyLength*2)+vaultInitializationVectorLength]
-	// Valudate the password
-	keyHash := hmac.New(sha256.New, v.Key.HMAC)
-	keyHash.Write(v.Body.Data)
-	if !hmac.Equal(keyHash.Sum(nil), v.Body.HMAC) {
+	if !unlocked {
+		v.Key = VaultKey{}
 		return fmt.Errorf("invalid vault vault password")
 	}
-	// Decrypt the vault
 	cphr, err := aes.NewCipher(v.Key.Cipher)
 	if err != nil {
+		v.Key = VaultKey{}
 		return fmt.Errorf("error opening the vault: %s", err)
 	}
-	plainText := make([]byte, len(v.Body.Data))
-	encrBlock := cipher.NewCTR(cphr, v.Key.InitializationVector)
-	encrBlock.XORKeyStream(plainText, v.Body.Data)
-	output, err := unpadBytes(plainText)
+	var plainText bytes.Buffer
+	plainText.Grow(hexLength(body) / 4)
+	encrBlock := cipher.StreamWriter{S: cipher.NewCTR(cphr, v.Key.InitializationVector), W: &plainText}
+	_, _, data, _ := openVaultBody(body)
+	if _, err := io.Copy(encrBlock, data); err != nil {
+		v.Key = VaultKey{}
+		return fmt.Errorf("invalid vault body (data): %s", err)
+	}
+	if plainText.Len() == 0 {
+		return fmt.Errorf("error opening the vault: empty data")
+	}
+	output, err := unpadBytes(plainText.Bytes())
 	if err != nil {
 		return fmt.Errorf("error opening the vault: %s", err)
 	}
 	v.Payload = output
-	tv := &Vault{}
-	if err := yaml.Unmarshal(output, tv); err != nil {
-		return fmt.Errorf("error parsing YAML content of the vault: %s", err)
+	return nil
+}
+
+// decryptBytes decrypts vault data with the password of the vault. Unlike
+// LoadFromBytes, it leaves the state of the vault intact.
+func (v *Vault) decryptBytes(b []byte) ([]byte, error) {
+	tv := &Vault{
+		Password:       v.Password,
+		keyring:        v.keyring,
+		keys:           v.keys,
+		versions:       v.versions,
+		logger:         v.logger,
+		maxPayloadSize: v.maxPayloadSize,
 	}
-	// Check regular expressions for their validity
-	for _, c := range tv.Credentials {
-		if !c.Default && c.Regex == "" {
-			return fmt.Errorf("invalid vault entry, non-default and empty regex pattern")
-		}
-		if c.Default && c.Regex != "" {
-			return fmt.Errorf("invalid vault entry, default and non-empty regex pattern")
-		}
-		if c.Default {
-			continue
-		}
-		if _, err := regexp.Compile(c.Regex); err != nil {
-			return fmt.Errorf("invalid vault entry, regex compilation for '%s', failed: %s", c.Regex, err)
+	if err := tv.open(b); err != nil {
+		return nil, err
+	}
+	return tv.Payload, nil
+}
+
+// withKeys returns an empty Vault with copies of the passwords and the
+// settings of the vault, e.g. to load a new version of a vault file.
+func (v *Vault) withKeys() *Vault {
+	keyring := make(map[string][]byte, len(v.keyring))
+	for label, p := range v.keyring {
+		keyring[label] = append([]byte{}, p...)
+	}
+	var password []byte
+	if v.Password != nil {
+		password = append([]byte{}, v.Password...)
+	}
+	return &Vault{
+		Password:       password,
+		keyring:        keyring,
+		keys:           v.keys,
+		versions:       v.versions,
+		maxFileSize:    v.maxFileSize,
+		maxPayloadSize: v.maxPayloadSize,
+		logger:         v.logger,
+	}
+}
+
+// Clone returns a deep copy of the Vault, i.e. of its passwords, keys,
+// payload, and credentials, with the same settings and logger. The copy
+// may be modified while other goroutines use the Vault.
+func (v *Vault) Clone() *Vault {
+	c := v.withKeys()
+	c.Header = v.Header
+	c.Body = VaultBody{
+		Salt: cloneBytes(v.Body.Salt),
+		HMAC: cloneBytes(v.Body.HMAC),
+		Data: cloneBytes(v.Body.Data),
+	}
+	c.Key = VaultKey{
+		Cipher:               cloneBytes(v.Key.Cipher),
+		HMAC:                 cloneBytes(v.Key.HMAC),
+		InitializationVector: cloneBytes(v.Key.InitializationVector),
+	}
+	c.Payload = cloneBytes(v.Payload)
+	if v.Credentials != nil {
+		c.Credentials = make([]*VaultCredential, 0, len(v.Credentials))
+		for _, cr := range v.Credentials {
+			// The compiled patterns are safe for concurrent use and are
+			// compiled again when the pattern changes.
+			cc := *cr
+			c.Credentials = append(c.Credentials, &cc)
 		}
 	}
-	v.Credentials = tv.Credentials
-	return nil
+	return c
+}
+
+// encryptBytes encrypts data with the password of the vault in Ansible
+// vault 1.1 format.
+func (v *Vault) encryptBytes(b []byte) ([]byte, error) {
+	if v.Password == nil {
+		return nil, fmt.Errorf("vault password not found")
+	}
+	return encryptVault(b, v.Password, "")
+}
+
+// encryptVault encrypts data with the password in Ansible vault 1.1
+// format, or in vault 1.2 format when the vault ID label is not empty.
+func encryptVault(b, password []byte, label string) ([]byte, error) {
+	salt := make([]byte, vaultSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("error generating vault salt: %s", err)
+	}
+	key := deriveVaultKey(password, salt)
+	cphr, err := aes.NewCipher(key[:vaultKeyLength])
+	if err != nil {
+		return nil, fmt.Errorf("error creating the vault: %s", err)
+	}
+	plainText := padBytes(b, aes.BlockSize)
+	data := make([]byte, len(plainText))
+	encrBlock := cipher.NewCTR(cphr, key[(vaultKeyLength*2):(vaultKeyLength*2)+vaultInitializationVectorLength])
+	encrBlock.XORKeyStream(data, plainText)
+	keyHash := hmac.New(sha256.New, key[vaultKeyLength:(vaultKeyLength*2)])
+	keyHash.Write(data)
+	body := hex.EncodeToString([]byte(hex.EncodeToString(salt) + "\n" + hex.EncodeToString(keyHash.Sum(nil)) + "\n" + hex.EncodeToString(data)))
+	var sb strings.Builder
+	if label != "" {
+		sb.WriteString("$ANSIBLE_VAULT;1.2;AES256;" + label + "\n")
+	} else {
+		sb.WriteString("$ANSIBLE_VAULT;1.1;AES256\n")
+	}
+	for len(body) > 80 {
+		sb.WriteString(body[:80] + "\n")
+		body = body[80:]
+	}
+	sb.WriteString(body + "\n")
+	return []byte(sb.String()), nil
+}
+
+// deriveVaultKey derives the cipher key, the HMAC key, and the
+// initialization vector of a vault from the password and the salt.
+func deriveVaultKey(password, salt []byte) []byte {
+	return pbkdf2.Key(password, salt, vaultOperations, 2*vaultKeyLength+vaultInitializationVectorLength, sha256.New)
+}
+
+// isVaultData returns true when the data starts with the Ansible vault
+// header, regardless of the text encoding.
+func isVaultData(b []byte) bool {
+	b, err := normalizeText(b)
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte("$ANSIBLE_VAULT;"))
+}
+
+func padBytes(b []byte, blockSize int) []byte {
+	n := blockSize - len(b)%blockSize
+	return append(append([]byte{}, b...), bytes.Repeat([]byte{byte(n)}, n)...)
 }
 
 func unpadBytes(b []byte) ([]byte, error) {
@@ -202,7 +474,7 @@ func (v *Vault) LoadFromBytes(b []byte) error {
 // LoadFromFile loads vault data from a file.
 func (v *Vault) LoadFromFile(fp string) error {
 	fp = expandFilePath(fp)
-	b, err := ioutil.ReadFile(fp)
+	b, err := readFile(fp, v.maxFileSize)
 	if err != nil {
 		return err
 	}
@@ -210,9 +482,22 @@ func (v *Vault) LoadFromFile(fp string) error {
 }
 
 // LoadPasswordFromFile loads unlock password for the vault from a file.
+// When the file is executable, it is a script printing the password, as
+// with ansible-vault, see LoadPasswordFromCommand.
 func (v *Vault) LoadPasswordFromFile(fp string) error {
 	fp = expandFilePath(fp)
-	b, err := ioutil.ReadFile(fp)
+	fi, err := os.Stat(fp)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+		return v.LoadPasswordFromCommand(fp)
+	}
+	b, err := readFile(fp, v.maxFileSize)
+	if err != nil {
+		return err
+	}
+	b, err = normalizeText(b)
 	if err != nil {
 		return err
 	}
@@ -220,6 +505,26 @@ func (v *Vault) LoadPasswordFromFile(fp string) error {
 	return nil
 }
 
+// LoadPasswordFromCommand loads unlock password for the vault from the
+// output of a command, e.g. a script querying a password manager. The
+// first line of the output is the password.
+func (v *Vault) LoadPasswordFromCommand(fp string, args ...string) error {
+	password, err := runPasswordCommand(context.Background(), expandFilePath(fp), args...)
+	if err != nil {
+		return err
+	}
+	return v.SetPassword(password)
+}
+
+// SetLogger sets the logger of the Vault, see WithVaultLogger. A nil logger
+// discards the events.
+func (v *Vault) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	v.logger = logger
+}
+
 // SetPassword sets unlock password for the vault.
 func (v *Vault) SetPassword(s string) error {
 	if s == "" {
@@ -230,23 +535,55 @@ func (v *Vault) SetPassword(s string) error {
 }
 
 // GetCredentials returns a list of credential applicable to the provided
-// host name.
+// host name. The host-specific credentials come first, followed by the
+// default ones. Within each of the two, the credentials are ordered by
+// priority, then by description, then by username. The credentials equal
+// in all three keep their order in the vault file. The credentials
+// targeting groups do not apply, because the groups of the host are not
+// known, see GetCredentialsForHost.
 func (v *Vault) GetCredentials(s string) ([]*VaultCredential, error) {
+	return v.getCredentials(s, nil), nil
+}
+
+// GetCredentialsForHost returns a list of credential applicable to a host
+// of the provided Inventory, including the credentials targeting the groups
+// of the host. The credentials are ordered as by GetCredentials.
+func (v *Vault) GetCredentialsForHost(inv *Inventory, s string) ([]*VaultCredential, error) {
+	if inv == nil {
+		return nil, fmt.Errorf("inventory not found")
+	}
+	h, err := inv.GetHost(s)
+	if err != nil {
+		return nil, err
+	}
+	return v.hostCredentials(h), nil
+}
+
+// hostCredentials returns a list of credential applicable to a host,
+// including the credentials targeting the groups of the host.
+func (v *Vault) hostCredentials(h *InventoryHost) []*VaultCredential {
+	groups := map[string]bool{"all": true}
+	if h.Parent != "" {
+		groups[h.Parent] = true
+	}
+	for _, g := range h.Groups {
+		groups[g] = true
+	}
+	return v.getCredentials(h.Name, groups)
+}
+
+func (v *Vault) getCredentials(s string, groups map[string]bool) []*VaultCredential {
 	cv := []*VaultCredential{}
 	for _, c := range v.Credentials {
 		if c.Default {
 			continue
 		}
-		r, err := regexp.Compile(c.Regex)
-		if err != nil {
-			continue
-		}
-		if r.MatchString(s) == true {
+		if c.matches(s, groups) {
 			cv = append(cv, c)
 		}
 	}
 	sort.SliceStable(cv, func(i, j int) bool {
-		return cv[i].Priority < cv[j].Priority
+		return cv[i].less(cv[j])
 	})
 	dcv := []*VaultCredential{}
 	for _, c := range v.Credentials {
@@ -256,21 +593,167 @@ func (v *Vault) GetCredentials(s string) ([]*VaultCredential, error) {
 		dcv = append(dcv, c)
 	}
 	sort.SliceStable(dcv, func(i, j int) bool {
-		return dcv[i].Priority < dcv[j].Priority
+		return dcv[i].less(dcv[j])
 	})
 	for _, c := range dcv {
 		cv = append(cv, c)
 	}
-	return cv, nil
+	return cv
+}
+
+// matches reports whether the host-specific credential applies to a host
+// with the provided name and groups.
+func (c *VaultCredential) matches(s string, groups map[string]bool) bool {
+	if c.Regex != "" {
+		r, err := compiledPattern(c.regex, c.Regex)
+		if err != nil || !r.MatchString(s) {
+			return false
+		}
+	}
+	if c.Group != "" && !groups[c.Group] {
+		return false
+	}
+	if c.GroupRegex != "" {
+		r, err := compiledPattern(c.groupRegex, c.GroupRegex)
+		if err != nil {
+			return false
+		}
+		matched := false
+		for g := range groups {
+			if r.MatchString(g) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// compiledPattern returns the compiled pattern, when it is still current,
+// or compiles the pattern, e.g. for the credentials added to the vault
+// after it was loaded.
+func compiledPattern(r *regexp.Regexp, pattern string) (*regexp.Regexp, error) {
+	if r != nil && r.String() == pattern {
+		return r, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// GetCredential returns the credential to use for the provided host name,
+// i.e. the host-specific credential with the highest priority, the lowest
+// number, or, when there is none, the default credential with the highest
+// priority. See GetCredentials for the order of the credentials.
+func (v *Vault) GetCredential(s string) (*VaultCredential, error) {
+	creds, err := v.GetCredentials(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("no credentials found for host %s", s)
+	}
+	return creds[0], nil
+}
+
+// less reports whether the credential is tried before the other one.
+func (c *VaultCredential) less(other *VaultCredential) bool {
+	if c.Priority != other.Priority {
+		return c.Priority < other.Priority
+	}
+	if c.Description != other.Description {
+		return c.Description < other.Description
+	}
+	return c.Username < other.Username
 }
 
+// CredentialGap is an inventory host for which a Vault holds no host-specific
+// credential.
+type CredentialGap struct {
+	Host     string `xml:"host" json:"host" yaml:"host"`
+	Defaults int    `xml:"defaults" json:"defaults" yaml:"defaults"`
+}
+
+// GetCredentialGaps returns the hosts of the provided Inventory for which
+// GetCredentialsForHost returns default credentials only or nothing at all.
+func (v *Vault) GetCredentialGaps(inv *Inventory) ([]*CredentialGap, error) {
+	if inv == nil {
+		return nil, fmt.Errorf("inventory not found")
+	}
+	if err := inv.Precompute(); err != nil {
+		return nil, err
+	}
+	gaps := []*CredentialGap{}
+	for _, h := range inv.Hosts {
+		creds := v.hostCredentials(h)
+		gap := &CredentialGap{Host: h.Name}
+		matched := false
+		for _, c := range creds {
+			if c.Default {
+				gap.Defaults++
+				continue
+			}
+			matched = true
+			break
+		}
+		if !matched {
+			gaps = append(gaps, gap)
+		}
+	}
+	return gaps, nil
+}
+
+// String returns the credential in a form suitable for logs. The
+// passwords, the passphrase, and the private key are masked, see
+// UnsafeString.
 func (c *VaultCredential) String() string {
+	return c.format(false)
+}
+
+// UnsafeString returns the credential with the passwords, the passphrase,
+// and the private key in plaintext, for the callers that need them.
+func (c *VaultCredential) UnsafeString() string {
+	return c.format(true)
+}
+
+func (c *VaultCredential) format(reveal bool) string {
+	secret := func(v string) string {
+		if reveal || v == "" {
+			return v
+		}
+		return redactedSecret
+	}
 	var s strings.Builder
 	s.WriteString("username=" + c.Username)
-	s.WriteString(", password=" + c.Password)
-	s.WriteString(", enabled_password=" + c.EnabledPassword)
+	s.WriteString(", password=" + secret(c.Password))
+	s.WriteString(", enabled_password=" + secret(c.EnabledPassword))
 	s.WriteString(", priority=" + strconv.Itoa(c.Priority))
 	s.WriteString(", default=" + strconv.FormatBool(c.Default))
+	if c.Group != "" {
+		s.WriteString(", group=" + c.Group)
+	}
+	if c.GroupRegex != "" {
+		s.WriteString(", group_regex=" + c.GroupRegex)
+	}
+	if c.PrivateKey != "" {
+		s.WriteString(", private_key=" + secret(c.PrivateKey))
+	}
+	if c.PrivateKeyFile != "" {
+		s.WriteString(", private_key_file=" + c.PrivateKeyFile)
+	}
+	if c.Passphrase != "" {
+		s.WriteString(", passphrase=" + secret(c.Passphrase))
+	}
+	if c.Port != 0 {
+		s.WriteString(", port=" + strconv.Itoa(c.Port))
+	}
+	if c.BecomeMethod != "" {
+		s.WriteString(", become_method=" + c.BecomeMethod)
+	}
+	if c.BecomePassword != "" {
+		s.WriteString(", become_password=" + secret(c.BecomePassword))
+	}
 	s.WriteString(", description=" + c.Description)
 	return s.String()
 }
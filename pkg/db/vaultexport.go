@@ -0,0 +1,100 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CredentialExportOption configures ExportCredentials.
+type CredentialExportOption func(*credentialExportConfig)
+
+type credentialExportConfig struct {
+	redact bool
+}
+
+// WithRedactedSecrets makes ExportCredentials mask the passwords, the
+// passphrases, and the private keys of the credentials, as String does.
+func WithRedactedSecrets() CredentialExportOption {
+	return func(c *credentialExportConfig) {
+		c.redact = true
+	}
+}
+
+// credentialExport is the document written by ExportCredentials. Its YAML
+// form is the plaintext of a vault file.
+type credentialExport struct {
+	XMLName     xml.Name           `xml:"vault" json:"-" yaml:"-"`
+	Credentials []*VaultCredential `xml:"credentials" json:"credentials" yaml:"credentials"`
+}
+
+// ExportCredentials writes the decrypted credentials of the Vault to the
+// provided writer in the "json", "yaml", or "xml" format, e.g. for other
+// tooling to ingest them. The secrets are in plaintext, unless
+// WithRedactedSecrets is provided.
+func (v *Vault) ExportCredentials(format string, w io.Writer, opts ...CredentialExportOption) error {
+	cfg := &credentialExportConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	doc := &credentialExport{Credentials: []*VaultCredential{}}
+	for _, c := range v.Credentials {
+		if cfg.redact {
+			c = c.redacted()
+		}
+		doc.Credentials = append(doc.Credentials, c)
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	case "yaml":
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("error encoding YAML content of the vault: %s", err)
+		}
+		_, err = w.Write(b)
+		return err
+	case "xml":
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	return fmt.Errorf("unsupported credential export format: %s", format)
+}
+
+// redacted returns a copy of the credential with the secrets masked.
+func (c *VaultCredential) redacted() *VaultCredential {
+	rc := *c
+	for _, s := range []*string{&rc.Password, &rc.EnabledPassword, &rc.PrivateKey, &rc.Passphrase, &rc.BecomePassword} {
+		if *s != "" {
+			*s = redactedSecret
+		}
+	}
+	return &rc
+}
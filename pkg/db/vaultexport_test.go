@@ -0,0 +1,94 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestExportCredentials(t *testing.T) {
+	vlt := NewVault()
+	vlt.Credentials = []*VaultCredential{
+		{Regex: "^ny-sw", Username: "admin", Password: "s3cret", EnabledPassword: "3nable", Priority: 1},
+		{Group: "linux", Username: "deploy", PrivateKey: "-----BEGIN KEY-----", Passphrase: "phrase", Port: 2222},
+		{Default: true, Username: "root", Password: "r00t", Description: "fallback"},
+	}
+	for i, test := range []struct {
+		format    string
+		redact    bool
+		shouldErr bool
+	}{
+		{format: "yaml"},
+		{format: "json"},
+		{format: "xml"},
+		{format: "yaml", redact: true},
+		{format: "xml", redact: true},
+		{format: "csv", shouldErr: true},
+	} {
+		var opts []CredentialExportOption
+		if test.redact {
+			opts = append(opts, WithRedactedSecrets())
+		}
+		var buf bytes.Buffer
+		err := vlt.ExportCredentials(test.format, &buf, opts...)
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error, but passed", i)
+			}
+			t.Logf("PASS: Test %d, error: %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		doc := &credentialExport{}
+		switch test.format {
+		case "yaml":
+			err = yaml.Unmarshal(buf.Bytes(), doc)
+		case "json":
+			err = json.Unmarshal(buf.Bytes(), doc)
+		case "xml":
+			err = xml.Unmarshal(buf.Bytes(), doc)
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error decoding export: %s\n%s", i, err, buf.String())
+		}
+		if len(doc.Credentials) != len(vlt.Credentials) {
+			t.Fatalf("FAIL: Test %d, credential count mismatch: %d (expected) vs. %d (received)", i, len(vlt.Credentials), len(doc.Credentials))
+		}
+		for j, c := range doc.Credentials {
+			expected := vlt.Credentials[j]
+			if test.redact {
+				expected = expected.redacted()
+			}
+			if c.UnsafeString() != expected.UnsafeString() {
+				t.Fatalf("FAIL: Test %d, credential %d mismatch:\n%s (expected)\n%s (received)", i, j, expected.UnsafeString(), c.UnsafeString())
+			}
+		}
+		if test.redact && strings.Contains(buf.String(), "s3cret") {
+			t.Fatalf("FAIL: Test %d, secret found in redacted export:\n%s", i, buf.String())
+		}
+		t.Logf("PASS: Test %d, format: %s, redacted: %t", i, test.format, test.redact)
+	}
+	if vlt.Credentials[0].Password != "s3cret" {
+		t.Fatalf("export modified the credentials of the vault")
+	}
+}
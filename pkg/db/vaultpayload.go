@@ -0,0 +1,75 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Decrypt returns the plaintext of data encrypted in the Ansible vault
+// format, e.g. a vars file, with the password of the Vault, or the
+// password of the vault ID in the header of the data. Unlike LoadFromBytes,
+// it leaves the state of the Vault intact and does not expect the plaintext
+// to hold credentials.
+func (v *Vault) Decrypt(b []byte) ([]byte, error) {
+	return v.decryptBytes(b)
+}
+
+// LoadPayloadFromBytes decrypts vault data and keeps its plaintext as the
+// payload of the Vault, whatever its content, e.g. a map of variables. See
+// UnmarshalPayload and PayloadAsMap.
+func (v *Vault) LoadPayloadFromBytes(b []byte) error {
+	return v.open(b)
+}
+
+// LoadPayloadFromFile is the LoadPayloadFromBytes counterpart reading the
+// vault data from a file.
+func (v *Vault) LoadPayloadFromFile(fp string) error {
+	fp = expandFilePath(fp)
+	b, err := readFile(fp, v.maxFileSize)
+	if err != nil {
+		return err
+	}
+	return v.open(b)
+}
+
+// UnmarshalPayload decodes the YAML, or JSON, payload of the Vault into the
+// provided value.
+func (v *Vault) UnmarshalPayload(out interface{}) error {
+	if v.Payload == nil {
+		return fmt.Errorf("vault payload not found")
+	}
+	payload, err := normalizeText(v.Payload)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(payload, out); err != nil {
+		return fmt.Errorf("error parsing YAML content of the vault: %s", err)
+	}
+	return nil
+}
+
+// PayloadAsMap returns the payload of the Vault decoded as a YAML, or JSON,
+// document with the nested maps keyed by strings, e.g. to be encoded as
+// JSON.
+func (v *Vault) PayloadAsMap() (map[string]interface{}, error) {
+	raw := make(map[interface{}]interface{})
+	if err := v.UnmarshalPayload(&raw); err != nil {
+		return nil, err
+	}
+	return normalizeYAML(raw).(map[string]interface{}), nil
+}
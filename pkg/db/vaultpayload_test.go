@@ -0,0 +1,82 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVaultPayload(t *testing.T) {
+	vlt := NewVault()
+	if err := vlt.SetPassword("secret"); err != nil {
+		t.Fatalf("error setting vault password: %s", err)
+	}
+	plaintext := []byte("db_password: s3cr3t\nports:\n  - 5432\n  - 6432\nreplica:\n  host: db02\n")
+	b, err := vlt.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("error encrypting payload: %s", err)
+	}
+
+	decrypted, err := vlt.Decrypt(b)
+	if err != nil {
+		t.Fatalf("error decrypting payload: %s", err)
+	}
+	if string(decrypted) != string(plaintext) {
+		t.Fatalf("plaintext mismatch: %q (expected) vs. %q (received)", plaintext, decrypted)
+	}
+	if vlt.Payload != nil {
+		t.Fatalf("expected Decrypt to leave the vault intact")
+	}
+
+	fp := filepath.Join(t.TempDir(), "vars.yml")
+	if err := os.WriteFile(fp, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := vlt.LoadPayloadFromFile(fp); err != nil {
+		t.Fatalf("error loading vault payload: %s", err)
+	}
+	m, err := vlt.PayloadAsMap()
+	if err != nil {
+		t.Fatalf("error decoding vault payload: %s", err)
+	}
+	expected := map[string]interface{}{
+		"db_password": "s3cr3t",
+		"ports":       []interface{}{5432, 6432},
+		"replica":     map[string]interface{}{"host": "db02"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("payload mismatch: %#v (expected) vs. %#v (received)", expected, m)
+	}
+	var vars struct {
+		Password string `yaml:"db_password"`
+		Ports    []int  `yaml:"ports"`
+	}
+	if err := vlt.UnmarshalPayload(&vars); err != nil {
+		t.Fatalf("error decoding vault payload: %s", err)
+	}
+	if vars.Password != "s3cr3t" || len(vars.Ports) != 2 {
+		t.Fatalf("unexpected payload: %+v", vars)
+	}
+
+	if err := NewVault().LoadPayloadFromBytes(b); err == nil {
+		t.Fatalf("expected loading without a password to fail, but passed")
+	}
+	if _, err := NewVault().PayloadAsMap(); err == nil {
+		t.Fatalf("expected decoding a missing payload to fail, but passed")
+	}
+}
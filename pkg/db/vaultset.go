@@ -0,0 +1,263 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// vaultKeyCache holds the keys derived from the passwords and the salts of
+// the vaults, so that the vaults encrypted with the same password and salt
+// pay the cost of the key derivation once.
+type vaultKeyCache struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func newVaultKeyCache() *vaultKeyCache {
+	return &vaultKeyCache{keys: make(map[string][]byte)}
+}
+
+// derive returns a copy of the key derived from the password and the salt.
+// A nil cache derives the key every time.
+func (c *vaultKeyCache) derive(password, salt []byte) []byte {
+	if c == nil {
+		return deriveVaultKey(password, salt)
+	}
+	h := sha256.New()
+	h.Write(password)
+	id := string(h.Sum(nil)) + string(salt)
+	c.mu.Lock()
+	key, exists := c.keys[id]
+	c.mu.Unlock()
+	if !exists {
+		key = deriveVaultKey(password, salt)
+		c.mu.Lock()
+		c.keys[id] = key
+		c.mu.Unlock()
+	}
+	return append([]byte{}, key...)
+}
+
+// wipe erases the cached keys from memory.
+func (c *vaultKeyCache) wipe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, key := range c.keys {
+		for i := range key {
+			key[i] = 0
+		}
+		delete(c.keys, id)
+	}
+}
+
+// VaultSet is a set of vault files opened with the same passwords, e.g. the
+// vault files of a directory. The files are decrypted in parallel, and the
+// keys derived from a password and a salt are reused across the files.
+type VaultSet struct {
+	// Concurrency is the number of the files decrypted in parallel. It
+	// defaults to the number of CPUs.
+	Concurrency int
+
+	mu     sync.RWMutex
+	keys   *Vault
+	files  []string
+	vaults map[string]*Vault
+}
+
+// NewVaultSet returns a pointer to VaultSet. The options apply to the
+// vaults of the set.
+func NewVaultSet(opts ...VaultOption) *VaultSet {
+	keys := NewVault(opts...)
+	keys.keys = newVaultKeyCache()
+	return &VaultSet{
+		Concurrency: runtime.NumCPU(),
+		keys:        keys,
+		vaults:      make(map[string]*Vault),
+	}
+}
+
+// SetPassword sets the password of the vaults in the set.
+func (s *VaultSet) SetPassword(password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys.SetPassword(password)
+}
+
+// AddPassword adds a password under a vault ID label, see
+// Vault.AddVaultID.
+func (s *VaultSet) AddPassword(label, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys.AddVaultID(label, password)
+}
+
+// LoadFromDir opens the vault files of a directory, i.e. the regular files
+// starting with the vault header. The other files are skipped.
+func (s *VaultSet) LoadFromDir(ctx context.Context, dir string) error {
+	dir = expandFilePath(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []string
+	var data [][]byte
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		fp := filepath.Join(dir, entry.Name())
+		b, err := readFile(fp, s.keys.maxFileSize)
+		if err != nil {
+			return err
+		}
+		if isVaultData(b) {
+			files = append(files, fp)
+			data = append(data, b)
+		}
+	}
+	return s.load(ctx, files, data)
+}
+
+// LoadFiles opens the provided vault files in parallel and adds them to the
+// set. A file already in the set is reloaded. When any of the files fails
+// to open, the set remains unchanged, and the error lists the failed files.
+func (s *VaultSet) LoadFiles(ctx context.Context, files ...string) error {
+	return s.load(ctx, files, nil)
+}
+
+// load is LoadFiles opening the vaults from the provided contents of the
+// files, if any, rather than reading the files.
+func (s *VaultSet) load(ctx context.Context, files []string, data [][]byte) error {
+	vaults := make([]*Vault, len(files))
+	errs := make([]error, len(files))
+	forEachConcurrently(len(files), s.Concurrency, func(i int) {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			return
+		}
+		s.mu.RLock()
+		v := s.keys.withKeys()
+		s.mu.RUnlock()
+		var err error
+		if data != nil {
+			err = v.LoadFromBytes(data[i])
+		} else {
+			err = v.LoadFromFile(files[i])
+		}
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		vaults[i] = v
+	})
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", files[i], err))
+		}
+	}
+	if len(failed) > 0 {
+		for _, v := range vaults {
+			if v != nil {
+				v.Close()
+			}
+		}
+		return fmt.Errorf("failed opening vault files: %s", strings.Join(failed, "; "))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, fp := range files {
+		fp = expandFilePath(fp)
+		if prev, exists := s.vaults[fp]; exists {
+			prev.Close()
+		} else {
+			s.files = append(s.files, fp)
+		}
+		s.vaults[fp] = vaults[i]
+	}
+	sort.Strings(s.files)
+	return nil
+}
+
+// Files returns the sorted paths of the vault files in the set.
+func (s *VaultSet) Files() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string{}, s.files...)
+}
+
+// Vault returns the vault opened from the provided file.
+func (s *VaultSet) Vault(fp string) (*Vault, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, exists := s.vaults[expandFilePath(fp)]
+	if !exists {
+		return nil, fmt.Errorf("vault file %s not found in the set", fp)
+	}
+	return v, nil
+}
+
+// Credentials returns the credentials of all the vaults in the set, in the
+// order of the files.
+func (s *VaultSet) Credentials() []*VaultCredential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var creds []*VaultCredential
+	for _, fp := range s.files {
+		creds = append(creds, s.vaults[fp].Credentials...)
+	}
+	return creds
+}
+
+// GetCredentials returns the credentials of the set applicable to the
+// provided host name, see Vault.GetCredentials.
+func (s *VaultSet) GetCredentials(host string) ([]*VaultCredential, error) {
+	return s.merged().GetCredentials(host)
+}
+
+// GetCredentialsForHost returns the credentials of the set applicable to
+// the inventory host, see Vault.GetCredentialsForHost.
+func (s *VaultSet) GetCredentialsForHost(inv *Inventory, host string) ([]*VaultCredential, error) {
+	return s.merged().GetCredentialsForHost(inv, host)
+}
+
+// merged returns a Vault with the credentials of the set.
+func (s *VaultSet) merged() *Vault {
+	return &Vault{Credentials: s.Credentials()}
+}
+
+// Close erases the passwords, the derived keys, and the vaults of the set
+// from memory.
+func (s *VaultSet) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.vaults {
+		v.Close()
+	}
+	s.keys.keys.wipe()
+	s.keys.Close()
+	s.files = nil
+	s.vaults = make(map[string]*Vault)
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVaultSet(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ny.yml": "credentials:\n- regex: ^ny\n  username: ny\n",
+		"la.yml": "credentials:\n- regex: ^la\n  username: la\n- default: true\n  username: root\n",
+	}
+	for name, payload := range files {
+		b, err := encryptVault([]byte(payload), []byte("s3cret"), "")
+		if err != nil {
+			t.Fatalf("error encrypting vault: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		// A copy of the file shares the salt, and thus the derived key.
+		if err := os.WriteFile(filepath.Join(dir, "copy-"+name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a vault\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	set := NewVaultSet()
+	if err := set.LoadFromDir(context.Background(), dir); err == nil {
+		t.Fatalf("expected error without password")
+	}
+	if err := set.SetPassword("s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.LoadFromDir(context.Background(), dir); err != nil {
+		t.Fatalf("error loading vault files: %s", err)
+	}
+	defer set.Close()
+
+	var names []string
+	for _, fp := range set.Files() {
+		names = append(names, filepath.Base(fp))
+	}
+	expected := []string{"copy-la.yml", "copy-ny.yml", "la.yml", "ny.yml"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("files mismatch: %v (expected) vs. %v (received)", expected, names)
+	}
+	if n := len(set.keys.keys.keys); n != 2 {
+		t.Fatalf("derived keys mismatch: 2 (expected) vs. %d (received)", n)
+	}
+	if n := len(set.Credentials()); n != 6 {
+		t.Fatalf("credentials mismatch: 6 (expected) vs. %d (received)", n)
+	}
+
+	for i, test := range []struct {
+		host      string
+		usernames []string
+	}{
+		{host: "ny01", usernames: []string{"ny", "ny", "root", "root"}},
+		{host: "la01", usernames: []string{"la", "la", "root", "root"}},
+		{host: "sf01", usernames: []string{"root", "root"}},
+	} {
+		creds, err := set.GetCredentials(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, host %s: unexpected error: %s", i, test.host, err)
+		}
+		var usernames []string
+		for _, c := range creds {
+			usernames = append(usernames, c.Username)
+		}
+		if !reflect.DeepEqual(usernames, test.usernames) {
+			t.Fatalf("FAIL: Test %d, host %s: credentials mismatch: %v (expected) vs. %v (received)", i, test.host, test.usernames, usernames)
+		}
+		t.Logf("PASS: Test %d, host %s: credentials: %v", i, test.host, usernames)
+	}
+
+	// A file failing to open leaves the set unchanged.
+	b, err := encryptVault([]byte(files["ny.yml"]), []byte("other"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sf.yml"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.LoadFiles(context.Background(), filepath.Join(dir, "sf.yml"), filepath.Join(dir, "ny.yml")); err == nil {
+		t.Fatalf("expected error for a vault with another password")
+	}
+	if n := len(set.Files()); n != 4 {
+		t.Fatalf("files mismatch after failed load: 4 (expected) vs. %d (received)", n)
+	}
+	if _, err := set.Vault(filepath.Join(dir, "sf.yml")); err == nil {
+		t.Fatalf("expected error for a vault file not in the set")
+	}
+}
+
+func BenchmarkVaultSetLoadFiles(b *testing.B) {
+	dir := b.TempDir()
+	data, err := encryptVault([]byte("credentials:\n- default: true\n  username: root\n"), []byte("s3cret"), "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var files []string
+	for i := 0; i < 16; i++ {
+		fp := filepath.Join(dir, "vault"+string(rune('a'+i)))
+		if err := os.WriteFile(fp, data, 0600); err != nil {
+			b.Fatal(err)
+		}
+		files = append(files, fp)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set := NewVaultSet()
+		set.SetPassword("s3cret")
+		if err := set.LoadFiles(context.Background(), files...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// splitVaultHeader splits vault data into the header line and the body
+// following it, without copying the data. The body is nil when the data
+// has no line following the header.
+func splitVaultHeader(b []byte) ([]byte, []byte) {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return b, nil
+	}
+	return b[:i], b[i+1:]
+}
+
+// hexLength returns the number of the characters of the vault body other
+// than the whitespace, i.e. its hex-encoded length.
+func hexLength(b []byte) int {
+	var n int
+	for _, c := range b {
+		if !isHexSpace(c) {
+			n++
+		}
+	}
+	return n
+}
+
+func isHexSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// hexLineReader reads the hex-encoded lines of a vault body as a single
+// hex string, i.e. without the whitespace.
+type hexLineReader struct {
+	b []byte
+}
+
+func (r *hexLineReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	var n int
+	for n < len(p) && len(r.b) > 0 {
+		if isHexSpace(r.b[0]) {
+			r.b = r.b[1:]
+			continue
+		}
+		// Copy the run of the hex characters up to the next whitespace.
+		run := r.b
+		if len(run) > len(p)-n {
+			run = run[:len(p)-n]
+		}
+		if i := bytes.IndexAny(run, " \t\r\n"); i >= 0 {
+			run = run[:i]
+		}
+		c := copy(p[n:], run)
+		n += c
+		r.b = r.b[c:]
+	}
+	return n, nil
+}
+
+// openVaultBody decodes the salt and the HMAC of a vault body, and returns
+// a reader of the encrypted data. The body is hex-encoded twice, i.e. the
+// hex encoding of the hex-encoded salt, HMAC, and data lines, and is
+// decoded incrementally, so that the data is never held in memory in full.
+func openVaultBody(b []byte) ([]byte, []byte, io.Reader, error) {
+	r := bufio.NewReader(hex.NewDecoder(&hexLineReader{b: b}))
+	var lines [2][]byte
+	for i := range lines {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return nil, nil, nil, fmt.Errorf("invalid vault body")
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("vault hex decoding error: %s", err)
+		}
+		lines[i] = line[:len(line)-1]
+	}
+	salt, err := hex.DecodeString(string(lines[0]))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid vault body (salt): %s", err)
+	}
+	mac, err := hex.DecodeString(string(lines[1]))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid vault body (hmac): %s", err)
+	}
+	return salt, mac, hex.NewDecoder(r), nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestOpenVaultBody(t *testing.T) {
+	payload := bytes.Repeat([]byte("credentials:\n- default: true\n  username: root\n"), 1000)
+	b, err := encryptVault(payload, []byte("s3cret"), "")
+	if err != nil {
+		t.Fatalf("error encrypting vault: %s", err)
+	}
+	_, body := splitVaultHeader(b)
+	salt, mac, data, err := openVaultBody(body)
+	if err != nil {
+		t.Fatalf("error opening vault body: %s", err)
+	}
+	if len(salt) != vaultSaltLength || len(mac) != 32 {
+		t.Fatalf("unexpected salt and hmac lengths: %d, %d", len(salt), len(mac))
+	}
+	encrypted, err := io.ReadAll(iotest.OneByteReader(data))
+	if err != nil {
+		t.Fatalf("error reading vault data: %s", err)
+	}
+	if len(encrypted)%16 != 0 || len(encrypted) < len(payload) {
+		t.Fatalf("unexpected vault data length: %d", len(encrypted))
+	}
+
+	vlt := NewVault()
+	vlt.SetPassword("s3cret")
+	if err := vlt.open(append([]byte("\n\n"), b...)); err != nil {
+		t.Fatalf("error opening vault: %s", err)
+	}
+	if !bytes.Equal(vlt.Payload, payload) {
+		t.Fatalf("payload mismatch after decryption")
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for i, test := range []struct {
+		input string
+		err   string
+	}{
+		{input: lines[0] + "\n" + "3132", err: "invalid vault body"},
+		{input: lines[0] + "\n" + "zz", err: "vault hex decoding error"},
+		{input: lines[0] + "\n" + "7a7a0a30300a", err: "invalid vault body (salt)"},
+		{input: lines[0] + "\n" + strings.Join(lines[1:], "\n") + "0", err: "invalid vault body (data)"},
+	} {
+		err := vlt.open([]byte(test.input))
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Fatalf("FAIL: Test %d, error mismatch: %s (expected) vs. %v (received)", i, test.err, err)
+		}
+		t.Logf("PASS: Test %d, error: %s", i, err)
+	}
+}
+
+func BenchmarkVaultOpenLarge(b *testing.B) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 1<<20)
+	data, err := encryptVault(payload, []byte("s3cret"), "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	vlt := NewVault()
+	vlt.SetPassword("s3cret")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := vlt.open(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// vaultStringIndent is the indentation of the lines of an inline-encrypted
+// value, as printed by "ansible-vault encrypt_string".
+const vaultStringIndent = "          "
+
+// EncryptString encrypts a string with the password in the Ansible vault
+// format, and returns it as the "!vault |" YAML block printed by
+// "ansible-vault encrypt_string", e.g. to be used as the value of a
+// variable in a vars file. When the vault ID is not empty, the string is
+// encrypted in the vault 1.2 format with the vault ID label.
+func EncryptString(plaintext, password, vaultID string) (string, error) {
+	password = strings.TrimSpace(password)
+	if password == "" {
+		return "", fmt.Errorf("empty password is unsupported")
+	}
+	b, err := encryptVault([]byte(plaintext), []byte(password), vaultID)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("!vault |\n")
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		sb.WriteString(vaultStringIndent + line + "\n")
+	}
+	return sb.String(), nil
+}
+
+// DecryptString decrypts a string encrypted in the Ansible vault format
+// with the password. The ciphertext is either the vault data, or the
+// "!vault |" YAML block, optionally preceded by the name of the variable,
+// e.g. as printed by "ansible-vault encrypt_string --name".
+func DecryptString(ciphertext, password string) (string, error) {
+	v := NewVault()
+	if err := v.SetPassword(password); err != nil {
+		return "", err
+	}
+	s := strings.TrimSpace(ciphertext)
+	if line, rest, found := strings.Cut(s, "\n"); found && strings.Contains(line, "!vault") {
+		s = rest
+	}
+	b, err := v.decryptBytes([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptString(t *testing.T) {
+	for i, test := range []struct {
+		plaintext string
+		vaultID   string
+		header    string
+	}{
+		{plaintext: "s3cr3t", header: "$ANSIBLE_VAULT;1.1;AES256"},
+		{plaintext: "s3cr3t", vaultID: "prod", header: "$ANSIBLE_VAULT;1.2;AES256;prod"},
+		{plaintext: "", header: "$ANSIBLE_VAULT;1.1;AES256"},
+		{plaintext: "multi\nline value\n", header: "$ANSIBLE_VAULT;1.1;AES256"},
+	} {
+		s, err := EncryptString(test.plaintext, "secret", test.vaultID)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+		if lines[0] != "!vault |" || lines[1] != vaultStringIndent+test.header {
+			t.Fatalf("FAIL: Test %d, unexpected block:\n%s", i, s)
+		}
+		for _, line := range lines[2:] {
+			if !strings.HasPrefix(line, vaultStringIndent) || len(line) > len(vaultStringIndent)+80 {
+				t.Fatalf("FAIL: Test %d, unexpected block line: %q", i, line)
+			}
+		}
+		for _, ciphertext := range []string{s, "ansible_password: " + s, strings.Join(lines[1:], "\n")} {
+			plaintext, err := DecryptString(ciphertext, "secret")
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+			}
+			if plaintext != test.plaintext {
+				t.Fatalf("FAIL: Test %d, plaintext mismatch: %q (expected) vs. %q (received)", i, test.plaintext, plaintext)
+			}
+		}
+		if _, err := DecryptString(s, "other"); err == nil {
+			t.Fatalf("FAIL: Test %d, expected error for a wrong password", i)
+		}
+		t.Logf("PASS: Test %d, block:\n%s", i, s)
+	}
+
+	// The block is the value of a variable in a vars file.
+	s, err := EncryptString("s3cr3t", "secret", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	vlt := NewVault()
+	vlt.SetPassword("secret")
+	inv := NewInventory(WithVault(vlt))
+	vars, err := inv.parseVarsFile([]byte("ansible_password: " + s + "env: prod\n"))
+	if err != nil {
+		t.Fatalf("error parsing vars file: %s", err)
+	}
+	if vars["ansible_password"] != "s3cr3t" || vars["env"] != "prod" {
+		t.Fatalf("unexpected variables: %v", vars)
+	}
+
+	if _, err := EncryptString("s3cr3t", " ", ""); err == nil {
+		t.Fatalf("expected error for an empty password")
+	}
+}
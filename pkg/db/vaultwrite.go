@@ -0,0 +1,109 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Encrypt encrypts data, e.g. a vars file, in the Ansible vault format, so
+// that ansible-vault can decrypt it. When the header of the Vault has a
+// vault ID label, e.g. the Vault was loaded from a vault 1.2 file, the
+// data is encrypted in the vault 1.2 format with the password of the vault
+// ID, when known, or with the password set with SetPassword. Otherwise,
+// the data is encrypted in the vault 1.1 format.
+func (v *Vault) Encrypt(b []byte) ([]byte, error) {
+	label := v.Header.Label
+	if label != "" {
+		if p, exists := v.keyring[label]; exists {
+			return encryptVault(b, p, label)
+		}
+	}
+	if v.Password == nil {
+		return nil, fmt.Errorf("vault password not found")
+	}
+	return encryptVault(b, v.Password, label)
+}
+
+// EncryptToBytes returns the credentials of the Vault encrypted in the
+// Ansible vault format, see Encrypt. When the Vault was loaded from a
+// vault, the other top-level keys of its payload are kept as they are, and
+// only the credentials are replaced.
+func (v *Vault) EncryptToBytes() ([]byte, error) {
+	if err := validateCredentials(v.Credentials); err != nil {
+		return nil, err
+	}
+	var doc yaml.MapSlice
+	if v.Payload != nil {
+		if err := v.UnmarshalPayload(&doc); err != nil {
+			return nil, err
+		}
+	}
+	replaced := false
+	for i, item := range doc {
+		if k, ok := item.Key.(string); ok && k == "credentials" {
+			doc[i].Value = v.Credentials
+			replaced = true
+		}
+	}
+	if !replaced {
+		doc = append(doc, yaml.MapItem{Key: "credentials", Value: v.Credentials})
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding YAML content of the vault: %s", err)
+	}
+	return v.Encrypt(b)
+}
+
+// Save writes the credentials of the Vault to a file in the Ansible vault
+// format, see EncryptToBytes. The file is replaced atomically and is
+// readable by the owner only. The file is compressed when it has the .gz
+// or .zst extension.
+func (v *Vault) Save(fp string) error {
+	fp = expandFilePath(fp)
+	b, err := v.EncryptToBytes()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomicCompressed(fp, b, 0600); err != nil {
+		return fmt.Errorf("failed saving vault: %s", err)
+	}
+	return nil
+}
+
+// SavePayload writes data, e.g. the edited payload of the Vault, to a file
+// in the Ansible vault format, see Encrypt. The file is replaced
+// atomically and is compressed according to its extension, see Save. An
+// existing file keeps its permissions, and a new one is readable by the
+// owner only.
+func (v *Vault) SavePayload(fp string, b []byte) error {
+	fp = expandFilePath(fp)
+	perm := os.FileMode(0600)
+	if fi, err := os.Stat(fp); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	b, err := v.Encrypt(b)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomicCompressed(fp, b, perm); err != nil {
+		return fmt.Errorf("failed saving vault: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVaultSave(t *testing.T) {
+	vlt := NewVault()
+	if err := vlt.LoadPasswordFromFile("../../testdata/inventory/vault.key"); err != nil {
+		t.Fatalf("error reading vault key file: %s", err)
+	}
+	if err := vlt.LoadFromFile("../../testdata/inventory/vault.yml"); err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	vlt.Credentials = append(vlt.Credentials, &VaultCredential{Regex: "ny-sw05", Username: "operator", Password: "n3w"})
+
+	fp := filepath.Join(t.TempDir(), "vault.yml")
+	if err := vlt.Save(fp); err != nil {
+		t.Fatalf("error saving vault: %s", err)
+	}
+	fi, err := os.Stat(fp)
+	if err != nil {
+		t.Fatalf("error reading saved vault: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("vault file mode mismatch: %o (expected) vs. %o (received)", 0600, fi.Mode().Perm())
+	}
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatalf("error reading saved vault: %s", err)
+	}
+	for i, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if i == 0 && line != "$ANSIBLE_VAULT;1.1;AES256" {
+			t.Fatalf("vault header mismatch: %s", line)
+		}
+		if len(line) > 80 {
+			t.Fatalf("vault line %d is longer than 80 characters", i)
+		}
+	}
+
+	saved := NewVault()
+	saved.Password = vlt.Password
+	if err := saved.LoadFromFile(fp); err != nil {
+		t.Fatalf("error reading saved vault: %s", err)
+	}
+	if len(saved.Credentials) != len(vlt.Credentials) {
+		t.Fatalf("credential count mismatch: %d (expected) vs. %d (received)", len(vlt.Credentials), len(saved.Credentials))
+	}
+	creds, err := saved.GetCredentials("ny-sw05")
+	if err != nil || len(creds) == 0 || creds[0].Username != "operator" {
+		t.Fatalf("saved vault credentials mismatch: %v, %v", creds, err)
+	}
+
+	// The vault files with .gz and .zst extensions are compressed.
+	for i, test := range []struct {
+		name  string
+		magic []byte
+	}{
+		{name: "vault.yml.gz", magic: gzipMagic},
+		{name: "vault.yml.zst", magic: zstdMagic},
+	} {
+		fp := filepath.Join(t.TempDir(), test.name)
+		if err := vlt.Save(fp); err != nil {
+			t.Fatalf("FAIL: Test %d, error saving vault %s: %s", i, test.name, err)
+		}
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error reading saved vault %s: %s", i, test.name, err)
+		}
+		if !bytes.HasPrefix(b, test.magic) {
+			t.Fatalf("FAIL: Test %d, vault %s is not compressed", i, test.name)
+		}
+		saved := NewVault()
+		saved.Password = vlt.Password
+		if err := saved.LoadFromFile(fp); err != nil {
+			t.Fatalf("FAIL: Test %d, error reading saved vault %s: %s", i, test.name, err)
+		}
+		if len(saved.Credentials) != len(vlt.Credentials) {
+			t.Fatalf("FAIL: Test %d, credential count mismatch: %d (expected) vs. %d (received)", i, len(vlt.Credentials), len(saved.Credentials))
+		}
+		t.Logf("PASS: Test %d, vault %s", i, test.name)
+	}
+
+	vlt.Credentials = append(vlt.Credentials, &VaultCredential{Username: "invalid"})
+	if err := vlt.Save(fp); err == nil {
+		t.Fatalf("expected saving an invalid credential to fail, but passed")
+	}
+}
+
+func TestVaultEncrypt(t *testing.T) {
+	for i, test := range []struct {
+		password  string
+		ids       map[string]string
+		label     string
+		header    string
+		shouldErr bool
+	}{
+		{password: "s3cret", header: "$ANSIBLE_VAULT;1.1;AES256"},
+		{ids: map[string]string{"prod": "pr0d", "dev": "d3v"}, label: "prod", header: "$ANSIBLE_VAULT;1.2;AES256;prod"},
+		{password: "s3cret", label: "prod", header: "$ANSIBLE_VAULT;1.2;AES256;prod"},
+		{ids: map[string]string{"dev": "d3v"}, shouldErr: true},
+	} {
+		vlt := NewVault()
+		if test.password != "" {
+			vlt.SetPassword(test.password)
+		}
+		for label, password := range test.ids {
+			vlt.AddVaultID(label, password)
+		}
+		vlt.Header.Label = test.label
+		b, err := vlt.Encrypt([]byte("ntp_server: 192.0.2.1\n"))
+		if test.shouldErr {
+			if err == nil {
+				t.Fatalf("FAIL: Test %d, expected error, but passed", i)
+			}
+			t.Logf("PASS: Test %d, error: %s", i, err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, unexpected error: %s", i, err)
+		}
+		if header := strings.SplitN(string(b), "\n", 2)[0]; header != test.header {
+			t.Fatalf("FAIL: Test %d, header mismatch: %s (expected) vs. %s (received)", i, test.header, header)
+		}
+		plain, err := vlt.decryptBytes(b)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, error decrypting: %s", i, err)
+		}
+		if string(plain) != "ntp_server: 192.0.2.1\n" {
+			t.Fatalf("FAIL: Test %d, plaintext mismatch: %q", i, plain)
+		}
+		t.Logf("PASS: Test %d, %s", i, test.header)
+	}
+}
+
+func TestVaultSavePayload(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "vars.yml")
+	vlt := NewVault()
+	vlt.SetPassword("s3cret")
+	vlt.Header.Label = "prod"
+	if err := vlt.SavePayload(fp, []byte("ntp_server: 192.0.2.1\n")); err != nil {
+		t.Fatalf("error saving vault payload: %s", err)
+	}
+	if err := os.Chmod(fp, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := NewVault()
+	edited.SetPassword("s3cret")
+	if err := edited.LoadPayloadFromFile(fp); err != nil {
+		t.Fatalf("error reading vault payload: %s", err)
+	}
+	if err := edited.SavePayload(fp, append(edited.Payload, "dns_server: 192.0.2.2\n"...)); err != nil {
+		t.Fatalf("error saving edited vault payload: %s", err)
+	}
+	fi, err := os.Stat(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Fatalf("vault file mode mismatch: %o (expected) vs. %o (received)", 0640, fi.Mode().Perm())
+	}
+	saved := NewVault()
+	saved.SetPassword("s3cret")
+	if err := saved.LoadPayloadFromFile(fp); err != nil {
+		t.Fatalf("error reading saved vault payload: %s", err)
+	}
+	if saved.Header.Label != "prod" || string(saved.Payload) != "ntp_server: 192.0.2.1\ndns_server: 192.0.2.2\n" {
+		t.Fatalf("saved vault mismatch: %s, %q", saved.Header.Label, saved.Payload)
+	}
+}
+
+func TestVaultSaveKeepsPayload(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "vault.yml")
+	vlt := NewVault()
+	vlt.SetPassword("s3cret")
+	payload := "ntp_server: 192.0.2.1\ncredentials:\n- regex: ny-sw01\n  username: admin\n  password: s3cret\nsnmp:\n  community: public\n"
+	if err := vlt.SavePayload(fp, []byte(payload)); err != nil {
+		t.Fatalf("error saving vault payload: %s", err)
+	}
+
+	edited := NewVault()
+	edited.SetPassword("s3cret")
+	if err := edited.LoadFromFile(fp); err != nil {
+		t.Fatalf("error reading vault: %s", err)
+	}
+	edited.Credentials = append(edited.Credentials, &VaultCredential{Regex: "ny-sw02", Username: "operator", Password: "n3w"})
+	if err := edited.Save(fp); err != nil {
+		t.Fatalf("error saving vault: %s", err)
+	}
+
+	saved := NewVault()
+	saved.SetPassword("s3cret")
+	if err := saved.LoadFromFile(fp); err != nil {
+		t.Fatalf("error reading saved vault: %s", err)
+	}
+	if len(saved.Credentials) != 2 {
+		t.Fatalf("credential count mismatch: 2 (expected) vs. %d (received)", len(saved.Credentials))
+	}
+	m, err := saved.PayloadAsMap()
+	if err != nil {
+		t.Fatalf("error decoding saved vault payload: %s", err)
+	}
+	if m["ntp_server"] != "192.0.2.1" {
+		t.Fatalf("saved vault payload lost ntp_server: %v", m)
+	}
+	if snmp, ok := m["snmp"].(map[string]interface{}); !ok || snmp["community"] != "public" {
+		t.Fatalf("saved vault payload lost snmp: %v", m)
+	}
+	if !strings.HasPrefix(string(saved.Payload), "ntp_server: 192.0.2.1\ncredentials:\n") {
+		t.Fatalf("saved vault payload order mismatch: %q", saved.Payload)
+	}
+}
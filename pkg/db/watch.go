@@ -0,0 +1,224 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// WatchedInventory keeps an Inventory, and optionally a Vault, in sync with
+// their files. It checks the files for changes periodically, reloads them
+// when they change, swaps the current versions atomically, and emits the
+// delta of the inventory to the subscribers. The current versions must not
+// be modified, because they may be in use by other goroutines.
+type WatchedInventory struct {
+	path          string
+	vaultFile     string
+	vaultKeys     *Vault
+	interval      time.Duration
+	inventoryOpts []InventoryOption
+	logger        Logger
+
+	reloader *Reloader
+	mu       sync.Mutex
+	vault    *Vault
+	pending  *Vault
+	stamps   map[string]fileStamp
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// fileStamp is the modification time and the size of a file, telling
+// whether the file changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewWatchedInventory loads the inventory file, or directory, and starts
+// watching it for changes. The inventory is reloaded in the background
+// until Close is called. A failed reload is reported to the logger and the
+// current version is kept.
+func NewWatchedInventory(fp string, opts ...WatchOption) (*WatchedInventory, error) {
+	w := &WatchedInventory{
+		path:     expandFilePath(fp),
+		interval: 2 * time.Second,
+		logger:   nopLogger{},
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.reloader = NewReloader(w.load)
+	stamps, err := w.fileStamps()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	w.stamps = stamps
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go w.watch(ctx)
+	return w, nil
+}
+
+// Current returns the current version of the Inventory.
+func (w *WatchedInventory) Current() *Inventory {
+	return w.reloader.Current()
+}
+
+// Vault returns the current version of the Vault, or nil when the vault
+// file is not watched.
+func (w *WatchedInventory) Vault() *Vault {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.vault
+}
+
+// Subscribe returns a channel receiving the deltas of the reloaded
+// inventories, see Reloader.Subscribe. The channel is closed by Close.
+func (w *WatchedInventory) Subscribe(buffer int) <-chan *InventoryDelta {
+	return w.reloader.Subscribe(buffer)
+}
+
+// Reload reloads the inventory, and the vault, regardless of whether their
+// files changed, and returns the delta of the inventory.
+func (w *WatchedInventory) Reload(ctx context.Context) (*InventoryDelta, error) {
+	d, err := w.reloader.Reload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	if w.pending != nil {
+		w.vault = w.pending
+		w.pending = nil
+	}
+	w.mu.Unlock()
+	return d, nil
+}
+
+// Close stops watching the files and closes the subscriber channels.
+func (w *WatchedInventory) Close() error {
+	if w.cancel != nil {
+		w.cancel()
+		<-w.done
+	}
+	return w.reloader.Close()
+}
+
+// load loads a new version of the vault, if any, and of the inventory.
+func (w *WatchedInventory) load(ctx context.Context) (*Inventory, error) {
+	opts := append([]InventoryOption{}, w.inventoryOpts...)
+	var vlt *Vault
+	if w.vaultFile != "" {
+		keys := w.vaultKeys
+		if keys == nil {
+			keys = NewVault()
+		}
+		vlt = keys.withKeys()
+		if err := vlt.LoadFromFile(w.vaultFile); err != nil {
+			return nil, fmt.Errorf("failed reloading vault %s: %s", w.vaultFile, err)
+		}
+		opts = append(opts, WithVault(vlt))
+	}
+	inv := NewInventory(opts...)
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		err = inv.LoadFromSources(ctx, w.path)
+	} else {
+		err = inv.LoadFromFile(w.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reloading inventory %s: %s", w.path, err)
+	}
+	w.mu.Lock()
+	w.pending = vlt
+	w.mu.Unlock()
+	return inv, nil
+}
+
+// watch reloads the inventory when its files change, until the context is
+// canceled.
+func (w *WatchedInventory) watch(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stamps, err := w.fileStamps()
+		if err != nil {
+			w.logger.Warnf("failed checking inventory %s for changes: %s", w.path, err)
+			continue
+		}
+		if reflect.DeepEqual(stamps, w.stamps) {
+			continue
+		}
+		// The stamps are updated even when the reload fails, so that a
+		// broken file is not reloaded again until it changes.
+		w.stamps = stamps
+		if _, err := w.Reload(ctx); err != nil {
+			w.logger.Warnf("%s", err)
+			continue
+		}
+		w.logger.Debugf("reloaded inventory %s", w.path)
+	}
+}
+
+// fileStamps returns the stamps of the watched files, i.e. the inventory
+// file, or the files of the inventory directory, and the vault file.
+func (w *WatchedInventory) fileStamps() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	err := filepath.WalkDir(w.path, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stamps[fp] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if w.vaultFile != "" {
+		fi, err := os.Stat(w.vaultFile)
+		if err != nil {
+			return nil, err
+		}
+		stamps[w.vaultFile] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	return stamps, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchedInventory(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(fp, []byte("[web]\nweb01\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewVault()
+	if err := keys.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	vlt := keys.withKeys()
+	vlt.Credentials = []*VaultCredential{{Regex: "web01", Username: "admin", Password: "s3cr3t"}}
+	vaultFile := filepath.Join(dir, "vault.yml")
+	if err := vlt.Save(vaultFile); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatchedInventory(fp, WithWatchInterval(10*time.Millisecond), WithWatchedVault(keys, vaultFile))
+	if err != nil {
+		t.Fatalf("error watching inventory: %s", err)
+	}
+	defer w.Close()
+	deltas := w.Subscribe(4)
+	if w.Current().Size() != 1 {
+		t.Fatalf("inventory size mismatch: 1 (expected) vs. %d (received)", w.Current().Size())
+	}
+	if creds, err := w.Vault().GetCredentials("web01"); err != nil || creds[0].Username != "admin" {
+		t.Fatalf("unexpected credentials: %v, %v", creds, err)
+	}
+
+	// a change to the inventory file is picked up and emitted
+	if err := os.WriteFile(fp, []byte("[web]\nweb01\nweb02\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-deltas:
+		if len(d.Hosts) != 1 || d.Hosts[0].Host != "web02" || d.Hosts[0].Type != HostAdded {
+			t.Fatalf("unexpected delta: %+v", d.Hosts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the inventory reload")
+	}
+	if w.Current().Size() != 2 {
+		t.Fatalf("inventory size mismatch: 2 (expected) vs. %d (received)", w.Current().Size())
+	}
+
+	// a broken inventory file keeps the current version
+	if err := os.WriteFile(fp, []byte("[web:unknown]\nweb01\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if w.Current().Size() != 2 {
+		t.Fatalf("expected the broken inventory to keep the current version")
+	}
+
+	// a change to the vault file is picked up
+	vlt.Credentials[0].Username = "operator"
+	if err := vlt.Save(vaultFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fp, []byte("[web]\nweb01\nweb02\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		creds, err := w.Vault().GetCredentials("web01")
+		if err == nil && creds[0].Username == "operator" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the vault reload: %v, %v", creds, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing watcher: %s", err)
+	}
+	for range deltas {
+		// the channel is closed once drained
+	}
+
+	if _, err := NewWatchedInventory(filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("expected watching a missing inventory to fail, but passed")
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hcvault provides the credentials of the hosts from the KV
+// version 2 secrets engine of HashiCorp Vault, as an alternative to the
+// Ansible vault files. A secret holds the secrets of a credential, e.g. the
+// username and the password, and its custom metadata holds the targeting
+// of the credential, e.g. the regular expression of the host names, so that
+// the hosts a credential applies to can be changed without reading the
+// secret.
+package hcvault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+)
+
+// The defaults of Provider.Mount and Provider.Path.
+const (
+	DefaultMount = "secret"
+	DefaultPath  = "ansible/credentials"
+)
+
+// Provider is a db.CredentialProvider serving the credentials read from
+// the secrets under a path of a KV version 2 secrets engine, e.g.
+// secret/ansible/credentials/ny-switches. The fields of the secrets are
+// username, password, password_enable, private_key, passphrase, and
+// become_password. The fields of the custom metadata are description,
+// regex, group, group_regex, priority, default, port, private_key_file, and
+// become_method, as the fields of the credentials of a vault file.
+type Provider struct {
+	// URL is the address of Vault, e.g. https://vault.example.com:8200.
+	URL string
+	// Token authenticates the requests. When empty, and RoleID is set,
+	// the provider logs in with the AppRole auth method, and logs in again
+	// when the token expires or is revoked.
+	Token    string
+	RoleID   string
+	SecretID string
+	// Namespace is the namespace of Vault Enterprise, if any.
+	Namespace string
+	// Mount is the path of the secrets engine, and Path the path of the
+	// credentials in the secrets engine, read recursively.
+	Mount  string
+	Path   string
+	Client *http.Client
+	Logger db.Logger
+
+	mu    sync.RWMutex
+	vault *db.Vault
+
+	// tokenMu guards the token obtained with the AppRole auth method, and
+	// its expiration time, zero for a token without expiration.
+	tokenMu sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// tokenRenewMargin is the time before the expiration of a token when the
+// provider logs in again.
+const tokenRenewMargin = 30 * time.Second
+
+// NewProvider returns an instance of Provider.
+func NewProvider(addr, token string) *Provider {
+	return &Provider{
+		URL:    addr,
+		Token:  token,
+		Mount:  DefaultMount,
+		Path:   DefaultPath,
+		Client: http.DefaultClient,
+	}
+}
+
+// Load reads the credentials from Vault, and replaces the credentials of
+// the provider, unless one of them is invalid. Load is called again to
+// pick up the changes of the secrets, e.g. the rotated passwords.
+func (p *Provider) Load(ctx context.Context) error {
+	paths, err := p.list(ctx, strings.Trim(p.Path, "/"))
+	if err != nil {
+		return err
+	}
+	creds := []*db.VaultCredential{}
+	for _, s := range paths {
+		c, err := p.read(ctx, s)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			continue
+		}
+		creds = append(creds, c)
+	}
+	vlt, err := db.NewVaultFromCredentials(creds)
+	if err != nil {
+		return err
+	}
+	if len(creds) == 0 {
+		p.warnf("vault path %s/%s has no credentials", p.mount(), p.Path)
+	}
+	p.mu.Lock()
+	p.vault = vlt
+	p.mu.Unlock()
+	return nil
+}
+
+// Credentials returns the credentials read by Load.
+func (p *Provider) Credentials() []*db.VaultCredential {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.vault == nil {
+		return nil
+	}
+	return append([]*db.VaultCredential{}, p.vault.Credentials...)
+}
+
+// GetCredentials returns the credentials applicable to a host name, see
+// db.Vault.GetCredentials.
+func (p *Provider) GetCredentials(host string) ([]*db.VaultCredential, error) {
+	vlt, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return vlt.GetCredentials(host)
+}
+
+// GetCredentialsForHost returns the credentials applicable to a host of
+// the provided Inventory, see db.Vault.GetCredentialsForHost.
+func (p *Provider) GetCredentialsForHost(inv *db.Inventory, host string) ([]*db.VaultCredential, error) {
+	vlt, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return vlt.GetCredentialsForHost(inv, host)
+}
+
+func (p *Provider) current() (*db.Vault, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.vault == nil {
+		return nil, fmt.Errorf("vault credentials not loaded")
+	}
+	return p.vault, nil
+}
+
+// list returns the paths of the secrets under the provided path, sorted.
+// The keys ending with a slash are the folders, listed recursively.
+func (p *Provider) list(ctx context.Context, dir string) ([]string, error) {
+	out := struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}{}
+	found, err := p.request(ctx, "LIST", p.mount()+"/metadata/"+escapePath(dir), nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	paths := []string{}
+	for _, k := range out.Data.Keys {
+		if strings.HasSuffix(k, "/") {
+			sub, err := p.list(ctx, joinPath(dir, strings.TrimSuffix(k, "/")))
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, sub...)
+			continue
+		}
+		paths = append(paths, joinPath(dir, k))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// read returns the credential of the secret at the provided path, or nil
+// when the current version of the secret is deleted.
+func (p *Provider) read(ctx context.Context, s string) (*db.VaultCredential, error) {
+	out := struct {
+		Data struct {
+			Data     map[string]interface{} `json:"data"`
+			Metadata struct {
+				CustomMetadata map[string]string `json:"custom_metadata"`
+				DeletionTime   string            `json:"deletion_time"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}{}
+	found, err := p.request(ctx, http.MethodGet, p.mount()+"/data/"+escapePath(s), nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	if !found || out.Data.Data == nil {
+		p.warnf("vault secret %s is deleted, skipped", s)
+		return nil, nil
+	}
+	c, err := newCredential(out.Data.Data, out.Data.Metadata.CustomMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault secret %s: %s", s, err)
+	}
+	if c.Description == "" {
+		c.Description = s
+	}
+	return c, nil
+}
+
+// newCredential returns the credential with the provided secrets and
+// custom metadata.
+func newCredential(data map[string]interface{}, meta map[string]string) (*db.VaultCredential, error) {
+	c := &db.VaultCredential{}
+	secrets := map[string]*string{
+		"username":        &c.Username,
+		"password":        &c.Password,
+		"password_enable": &c.EnabledPassword,
+		"private_key":     &c.PrivateKey,
+		"passphrase":      &c.Passphrase,
+		"become_password": &c.BecomePassword,
+	}
+	for k, v := range data {
+		field, exists := secrets[k]
+		if !exists {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("field %s is not a string", k)
+		}
+		*field = s
+	}
+	var err error
+	for k, v := range meta {
+		switch k {
+		case "description":
+			c.Description = v
+		case "regex":
+			c.Regex = v
+		case "group":
+			c.Group = v
+		case "group_regex":
+			c.GroupRegex = v
+		case "private_key_file":
+			c.PrivateKeyFile = v
+		case "become_method":
+			c.BecomeMethod = v
+		case "priority":
+			if c.Priority, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("metadata %s is not a number: %s", k, v)
+			}
+		case "port":
+			if c.Port, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("metadata %s is not a number: %s", k, v)
+			}
+		case "default":
+			if c.Default, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("metadata %s is not a boolean: %s", k, v)
+			}
+		}
+	}
+	return c, nil
+}
+
+// authToken returns the token of the requests. The token obtained with the
+// AppRole auth method is renewed, by logging in again, when it is about to
+// expire, or when it is the rejected one, i.e. the token Vault rejected
+// was not renewed by a concurrent request yet.
+func (p *Provider) authToken(ctx context.Context, rejected string) (string, error) {
+	if p.Token != "" || p.RoleID == "" {
+		return p.Token, nil
+	}
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+	if p.token != "" && p.token != rejected && (p.expires.IsZero() || time.Now().Add(tokenRenewMargin).Before(p.expires)) {
+		return p.token, nil
+	}
+	in := map[string]string{"role_id": p.RoleID, "secret_id": p.SecretID}
+	out := struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}{}
+	if _, _, err := p.do(ctx, http.MethodPost, "auth/approle/login", "", in, &out); err != nil {
+		return "", err
+	}
+	if out.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault approle login returned no token")
+	}
+	p.token = out.Auth.ClientToken
+	p.expires = time.Time{}
+	if out.Auth.LeaseDuration > 0 {
+		p.expires = time.Now().Add(time.Duration(out.Auth.LeaseDuration) * time.Second)
+	}
+	return p.token, nil
+}
+
+// request sends an authenticated request to the HTTP API of Vault, and
+// decodes the response. It returns false when the path is not found. A
+// request rejected with the token obtained with the AppRole auth method is
+// sent again after logging in again.
+func (p *Provider) request(ctx context.Context, method, s string, in, out interface{}) (bool, error) {
+	token, err := p.authToken(ctx, "")
+	if err != nil {
+		return false, err
+	}
+	found, status, err := p.do(ctx, method, s, token, in, out)
+	if status != http.StatusForbidden || p.Token != "" || p.RoleID == "" {
+		return found, err
+	}
+	if token, err = p.authToken(ctx, token); err != nil {
+		return false, err
+	}
+	found, _, err = p.do(ctx, method, s, token, in, out)
+	return found, err
+}
+
+// do sends a request to the HTTP API of Vault, and decodes the response.
+// It returns false when the path is not found, and the status of the
+// response.
+func (p *Provider) do(ctx context.Context, method, s, token string, in, out interface{}) (bool, int, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return false, 0, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(p.URL, "/")+"/v1/"+s, body)
+	if err != nil {
+		return false, 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, 0, fmt.Errorf("vault request %s %s failed: %s", method, s, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, resp.StatusCode, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, resp.StatusCode, fmt.Errorf("vault request %s %s failed: %s: %s", method, s, resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, resp.StatusCode, fmt.Errorf("failed decoding vault response of %s: %s", s, err)
+	}
+	return true, resp.StatusCode, nil
+}
+
+func (p *Provider) mount() string {
+	if p.Mount == "" {
+		return DefaultMount
+	}
+	return strings.Trim(p.Mount, "/")
+}
+
+func (p *Provider) warnf(format string, args ...interface{}) {
+	if p.Logger != nil {
+		p.Logger.Warnf(format, args...)
+	}
+}
+
+func joinPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// escapePath escapes the segments of a path of a secret.
+func escapePath(s string) string {
+	segments := strings.Split(s, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
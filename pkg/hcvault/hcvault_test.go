@@ -0,0 +1,241 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hcvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+)
+
+type testSecret struct {
+	data map[string]interface{}
+	meta map[string]string
+}
+
+// testServer is a fake Vault serving the secrets of a KV version 2
+// secrets engine mounted at secret/, and the AppRole login.
+type testServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	tokens map[string]bool
+	logins int
+}
+
+// revoke revokes the tokens issued by the AppRole login.
+func (srv *testServer) revoke() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.tokens = map[string]bool{}
+}
+
+func (srv *testServer) loginCount() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.logins
+}
+
+func newTestServer(t *testing.T, secrets map[string]*testSecret) *testServer {
+	srv := &testServer{tokens: map[string]bool{}}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		if r.URL.Path == "/v1/auth/approle/login" {
+			in := map[string]string{}
+			json.NewDecoder(r.Body).Decode(&in)
+			if in["role_id"] != "ansible" || in["secret_id"] != "s3cr3t" {
+				http.Error(w, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+				return
+			}
+			srv.logins++
+			token := fmt.Sprintf("token-%d", srv.logins)
+			srv.tokens[token] = true
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": token, "lease_duration": 3600},
+			})
+			return
+		}
+		if !srv.tokens[r.Header.Get("X-Vault-Token")] {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.Method == "LIST" && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+			dir := strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/") + "/"
+			keys := map[string]bool{}
+			for k := range secrets {
+				if !strings.HasPrefix(k, dir) {
+					continue
+				}
+				k = strings.TrimPrefix(k, dir)
+				if i := strings.Index(k, "/"); i >= 0 {
+					k = k[:i+1]
+				}
+				keys[k] = true
+			}
+			if len(keys) == 0 {
+				http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+				return
+			}
+			out := []string{}
+			for k := range keys {
+				out = append(out, k)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": out}})
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+			s, exists := secrets[strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")]
+			if !exists || s.data == nil {
+				http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     s.data,
+					"metadata": map[string]interface{}{"custom_metadata": s.meta},
+				},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv
+}
+
+func TestProvider(t *testing.T) {
+	secrets := map[string]*testSecret{
+		"ansible/credentials/default": {
+			data: map[string]interface{}{"username": "admin", "password": "default"},
+			meta: map[string]string{"default": "true"},
+		},
+		"ansible/credentials/ny/switches": {
+			data: map[string]interface{}{"username": "netops", "password": "sw", "password_enable": "enable"},
+			meta: map[string]string{"regex": "^ny-sw", "priority": "1", "description": "ny switches"},
+		},
+		"ansible/credentials/ny/routers": {
+			data: map[string]interface{}{"username": "netops", "password": "rtr"},
+			meta: map[string]string{"group": "routers", "port": "2222"},
+		},
+		"ansible/credentials/retired": {},
+		"other/credentials/x": {
+			data: map[string]interface{}{"username": "x"},
+			meta: map[string]string{"default": "true"},
+		},
+	}
+	srv := newTestServer(t, secrets)
+	defer srv.Close()
+
+	p := NewProvider(srv.URL, "")
+	if _, err := p.GetCredentials("ny-sw01"); err == nil {
+		t.Fatalf("FAIL: expected error before the credentials are loaded")
+	}
+	if err := p.Load(context.Background()); err == nil {
+		t.Fatalf("FAIL: expected error without authentication")
+	}
+	p.RoleID = "ansible"
+	p.SecretID = "s3cr3t"
+	if err := p.Load(context.Background()); err != nil {
+		t.Fatalf("FAIL: load failed: %s", err)
+	}
+	if n := len(p.Credentials()); n != 3 {
+		t.Fatalf("FAIL: credentials mismatch: %d (expected) vs. %d (received)", 3, n)
+	}
+
+	inv := db.NewInventory()
+	if err := inv.LoadFromBytes([]byte("[routers]\nny-rtr01\n\n[switches]\nny-sw01\n")); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	var provider db.CredentialProvider = p
+	for i, test := range []struct {
+		host      string
+		inventory bool
+		want      []string
+	}{
+		{host: "ny-sw01", want: []string{"sw", "default"}},
+		{host: "ny-rtr01", want: []string{"default"}},
+		{host: "ny-rtr01", inventory: true, want: []string{"rtr", "default"}},
+	} {
+		var creds []*db.VaultCredential
+		var err error
+		if test.inventory {
+			creds, err = provider.GetCredentialsForHost(inv, test.host)
+		} else {
+			creds, err = provider.GetCredentials(test.host)
+		}
+		if err != nil {
+			t.Fatalf("FAIL: Test %d: %s", i, err)
+		}
+		got := []string{}
+		for _, c := range creds {
+			got = append(got, c.Password)
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Fatalf("FAIL: Test %d: credentials mismatch: %v (expected) vs. %v (received)", i, test.want, got)
+		}
+		t.Logf("PASS: Test %d: host %s: %v", i, test.host, got)
+	}
+	creds, _ := p.GetCredentials("ny-sw01")
+	if c := creds[0]; c.Description != "ny switches" || c.EnabledPassword != "enable" || c.Priority != 1 {
+		t.Fatalf("FAIL: credential mismatch: %s", c.UnsafeString())
+	}
+	creds, _ = p.GetCredentialsForHost(inv, "ny-rtr01")
+	if c := creds[0]; c.Description != "ansible/credentials/ny/routers" || c.Port != 2222 {
+		t.Fatalf("FAIL: credential mismatch: %s", c.UnsafeString())
+	}
+
+	// A revoked token is replaced by logging in again, once for the
+	// concurrent loads.
+	srv.revoke()
+	logins := srv.loginCount()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Load(context.Background()); err != nil {
+				t.Errorf("FAIL: load with revoked token failed: %s", err)
+			}
+			p.GetCredentials("ny-sw01")
+		}()
+	}
+	wg.Wait()
+	if n := srv.loginCount() - logins; n != 1 {
+		t.Fatalf("FAIL: login count mismatch after revocation: %d", n)
+	}
+	t.Logf("PASS: logged in %d times after revocation", srv.loginCount()-logins)
+
+	// An invalid secret keeps the credentials loaded before.
+	secrets["ansible/credentials/bad"] = &testSecret{
+		data: map[string]interface{}{"username": "bad"},
+		meta: map[string]string{"regex": "(", "priority": "1"},
+	}
+	if err := p.Load(context.Background()); err == nil {
+		t.Fatalf("FAIL: expected error for invalid regex")
+	}
+	secrets["ansible/credentials/bad"].meta["priority"] = "high"
+	if err := p.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "ansible/credentials/bad") {
+		t.Fatalf("FAIL: expected error for invalid priority, got: %v", err)
+	}
+	if n := len(p.Credentials()); n != 3 {
+		t.Fatalf("FAIL: credentials mismatch after failed load: %d (expected) vs. %d (received)", 3, n)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package consul imports the nodes of the Consul catalog into an
+// Inventory, and exports the hosts of an Inventory to the catalog as
+// external services.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"github.com/greenpau/go-ansible-db/pkg/importers"
+)
+
+// The prefixes of the groups of the datacenters and the services.
+const (
+	datacenterPrefix = "dc_"
+	servicePrefix    = "service_"
+)
+
+// defaultService is the name of the service the hosts are exported as,
+// unless Exporter.Service says otherwise.
+const defaultService = "ansible"
+
+// Importer fetches the nodes of the Consul catalog. The datacenters and
+// the services of the nodes become the groups, e.g. dc_ny4 and
+// service_web, the address of a node its ansible_host variable, and the
+// node metadata its variables.
+type Importer struct {
+	// URL is the address of Consul, e.g. http://127.0.0.1:8500.
+	URL string
+	// Token is the ACL token of Consul, if any.
+	Token  string
+	Client *http.Client
+	// Datacenters are the datacenters of the nodes. All of the
+	// datacenters of the catalog are fetched when none is set.
+	Datacenters []string
+	// Services, when set, are the only services becoming groups.
+	Services []string
+	// Logger reports the nodes and the variables skipped.
+	Logger db.Logger
+}
+
+// NewImporter returns an instance of Importer.
+func NewImporter(addr, token string) *Importer {
+	return &Importer{
+		URL:    addr,
+		Token:  token,
+		Client: http.DefaultClient,
+	}
+}
+
+// node is a node of the catalog.
+type node struct {
+	Node    string            `json:"Node"`
+	Address string            `json:"Address"`
+	Meta    map[string]string `json:"Meta"`
+}
+
+// serviceNode is a node providing a service.
+type serviceNode struct {
+	Node string `json:"Node"`
+}
+
+// Import fetches the nodes, and returns the Inventory created with the
+// provided options holding them.
+func (i *Importer) Import(ctx context.Context, opts ...db.InventoryOption) (*db.Inventory, error) {
+	b, err := i.INI(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv := db.NewInventory(opts...)
+	if err := inv.LoadFromBytes(b); err != nil {
+		return nil, fmt.Errorf("failed loading consul inventory: %s", err)
+	}
+	return inv, nil
+}
+
+// INI fetches the nodes, and returns them in the INI inventory format. The
+// node with more than one group is a member of the group combining them,
+// e.g. dc_ny4-service_web, see importers.BuildINI.
+func (i *Importer) INI(ctx context.Context) ([]byte, error) {
+	datacenters := i.Datacenters
+	if len(datacenters) == 0 {
+		if err := i.get(ctx, "/v1/catalog/datacenters", nil, &datacenters); err != nil {
+			return nil, err
+		}
+	}
+	var hosts []*importers.Host
+	seen := make(map[string]bool)
+	for _, dc := range datacenters {
+		nodes, err := i.fetch(ctx, dc)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range nodes {
+			if seen[h.Name] {
+				i.warnf("consul node %s in %s skipped, duplicate name", h.Name, dc)
+				continue
+			}
+			seen[h.Name] = true
+			hosts = append(hosts, h)
+		}
+	}
+	return importers.BuildINI(hosts, nil), nil
+}
+
+// fetch returns the nodes of a datacenter, with their groups.
+func (i *Importer) fetch(ctx context.Context, dc string) ([]*importers.Host, error) {
+	q := url.Values{"dc": []string{dc}}
+	var nodes []*node
+	if err := i.get(ctx, "/v1/catalog/nodes", q, &nodes); err != nil {
+		return nil, err
+	}
+	services := i.Services
+	if len(services) == 0 {
+		m := make(map[string][]string)
+		if err := i.get(ctx, "/v1/catalog/services", q, &m); err != nil {
+			return nil, err
+		}
+		for k := range m {
+			services = append(services, k)
+		}
+		sort.Strings(services)
+	}
+	members := make(map[string][]string)
+	for _, s := range services {
+		var providers []*serviceNode
+		if err := i.get(ctx, "/v1/catalog/service/"+url.PathEscape(s), q, &providers); err != nil {
+			return nil, err
+		}
+		for _, p := range providers {
+			members[p.Node] = append(members[p.Node], importers.SanitizeGroupName(servicePrefix+s))
+		}
+	}
+
+	var hosts []*importers.Host
+	for _, n := range nodes {
+		if n.Node == "" {
+			i.warnf("consul node without name in %s skipped", dc)
+			continue
+		}
+		h := &importers.Host{
+			Name:      n.Node,
+			Groups:    append([]string{importers.SanitizeGroupName(datacenterPrefix + dc)}, members[n.Node]...),
+			Variables: make(map[string]string),
+		}
+		if n.Address != "" {
+			h.Variables["ansible_host"] = n.Address
+		}
+		for k, v := range n.Meta {
+			if strings.ContainsAny(v, "\r\n") {
+				i.warnf("consul node %s metadata %s skipped, multi-line value", n.Node, k)
+				continue
+			}
+			h.Variables[strings.ReplaceAll(k, "-", "_")] = v
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+func (i *Importer) get(ctx context.Context, p string, q url.Values, out interface{}) error {
+	return request(ctx, i.Client, i.URL, i.Token, http.MethodGet, p, q, nil, out)
+}
+
+func (i *Importer) warnf(format string, args ...interface{}) {
+	if i.Logger != nil {
+		i.Logger.Warnf(format, args...)
+	}
+}
+
+// Exporter registers the hosts of an Inventory in the Consul catalog as
+// external services, i.e. the services of the nodes not running a Consul
+// agent. The groups of a host become the tags of its service.
+type Exporter struct {
+	// URL is the address of Consul, e.g. http://127.0.0.1:8500.
+	URL string
+	// Token is the ACL token of Consul, if any.
+	Token  string
+	Client *http.Client
+	// Datacenter is the datacenter of the services, by default the
+	// datacenter of the agent.
+	Datacenter string
+	// Service is the name of the services, "ansible" unless set.
+	Service string
+}
+
+// NewExporter returns an instance of Exporter.
+func NewExporter(addr, token string) *Exporter {
+	return &Exporter{
+		URL:    addr,
+		Token:  token,
+		Client: http.DefaultClient,
+	}
+}
+
+// registration is the request registering an external service.
+type registration struct {
+	Datacenter string            `json:"Datacenter,omitempty"`
+	Node       string            `json:"Node"`
+	Address    string            `json:"Address"`
+	NodeMeta   map[string]string `json:"NodeMeta"`
+	Service    *service          `json:"Service"`
+}
+
+type service struct {
+	ID      string            `json:"ID"`
+	Service string            `json:"Service"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+}
+
+// Export registers the hosts of the Inventory. The address and the port of
+// a service are the ones Ansible connects to, see InventoryHost.AnsibleHost.
+func (e *Exporter) Export(ctx context.Context, inv *db.Inventory) error {
+	hosts, err := inv.GetHosts()
+	if err != nil {
+		return err
+	}
+	name := e.Service
+	if name == "" {
+		name = defaultService
+	}
+	for _, h := range hosts {
+		r := &registration{
+			Datacenter: e.Datacenter,
+			Node:       h.Name,
+			Address:    h.AnsibleHost(),
+			NodeMeta:   map[string]string{"external-node": "true", "external-probe": "false"},
+			Service: &service{
+				ID:      name,
+				Service: name,
+				Address: h.AnsibleHost(),
+				Meta:    map[string]string{"ansible_group": h.Parent},
+			},
+		}
+		if port, err := h.AnsiblePort(); err == nil {
+			r.Service.Port = port
+		}
+		for _, g := range h.Groups {
+			if g != "all" {
+				r.Service.Tags = append(r.Service.Tags, g)
+			}
+		}
+		if err := request(ctx, e.Client, e.URL, e.Token, http.MethodPut, "/v1/catalog/register", nil, r, nil); err != nil {
+			return fmt.Errorf("failed registering host %s: %s", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// request sends a request to the Consul API, with the JSON encoding of in
+// as its body, if any, and decodes the response into out, if any.
+func request(ctx context.Context, client *http.Client, addr, token, method, p string, q url.Values, in, out interface{}) error {
+	u, err := url.Parse(strings.TrimRight(addr, "/") + p)
+	if err != nil {
+		return fmt.Errorf("invalid consul url %s: %s", addr, err)
+	}
+	u.RawQuery = q.Encode()
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed requesting %s: %s", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed requesting %s: %s", u, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed decoding %s: %s", u, err)
+	}
+	return nil
+}
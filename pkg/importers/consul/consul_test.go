@@ -0,0 +1,167 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+)
+
+type testLogger struct {
+	warnings []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {}
+
+func (l *testLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func newTestServer(t *testing.T, registered *[]*registration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			http.Error(w, "ACL not found", http.StatusForbidden)
+			return
+		}
+		dc := r.URL.Query().Get("dc")
+		switch {
+		case r.URL.Path == "/v1/catalog/datacenters":
+			fmt.Fprint(w, `["ny4", "sf1"]`)
+		case r.URL.Path == "/v1/catalog/nodes" && dc == "ny4":
+			fmt.Fprint(w, `[
+				{"Node": "ny-web01", "Address": "10.0.0.1", "Meta": {"os-family": "linux", "notes": "a\nb"}},
+				{"Node": "ny-db01", "Address": "10.0.0.2"}
+			]`)
+		case r.URL.Path == "/v1/catalog/nodes" && dc == "sf1":
+			fmt.Fprint(w, `[{"Node": "ny-web01", "Address": "10.1.0.1"}, {"Node": "sf-web01", "Address": "10.1.0.2"}]`)
+		case r.URL.Path == "/v1/catalog/services" && dc == "ny4":
+			fmt.Fprint(w, `{"web": ["v1"], "postgres": []}`)
+		case r.URL.Path == "/v1/catalog/services" && dc == "sf1":
+			fmt.Fprint(w, `{"web": []}`)
+		case r.URL.Path == "/v1/catalog/service/web" && dc == "ny4":
+			fmt.Fprint(w, `[{"Node": "ny-web01"}]`)
+		case r.URL.Path == "/v1/catalog/service/web" && dc == "sf1":
+			fmt.Fprint(w, `[{"Node": "sf-web01"}]`)
+		case r.URL.Path == "/v1/catalog/service/postgres":
+			fmt.Fprint(w, `[{"Node": "ny-db01"}]`)
+		case r.URL.Path == "/v1/catalog/register" && r.Method == http.MethodPut:
+			reg := &registration{}
+			if err := json.NewDecoder(r.Body).Decode(reg); err != nil {
+				t.Errorf("invalid registration: %s", err)
+			}
+			*registered = append(*registered, reg)
+			fmt.Fprint(w, `true`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestImport(t *testing.T) {
+	srv := newTestServer(t, nil)
+	defer srv.Close()
+	logger := &testLogger{}
+	imp := NewImporter(srv.URL, "secret")
+	imp.Logger = logger
+	inv, err := imp.Import(context.Background())
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	for i, test := range []struct {
+		host   string
+		parent string
+		vars   map[string]string
+	}{
+		{host: "ny-web01", parent: "dc_ny4-service_web", vars: map[string]string{"ansible_host": "10.0.0.1", "os_family": "linux"}},
+		{host: "ny-db01", parent: "dc_ny4-service_postgres", vars: map[string]string{"ansible_host": "10.0.0.2"}},
+		{host: "sf-web01", parent: "dc_sf1-service_web", vars: map[string]string{"ansible_host": "10.1.0.2"}},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, host %s: %s", i, test.host, err)
+		}
+		if h.Parent != test.parent {
+			t.Fatalf("FAIL: Test %d, host %s: parent mismatch: %s (expected) vs. %s (received)", i, test.host, test.parent, h.Parent)
+		}
+		vars := make(map[string]string)
+		for k, v := range h.Variables {
+			if strings.HasPrefix(h.VariableSources[k], "host ") {
+				vars[k] = v
+			}
+		}
+		if !reflect.DeepEqual(vars, test.vars) {
+			t.Fatalf("FAIL: Test %d, host %s: variables mismatch: %v (expected) vs. %v (received)", i, test.host, test.vars, vars)
+		}
+		t.Logf("PASS: Test %d, host %s, parent: %s", i, test.host, h.Parent)
+	}
+	hosts, err := inv.GetHostsByGroup("service_web", true)
+	if err != nil || len(hosts) != 2 {
+		t.Fatalf("FAIL: service_web group mismatch: %v, %v", hosts, err)
+	}
+	expected := []string{
+		"consul node ny-web01 metadata notes skipped, multi-line value",
+		"consul node ny-web01 in sf1 skipped, duplicate name",
+	}
+	if !reflect.DeepEqual(logger.warnings, expected) {
+		t.Fatalf("FAIL: warnings mismatch: %v (expected) vs. %v (received)", expected, logger.warnings)
+	}
+
+	imp = NewImporter(srv.URL, "invalid")
+	if _, err := imp.Import(context.Background()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("FAIL: expected error for invalid token, got: %v", err)
+	}
+	t.Logf("PASS: invalid token rejected")
+}
+
+func TestExport(t *testing.T) {
+	var registered []*registration
+	srv := newTestServer(t, &registered)
+	defer srv.Close()
+	inv := db.NewInventory()
+	if err := inv.LoadFromBytes([]byte("[web]\nweb01 ansible_host=10.0.0.1 ansible_port=2222\n\n[ny:children]\nweb\n")); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	exp := NewExporter(srv.URL, "secret")
+	exp.Datacenter = "ny4"
+	if err := exp.Export(context.Background(), inv); err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	if len(registered) != 1 {
+		t.Fatalf("FAIL: registration count mismatch: 1 (expected) vs. %d (received)", len(registered))
+	}
+	r := registered[0]
+	sort.Strings(r.Service.Tags)
+	if r.Node != "web01" || r.Address != "10.0.0.1" || r.Datacenter != "ny4" || r.NodeMeta["external-node"] != "true" {
+		t.Fatalf("FAIL: node mismatch: %+v", r)
+	}
+	if r.Service.Service != "ansible" || r.Service.Port != 2222 || !reflect.DeepEqual(r.Service.Tags, []string{"ny", "web"}) {
+		t.Fatalf("FAIL: service mismatch: %+v", r.Service)
+	}
+	t.Logf("PASS: host %s registered with tags %v", r.Node, r.Service.Tags)
+
+	exp = NewExporter(srv.URL, "invalid")
+	if err := exp.Export(context.Background(), inv); err == nil {
+		t.Fatalf("FAIL: expected error for invalid token")
+	}
+}
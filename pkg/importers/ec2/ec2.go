@@ -0,0 +1,455 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ec2 imports the instances of AWS EC2 into an Inventory, the way
+// the amazon.aws.aws_ec2 Ansible inventory plugin does.
+package ec2
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"github.com/greenpau/go-ansible-db/pkg/importers"
+)
+
+// apiVersion is the version of the EC2 Query API.
+const apiVersion = "2016-11-15"
+
+// defaultGroup is the group of all of the instances, as in aws_ec2.
+const defaultGroup = "aws_ec2"
+
+// defaultHostnames are the hostnames preferred, unless Importer.Hostnames
+// says otherwise, as in aws_ec2.
+var defaultHostnames = []string{"dns-name", "private-dns-name"}
+
+// KeyedGroup creates a group for each value of the key of the instances,
+// as the keyed_groups of aws_ec2, e.g. the tag_Env_prod group for the key
+// tags.Env and the prefix tag. The key "tags" creates a group per tag.
+// The supported keys are tags, tags.<name>, placement.availability_zone,
+// placement.region, vpc_id, subnet_id, instance_type, image_id,
+// architecture, key_name, and instance_state.name.
+type KeyedGroup struct {
+	Key    string
+	Prefix string
+	// Separator is the separator of the prefix and the value, "_" unless
+	// set.
+	Separator *string
+	// LeadingSeparator, when false, omits the separator of the groups
+	// without a prefix.
+	LeadingSeparator *bool
+	// Parent is the parent group of the groups created.
+	Parent string
+}
+
+// Importer fetches the instances of the regions from EC2.
+type Importer struct {
+	// Regions are the regions of the instances. The AWS_REGION and the
+	// AWS_DEFAULT_REGION environment variables provide the region when
+	// none is set.
+	Regions []string
+	// Filters are the filters of DescribeInstances, e.g.
+	// instance-state-name: [running] or tag:Env: [prod].
+	Filters map[string][]string
+	// KeyedGroups are the groups created from the values of the instances.
+	KeyedGroups []*KeyedGroup
+	// Hostnames are the hostnames of the instances in the order of
+	// preference, i.e. dns-name, private-dns-name, ip-address,
+	// private-ip-address, instance-id, or tag:<name>. The instances without
+	// any of them are skipped.
+	Hostnames   []string
+	Credentials Credentials
+	Client      *http.Client
+	// Endpoint returns the URL of the EC2 API of a region, by default
+	// https://ec2.<region>.amazonaws.com.
+	Endpoint func(region string) string
+	// Logger reports the instances skipped.
+	Logger db.Logger
+}
+
+// NewImporter returns an instance of Importer for the provided regions,
+// with the credentials of the environment, see CredentialsFromEnv.
+func NewImporter(regions ...string) *Importer {
+	return &Importer{
+		Regions:     regions,
+		Credentials: CredentialsFromEnv(),
+		Client:      http.DefaultClient,
+	}
+}
+
+// instance is an instance of DescribeInstances.
+type instance struct {
+	InstanceID       string `xml:"instanceId"`
+	ImageID          string `xml:"imageId"`
+	State            string `xml:"instanceState>name"`
+	PrivateDNSName   string `xml:"privateDnsName"`
+	DNSName          string `xml:"dnsName"`
+	KeyName          string `xml:"keyName"`
+	InstanceType     string `xml:"instanceType"`
+	AvailabilityZone string `xml:"placement>availabilityZone"`
+	SubnetID         string `xml:"subnetId"`
+	VpcID            string `xml:"vpcId"`
+	PrivateIPAddress string `xml:"privateIpAddress"`
+	IPAddress        string `xml:"ipAddress"`
+	Architecture     string `xml:"architecture"`
+	Tags             []struct {
+		Key   string `xml:"key"`
+		Value string `xml:"value"`
+	} `xml:"tagSet>item"`
+
+	region string
+	tags   map[string]string
+}
+
+type describeInstancesResponse struct {
+	Reservations []struct {
+		Instances []*instance `xml:"instancesSet>item"`
+	} `xml:"reservationSet>item"`
+	NextToken string `xml:"nextToken"`
+}
+
+type errorResponse struct {
+	Errors []struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Errors>Error"`
+}
+
+// Import fetches the instances, and returns the Inventory created with the
+// provided options holding them.
+func (i *Importer) Import(ctx context.Context, opts ...db.InventoryOption) (*db.Inventory, error) {
+	b, err := i.INI(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv := db.NewInventory(opts...)
+	if err := inv.LoadFromBytes(b); err != nil {
+		return nil, fmt.Errorf("failed loading ec2 inventory: %s", err)
+	}
+	return inv, nil
+}
+
+// INI fetches the instances, and returns them in the INI inventory
+// format. The instances are members of the aws_ec2 group and of their
+// keyed groups. The instance with more than one group is a member of the
+// group combining them, e.g. aws_ec2-tag_Env_prod, see
+// importers.BuildINI.
+func (i *Importer) INI(ctx context.Context) ([]byte, error) {
+	if err := i.validate(); err != nil {
+		return nil, err
+	}
+	regions := i.Regions
+	if len(regions) == 0 {
+		for _, k := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+			if s := os.Getenv(k); s != "" {
+				regions = []string{s}
+				break
+			}
+		}
+	}
+	if len(regions) == 0 {
+		return nil, fmt.Errorf("ec2 importer requires regions")
+	}
+	hostnames := i.Hostnames
+	if len(hostnames) == 0 {
+		hostnames = defaultHostnames
+	}
+
+	var hosts []*importers.Host
+	parents := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, region := range regions {
+		instances, err := i.fetch(ctx, region)
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range instances {
+			name := preferredHostname(in, hostnames)
+			if name == "" {
+				i.warnf("ec2 instance %s skipped, no hostname", in.InstanceID)
+				continue
+			}
+			if seen[name] {
+				i.warnf("ec2 instance %s skipped, duplicate hostname %s", in.InstanceID, name)
+				continue
+			}
+			seen[name] = true
+			h := &importers.Host{
+				Name:      name,
+				Groups:    []string{defaultGroup},
+				Variables: hostVariables(in),
+			}
+			for _, kg := range i.KeyedGroups {
+				for _, g := range kg.groups(in) {
+					if kg.Parent != "" {
+						parents[g] = appendUnique(parents[g], kg.Parent)
+					}
+					h.Groups = appendUnique(h.Groups, g)
+				}
+			}
+			hosts = append(hosts, h)
+		}
+	}
+	return importers.BuildINI(hosts, parents), nil
+}
+
+// validate checks the hostnames and the keyed groups.
+func (i *Importer) validate() error {
+	for _, s := range i.Hostnames {
+		switch {
+		case s == "dns-name", s == "private-dns-name", s == "ip-address", s == "private-ip-address", s == "instance-id":
+		case strings.HasPrefix(s, "tag:") && len(s) > len("tag:"):
+		default:
+			return fmt.Errorf("unsupported ec2 hostname: %s", s)
+		}
+	}
+	for _, kg := range i.KeyedGroups {
+		if kg.Key == "" {
+			return fmt.Errorf("ec2 keyed group requires key")
+		}
+		if _, err := instanceValues(&instance{}, kg.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch returns the instances of a region, following the pages.
+func (i *Importer) fetch(ctx context.Context, region string) ([]*instance, error) {
+	endpoint := "https://ec2." + region + ".amazonaws.com"
+	if i.Endpoint != nil {
+		endpoint = i.Endpoint(region)
+	}
+	q := url.Values{}
+	q.Set("Action", "DescribeInstances")
+	q.Set("Version", apiVersion)
+	names := make([]string, 0, len(i.Filters))
+	for k := range i.Filters {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for n, k := range names {
+		prefix := "Filter." + strconv.Itoa(n+1)
+		q.Set(prefix+".Name", k)
+		for m, v := range i.Filters[k] {
+			q.Set(prefix+".Value."+strconv.Itoa(m+1), v)
+		}
+	}
+
+	var instances []*instance
+	for {
+		resp, err := i.describeInstances(ctx, endpoint, region, q)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Reservations {
+			for _, in := range r.Instances {
+				in.region = region
+				in.tags = make(map[string]string, len(in.Tags))
+				for _, t := range in.Tags {
+					in.tags[t.Key] = t.Value
+				}
+				instances = append(instances, in)
+			}
+		}
+		if resp.NextToken == "" {
+			return instances, nil
+		}
+		q.Set("NextToken", resp.NextToken)
+	}
+}
+
+func (i *Importer) describeInstances(ctx context.Context, endpoint, region string, q url.Values) (*describeInstancesResponse, error) {
+	u, err := url.Parse(strings.TrimRight(endpoint, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid ec2 endpoint %s: %s", endpoint, err)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	signRequest(req, i.Credentials, region, "ec2", time.Now())
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed describing ec2 instances in %s: %s", region, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed describing ec2 instances in %s: %s", region, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &errorResponse{}
+		if err := xml.Unmarshal(b, e); err == nil && len(e.Errors) > 0 {
+			return nil, fmt.Errorf("failed describing ec2 instances in %s: %s: %s", region, e.Errors[0].Code, e.Errors[0].Message)
+		}
+		return nil, fmt.Errorf("failed describing ec2 instances in %s: %s", region, resp.Status)
+	}
+	r := &describeInstancesResponse{}
+	if err := xml.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("failed decoding ec2 instances in %s: %s", region, err)
+	}
+	return r, nil
+}
+
+// preferredHostname returns the first of the hostnames the instance has.
+func preferredHostname(in *instance, hostnames []string) string {
+	for _, s := range hostnames {
+		var name string
+		switch s {
+		case "dns-name":
+			name = in.DNSName
+		case "private-dns-name":
+			name = in.PrivateDNSName
+		case "ip-address":
+			name = in.IPAddress
+		case "private-ip-address":
+			name = in.PrivateIPAddress
+		case "instance-id":
+			name = in.InstanceID
+		default:
+			name = in.tags[strings.TrimPrefix(s, "tag:")]
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// hostVariables returns the variables of an instance, named as the host
+// variables of aws_ec2, with the nested ones flattened, e.g.
+// placement_availability_zone. The tags are JSON-encoded.
+func hostVariables(in *instance) map[string]string {
+	vars := make(map[string]string)
+	for k, v := range map[string]string{
+		"instance_id":                 in.InstanceID,
+		"image_id":                    in.ImageID,
+		"instance_type":               in.InstanceType,
+		"instance_state_name":         in.State,
+		"architecture":                in.Architecture,
+		"key_name":                    in.KeyName,
+		"vpc_id":                      in.VpcID,
+		"subnet_id":                   in.SubnetID,
+		"private_ip_address":          in.PrivateIPAddress,
+		"private_dns_name":            in.PrivateDNSName,
+		"public_ip_address":           in.IPAddress,
+		"public_dns_name":             in.DNSName,
+		"placement_availability_zone": in.AvailabilityZone,
+		"placement_region":            in.region,
+	} {
+		if v != "" {
+			vars[k] = v
+		}
+	}
+	if len(in.tags) > 0 {
+		if b, err := json.Marshal(in.tags); err == nil {
+			vars["tags"] = string(b)
+		}
+	}
+	return vars
+}
+
+// instanceValues returns the values of a keyed group key of an instance,
+// i.e. a single value, or a "name_value" value per tag for the "tags" key.
+func instanceValues(in *instance, key string) ([]string, error) {
+	var v string
+	switch key {
+	case "tags":
+		var values []string
+		for k, v := range in.tags {
+			if v != "" {
+				k += "_" + v
+			}
+			values = append(values, k)
+		}
+		sort.Strings(values)
+		return values, nil
+	case "placement.availability_zone":
+		v = in.AvailabilityZone
+	case "placement.region":
+		v = in.region
+	case "vpc_id":
+		v = in.VpcID
+	case "subnet_id":
+		v = in.SubnetID
+	case "instance_type":
+		v = in.InstanceType
+	case "image_id":
+		v = in.ImageID
+	case "architecture":
+		v = in.Architecture
+	case "key_name":
+		v = in.KeyName
+	case "instance_state.name":
+		v = in.State
+	default:
+		if !strings.HasPrefix(key, "tags.") || key == "tags." {
+			return nil, fmt.Errorf("unsupported ec2 keyed group key: %s", key)
+		}
+		v = in.tags[strings.TrimPrefix(key, "tags.")]
+	}
+	if v == "" {
+		return nil, nil
+	}
+	return []string{v}, nil
+}
+
+// groups returns the names of the groups of an instance.
+func (kg *KeyedGroup) groups(in *instance) []string {
+	values, _ := instanceValues(in, kg.Key)
+	sep := "_"
+	if kg.Separator != nil {
+		sep = *kg.Separator
+	}
+	var groups []string
+	for _, v := range values {
+		name := kg.Prefix + sep + v
+		if kg.Prefix == "" && kg.LeadingSeparator != nil && !*kg.LeadingSeparator {
+			name = v
+		}
+		groups = append(groups, importers.SanitizeGroupName(name))
+	}
+	return groups
+}
+
+func appendUnique(arr []string, s string) []string {
+	for _, v := range arr {
+		if v == s {
+			return arr
+		}
+	}
+	return append(arr, s)
+}
+
+func (i *Importer) warnf(format string, args ...interface{}) {
+	if i.Logger != nil {
+		i.Logger.Warnf(format, args...)
+	}
+}
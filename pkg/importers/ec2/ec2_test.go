@@ -0,0 +1,175 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testLogger struct {
+	warnings []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {}
+
+func (l *testLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+const testInstanceTemplate = `<item>
+  <instanceId>%s</instanceId>
+  <instanceState><name>running</name></instanceState>
+  <privateDnsName>%s</privateDnsName>
+  <dnsName>%s</dnsName>
+  <instanceType>t3.micro</instanceType>
+  <placement><availabilityZone>%s</availabilityZone></placement>
+  <vpcId>vpc-1</vpcId>
+  <privateIpAddress>%s</privateIpAddress>
+  <tagSet>%s</tagSet>
+</item>`
+
+func testInstance(id, privateDNS, dns, zone, ip, tags string) string {
+	return fmt.Sprintf(testInstanceTemplate, id, privateDNS, dns, zone, ip, tags)
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "SignedHeaders=host;x-amz-date") {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `<Response><Errors><Error><Code>AuthFailure</Code><Message>invalid signature</Message></Error></Errors></Response>`)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("Action") != "DescribeInstances" || q.Get("Filter.1.Name") != "instance-state-name" || q.Get("Filter.1.Value.1") != "running" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/us-east-1") && q.Get("NextToken") == "":
+			fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet>%s%s</instancesSet></item></reservationSet><nextToken>page2</nextToken></DescribeInstancesResponse>`,
+				testInstance("i-1", "ip-10-0-0-1.ec2.internal", "ec2-1.compute.amazonaws.com", "us-east-1a", "10.0.0.1",
+					`<item><key>Env</key><value>prod</value></item><item><key>Name</key><value>web "01"</value></item>`),
+				testInstance("i-2", "", "", "us-east-1a", "", ""),
+			)
+		case strings.HasPrefix(r.URL.Path, "/us-east-1"):
+			fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet>%s</instancesSet></item></reservationSet></DescribeInstancesResponse>`,
+				testInstance("i-3", "ip-10-0-0-3.ec2.internal", "", "us-east-1b", "10.0.0.3", `<item><key>Env</key><value>dev</value></item>`),
+			)
+		case strings.HasPrefix(r.URL.Path, "/eu-west-1"):
+			fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet>%s</instancesSet></item></reservationSet></DescribeInstancesResponse>`,
+				testInstance("i-4", "ip-10-0-0-3.ec2.internal", "", "eu-west-1a", "10.1.0.1", ""),
+			)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestImport(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+	logger := &testLogger{}
+	noSeparator := false
+	imp := NewImporter("us-east-1", "eu-west-1")
+	imp.Credentials = Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	imp.Endpoint = func(region string) string { return srv.URL + "/" + region }
+	imp.Filters = map[string][]string{"instance-state-name": {"running"}}
+	imp.KeyedGroups = []*KeyedGroup{
+		{Key: "tags.Env", Prefix: "env"},
+		{Key: "placement.availability_zone", LeadingSeparator: &noSeparator, Parent: "zones"},
+	}
+	imp.Logger = logger
+	inv, err := imp.Import(context.Background())
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	for i, test := range []struct {
+		host   string
+		parent string
+		groups []string
+		vars   map[string]string
+	}{
+		{
+			host:   "ec2-1.compute.amazonaws.com",
+			parent: "aws_ec2-env_prod-us_east_1a",
+			groups: []string{"aws_ec2", "env_prod", "us_east_1a", "zones"},
+			vars: map[string]string{
+				"instance_id":         "i-1",
+				"tags":                `{"Env":"prod","Name":"web \"01\""}`,
+				"private_ip_address":  "10.0.0.1",
+				"instance_state_name": "running",
+			},
+		},
+		{
+			host:   "ip-10-0-0-3.ec2.internal",
+			parent: "aws_ec2-env_dev-us_east_1b",
+			groups: []string{"aws_ec2", "env_dev", "us_east_1b", "zones"},
+			vars:   map[string]string{"instance_id": "i-3", "placement_region": "us-east-1"},
+		},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, host %s: %s", i, test.host, err)
+		}
+		if h.Parent != test.parent {
+			t.Fatalf("FAIL: Test %d, host %s: parent mismatch: %s (expected) vs. %s (received)", i, test.host, test.parent, h.Parent)
+		}
+		for _, g := range test.groups {
+			hosts, err := inv.GetHostsByGroup(g, true)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, host %s: group %s: %s", i, test.host, g, err)
+			}
+			found := false
+			for _, gh := range hosts {
+				found = found || gh.Name == test.host
+			}
+			if !found {
+				t.Fatalf("FAIL: Test %d, host %s: not a member of group %s", i, test.host, g)
+			}
+		}
+		for k, v := range test.vars {
+			if h.Variables[k] != v {
+				t.Fatalf("FAIL: Test %d, host %s: variable %s mismatch: %q (expected) vs. %q (received)", i, test.host, k, v, h.Variables[k])
+			}
+		}
+		t.Logf("PASS: Test %d, host %s, parent: %s", i, test.host, h.Parent)
+	}
+	if inv.Size() != 2 {
+		t.Fatalf("FAIL: host count mismatch: 2 (expected) vs. %d (received)", inv.Size())
+	}
+	expected := []string{
+		"ec2 instance i-2 skipped, no hostname",
+		"ec2 instance i-4 skipped, duplicate hostname ip-10-0-0-3.ec2.internal",
+	}
+	if !reflect.DeepEqual(logger.warnings, expected) {
+		t.Fatalf("FAIL: warnings mismatch: %v (expected) vs. %v (received)", expected, logger.warnings)
+	}
+
+	imp.Credentials = Credentials{AccessKeyID: "invalid", SecretAccessKey: "secret"}
+	if _, err := imp.Import(context.Background()); err == nil || !strings.Contains(err.Error(), "AuthFailure") {
+		t.Fatalf("FAIL: expected error for invalid credentials, got: %v", err)
+	}
+	imp.KeyedGroups = []*KeyedGroup{{Key: "launch_time"}}
+	if _, err := imp.Import(context.Background()); err == nil {
+		t.Fatalf("FAIL: expected error for unsupported keyed group key")
+	}
+	t.Logf("PASS: invalid credentials and keyed groups rejected")
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package importers holds the helpers of the importers building an
+// Inventory from a source of truth, e.g. NetBox or AWS EC2.
+package importers
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var groupNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// SanitizeGroupName replaces the characters of a group name other than
+// letters, digits, and underscores with underscores, as Ansible does.
+func SanitizeGroupName(s string) string {
+	return groupNameSanitizer.ReplaceAllString(s, "_")
+}
+
+// Host is a host found by an importer, with its groups and variables.
+type Host struct {
+	Name      string
+	Groups    []string
+	Variables map[string]string
+}
+
+// BuildINI returns the hosts in the INI inventory format. A host has a
+// single parent group in an Inventory, so the host with more than one
+// group is a member of the group combining them, e.g. a-b, a child of
+// each of them. The parents hold the parent groups of the groups, if any.
+// The group names are expected to be sanitized, see SanitizeGroupName.
+func BuildINI(hosts []*Host, parents map[string][]string) []byte {
+	var groups []string
+	known := make(map[string]bool)
+	addGroup := func(g string) {
+		if !known[g] {
+			known[g] = true
+			groups = append(groups, g)
+		}
+	}
+	members := make(map[string][]*Host)
+	children := make(map[string][]string)
+	addChild := func(parent, child string) {
+		for _, c := range children[parent] {
+			if c == child {
+				return
+			}
+		}
+		children[parent] = append(children[parent], child)
+	}
+	var ungrouped []*Host
+	for _, h := range hosts {
+		if len(h.Groups) == 0 {
+			ungrouped = append(ungrouped, h)
+			continue
+		}
+		for _, g := range h.Groups {
+			addGroup(g)
+		}
+		parent := strings.Join(h.Groups, "-")
+		if len(h.Groups) > 1 {
+			for _, g := range h.Groups {
+				addChild(g, parent)
+			}
+		}
+		addGroup(parent)
+		members[parent] = append(members[parent], h)
+	}
+	for _, g := range append([]string{}, groups...) {
+		for _, p := range parents[g] {
+			addGroup(p)
+			addChild(p, g)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, h := range ungrouped {
+		buf.WriteString(hostLine(h) + "\n")
+	}
+	for _, g := range groups {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "[%s]\n", g)
+		for _, h := range members[g] {
+			buf.WriteString(hostLine(h) + "\n")
+		}
+		if len(children[g]) > 0 {
+			fmt.Fprintf(&buf, "\n[%s:children]\n", g)
+			for _, c := range children[g] {
+				buf.WriteString(c + "\n")
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// hostLine returns the INI line of a host, with its variables quoted.
+func hostLine(h *Host) string {
+	keys := make([]string, 0, len(h.Variables))
+	for k := range h.Variables {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	line := h.Name
+	for _, k := range keys {
+		line += " " + k + `="` + r.Replace(h.Variables[k]) + `"`
+	}
+	return line
+}
@@ -0,0 +1,260 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netbox imports the devices and the virtual machines of NetBox,
+// i.e. its REST API, into an Inventory.
+package netbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"github.com/greenpau/go-ansible-db/pkg/importers"
+)
+
+// The API endpoints of the devices and the virtual machines.
+const (
+	devicesPath         = "/api/dcim/devices/"
+	virtualMachinesPath = "/api/virtualization/virtual-machines/"
+)
+
+// defaultPageSize is the number of objects fetched per request, unless
+// Importer.PageSize says otherwise.
+const defaultPageSize = 100
+
+// Importer fetches the devices and the virtual machines from NetBox. As
+// in the netbox.netbox.nb_inventory Ansible plugin, the sites, the roles,
+// and the tenants of the hosts become the groups, e.g. sites_ny4,
+// device_roles_switch, and tenants_acme, the primary IP address of a host
+// its ansible_host variable, and its custom fields its variables.
+type Importer struct {
+	// URL is the address of NetBox, e.g. https://netbox.example.com.
+	URL string
+	// Token is the API token of NetBox.
+	Token  string
+	Client *http.Client
+	// PageSize is the number of objects fetched per request.
+	PageSize int
+	// Query holds the filters of the devices and the virtual machines,
+	// e.g. status=active.
+	Query url.Values
+	// SkipVirtualMachines makes the Importer fetch the devices only.
+	SkipVirtualMachines bool
+	// Logger reports the objects and the variables skipped.
+	Logger db.Logger
+}
+
+// NewImporter returns an instance of Importer.
+func NewImporter(addr, token string) *Importer {
+	return &Importer{
+		URL:    addr,
+		Token:  token,
+		Client: http.DefaultClient,
+	}
+}
+
+// object is a device or a virtual machine of NetBox. The role of a device
+// is in "device_role" before NetBox 3.6.
+type object struct {
+	Name         string                 `json:"name"`
+	Site         *reference             `json:"site"`
+	Role         *reference             `json:"role"`
+	DeviceRole   *reference             `json:"device_role"`
+	Tenant       *reference             `json:"tenant"`
+	PrimaryIP    *ipAddress             `json:"primary_ip"`
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+type reference struct {
+	Slug string `json:"slug"`
+}
+
+type ipAddress struct {
+	Address string `json:"address"`
+}
+
+type page struct {
+	Next    string    `json:"next"`
+	Results []*object `json:"results"`
+}
+
+// Import fetches the devices and the virtual machines, and returns the
+// Inventory created with the provided options holding them.
+func (i *Importer) Import(ctx context.Context, opts ...db.InventoryOption) (*db.Inventory, error) {
+	b, err := i.INI(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv := db.NewInventory(opts...)
+	if err := inv.LoadFromBytes(b); err != nil {
+		return nil, fmt.Errorf("failed loading netbox inventory: %s", err)
+	}
+	return inv, nil
+}
+
+// INI fetches the devices and the virtual machines, and returns them in
+// the INI inventory format. The host with more than one group is a member
+// of the group combining them, e.g. sites_ny4-device_roles_switch, see
+// importers.BuildINI.
+func (i *Importer) INI(ctx context.Context) ([]byte, error) {
+	paths := []string{devicesPath}
+	if !i.SkipVirtualMachines {
+		paths = append(paths, virtualMachinesPath)
+	}
+	var hosts []*importers.Host
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		objects, err := i.fetch(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			if o.Name == "" {
+				i.warnf("netbox object without name skipped")
+				continue
+			}
+			if seen[o.Name] {
+				i.warnf("netbox host %s skipped, duplicate name", o.Name)
+				continue
+			}
+			seen[o.Name] = true
+			hosts = append(hosts, i.newHost(o))
+		}
+	}
+	return importers.BuildINI(hosts, nil), nil
+}
+
+// fetch returns the objects of an endpoint, following the pages.
+func (i *Importer) fetch(ctx context.Context, p string) ([]*object, error) {
+	u, err := url.Parse(strings.TrimRight(i.URL, "/") + p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid netbox url %s: %s", i.URL, err)
+	}
+	q := url.Values{}
+	for k, v := range i.Query {
+		q[k] = append([]string{}, v...)
+	}
+	size := i.PageSize
+	if size < 1 {
+		size = defaultPageSize
+	}
+	q.Set("limit", strconv.Itoa(size))
+	u.RawQuery = q.Encode()
+
+	var objects []*object
+	next := u.String()
+	for next != "" {
+		pg, err := i.fetchPage(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, pg.Results...)
+		next = pg.Next
+	}
+	return objects, nil
+}
+
+func (i *Importer) fetchPage(ctx context.Context, u string) (*page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if i.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.Token)
+	}
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching %s: %s", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed fetching %s: %s", u, resp.Status)
+	}
+	pg := &page{}
+	if err := json.NewDecoder(resp.Body).Decode(pg); err != nil {
+		return nil, fmt.Errorf("failed decoding %s: %s", u, err)
+	}
+	return pg, nil
+}
+
+// newHost returns the host of a NetBox object.
+func (i *Importer) newHost(o *object) *importers.Host {
+	h := &importers.Host{Name: o.Name, Variables: make(map[string]string)}
+	role := o.Role
+	if role == nil {
+		role = o.DeviceRole
+	}
+	for _, g := range []struct {
+		prefix string
+		ref    *reference
+	}{
+		{"sites_", o.Site},
+		{"device_roles_", role},
+		{"tenants_", o.Tenant},
+	} {
+		if g.ref == nil || g.ref.Slug == "" {
+			continue
+		}
+		h.Groups = append(h.Groups, importers.SanitizeGroupName(g.prefix+g.ref.Slug))
+	}
+	if o.PrimaryIP != nil && o.PrimaryIP.Address != "" {
+		h.Variables["ansible_host"] = strings.SplitN(o.PrimaryIP.Address, "/", 2)[0]
+	}
+	for k, v := range o.CustomFields {
+		s, ok := customFieldValue(v)
+		if !ok {
+			continue
+		}
+		if strings.ContainsAny(s, "\r\n") {
+			i.warnf("netbox host %s custom field %s skipped, multi-line value", o.Name, k)
+			continue
+		}
+		h.Variables[k] = s
+	}
+	return h
+}
+
+// customFieldValue returns the value of a custom field as a string, i.e.
+// the JSON encoding of the values other than strings. The empty custom
+// fields are skipped.
+func customFieldValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, v != ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+func (i *Importer) warnf(format string, args ...interface{}) {
+	if i.Logger != nil {
+		i.Logger.Warnf(format, args...)
+	}
+}
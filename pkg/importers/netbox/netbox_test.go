@@ -0,0 +1,170 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testLogger struct {
+	warnings []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {}
+
+func (l *testLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			http.Error(w, "invalid token", http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("status") != "active" {
+			t.Errorf("query filter not sent: %s", r.URL.RawQuery)
+		}
+		switch {
+		case r.URL.Path == devicesPath && r.URL.Query().Get("offset") == "":
+			fmt.Fprintf(w, `{"count": 3, "next": "%s%s?limit=2&offset=2&status=active", "results": [
+				{"name": "ny-sw01", "site": {"slug": "ny4"}, "role": {"slug": "access-switch"}, "tenant": {"slug": "acme"},
+				 "primary_ip": {"address": "10.0.0.1/24"}, "custom_fields": {"os": "cisco_nxos", "rack_unit": 12, "notes": "a\nb", "owner": null}},
+				{"name": "ny-sw02", "site": {"slug": "ny4"}, "device_role": {"slug": "access-switch"}, "tenant": null,
+				 "primary_ip": {"address": "10.0.0.2/24"}, "custom_fields": {"contact": "Paul \"Ops\" Greenberg"}}
+			]}`, srv.URL, devicesPath)
+		case r.URL.Path == devicesPath:
+			fmt.Fprint(w, `{"count": 3, "next": null, "results": [
+				{"name": null, "site": {"slug": "ny4"}},
+				{"name": "ny-fw01", "site": {"slug": "ny4"}, "role": {"slug": "firewall"}, "tenant": {"slug": "acme"}}
+			]}`)
+		case r.URL.Path == virtualMachinesPath:
+			fmt.Fprint(w, `{"count": 3, "next": null, "results": [
+				{"name": "app01", "tenant": {"slug": "acme"}, "primary_ip": {"address": "2001:db8::10/64"}},
+				{"name": "ny-sw01"},
+				{"name": "tmp01"}
+			]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv
+}
+
+func TestImport(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+	logger := &testLogger{}
+	imp := NewImporter(srv.URL+"/", "secret")
+	imp.PageSize = 2
+	imp.Query = url.Values{"status": []string{"active"}}
+	imp.Logger = logger
+	inv, err := imp.Import(context.Background())
+	if err != nil {
+		t.Fatalf("FAIL: unexpected error: %s", err)
+	}
+	for i, test := range []struct {
+		host   string
+		parent string
+		groups []string
+		vars   map[string]string
+	}{
+		{
+			host:   "ny-sw01",
+			parent: "sites_ny4-device_roles_access_switch-tenants_acme",
+			groups: []string{"device_roles_access_switch", "sites_ny4", "tenants_acme"},
+			vars:   map[string]string{"ansible_host": "10.0.0.1", "os": "cisco_nxos", "rack_unit": "12"},
+		},
+		{
+			host:   "ny-sw02",
+			parent: "sites_ny4-device_roles_access_switch",
+			groups: []string{"device_roles_access_switch", "sites_ny4"},
+			vars:   map[string]string{"ansible_host": "10.0.0.2", "contact": `Paul "Ops" Greenberg`},
+		},
+		{
+			host:   "ny-fw01",
+			parent: "sites_ny4-device_roles_firewall-tenants_acme",
+			groups: []string{"device_roles_firewall", "sites_ny4", "tenants_acme"},
+			vars:   map[string]string{},
+		},
+		{
+			host:   "app01",
+			parent: "tenants_acme",
+			groups: []string{"tenants_acme"},
+			vars:   map[string]string{"ansible_host": "2001:db8::10"},
+		},
+		{
+			host:   "tmp01",
+			parent: "ungrouped",
+			vars:   map[string]string{},
+		},
+	} {
+		h, err := inv.GetHost(test.host)
+		if err != nil {
+			t.Fatalf("FAIL: Test %d, host %s: %s", i, test.host, err)
+		}
+		if h.Parent != test.parent {
+			t.Fatalf("FAIL: Test %d, host %s: parent mismatch: %s (expected) vs. %s (received)", i, test.host, test.parent, h.Parent)
+		}
+		for _, g := range test.groups {
+			hosts, err := inv.GetHostsByGroup(g, true)
+			if err != nil {
+				t.Fatalf("FAIL: Test %d, host %s: group %s: %s", i, test.host, g, err)
+			}
+			found := false
+			for _, gh := range hosts {
+				found = found || gh.Name == test.host
+			}
+			if !found {
+				t.Fatalf("FAIL: Test %d, host %s: not a member of group %s", i, test.host, g)
+			}
+		}
+		vars := make(map[string]string)
+		for k, v := range h.Variables {
+			if strings.HasPrefix(h.VariableSources[k], "host ") {
+				vars[k] = v
+			}
+		}
+		if !reflect.DeepEqual(vars, test.vars) {
+			t.Fatalf("FAIL: Test %d, host %s: variables mismatch: %v (expected) vs. %v (received)", i, test.host, test.vars, vars)
+		}
+		t.Logf("PASS: Test %d, host %s, parent: %s, variables: %v", i, test.host, h.Parent, vars)
+	}
+	if inv.Size() != 5 {
+		t.Fatalf("FAIL: host count mismatch: 5 (expected) vs. %d (received)", inv.Size())
+	}
+	expected := []string{
+		"netbox host ny-sw01 custom field notes skipped, multi-line value",
+		"netbox object without name skipped",
+		"netbox host ny-sw01 skipped, duplicate name",
+	}
+	if !reflect.DeepEqual(logger.warnings, expected) {
+		t.Fatalf("FAIL: warnings mismatch: %v (expected) vs. %v (received)", expected, logger.warnings)
+	}
+
+	imp = NewImporter(srv.URL, "invalid")
+	if _, err := imp.Import(context.Background()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("FAIL: expected error for invalid token, got: %v", err)
+	}
+	t.Logf("PASS: invalid token rejected")
+}
@@ -0,0 +1,404 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pb converts inventory and vault data to and from the protocol
+// buffers wire format described by ansibledb.proto.
+package pb
+
+import (
+	"fmt"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+)
+
+// fieldFunc decodes a single field of a message. It returns false when the
+// field is unknown and must be skipped.
+type fieldFunc func(d *decoder, field, wireType int) (bool, error)
+
+func decodeMessage(b []byte, fn fieldFunc) error {
+	d := &decoder{b: b}
+	for !d.done() {
+		field, wireType, err := d.next()
+		if err != nil {
+			return err
+		}
+		known, err := fn(d, field, wireType)
+		if err != nil {
+			return fmt.Errorf("field %d: %s", field, err)
+		}
+		if known {
+			continue
+		}
+		if err := d.skip(wireType); err != nil {
+			return fmt.Errorf("field %d: %s", field, err)
+		}
+	}
+	return nil
+}
+
+// MarshalHost encodes an InventoryHost as the InventoryHost message.
+func MarshalHost(h *db.InventoryHost) []byte {
+	e := &encoder{}
+	e.string(1, h.Name)
+	e.string(2, h.Parent)
+	e.stringMap(3, h.Variables)
+	e.strings(4, h.Groups)
+	e.strings(5, h.GroupChains)
+	e.bool(6, h.Implicit)
+	e.stringSet(7, h.Templated)
+	e.strings(8, h.Tags)
+	e.bool(9, h.Ephemeral)
+	e.stringMap(10, h.VariableSources)
+	e.strings(11, h.ExtraParents)
+	return e.b
+}
+
+// UnmarshalHost decodes the InventoryHost message.
+func UnmarshalHost(b []byte) (*db.InventoryHost, error) {
+	h := &db.InventoryHost{
+		Variables: make(map[string]string),
+	}
+	err := decodeMessage(b, func(d *decoder, field, wireType int) (bool, error) {
+		var err error
+		var s string
+		var v uint64
+		switch {
+		case field == 1 && wireType == wireBytes:
+			h.Name, err = d.string()
+		case field == 2 && wireType == wireBytes:
+			h.Parent, err = d.string()
+		case field == 3 && wireType == wireBytes:
+			err = d.stringMapEntry(h.Variables)
+		case field == 4 && wireType == wireBytes:
+			s, err = d.string()
+			h.Groups = append(h.Groups, s)
+		case field == 5 && wireType == wireBytes:
+			s, err = d.string()
+			h.GroupChains = append(h.GroupChains, s)
+		case field == 6 && wireType == wireVarint:
+			v, err = d.varint()
+			h.Implicit = v != 0
+		case field == 7 && wireType == wireBytes:
+			s, err = d.string()
+			if h.Templated == nil {
+				h.Templated = make(map[string]bool)
+			}
+			h.Templated[s] = true
+		case field == 8 && wireType == wireBytes:
+			s, err = d.string()
+			h.Tags = append(h.Tags, s)
+		case field == 9 && wireType == wireVarint:
+			v, err = d.varint()
+			h.Ephemeral = v != 0
+		case field == 10 && wireType == wireBytes:
+			if h.VariableSources == nil {
+				h.VariableSources = make(map[string]string)
+			}
+			err = d.stringMapEntry(h.VariableSources)
+		case field == 11 && wireType == wireBytes:
+			s, err = d.string()
+			h.ExtraParents = append(h.ExtraParents, s)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding inventory host: %s", err)
+	}
+	return h, nil
+}
+
+// MarshalGroup encodes an InventoryGroup as the InventoryGroup message.
+func MarshalGroup(g *db.InventoryGroup) []byte {
+	e := &encoder{}
+	e.string(1, g.Name)
+	e.strings(2, g.Ancestors)
+	e.stringMap(3, g.Variables)
+	counters := &encoder{}
+	counters.uint64(1, g.Counters.Hosts)
+	counters.uint64(2, g.Counters.Groups)
+	if len(counters.b) > 0 {
+		e.rawBytes(4, counters.b)
+	}
+	e.stringSet(5, g.Templated)
+	e.bool(6, g.Ephemeral)
+	e.stringMap(7, g.VariableSources)
+	return e.b
+}
+
+// UnmarshalGroup decodes the InventoryGroup message. The returned group is
+// not attached to any Inventory.
+func UnmarshalGroup(b []byte) (*db.InventoryGroup, error) {
+	g := &db.InventoryGroup{
+		Variables: make(map[string]string),
+	}
+	err := decodeMessage(b, func(d *decoder, field, wireType int) (bool, error) {
+		var err error
+		var s string
+		var counters []byte
+		switch {
+		case field == 1 && wireType == wireBytes:
+			g.Name, err = d.string()
+		case field == 2 && wireType == wireBytes:
+			s, err = d.string()
+			g.Ancestors = append(g.Ancestors, s)
+		case field == 3 && wireType == wireBytes:
+			err = d.stringMapEntry(g.Variables)
+		case field == 4 && wireType == wireBytes:
+			counters, err = d.bytes()
+			if err != nil {
+				return true, err
+			}
+			err = decodeMessage(counters, func(d *decoder, field, wireType int) (bool, error) {
+				var err error
+				switch {
+				case field == 1 && wireType == wireVarint:
+					g.Counters.Hosts, err = d.varint()
+				case field == 2 && wireType == wireVarint:
+					g.Counters.Groups, err = d.varint()
+				default:
+					return false, nil
+				}
+				return true, err
+			})
+		case field == 5 && wireType == wireBytes:
+			s, err = d.string()
+			if g.Templated == nil {
+				g.Templated = make(map[string]bool)
+			}
+			g.Templated[s] = true
+		case field == 6 && wireType == wireVarint:
+			var v uint64
+			v, err = d.varint()
+			g.Ephemeral = v != 0
+		case field == 7 && wireType == wireBytes:
+			if g.VariableSources == nil {
+				g.VariableSources = make(map[string]string)
+			}
+			err = d.stringMapEntry(g.VariableSources)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding inventory group: %s", err)
+	}
+	return g, nil
+}
+
+// MarshalInventory encodes an Inventory as the Inventory message.
+func MarshalInventory(inv *db.Inventory) []byte {
+	e := &encoder{}
+	// The hosts failing to resolve are reported by GetHost.
+	inv.Precompute()
+	for _, h := range inv.Hosts {
+		e.rawBytes(1, MarshalHost(h))
+	}
+	for _, g := range inv.Groups {
+		e.rawBytes(2, MarshalGroup(g))
+	}
+	return e.b
+}
+
+// UnmarshalInventory decodes the Inventory message.
+func UnmarshalInventory(b []byte) (*db.Inventory, error) {
+	hosts := []*db.InventoryHost{}
+	groups := []*db.InventoryGroup{}
+	err := decodeMessage(b, func(d *decoder, field, wireType int) (bool, error) {
+		if wireType != wireBytes || (field != 1 && field != 2) {
+			return false, nil
+		}
+		msg, err := d.bytes()
+		if err != nil {
+			return true, err
+		}
+		if field == 1 {
+			h, err := UnmarshalHost(msg)
+			if err != nil {
+				return true, err
+			}
+			hosts = append(hosts, h)
+			return true, nil
+		}
+		g, err := UnmarshalGroup(msg)
+		if err != nil {
+			return true, err
+		}
+		groups = append(groups, g)
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding inventory: %s", err)
+	}
+
+	inv := db.NewInventory()
+	for _, g := range groups {
+		if g.Name != "all" {
+			for _, a := range g.Ancestors {
+				if err := inv.AddGroup(g.Name, a); err != nil {
+					return nil, err
+				}
+			}
+		}
+		ig, err := inv.GetGroup(g.Name)
+		if err != nil {
+			return nil, err
+		}
+		ig.Ancestors = g.Ancestors
+		ig.Variables = g.Variables
+		ig.Counters = g.Counters
+		ig.Templated = g.Templated
+		ig.Ephemeral = g.Ephemeral
+		ig.VariableSources = g.VariableSources
+	}
+	linkChildGroups(inv)
+	for _, h := range hosts {
+		if err := inv.AddHost(h.Name, h.Parent); err != nil {
+			return nil, err
+		}
+		ih, err := inv.GetHost(h.Name)
+		if err != nil {
+			return nil, err
+		}
+		*ih = *h
+	}
+	return inv, nil
+}
+
+// linkChildGroups sets the children of the groups from their parents, in
+// the order of the groups, as the Inventory does once the groups are
+// parsed. The children are not encoded.
+func linkChildGroups(inv *db.Inventory) {
+	groups := make(map[string]*db.InventoryGroup, len(inv.Groups))
+	for _, g := range inv.Groups {
+		g.Children = nil
+		groups[g.Name] = g
+	}
+	for _, g := range inv.Groups {
+		for _, a := range g.Ancestors {
+			if pg, exists := groups[a]; exists && a != g.Name {
+				pg.Children = append(pg.Children, g.Name)
+			}
+		}
+	}
+}
+
+// MarshalCredential encodes a VaultCredential as the VaultCredential
+// message.
+func MarshalCredential(c *db.VaultCredential) []byte {
+	e := &encoder{}
+	e.string(1, c.Description)
+	e.string(2, c.Regex)
+	e.string(3, c.Username)
+	e.string(4, c.Password)
+	e.string(5, c.EnabledPassword)
+	e.int64(6, int64(c.Priority))
+	e.bool(7, c.Default)
+	e.string(8, c.Group)
+	e.string(9, c.GroupRegex)
+	e.string(10, c.PrivateKey)
+	e.string(11, c.PrivateKeyFile)
+	e.string(12, c.Passphrase)
+	e.int64(13, int64(c.Port))
+	e.string(14, c.BecomeMethod)
+	e.string(15, c.BecomePassword)
+	return e.b
+}
+
+// UnmarshalCredential decodes the VaultCredential message.
+func UnmarshalCredential(b []byte) (*db.VaultCredential, error) {
+	c := &db.VaultCredential{}
+	err := decodeMessage(b, func(d *decoder, field, wireType int) (bool, error) {
+		var err error
+		var v uint64
+		switch {
+		case field == 1 && wireType == wireBytes:
+			c.Description, err = d.string()
+		case field == 2 && wireType == wireBytes:
+			c.Regex, err = d.string()
+		case field == 3 && wireType == wireBytes:
+			c.Username, err = d.string()
+		case field == 4 && wireType == wireBytes:
+			c.Password, err = d.string()
+		case field == 5 && wireType == wireBytes:
+			c.EnabledPassword, err = d.string()
+		case field == 6 && wireType == wireVarint:
+			v, err = d.varint()
+			c.Priority = int(int64(v))
+		case field == 7 && wireType == wireVarint:
+			v, err = d.varint()
+			c.Default = v != 0
+		case field == 8 && wireType == wireBytes:
+			c.Group, err = d.string()
+		case field == 9 && wireType == wireBytes:
+			c.GroupRegex, err = d.string()
+		case field == 10 && wireType == wireBytes:
+			c.PrivateKey, err = d.string()
+		case field == 11 && wireType == wireBytes:
+			c.PrivateKeyFile, err = d.string()
+		case field == 12 && wireType == wireBytes:
+			c.Passphrase, err = d.string()
+		case field == 13 && wireType == wireVarint:
+			v, err = d.varint()
+			c.Port = int(int64(v))
+		case field == 14 && wireType == wireBytes:
+			c.BecomeMethod, err = d.string()
+		case field == 15 && wireType == wireBytes:
+			c.BecomePassword, err = d.string()
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding vault credential: %s", err)
+	}
+	return c, nil
+}
+
+// MarshalCredentials encodes a list of VaultCredential instances as the
+// VaultCredentials message.
+func MarshalCredentials(creds []*db.VaultCredential) []byte {
+	e := &encoder{}
+	for _, c := range creds {
+		e.rawBytes(1, MarshalCredential(c))
+	}
+	return e.b
+}
+
+// UnmarshalCredentials decodes the VaultCredentials message.
+func UnmarshalCredentials(b []byte) ([]*db.VaultCredential, error) {
+	creds := []*db.VaultCredential{}
+	err := decodeMessage(b, func(d *decoder, field, wireType int) (bool, error) {
+		if field != 1 || wireType != wireBytes {
+			return false, nil
+		}
+		msg, err := d.bytes()
+		if err != nil {
+			return true, err
+		}
+		c, err := UnmarshalCredential(msg)
+		if err != nil {
+			return true, err
+		}
+		creds = append(creds, c)
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding vault credentials: %s", err)
+	}
+	return creds, nil
+}
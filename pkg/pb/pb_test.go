@@ -0,0 +1,99 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+)
+
+func TestInventory(t *testing.T) {
+	inv := db.NewInventory()
+	if err := inv.LoadFromFile("../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	b := MarshalInventory(inv)
+	decoded, err := UnmarshalInventory(b)
+	if err != nil {
+		t.Fatalf("error decoding inventory: %s", err)
+	}
+	if decoded.Size() != inv.Size() || len(decoded.Groups) != len(inv.Groups) {
+		t.Fatalf("inventory size mismatch: %d/%d (expected) vs. %d/%d (received)",
+			inv.Size(), len(inv.Groups), decoded.Size(), len(decoded.Groups))
+	}
+	for _, h := range inv.Hosts {
+		dh, err := decoded.GetHost(h.Name)
+		if err != nil {
+			t.Fatalf("error getting host %s: %s", h.Name, err)
+		}
+		if !reflect.DeepEqual(h, dh) {
+			t.Fatalf("host %s mismatch: %v (expected) vs. %v (received)", h.Name, h, dh)
+		}
+	}
+	for _, g := range inv.Groups {
+		dg, err := decoded.GetGroup(g.Name)
+		if err != nil {
+			t.Fatalf("error getting group %s: %s", g.Name, err)
+		}
+		if !reflect.DeepEqual(g.Ancestors, dg.Ancestors) || !reflect.DeepEqual(g.Variables, dg.Variables) || g.Counters != dg.Counters {
+			t.Fatalf("group %s mismatch: %v (expected) vs. %v (received)", g.Name, g, dg)
+		}
+		if !reflect.DeepEqual(g.Children, dg.Children) {
+			t.Fatalf("group %s children mismatch: %v (expected) vs. %v (received)", g.Name, g.Children, dg.Children)
+		}
+		descendants, err := inv.GetDescendantGroups(g.Name)
+		if err != nil {
+			t.Fatalf("error getting descendants of group %s: %s", g.Name, err)
+		}
+		decodedDescendants, err := decoded.GetDescendantGroups(g.Name)
+		if err != nil {
+			t.Fatalf("error getting descendants of decoded group %s: %s", g.Name, err)
+		}
+		if !reflect.DeepEqual(descendants, decodedDescendants) {
+			t.Fatalf("group %s descendants mismatch: %v (expected) vs. %v (received)", g.Name, descendants, decodedDescendants)
+		}
+	}
+	if !bytes.Equal(b, MarshalInventory(decoded)) {
+		t.Fatalf("inventory encoding is not deterministic")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	creds := []*db.VaultCredential{
+		{Regex: "ny-sw0[1-9]", Username: "admin", Password: "cisco", EnabledPassword: "cisco", Priority: 10, Description: "NY"},
+		{Group: "ny", GroupRegex: "^ny-", Username: "netops", Priority: 5},
+		{Regex: "^srv", Username: "deploy", PrivateKeyFile: "~/.ssh/id_ed25519", Passphrase: "s3cret", Port: 2222, BecomeMethod: "sudo", BecomePassword: "sudo123"},
+		{Default: true, Username: "root", Password: "root123", Priority: -1},
+	}
+	decoded, err := UnmarshalCredentials(MarshalCredentials(creds))
+	if err != nil {
+		t.Fatalf("error decoding credentials: %s", err)
+	}
+	if !reflect.DeepEqual(creds, decoded) {
+		t.Fatalf("credentials mismatch: %v (expected) vs. %v (received)", creds, decoded)
+	}
+	for i, input := range [][]byte{
+		{0x0a, 0x05, 'a'},
+		{0x08},
+		{0x00, 0x01},
+	} {
+		if _, err := UnmarshalCredential(input); err == nil {
+			t.Fatalf("FAIL: Test %d, expected malformed input to fail, but passed", i)
+		}
+	}
+}
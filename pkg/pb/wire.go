@@ -0,0 +1,200 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Protocol buffers wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) tag(field, wireType int) {
+	e.b = binary.AppendUvarint(e.b, uint64(field)<<3|uint64(wireType))
+}
+
+func (e *encoder) rawBytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	e.b = binary.AppendUvarint(e.b, uint64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+func (e *encoder) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.rawBytes(field, []byte(s))
+}
+
+func (e *encoder) strings(field int, arr []string) {
+	for _, s := range arr {
+		e.rawBytes(field, []byte(s))
+	}
+}
+
+func (e *encoder) stringMap(field int, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		entry := &encoder{}
+		entry.string(1, k)
+		entry.string(2, m[k])
+		e.rawBytes(field, entry.b)
+	}
+}
+
+func (e *encoder) stringSet(field int, m map[string]bool) {
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		if v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	e.strings(field, keys)
+}
+
+func (e *encoder) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.b = binary.AppendUvarint(e.b, v)
+}
+
+func (e *encoder) int64(field int, v int64) {
+	e.uint64(field, uint64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.uint64(field, 1)
+	}
+}
+
+type decoder struct {
+	b []byte
+}
+
+func (d *decoder) done() bool {
+	return len(d.b) == 0
+}
+
+func (d *decoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		return 0, fmt.Errorf("malformed varint")
+	}
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *decoder) next() (int, int, error) {
+	v, err := d.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	field := int(v >> 3)
+	if field < 1 {
+		return 0, 0, fmt.Errorf("malformed field number: %d", field)
+	}
+	return field, int(v & 7), nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	size, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(len(d.b)) {
+		return nil, fmt.Errorf("truncated length-delimited field")
+	}
+	b := d.b[:size]
+	d.b = d.b[size:]
+	return b, nil
+}
+
+func (d *decoder) string() (string, error) {
+	b, err := d.bytes()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *decoder) stringMapEntry(m map[string]string) error {
+	b, err := d.bytes()
+	if err != nil {
+		return err
+	}
+	entry := &decoder{b: b}
+	var k, v string
+	for !entry.done() {
+		field, wireType, err := entry.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			k, err = entry.string()
+		case field == 2 && wireType == wireBytes:
+			v, err = entry.string()
+		default:
+			err = entry.skip(wireType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	m[k] = v
+	return nil
+}
+
+func (d *decoder) skip(wireType int) error {
+	var size int
+	switch wireType {
+	case wireVarint:
+		_, err := d.varint()
+		return err
+	case wireBytes:
+		_, err := d.bytes()
+		return err
+	case wireFixed64:
+		size = 8
+	case wireFixed32:
+		size = 4
+	default:
+		return fmt.Errorf("unsupported wire type: %d", wireType)
+	}
+	if size > len(d.b) {
+		return fmt.Errorf("truncated fixed-size field")
+	}
+	d.b = d.b[size:]
+	return nil
+}
@@ -0,0 +1,334 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EtcdBackend is a Backend storing the keys in etcd, through the JSON
+// gateway of the etcd v3 API, e.g. http://127.0.0.1:2379. The revisions
+// are the revisions of etcd.
+type EtcdBackend struct {
+	// URL is the address of etcd.
+	URL string
+	// Username and Password authenticate the requests, when etcd has
+	// authentication enabled.
+	Username string
+	Password string
+	Client   *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewEtcdBackend returns an instance of EtcdBackend.
+func NewEtcdBackend(addr string) *EtcdBackend {
+	return &EtcdBackend{
+		URL:    addr,
+		Client: http.DefaultClient,
+	}
+}
+
+// etcdRevision is a revision of the etcd JSON gateway, which encodes the
+// 64-bit integers as strings.
+type etcdRevision int64
+
+func (r *etcdRevision) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" {
+		*r = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*r = etcdRevision(n)
+	return nil
+}
+
+func (r etcdRevision) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatInt(int64(r), 10) + `"`), nil
+}
+
+type etcdHeader struct {
+	Revision etcdRevision `json:"revision"`
+}
+
+type etcdKeyValue struct {
+	Key         []byte       `json:"key"`
+	Value       []byte       `json:"value,omitempty"`
+	ModRevision etcdRevision `json:"mod_revision,omitempty"`
+}
+
+type etcdRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader      `json:"header"`
+	Kvs    []*etcdKeyValue `json:"kvs"`
+}
+
+type etcdCompare struct {
+	Key            []byte        `json:"key"`
+	Target         string        `json:"target"`
+	Result         string        `json:"result"`
+	ModRevision    *etcdRevision `json:"mod_revision,omitempty"`
+	CreateRevision *etcdRevision `json:"create_revision,omitempty"`
+}
+
+type etcdRequestOp struct {
+	RequestPut         *etcdKeyValue     `json:"request_put,omitempty"`
+	RequestDeleteRange *etcdRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+type etcdTxnRequest struct {
+	Compare []*etcdCompare   `json:"compare,omitempty"`
+	Success []*etcdRequestOp `json:"success"`
+}
+
+type etcdTxnResponse struct {
+	Header    etcdHeader `json:"header"`
+	Succeeded bool       `json:"succeeded"`
+}
+
+type etcdWatchRequest struct {
+	CreateRequest struct {
+		Key           []byte       `json:"key"`
+		RangeEnd      []byte       `json:"range_end,omitempty"`
+		StartRevision etcdRevision `json:"start_revision,omitempty"`
+	} `json:"create_request"`
+}
+
+type etcdWatchResponse struct {
+	Result *struct {
+		Canceled bool `json:"canceled"`
+		Events   []*struct {
+			Type string        `json:"type"`
+			Kv   *etcdKeyValue `json:"kv"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// List returns the keys with the provided prefix.
+func (b *EtcdBackend) List(ctx context.Context, prefix string) ([]*Entry, int64, error) {
+	resp := &etcdRangeResponse{}
+	req := &etcdRangeRequest{Key: []byte(prefix), RangeEnd: prefixEnd(prefix)}
+	if err := b.call(ctx, "/v3/kv/range", req, resp); err != nil {
+		return nil, 0, err
+	}
+	entries := make([]*Entry, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		entries = append(entries, &Entry{Key: string(kv.Key), Value: kv.Value, Revision: int64(kv.ModRevision)})
+	}
+	return entries, int64(resp.Header.Revision), nil
+}
+
+// Put sets the value of a key.
+func (b *EtcdBackend) Put(ctx context.Context, key string, value []byte, revision int64) (int64, error) {
+	op := &etcdRequestOp{RequestPut: &etcdKeyValue{Key: []byte(key), Value: value}}
+	return b.txn(ctx, key, revision, op)
+}
+
+// Delete removes a key.
+func (b *EtcdBackend) Delete(ctx context.Context, key string, revision int64) error {
+	op := &etcdRequestOp{RequestDeleteRange: &etcdRangeRequest{Key: []byte(key)}}
+	_, err := b.txn(ctx, key, revision, op)
+	return err
+}
+
+// txn applies the operation on a key, when the revision of the key is the
+// one provided.
+func (b *EtcdBackend) txn(ctx context.Context, key string, revision int64, op *etcdRequestOp) (int64, error) {
+	req := &etcdTxnRequest{Success: []*etcdRequestOp{op}}
+	if revision != AnyRevision {
+		r := etcdRevision(revision)
+		c := &etcdCompare{Key: []byte(key), Target: "MOD", Result: "EQUAL", ModRevision: &r}
+		if revision == 0 {
+			c = &etcdCompare{Key: []byte(key), Target: "CREATE", Result: "EQUAL", CreateRevision: &r}
+		}
+		req.Compare = append(req.Compare, c)
+	}
+	resp := &etcdTxnResponse{}
+	if err := b.call(ctx, "/v3/kv/txn", req, resp); err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, ErrConflict
+	}
+	return int64(resp.Header.Revision), nil
+}
+
+// Watch returns the changes of the keys with the provided prefix.
+func (b *EtcdBackend) Watch(ctx context.Context, prefix string, revision int64) (<-chan *Event, error) {
+	req := &etcdWatchRequest{}
+	req.CreateRequest.Key = []byte(prefix)
+	req.CreateRequest.RangeEnd = prefixEnd(prefix)
+	req.CreateRequest.StartRevision = etcdRevision(revision)
+	resp, err := b.do(ctx, "/v3/watch", req)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *Event, watchBuffer)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		dec := json.NewDecoder(bufio.NewReader(resp.Body))
+		for {
+			r := &etcdWatchResponse{}
+			if err := dec.Decode(r); err != nil {
+				return
+			}
+			if r.Error != nil || r.Result == nil || r.Result.Canceled {
+				return
+			}
+			for _, e := range r.Result.Events {
+				if e.Kv == nil {
+					continue
+				}
+				ev := &Event{
+					Key:      string(e.Kv.Key),
+					Value:    e.Kv.Value,
+					Revision: int64(e.Kv.ModRevision),
+					Deleted:  e.Type == "DELETE",
+				}
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Close does nothing, the watches end with their contexts.
+func (b *EtcdBackend) Close() error {
+	return nil
+}
+
+// call sends a request to the JSON gateway, and decodes the response.
+func (b *EtcdBackend) call(ctx context.Context, p string, in, out interface{}) error {
+	resp, err := b.do(ctx, p, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed decoding etcd response of %s: %s", p, err)
+	}
+	return nil
+}
+
+func (b *EtcdBackend) do(ctx context.Context, p string, in interface{}) (*http.Response, error) {
+	token, err := b.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.post(ctx, p, token, in)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("etcd request %s failed: %s: %s", p, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// authenticate returns the token of the user, if any. The token is
+// requested once.
+func (b *EtcdBackend) authenticate(ctx context.Context) (string, error) {
+	if b.Username == "" {
+		return "", nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.token != "" {
+		return b.token, nil
+	}
+	req := map[string]string{"name": b.Username, "password": b.Password}
+	resp, err := b.post(ctx, "/v3/auth/authenticate", "", req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("etcd authentication failed: %s", resp.Status)
+	}
+	out := struct {
+		Token string `json:"token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed decoding etcd token: %s", err)
+	}
+	b.token = out.Token
+	return b.token, nil
+}
+
+func (b *EtcdBackend) post(ctx context.Context, p, token string, in interface{}) (*http.Response, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(b.URL, "/")+p, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("etcd request %s failed: %s", p, err)
+	}
+	return resp, nil
+}
+
+// prefixEnd returns the end of the range of the keys with the provided
+// prefix, i.e. the prefix with its last byte incremented.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// The prefix is all 0xff bytes, the range extends to the last key.
+	return []byte{0}
+}
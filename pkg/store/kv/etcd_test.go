@@ -0,0 +1,122 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestEtcdServer returns a fake etcd JSON gateway keeping the keys in
+// a MemoryBackend. The ranges are prefixes.
+func newTestEtcdServer(t *testing.T) *httptest.Server {
+	mem := NewMemoryBackend()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		switch r.URL.Path {
+		case "/v3/auth/authenticate":
+			json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+			return
+		}
+		if r.Header.Get("Authorization") != "secret" {
+			http.Error(w, `{"error": "invalid auth token"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			req := &etcdRangeRequest{}
+			json.NewDecoder(r.Body).Decode(req)
+			entries, revision, _ := mem.List(ctx, string(req.Key))
+			resp := &etcdRangeResponse{Header: etcdHeader{Revision: etcdRevision(revision)}}
+			for _, e := range entries {
+				resp.Kvs = append(resp.Kvs, &etcdKeyValue{Key: []byte(e.Key), Value: e.Value, ModRevision: etcdRevision(e.Revision)})
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/v3/kv/txn":
+			req := &etcdTxnRequest{}
+			json.NewDecoder(r.Body).Decode(req)
+			revision := AnyRevision
+			for _, c := range req.Compare {
+				switch {
+				case c.Target == "MOD" && c.ModRevision != nil:
+					revision = int64(*c.ModRevision)
+				case c.Target == "CREATE" && c.CreateRevision != nil:
+					revision = int64(*c.CreateRevision)
+				}
+			}
+			op := req.Success[0]
+			resp := &etcdTxnResponse{Succeeded: true}
+			var err error
+			if op.RequestPut != nil {
+				var rev int64
+				rev, err = mem.Put(ctx, string(op.RequestPut.Key), op.RequestPut.Value, revision)
+				resp.Header.Revision = etcdRevision(rev)
+			} else {
+				err = mem.Delete(ctx, string(op.RequestDeleteRange.Key), revision)
+			}
+			if errors.Is(err, ErrConflict) {
+				resp.Succeeded = false
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/v3/watch":
+			req := &etcdWatchRequest{}
+			json.NewDecoder(r.Body).Decode(req)
+			events, _ := mem.Watch(ctx, string(req.CreateRequest.Key), int64(req.CreateRequest.StartRevision))
+			enc := json.NewEncoder(w)
+			enc.Encode(map[string]interface{}{"result": map[string]interface{}{"created": true}})
+			w.(http.Flusher).Flush()
+			for e := range events {
+				ev := map[string]interface{}{"kv": &etcdKeyValue{Key: []byte(e.Key), Value: e.Value, ModRevision: etcdRevision(e.Revision)}}
+				if e.Deleted {
+					ev["type"] = "DELETE"
+				}
+				enc.Encode(map[string]interface{}{"result": map[string]interface{}{"events": []interface{}{ev}}})
+				w.(http.Flusher).Flush()
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestEtcdBackend(t *testing.T) {
+	srv := newTestEtcdServer(t)
+	defer srv.Close()
+	backend := NewEtcdBackend(srv.URL)
+	if _, _, err := backend.List(context.Background(), DefaultPrefix); err == nil {
+		t.Fatalf("FAIL: expected error without authentication")
+	}
+	backend.Username = "root"
+	backend.Password = "secret"
+	testBackend(t, backend)
+}
+
+func TestPrefixEnd(t *testing.T) {
+	for _, test := range []struct {
+		prefix string
+		end    string
+	}{
+		{prefix: "/ansible/", end: "/ansible0"},
+		{prefix: "a\xff", end: "b"},
+	} {
+		if end := string(prefixEnd(test.prefix)); end != test.end {
+			t.Fatalf("FAIL: prefix %q end mismatch: %q (expected) vs. %q (received)", test.prefix, test.end, end)
+		}
+	}
+}
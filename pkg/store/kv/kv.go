@@ -0,0 +1,334 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kv stores the hosts and the groups of an Inventory in a
+// key-value store, e.g. etcd or Redis, shared by the workers of a
+// distributed automation. The hosts and the groups are updated
+// optimistically, with the revisions of their keys, and the changes are
+// streamed into a live Inventory, see LiveInventory.
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"github.com/greenpau/go-ansible-db/pkg/store"
+)
+
+// DefaultPrefix is the prefix of the keys, unless NewStore says otherwise.
+const DefaultPrefix = "/ansible/inventory/"
+
+// The prefixes of the keys of the groups and the hosts, following the
+// prefix of the store.
+const (
+	groupsPrefix = "groups/"
+	hostsPrefix  = "hosts/"
+)
+
+// AnyRevision makes Backend.Put and Backend.Delete ignore the revision of
+// the key.
+const AnyRevision int64 = -1
+
+// maxUpdateAttempts is the number of times UpdateHost and UpdateGroup
+// retry a conflicting update.
+const maxUpdateAttempts = 10
+
+// ErrConflict is the error of Backend.Put and Backend.Delete when the
+// revision of the key is not the one provided, i.e. the key was changed
+// concurrently.
+var ErrConflict = errors.New("kv: revision conflict")
+
+// Entry is a key of a Backend, with its value and the revision of its last
+// change.
+type Entry struct {
+	Key      string
+	Value    []byte
+	Revision int64
+}
+
+// Event is a change of a key. The value of a deleted key is empty.
+type Event struct {
+	Key      string
+	Value    []byte
+	Revision int64
+	Deleted  bool
+}
+
+// Backend is a key-value store with revisions, see NewMemoryBackend,
+// NewEtcdBackend, and NewRedisBackend. The revisions increase with every
+// change of the store.
+type Backend interface {
+	// List returns the keys with the provided prefix, sorted by key, and
+	// the current revision of the store.
+	List(ctx context.Context, prefix string) ([]*Entry, int64, error)
+	// Put sets the value of a key, when the revision of the key is the
+	// one provided, 0 for a new key, or AnyRevision. It returns the
+	// revision of the change, or ErrConflict.
+	Put(ctx context.Context, key string, value []byte, revision int64) (int64, error)
+	// Delete removes a key, when the revision of the key is the one
+	// provided, or AnyRevision. Removing a missing key is not an error.
+	Delete(ctx context.Context, key string, revision int64) error
+	// Watch returns the changes of the keys with the provided prefix,
+	// starting with the provided revision. The channel is closed when
+	// the context is canceled, or the watch fails.
+	Watch(ctx context.Context, prefix string, revision int64) (<-chan *Event, error)
+	// Close releases the connections of the backend.
+	Close() error
+}
+
+// Store keeps the hosts and the groups of an Inventory in a Backend, with
+// a key per host and per group holding its record in JSON format, e.g.
+// /ansible/inventory/hosts/web01.
+type Store struct {
+	backend Backend
+	prefix  string
+}
+
+// NewStore returns an instance of Store keeping the keys under the
+// provided prefix, or DefaultPrefix when empty.
+func NewStore(backend Backend, prefix string) *Store {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Store{backend: backend, prefix: prefix}
+}
+
+// Save writes the hosts and the groups of the Inventory, and removes the
+// hosts and the groups the Inventory does not have. Each key is written
+// unconditionally, and separately, so the concurrent writers should
+// rather update the hosts and the groups they change, see UpdateHost.
+func (s *Store) Save(ctx context.Context, inv *db.Inventory) error {
+	groups, hosts := store.Records(inv)
+	keys := make(map[string]bool)
+	for _, g := range groups {
+		if _, err := s.put(ctx, s.groupKey(g.Name), g, AnyRevision); err != nil {
+			return fmt.Errorf("failed saving group %s: %s", g.Name, err)
+		}
+		keys[s.groupKey(g.Name)] = true
+	}
+	for _, h := range hosts {
+		if _, err := s.put(ctx, s.hostKey(h.Name), h, AnyRevision); err != nil {
+			return fmt.Errorf("failed saving host %s: %s", h.Name, err)
+		}
+		keys[s.hostKey(h.Name)] = true
+	}
+	entries, _, err := s.backend.List(ctx, s.prefix)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if keys[e.Key] {
+			continue
+		}
+		if err := s.backend.Delete(ctx, e.Key, e.Revision); err != nil && !errors.Is(err, ErrConflict) {
+			return fmt.Errorf("failed removing %s: %s", e.Key, err)
+		}
+	}
+	return nil
+}
+
+// Load returns the Inventory created with the provided options holding
+// the hosts and the groups of the store, and the revision of the store
+// it reflects.
+func (s *Store) Load(ctx context.Context, opts ...db.InventoryOption) (*db.Inventory, int64, error) {
+	entries, revision, err := s.backend.List(ctx, s.prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	state := newState()
+	for _, e := range entries {
+		if err := state.apply(s, &Event{Key: e.Key, Value: e.Value, Revision: e.Revision}); err != nil {
+			return nil, 0, err
+		}
+	}
+	inv, err := state.build(opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return inv, revision, nil
+}
+
+// UpdateHost applies the provided function to the record of a host and
+// writes it, unless the host was changed concurrently, in which case the
+// function is applied again to the new record. A host not found is
+// provided with an empty record, and is created. The function returning
+// an error aborts the update.
+func (s *Store) UpdateHost(ctx context.Context, name string, fn func(*store.Host) error) error {
+	return s.update(ctx, s.hostKey(name), func(b []byte) (interface{}, error) {
+		h := &store.Host{}
+		if b != nil {
+			if err := json.Unmarshal(b, h); err != nil {
+				return nil, err
+			}
+		}
+		h.Name = name
+		if h.Variables == nil {
+			h.Variables = make(map[string]string)
+		}
+		if err := fn(h); err != nil {
+			return nil, err
+		}
+		if h.Parent == "" {
+			h.Parent = "all"
+		}
+		return h, nil
+	})
+}
+
+// UpdateGroup is UpdateHost for the record of a group.
+func (s *Store) UpdateGroup(ctx context.Context, name string, fn func(*store.Group) error) error {
+	return s.update(ctx, s.groupKey(name), func(b []byte) (interface{}, error) {
+		g := &store.Group{}
+		if b != nil {
+			if err := json.Unmarshal(b, g); err != nil {
+				return nil, err
+			}
+		}
+		g.Name = name
+		if g.Variables == nil {
+			g.Variables = make(map[string]string)
+		}
+		if err := fn(g); err != nil {
+			return nil, err
+		}
+		return g, nil
+	})
+}
+
+// DeleteHost removes a host.
+func (s *Store) DeleteHost(ctx context.Context, name string) error {
+	return s.backend.Delete(ctx, s.hostKey(name), AnyRevision)
+}
+
+// DeleteGroup removes a group. Its hosts and its child groups are kept,
+// and the Inventory fails to load until they are moved to another group.
+func (s *Store) DeleteGroup(ctx context.Context, name string) error {
+	return s.backend.Delete(ctx, s.groupKey(name), AnyRevision)
+}
+
+// update reads a key, and writes the record the provided function returns
+// for its value, nil for a missing key, with the revision read.
+func (s *Store) update(ctx context.Context, key string, fn func([]byte) (interface{}, error)) error {
+	for i := 0; i < maxUpdateAttempts; i++ {
+		entries, _, err := s.backend.List(ctx, key)
+		if err != nil {
+			return err
+		}
+		var value []byte
+		var revision int64
+		for _, e := range entries {
+			if e.Key == key {
+				value = e.Value
+				revision = e.Revision
+			}
+		}
+		r, err := fn(value)
+		if err != nil {
+			return err
+		}
+		if _, err := s.put(ctx, key, r, revision); err != nil {
+			if errors.Is(err, ErrConflict) {
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("failed updating %s: %w", key, ErrConflict)
+}
+
+func (s *Store) put(ctx context.Context, key string, r interface{}, revision int64) (int64, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return 0, err
+	}
+	return s.backend.Put(ctx, key, b, revision)
+}
+
+func (s *Store) groupKey(name string) string {
+	return s.prefix + groupsPrefix + name
+}
+
+func (s *Store) hostKey(name string) string {
+	return s.prefix + hostsPrefix + name
+}
+
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+}
+
+// state holds the records of the keys of a store.
+type state struct {
+	groups map[string]*store.Group
+	hosts  map[string]*store.Host
+}
+
+func newState() *state {
+	return &state{
+		groups: make(map[string]*store.Group),
+		hosts:  make(map[string]*store.Host),
+	}
+}
+
+// apply updates the records with a change of a key of the store.
+func (st *state) apply(s *Store, e *Event) error {
+	k := strings.TrimPrefix(e.Key, s.prefix)
+	switch {
+	case strings.HasPrefix(k, groupsPrefix):
+		name := strings.TrimPrefix(k, groupsPrefix)
+		if e.Deleted {
+			delete(st.groups, name)
+			return nil
+		}
+		g := &store.Group{}
+		if err := json.Unmarshal(e.Value, g); err != nil {
+			return fmt.Errorf("failed decoding %s: %s", e.Key, err)
+		}
+		g.Name = name
+		st.groups[name] = g
+	case strings.HasPrefix(k, hostsPrefix):
+		name := strings.TrimPrefix(k, hostsPrefix)
+		if e.Deleted {
+			delete(st.hosts, name)
+			return nil
+		}
+		h := &store.Host{}
+		if err := json.Unmarshal(e.Value, h); err != nil {
+			return fmt.Errorf("failed decoding %s: %s", e.Key, err)
+		}
+		h.Name = name
+		st.hosts[name] = h
+	}
+	return nil
+}
+
+// build returns the Inventory holding the records, sorted by name.
+func (st *state) build(opts ...db.InventoryOption) (*db.Inventory, error) {
+	groups := make([]*store.Group, 0, len(st.groups))
+	for _, g := range st.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	hosts := make([]*store.Host, 0, len(st.hosts))
+	for _, h := range st.hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	return store.Build(groups, hosts, opts...)
+}
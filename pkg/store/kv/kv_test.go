@@ -0,0 +1,145 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"github.com/greenpau/go-ansible-db/pkg/store"
+)
+
+var testInventory = []byte(`[web]
+web01 ansible_host=10.0.0.1
+web02
+
+[ny:children]
+web
+
+[ny:vars]
+site=ny
+`)
+
+// testBackend runs the Store tests against a Backend.
+func testBackend(t *testing.T, backend Backend) {
+	ctx := context.Background()
+	s := NewStore(backend, "")
+	inv := db.NewInventory()
+	if err := inv.LoadFromBytes(testInventory); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if err := s.Save(ctx, inv); err != nil {
+		t.Fatalf("FAIL: save failed: %s", err)
+	}
+	loaded, revision, err := s.Load(ctx)
+	if err != nil {
+		t.Fatalf("FAIL: load failed: %s", err)
+	}
+	if loaded.Size() != 2 || revision < 1 {
+		t.Fatalf("FAIL: load mismatch: %d hosts, revision %d", loaded.Size(), revision)
+	}
+	h, err := loaded.GetHost("web01")
+	if err != nil || h.Variables["site"] != "ny" || h.Variables["ansible_host"] != "10.0.0.1" {
+		t.Fatalf("FAIL: host web01 mismatch: %+v, %v", h, err)
+	}
+
+	live, err := NewLiveInventory(ctx, s, nil)
+	if err != nil {
+		t.Fatalf("FAIL: live inventory failed: %s", err)
+	}
+	defer live.Close()
+	deltas := live.Subscribe(10)
+
+	err = s.UpdateHost(ctx, "web03", func(h *store.Host) error {
+		h.Parent = "web"
+		h.Variables["env"] = "dev"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("FAIL: host update failed: %s", err)
+	}
+	select {
+	case d := <-deltas:
+		if d == nil || len(d.Hosts) != 1 || d.Hosts[0].Host != "web03" || d.Hosts[0].Type != db.HostAdded {
+			t.Fatalf("FAIL: delta mismatch: %+v", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("FAIL: live inventory not updated")
+	}
+	h, err = live.Current().GetHost("web03")
+	if err != nil || h.Variables["env"] != "dev" || h.Variables["site"] != "ny" {
+		t.Fatalf("FAIL: host web03 mismatch: %+v, %v", h, err)
+	}
+
+	// A write with a stale revision is rejected.
+	entries, _, err := backend.List(ctx, s.hostKey("web03"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("FAIL: list failed: %v, %v", entries, err)
+	}
+	if err := s.UpdateGroup(ctx, "ny", func(g *store.Group) error {
+		g.Variables["site"] = "nyc"
+		return nil
+	}); err != nil {
+		t.Fatalf("FAIL: group update failed: %s", err)
+	}
+	if _, err := backend.Put(ctx, entries[0].Key, []byte(`{"parent":"web"}`), entries[0].Revision); err != nil {
+		t.Fatalf("FAIL: put with current revision failed: %s", err)
+	}
+	if _, err := backend.Put(ctx, entries[0].Key, []byte(`{"parent":"web"}`), entries[0].Revision); !errors.Is(err, ErrConflict) {
+		t.Fatalf("FAIL: expected conflict, got: %v", err)
+	}
+	if _, err := backend.Put(ctx, entries[0].Key, []byte(`{"parent":"web"}`), 0); !errors.Is(err, ErrConflict) {
+		t.Fatalf("FAIL: expected conflict creating existing key, got: %v", err)
+	}
+
+	if err := s.DeleteHost(ctx, "web02"); err != nil {
+		t.Fatalf("FAIL: host delete failed: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cur := live.Current()
+		_, err := cur.GetHost("web02")
+		g, _ := cur.GetGroup("ny")
+		if err != nil && g != nil && g.Variables["site"] == "nyc" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("FAIL: live inventory not updated after delete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	hosts, err := live.Current().GetHosts()
+	if err != nil {
+		t.Fatalf("FAIL: %s", err)
+	}
+	var names []string
+	for _, h := range hosts {
+		names = append(names, h.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"web01", "web03"}) {
+		t.Fatalf("FAIL: hosts mismatch: %v", names)
+	}
+	t.Logf("PASS: live inventory at revision %d, hosts: %v", live.Revision(), names)
+}
+
+func TestMemoryBackend(t *testing.T) {
+	backend := NewMemoryBackend()
+	defer backend.Close()
+	testBackend(t, backend)
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+)
+
+// retryInterval is the delay before watching the store again, after the
+// watch failed.
+const retryInterval = time.Second
+
+// LiveInventory keeps an Inventory in sync with a Store. It watches the
+// keys of the store, rebuilds the Inventory when they change, swaps the
+// current version atomically, and emits the delta of the inventory to the
+// subscribers, the way db.WatchedInventory does for files. The current
+// version must not be modified, because it may be in use by other
+// goroutines.
+type LiveInventory struct {
+	store  *Store
+	opts   []db.InventoryOption
+	logger db.Logger
+
+	reloader *db.Reloader
+	mu       sync.Mutex
+	state    *state
+	revision int64
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewLiveInventory loads the Inventory, created with the provided options,
+// from the store and starts watching the store for changes, until Close
+// is called. The changes failing to build an Inventory, e.g. a host of a
+// group not yet created, are reported to the logger, if any, and the
+// current version is kept until the next change.
+func NewLiveInventory(ctx context.Context, s *Store, logger db.Logger, opts ...db.InventoryOption) (*LiveInventory, error) {
+	l := &LiveInventory{
+		store:  s,
+		opts:   opts,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	l.reloader = db.NewReloader(l.load)
+	if err := l.resync(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := l.reloader.Reload(ctx); err != nil {
+		return nil, err
+	}
+	wctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go l.watch(wctx)
+	return l, nil
+}
+
+// Current returns the current version of the Inventory.
+func (l *LiveInventory) Current() *db.Inventory {
+	return l.reloader.Current()
+}
+
+// Revision returns the revision of the store the current records reflect.
+func (l *LiveInventory) Revision() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.revision
+}
+
+// Subscribe returns a channel receiving the deltas of the rebuilt
+// inventories, see db.Reloader.Subscribe. The channel is closed by Close.
+func (l *LiveInventory) Subscribe(buffer int) <-chan *db.InventoryDelta {
+	return l.reloader.Subscribe(buffer)
+}
+
+// Close stops watching the store and closes the subscriber channels.
+func (l *LiveInventory) Close() error {
+	if l.cancel != nil {
+		l.cancel()
+		<-l.done
+	}
+	return l.reloader.Close()
+}
+
+// load builds a new version of the Inventory from the current records.
+func (l *LiveInventory) load(ctx context.Context) (*db.Inventory, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state.build(l.opts...)
+}
+
+// resync replaces the records with the keys of the store.
+func (l *LiveInventory) resync(ctx context.Context) error {
+	entries, revision, err := l.store.backend.List(ctx, l.store.prefix)
+	if err != nil {
+		return err
+	}
+	st := newState()
+	for _, e := range entries {
+		if err := st.apply(l.store, &Event{Key: e.Key, Value: e.Value, Revision: e.Revision}); err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
+	l.state = st
+	l.revision = revision
+	l.mu.Unlock()
+	return nil
+}
+
+// watch applies the changes of the store to the records, and rebuilds the
+// Inventory, until the context is canceled. The watch failing, e.g. the
+// connection to the store is lost, is retried after a resync, so that
+// the changes missed in the meantime are applied.
+func (l *LiveInventory) watch(ctx context.Context) {
+	defer close(l.done)
+	for {
+		events, err := l.store.backend.Watch(ctx, l.store.prefix, l.Revision()+1)
+		if err == nil {
+			l.consume(ctx, events)
+		} else {
+			l.warnf("failed watching inventory store: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+		if err := l.resync(ctx); err != nil {
+			l.warnf("failed resyncing inventory store: %s", err)
+			continue
+		}
+		l.reload(ctx)
+	}
+}
+
+// consume applies the events until the channel is closed.
+func (l *LiveInventory) consume(ctx context.Context, events <-chan *Event) {
+	for e := range events {
+		l.mu.Lock()
+		// The events of a transaction share its revision, and applying
+		// an event again is harmless.
+		if e.Revision < l.revision {
+			l.mu.Unlock()
+			continue
+		}
+		err := l.state.apply(l.store, e)
+		l.revision = e.Revision
+		l.mu.Unlock()
+		if err != nil {
+			l.warnf("%s", err)
+		}
+		// The events already queued are applied before rebuilding, e.g.
+		// the keys changed by Save.
+		if len(events) > 0 {
+			continue
+		}
+		l.reload(ctx)
+	}
+}
+
+func (l *LiveInventory) reload(ctx context.Context) {
+	if _, err := l.reloader.Reload(ctx); err != nil {
+		l.warnf("failed rebuilding inventory at revision %d: %s", l.Revision(), err)
+	}
+}
+
+func (l *LiveInventory) warnf(format string, args ...interface{}) {
+	if l.logger != nil {
+		l.logger.Warnf(format, args...)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// watchBuffer is the number of events a watcher buffers. A watcher falling
+// further behind is closed, and resynchronizes.
+const watchBuffer = 256
+
+// historySize is the number of changes MemoryBackend keeps for the
+// watchers starting at an earlier revision.
+const historySize = 1024
+
+// MemoryBackend is a Backend keeping the keys in memory, e.g. for the
+// workers of a single process, or for tests.
+type MemoryBackend struct {
+	mu       sync.Mutex
+	entries  map[string]*Entry
+	history  []*Event
+	revision int64
+	watchers map[*memoryWatcher]bool
+}
+
+type memoryWatcher struct {
+	prefix string
+	ch     chan *Event
+}
+
+// NewMemoryBackend returns an instance of MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		entries:  make(map[string]*Entry),
+		watchers: make(map[*memoryWatcher]bool),
+	}
+}
+
+// List returns the keys with the provided prefix.
+func (b *MemoryBackend) List(ctx context.Context, prefix string) ([]*Entry, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var entries []*Entry
+	for k, e := range b.entries {
+		if strings.HasPrefix(k, prefix) {
+			c := *e
+			entries = append(entries, &c)
+		}
+	}
+	sortEntries(entries)
+	return entries, b.revision, nil
+}
+
+// Put sets the value of a key.
+func (b *MemoryBackend) Put(ctx context.Context, key string, value []byte, revision int64) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.matches(key, revision) {
+		return 0, ErrConflict
+	}
+	b.revision++
+	b.entries[key] = &Entry{Key: key, Value: append([]byte{}, value...), Revision: b.revision}
+	b.notify(&Event{Key: key, Value: append([]byte{}, value...), Revision: b.revision})
+	return b.revision, nil
+}
+
+// Delete removes a key.
+func (b *MemoryBackend) Delete(ctx context.Context, key string, revision int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.matches(key, revision) {
+		return ErrConflict
+	}
+	if _, exists := b.entries[key]; !exists {
+		return nil
+	}
+	b.revision++
+	delete(b.entries, key)
+	b.notify(&Event{Key: key, Revision: b.revision, Deleted: true})
+	return nil
+}
+
+// Watch returns the changes of the keys with the provided prefix. The
+// changes since the provided revision are replayed first. When they are
+// no longer in the history, the channel is closed right away, so that the
+// watcher resynchronizes.
+func (b *MemoryBackend) Watch(ctx context.Context, prefix string, revision int64) (<-chan *Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w := &memoryWatcher{prefix: prefix, ch: make(chan *Event, watchBuffer)}
+	b.watchers[w] = true
+	if len(b.history) > 0 && b.history[0].Revision > revision {
+		delete(b.watchers, w)
+		close(w.ch)
+		return w.ch, nil
+	}
+	for _, e := range b.history {
+		if e.Revision >= revision && strings.HasPrefix(e.Key, prefix) {
+			b.send(w, e)
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.watchers[w] {
+			delete(b.watchers, w)
+			close(w.ch)
+		}
+	}()
+	return w.ch, nil
+}
+
+// Close closes the watchers.
+func (b *MemoryBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for w := range b.watchers {
+		delete(b.watchers, w)
+		close(w.ch)
+	}
+	return nil
+}
+
+// matches returns true when the revision of the key is the one provided.
+// The caller holds mu.
+func (b *MemoryBackend) matches(key string, revision int64) bool {
+	if revision == AnyRevision {
+		return true
+	}
+	e, exists := b.entries[key]
+	if !exists {
+		return revision == 0
+	}
+	return e.Revision == revision
+}
+
+// notify records a change, and sends it to the watchers. The caller holds
+// mu.
+func (b *MemoryBackend) notify(e *Event) {
+	b.history = append(b.history, e)
+	if len(b.history) > historySize {
+		b.history = append([]*Event{}, b.history[len(b.history)-historySize:]...)
+	}
+	for w := range b.watchers {
+		if strings.HasPrefix(e.Key, w.prefix) {
+			b.send(w, e)
+		}
+	}
+}
+
+// send sends an event to a watcher, or closes the watcher falling behind.
+// The caller holds mu.
+func (b *MemoryBackend) send(w *memoryWatcher, e *Event) {
+	select {
+	case w.ch <- e:
+	default:
+		if b.watchers[w] {
+			delete(b.watchers, w)
+			close(w.ch)
+		}
+	}
+}
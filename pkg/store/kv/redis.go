@@ -0,0 +1,423 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The defaults of RedisBackend.RevisionKey and RedisBackend.Channel.
+const (
+	defaultRedisRevisionKey = "ansible-db:revision"
+	defaultRedisChannel     = "ansible-db:changes"
+)
+
+// redisPutScript sets the value of a key, a hash holding the value and the
+// revision, when the revision matches, and publishes the change.
+const redisPutScript = `
+local cur = redis.call('HGET', KEYS[1], 'revision')
+local want = tonumber(ARGV[2])
+if want >= 0 and ((cur and tonumber(cur) ~= want) or (not cur and want ~= 0)) then
+  return -1
+end
+local rev = redis.call('INCR', KEYS[2])
+redis.call('HSET', KEYS[1], 'value', ARGV[1], 'revision', rev)
+redis.call('PUBLISH', KEYS[3], cjson.encode({key = KEYS[1], value = ARGV[1], revision = rev}))
+return rev
+`
+
+// redisDeleteScript removes a key, when the revision matches, and
+// publishes the change.
+const redisDeleteScript = `
+local cur = redis.call('HGET', KEYS[1], 'revision')
+local want = tonumber(ARGV[1])
+if want >= 0 and ((cur and tonumber(cur) ~= want) or (not cur and want ~= 0)) then
+  return -1
+end
+if not cur then
+  return 0
+end
+local rev = redis.call('INCR', KEYS[2])
+redis.call('DEL', KEYS[1])
+redis.call('PUBLISH', KEYS[3], cjson.encode({key = KEYS[1], deleted = true, revision = rev}))
+return rev
+`
+
+// redisListScript returns the current revision, followed by the name, the
+// value, and the revision of each key matching the pattern.
+const redisListScript = `
+local out = {redis.call('GET', KEYS[1]) or '0'}
+for _, k in ipairs(redis.call('KEYS', ARGV[1])) do
+  local h = redis.call('HMGET', k, 'value', 'revision')
+  if h[2] then
+    table.insert(out, k)
+    table.insert(out, h[1])
+    table.insert(out, h[2])
+  end
+end
+return out
+`
+
+// RedisBackend is a Backend storing the keys in Redis, e.g.
+// 127.0.0.1:6379. A key is a hash holding its value and its revision.
+// The revisions come from a counter, and the changes are published to a
+// channel. Redis does not replay the changes published before a watch
+// starts, so a watch starting after a change closes right away, and the
+// watcher resynchronizes.
+type RedisBackend struct {
+	// Addr is the address of Redis.
+	Addr string
+	// Password authenticates the connections, when set.
+	Password string
+	// DB is the database of the keys.
+	DB int
+	// RevisionKey is the key of the revision counter, and Channel is the
+	// channel of the changes. They must not start with the prefix of a
+	// Store.
+	RevisionKey string
+	Channel     string
+	// Timeout is the timeout of connecting to Redis.
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	conn *redisConn
+}
+
+// NewRedisBackend returns an instance of RedisBackend.
+func NewRedisBackend(addr, password string) *RedisBackend {
+	return &RedisBackend{
+		Addr:        addr,
+		Password:    password,
+		RevisionKey: defaultRedisRevisionKey,
+		Channel:     defaultRedisChannel,
+		Timeout:     5 * time.Second,
+	}
+}
+
+// redisChange is a change published by the scripts.
+type redisChange struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Revision int64  `json:"revision"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// List returns the keys with the provided prefix.
+func (b *RedisBackend) List(ctx context.Context, prefix string) ([]*Entry, int64, error) {
+	reply, err := b.do(ctx, "EVAL", redisListScript, "1", b.RevisionKey, redisGlobEscape(prefix)+"*")
+	if err != nil {
+		return nil, 0, err
+	}
+	arr, ok := reply.([]interface{})
+	if !ok || len(arr) < 1 || (len(arr)-1)%3 != 0 {
+		return nil, 0, fmt.Errorf("unexpected redis reply: %v", reply)
+	}
+	revision, err := redisInt(arr[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	var entries []*Entry
+	for i := 1; i < len(arr); i += 3 {
+		key, _ := arr[i].([]byte)
+		value, _ := arr[i+1].([]byte)
+		rev, err := redisInt(arr[i+2])
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, &Entry{Key: string(key), Value: value, Revision: rev})
+	}
+	sortEntries(entries)
+	return entries, revision, nil
+}
+
+// Put sets the value of a key.
+func (b *RedisBackend) Put(ctx context.Context, key string, value []byte, revision int64) (int64, error) {
+	reply, err := b.do(ctx, "EVAL", redisPutScript, "3", key, b.RevisionKey, b.Channel, string(value), strconv.FormatInt(revision, 10))
+	if err != nil {
+		return 0, err
+	}
+	rev, err := redisInt(reply)
+	if err != nil {
+		return 0, err
+	}
+	if rev < 0 {
+		return 0, ErrConflict
+	}
+	return rev, nil
+}
+
+// Delete removes a key.
+func (b *RedisBackend) Delete(ctx context.Context, key string, revision int64) error {
+	reply, err := b.do(ctx, "EVAL", redisDeleteScript, "3", key, b.RevisionKey, b.Channel, strconv.FormatInt(revision, 10))
+	if err != nil {
+		return err
+	}
+	rev, err := redisInt(reply)
+	if err != nil {
+		return err
+	}
+	if rev < 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Watch returns the changes of the keys with the provided prefix, on a
+// connection of its own subscribed to the channel.
+func (b *RedisBackend) Watch(ctx context.Context, prefix string, revision int64) (<-chan *Event, error) {
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.do("SUBSCRIBE", b.Channel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The changes published before the subscription are lost, so the watch
+	// starting after a change ends right away.
+	reply, err := b.do(ctx, "GET", b.RevisionKey)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	current, err := redisInt(reply)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ch := make(chan *Event, watchBuffer)
+	if current >= revision {
+		conn.Close()
+		close(ch)
+		return ch, nil
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(ch)
+		defer conn.Close()
+		for {
+			reply, err := conn.read()
+			if err != nil {
+				return
+			}
+			msg, ok := reply.([]interface{})
+			if !ok || len(msg) != 3 || string(redisBytes(msg[0])) != "message" {
+				continue
+			}
+			c := &redisChange{}
+			if err := json.Unmarshal(redisBytes(msg[2]), c); err != nil {
+				continue
+			}
+			if c.Revision < revision || !strings.HasPrefix(c.Key, prefix) {
+				continue
+			}
+			e := &Event{Key: c.Key, Revision: c.Revision, Deleted: c.Deleted}
+			if !c.Deleted {
+				e.Value = []byte(c.Value)
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Close closes the connection of the commands. The connections of the
+// watches are closed with their contexts.
+func (b *RedisBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
+
+// do runs a command on the shared connection, which is dialed again after
+// a failure.
+func (b *RedisBackend) do(ctx context.Context, args ...string) (interface{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		conn, err := b.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		b.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		b.conn.c.SetDeadline(deadline)
+		defer b.conn.c.SetDeadline(time.Time{})
+	}
+	reply, err := b.conn.do(args...)
+	if err != nil && !errors.As(err, new(redisError)) {
+		b.conn.Close()
+		b.conn = nil
+	}
+	return reply, err
+}
+
+// dial connects to Redis, and authenticates.
+func (b *RedisBackend) dial(ctx context.Context) (*redisConn, error) {
+	d := &net.Dialer{Timeout: b.Timeout}
+	c, err := d.DialContext(ctx, "tcp", b.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed connecting to redis %s: %s", b.Addr, err)
+	}
+	conn := &redisConn{c: c, r: bufio.NewReader(c)}
+	if b.Password != "" {
+		if _, err := conn.do("AUTH", b.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis authentication failed: %s", err)
+		}
+	}
+	if b.DB != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(b.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisConn is a connection speaking the Redis serialization protocol.
+type redisConn struct {
+	c net.Conn
+	r *bufio.Reader
+}
+
+// redisError is an error reply of Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// do sends a command, and reads its reply.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.c, sb.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads a reply, i.e. a string, an integer, a bulk string, nil, or an
+// array of replies.
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("malformed redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("malformed redis reply: %q", line)
+}
+
+func (c *redisConn) Close() error {
+	return c.c.Close()
+}
+
+// redisInt returns the integer of a reply, an integer or a bulk string.
+// Nil is 0.
+func redisInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("unexpected redis reply: %v", v)
+}
+
+func redisBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+// redisGlobEscape escapes the special characters of the KEYS patterns.
+func redisGlobEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return r.Replace(s)
+}
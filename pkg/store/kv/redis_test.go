@@ -0,0 +1,213 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRedisServer is a fake Redis server running the scripts of
+// RedisBackend on a MemoryBackend.
+type testRedisServer struct {
+	ln       net.Listener
+	mem      *MemoryBackend
+	password string
+
+	mu          sync.Mutex
+	subscribers map[net.Conn]bool
+}
+
+func newTestRedisServer(t *testing.T, password string) *testRedisServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed listening: %s", err)
+	}
+	srv := &testRedisServer{
+		ln:          ln,
+		mem:         NewMemoryBackend(),
+		password:    password,
+		subscribers: make(map[net.Conn]bool),
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(c)
+		}
+	}()
+	return srv
+}
+
+func (srv *testRedisServer) Close() {
+	srv.ln.Close()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.subscribers {
+		c.Close()
+	}
+}
+
+func (srv *testRedisServer) serve(c net.Conn) {
+	defer c.Close()
+	conn := &redisConn{c: c, r: bufio.NewReader(c)}
+	authenticated := srv.password == ""
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return
+		}
+		arr, _ := reply.([]interface{})
+		var args []string
+		for _, v := range arr {
+			args = append(args, string(redisBytes(v)))
+		}
+		if len(args) == 0 {
+			return
+		}
+		if args[0] == "AUTH" {
+			authenticated = args[1] == srv.password
+			if !authenticated {
+				srv.write(c, redisError("WRONGPASS invalid password"))
+				continue
+			}
+			srv.write(c, "OK")
+			continue
+		}
+		if !authenticated {
+			srv.write(c, redisError("NOAUTH Authentication required"))
+			continue
+		}
+		srv.write(c, srv.exec(c, args))
+	}
+}
+
+func (srv *testRedisServer) exec(c net.Conn, args []string) interface{} {
+	ctx := context.Background()
+	switch args[0] {
+	case "GET":
+		_, revision, _ := srv.mem.List(ctx, "")
+		return []byte(strconv.FormatInt(revision, 10))
+	case "SUBSCRIBE":
+		srv.mu.Lock()
+		srv.subscribers[c] = true
+		srv.mu.Unlock()
+		return []interface{}{[]byte("subscribe"), []byte(args[1]), int64(1)}
+	case "EVAL":
+		switch args[1] {
+		case redisListScript:
+			entries, revision, _ := srv.mem.List(ctx, strings.TrimSuffix(args[4], "*"))
+			out := []interface{}{[]byte(strconv.FormatInt(revision, 10))}
+			for _, e := range entries {
+				out = append(out, []byte(e.Key), e.Value, []byte(strconv.FormatInt(e.Revision, 10)))
+			}
+			return out
+		case redisPutScript:
+			want, _ := strconv.ParseInt(args[7], 10, 64)
+			rev, err := srv.mem.Put(ctx, args[3], []byte(args[6]), want)
+			if errors.Is(err, ErrConflict) {
+				return int64(-1)
+			}
+			srv.publish(&redisChange{Key: args[3], Value: args[6], Revision: rev})
+			return rev
+		case redisDeleteScript:
+			want, _ := strconv.ParseInt(args[6], 10, 64)
+			entries, _, _ := srv.mem.List(ctx, args[3])
+			if err := srv.mem.Delete(ctx, args[3], want); errors.Is(err, ErrConflict) {
+				return int64(-1)
+			}
+			if len(entries) == 0 || entries[0].Key != args[3] {
+				return int64(0)
+			}
+			_, rev, _ := srv.mem.List(ctx, "")
+			srv.publish(&redisChange{Key: args[3], Revision: rev, Deleted: true})
+			return rev
+		}
+	}
+	return redisError("ERR unknown command " + args[0])
+}
+
+func (srv *testRedisServer) publish(change *redisChange) {
+	b, _ := json.Marshal(change)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.subscribers {
+		srv.write(c, []interface{}{[]byte("message"), []byte(defaultRedisChannel), b})
+	}
+}
+
+// write sends a reply in the Redis serialization protocol.
+func (srv *testRedisServer) write(w io.Writer, v interface{}) {
+	var sb strings.Builder
+	var enc func(v interface{})
+	enc = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			fmt.Fprintf(&sb, "+%s\r\n", v)
+		case redisError:
+			fmt.Fprintf(&sb, "-%s\r\n", string(v))
+		case int64:
+			fmt.Fprintf(&sb, ":%d\r\n", v)
+		case []byte:
+			fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(v), v)
+		case []interface{}:
+			fmt.Fprintf(&sb, "*%d\r\n", len(v))
+			for _, item := range v {
+				enc(item)
+			}
+		}
+	}
+	enc(v)
+	io.WriteString(w, sb.String())
+}
+
+func TestRedisBackend(t *testing.T) {
+	srv := newTestRedisServer(t, "secret")
+	defer srv.Close()
+	backend := NewRedisBackend(srv.ln.Addr().String(), "")
+	if _, _, err := backend.List(context.Background(), DefaultPrefix); err == nil {
+		t.Fatalf("FAIL: expected error without authentication")
+	}
+	backend.Close()
+	backend = NewRedisBackend(srv.ln.Addr().String(), "secret")
+	defer backend.Close()
+	testBackend(t, backend)
+}
+
+func TestRedisGlobEscape(t *testing.T) {
+	for i, test := range []struct {
+		input string
+		want  string
+	}{
+		{input: "/ansible/inventory/", want: "/ansible/inventory/"},
+		{input: "/a*b?[c]/", want: `/a\*b\?\[c\]/`},
+	} {
+		if got := redisGlobEscape(test.input); got != test.want {
+			t.Fatalf("FAIL: Test %d: %q (expected) vs. %q (received)", i, test.want, got)
+		}
+		t.Logf("PASS: Test %d: %q", i, test.input)
+	}
+}
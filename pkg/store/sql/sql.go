@@ -0,0 +1,323 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sql saves the contents of an Inventory to the tables of a SQL
+// database, e.g. SQLite or PostgreSQL, and loads them back. The package
+// uses database/sql only, the application registers the driver of its
+// database, e.g. github.com/mattn/go-sqlite3 or github.com/lib/pq.
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"fmt"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	"github.com/greenpau/go-ansible-db/pkg/store"
+)
+
+// migrations are the statements creating the tables, in the order of the
+// schema versions, i.e. the statements of version 1 first. A new version
+// is appended, the statements of the existing versions never change. The
+// statements use the $1 placeholders, which both SQLite and PostgreSQL
+// accept.
+var migrations = [][]string{
+	{
+		`CREATE TABLE inventory_groups (
+			name TEXT PRIMARY KEY,
+			position INTEGER NOT NULL
+		)`,
+		`CREATE TABLE inventory_memberships (
+			group_name TEXT NOT NULL,
+			parent_name TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			PRIMARY KEY (group_name, parent_name)
+		)`,
+		`CREATE TABLE inventory_hosts (
+			name TEXT PRIMARY KEY,
+			parent_group TEXT NOT NULL,
+			position INTEGER NOT NULL
+		)`,
+		`CREATE TABLE inventory_variables (
+			kind TEXT NOT NULL,
+			owner TEXT NOT NULL,
+			name TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (kind, owner, name)
+		)`,
+	},
+	{
+		`CREATE TABLE inventory_host_groups (
+			host_name TEXT NOT NULL,
+			group_name TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			PRIMARY KEY (host_name, group_name)
+		)`,
+	},
+}
+
+// The kinds of the owners of the variables.
+const (
+	hostKind  = "host"
+	groupKind = "group"
+)
+
+// Store saves an Inventory to the tables of a database, i.e. the groups,
+// the parents of the groups, the hosts, the other groups of the hosts, and
+// the variables the hosts and the groups define. The variables the hosts
+// inherit are computed when the Inventory is loaded, as they are for an
+// inventory file.
+type Store struct {
+	db *dbsql.DB
+}
+
+// NewStore returns an instance of Store for the provided database. The
+// tables are created by Migrate.
+func NewStore(db *dbsql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Version returns the schema version of the database, i.e. 0 before the
+// first Migrate. The database is not modified.
+func (s *Store) Version(ctx context.Context) (int, error) {
+	exists, err := s.tableExists(ctx, "inventory_schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version dbsql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM inventory_schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed reading schema version: %s", err)
+	}
+	return int(version.Int64), nil
+}
+
+// tableExists returns true when the database has the table. PostgreSQL
+// lists the tables in information_schema, SQLite in sqlite_master.
+func (s *Store) tableExists(ctx context.Context, name string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.tables WHERE table_name = $1`, name).Scan(&n)
+	if err != nil {
+		err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1`, name).Scan(&n)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed looking up table %s: %s", name, err)
+	}
+	return n > 0, nil
+}
+
+// Migrate creates the tables, or upgrades them to the schema version of
+// the package. Each version is applied in its own transaction.
+func (s *Store) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS inventory_schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed creating schema migrations table: %s", err)
+	}
+	current, err := s.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("unsupported schema version: %d", current)
+	}
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		err := s.withTx(ctx, func(tx *dbsql.Tx) error {
+			for _, stmt := range migrations[i] {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO inventory_schema_migrations (version) VALUES ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed migrating schema to version %d: %s", version, err)
+		}
+	}
+	return nil
+}
+
+// Save replaces the contents of the tables with the hosts and the groups
+// of the Inventory, in a single transaction. The ephemeral hosts and
+// groups are not saved.
+func (s *Store) Save(ctx context.Context, inv *db.Inventory) error {
+	groups, hosts := store.Records(inv)
+	return s.withTx(ctx, func(tx *dbsql.Tx) error {
+		for _, t := range []string{"inventory_variables", "inventory_host_groups", "inventory_hosts", "inventory_memberships", "inventory_groups"} {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+t); err != nil {
+				return fmt.Errorf("failed clearing %s: %s", t, err)
+			}
+		}
+		for i, g := range groups {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO inventory_groups (name, position) VALUES ($1, $2)`, g.Name, i); err != nil {
+				return fmt.Errorf("failed saving group %s: %s", g.Name, err)
+			}
+			for j, p := range g.Parents {
+				if _, err := tx.ExecContext(ctx, `INSERT INTO inventory_memberships (group_name, parent_name, position) VALUES ($1, $2, $3)`, g.Name, p, j); err != nil {
+					return fmt.Errorf("failed saving parent %s of group %s: %s", p, g.Name, err)
+				}
+			}
+			for k, v := range g.Variables {
+				if err := insertVariable(ctx, tx, groupKind, g.Name, k, v); err != nil {
+					return err
+				}
+			}
+		}
+		for i, h := range hosts {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO inventory_hosts (name, parent_group, position) VALUES ($1, $2, $3)`, h.Name, h.Parent, i); err != nil {
+				return fmt.Errorf("failed saving host %s: %s", h.Name, err)
+			}
+			for j, p := range h.ExtraParents {
+				if _, err := tx.ExecContext(ctx, `INSERT INTO inventory_host_groups (host_name, group_name, position) VALUES ($1, $2, $3)`, h.Name, p, j); err != nil {
+					return fmt.Errorf("failed saving group %s of host %s: %s", p, h.Name, err)
+				}
+			}
+			for k, v := range h.Variables {
+				if err := insertVariable(ctx, tx, hostKind, h.Name, k, v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Load returns the Inventory created with the provided options holding
+// the hosts and the groups of the tables, see store.Build.
+func (s *Store) Load(ctx context.Context, opts ...db.InventoryOption) (*db.Inventory, error) {
+	var groups []*store.Group
+	groupsByName := make(map[string]*store.Group)
+	err := s.query(ctx, `SELECT name FROM inventory_groups ORDER BY position`, func(rows *dbsql.Rows) error {
+		g := &store.Group{Variables: make(map[string]string)}
+		if err := rows.Scan(&g.Name); err != nil {
+			return err
+		}
+		groups = append(groups, g)
+		groupsByName[g.Name] = g
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed loading groups: %s", err)
+	}
+	err = s.query(ctx, `SELECT group_name, parent_name FROM inventory_memberships ORDER BY group_name, position`, func(rows *dbsql.Rows) error {
+		var name, parent string
+		if err := rows.Scan(&name, &parent); err != nil {
+			return err
+		}
+		g, exists := groupsByName[name]
+		if !exists {
+			return fmt.Errorf("group %s not found", name)
+		}
+		g.Parents = append(g.Parents, parent)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed loading group memberships: %s", err)
+	}
+	var hosts []*store.Host
+	hostsByName := make(map[string]*store.Host)
+	err = s.query(ctx, `SELECT name, parent_group FROM inventory_hosts ORDER BY position`, func(rows *dbsql.Rows) error {
+		h := &store.Host{Variables: make(map[string]string)}
+		if err := rows.Scan(&h.Name, &h.Parent); err != nil {
+			return err
+		}
+		hosts = append(hosts, h)
+		hostsByName[h.Name] = h
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed loading hosts: %s", err)
+	}
+	err = s.query(ctx, `SELECT host_name, group_name FROM inventory_host_groups ORDER BY host_name, position`, func(rows *dbsql.Rows) error {
+		var name, group string
+		if err := rows.Scan(&name, &group); err != nil {
+			return err
+		}
+		h, exists := hostsByName[name]
+		if !exists {
+			return fmt.Errorf("host %s not found", name)
+		}
+		h.ExtraParents = append(h.ExtraParents, group)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed loading host memberships: %s", err)
+	}
+	err = s.query(ctx, `SELECT kind, owner, name, value FROM inventory_variables`, func(rows *dbsql.Rows) error {
+		var kind, owner, k, v string
+		if err := rows.Scan(&kind, &owner, &k, &v); err != nil {
+			return err
+		}
+		var vars map[string]string
+		switch kind {
+		case hostKind:
+			if h, exists := hostsByName[owner]; exists {
+				vars = h.Variables
+			}
+		case groupKind:
+			if g, exists := groupsByName[owner]; exists {
+				vars = g.Variables
+			}
+		default:
+			return fmt.Errorf("unsupported owner kind %s of variable %s", kind, k)
+		}
+		if vars == nil {
+			return fmt.Errorf("%s %s of variable %s not found", kind, owner, k)
+		}
+		vars[k] = v
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed loading variables: %s", err)
+	}
+	return store.Build(groups, hosts, opts...)
+}
+
+func insertVariable(ctx context.Context, tx *dbsql.Tx, kind, owner, k, v string) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO inventory_variables (kind, owner, name, value) VALUES ($1, $2, $3, $4)`, kind, owner, k, v); err != nil {
+		return fmt.Errorf("failed saving variable %s of %s %s: %s", k, kind, owner, err)
+	}
+	return nil
+}
+
+// query runs the query, and calls the provided function for each row.
+func (s *Store) query(ctx context.Context, q string, fn func(*dbsql.Rows) error) error {
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// withTx runs the provided function in a transaction, which is committed
+// unless the function fails.
+func (s *Store) withTx(ctx context.Context, fn func(*dbsql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
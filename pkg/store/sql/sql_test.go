@@ -0,0 +1,101 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	ctx := context.Background()
+	conn, err := dbsql.Open("sqlite3", filepath.Join(t.TempDir(), "inventory.db"))
+	if err != nil {
+		t.Fatalf("error opening database: %s", err)
+	}
+	defer conn.Close()
+	store := NewStore(conn)
+	if v, err := store.Version(ctx); err != nil || v != 0 {
+		t.Fatalf("FAIL: schema version mismatch: 0 (expected) vs. %d (received), error: %v", v, err)
+	}
+	if exists, err := store.tableExists(ctx, "inventory_schema_migrations"); err != nil || exists {
+		t.Fatalf("FAIL: expected Version not to create the schema migrations table, error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Migrate(ctx); err != nil {
+			t.Fatalf("FAIL: migration %d failed: %s", i, err)
+		}
+	}
+	if v, err := store.Version(ctx); err != nil || v != len(migrations) {
+		t.Fatalf("FAIL: schema version mismatch: %d (expected) vs. %d (received), error: %v", len(migrations), v, err)
+	}
+
+	inv := db.NewInventory()
+	if err := inv.LoadFromFile("../../../testdata/inventory/hosts"); err != nil {
+		t.Fatalf("error reading inventory: %s", err)
+	}
+	if err := inv.SetHostVariable("ny-sw01", "motd", `Paul "Ops" Greenberg`); err != nil {
+		t.Fatalf("error setting variable: %s", err)
+	}
+	if err := inv.AddHostToGroup("ny-sw01", "ny5-cisco"); err != nil {
+		t.Fatalf("error adding host to group: %s", err)
+	}
+	if err := store.Save(ctx, inv); err != nil {
+		t.Fatalf("FAIL: save failed: %s", err)
+	}
+	// Saving again replaces the contents of the tables.
+	if err := store.Save(ctx, inv); err != nil {
+		t.Fatalf("FAIL: second save failed: %s", err)
+	}
+	loaded, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("FAIL: load failed: %s", err)
+	}
+	if loaded.Size() != inv.Size() {
+		t.Fatalf("FAIL: host count mismatch: %d (expected) vs. %d (received)", inv.Size(), loaded.Size())
+	}
+	hosts, err := inv.GetHosts()
+	if err != nil {
+		t.Fatalf("error resolving hosts: %s", err)
+	}
+	for _, h := range hosts {
+		lh, err := loaded.GetHost(h.Name)
+		if err != nil {
+			t.Fatalf("FAIL: host %s not loaded: %s", h.Name, err)
+		}
+		if lh.Parent != h.Parent || !reflect.DeepEqual(lh.ExtraParents, h.ExtraParents) || !reflect.DeepEqual(lh.Groups, h.Groups) {
+			t.Fatalf("FAIL: host %s groups mismatch: %v (expected) vs. %v (received)", h.Name, h.Groups, lh.Groups)
+		}
+		if !reflect.DeepEqual(lh.Variables, h.Variables) {
+			t.Fatalf("FAIL: host %s variables mismatch: %v (expected) vs. %v (received)", h.Name, h.Variables, lh.Variables)
+		}
+	}
+	for _, g := range inv.Groups {
+		lg, err := loaded.GetGroup(g.Name)
+		if err != nil {
+			t.Fatalf("FAIL: group %s not loaded: %s", g.Name, err)
+		}
+		if !reflect.DeepEqual(lg.Variables, g.Variables) || lg.Counters != g.Counters {
+			t.Fatalf("FAIL: group %s mismatch: %+v (expected) vs. %+v (received)", g.Name, g, lg)
+		}
+	}
+	t.Logf("PASS: %d hosts and %d groups saved and loaded", loaded.Size(), len(loaded.Groups))
+}
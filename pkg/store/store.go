@@ -0,0 +1,135 @@
+// Copyright 2018 Paul Greenberg (greenpau@outlook.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store holds the records the storage backends persist an
+// Inventory as, e.g. the tables of a SQL database or the keys of etcd.
+package store
+
+import (
+	"fmt"
+
+	"github.com/greenpau/go-ansible-db/pkg/db"
+)
+
+// Group is a group of an Inventory, with its parent groups and the
+// variables it defines.
+type Group struct {
+	Name      string            `json:"-"`
+	Parents   []string          `json:"parents,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// Host is a host of an Inventory, with its parent groups and the variables
+// it defines, i.e. without the variables it inherits from its groups.
+type Host struct {
+	Name         string            `json:"-"`
+	Parent       string            `json:"parent"`
+	ExtraParents []string          `json:"extra_parents,omitempty"`
+	Variables    map[string]string `json:"variables,omitempty"`
+}
+
+// Records returns the groups and the hosts of the Inventory, in the order
+// they were added. The ephemeral hosts and groups are omitted.
+func Records(inv *db.Inventory) ([]*Group, []*Host) {
+	var groups []*Group
+	for _, g := range inv.Groups {
+		if g.Ephemeral {
+			continue
+		}
+		r := &Group{
+			Name:      g.Name,
+			Parents:   append([]string{}, g.Ancestors...),
+			Variables: make(map[string]string, len(g.Variables)),
+		}
+		for k, v := range g.Variables {
+			r.Variables[k] = v
+		}
+		groups = append(groups, r)
+	}
+	var hosts []*Host
+	for _, h := range inv.Hosts {
+		if h.Ephemeral {
+			continue
+		}
+		r := &Host{
+			Name:         h.Name,
+			Parent:       h.Parent,
+			ExtraParents: append([]string(nil), h.ExtraParents...),
+			Variables:    make(map[string]string),
+		}
+		for k, v := range h.Variables {
+			if !db.IsInheritedSource(h.VariableSource(k)) {
+				r.Variables[k] = v
+			}
+		}
+		hosts = append(hosts, r)
+	}
+	return groups, hosts
+}
+
+// Build returns the Inventory created with the provided options holding
+// the groups and the hosts. The records are added to a scratch Inventory
+// first, which is written in the INI format, so that the Inventory
+// returned is loaded, and validated, the way an inventory file is. The
+// hosts are then added to their other groups, see AddHostToGroup.
+func Build(groups []*Group, hosts []*Host, opts ...db.InventoryOption) (*db.Inventory, error) {
+	scratch := db.NewInventory()
+	for _, g := range groups {
+		if g.Name == "all" {
+			continue
+		}
+		parents := g.Parents
+		if len(parents) == 0 {
+			parents = []string{"all"}
+		}
+		for _, p := range parents {
+			if err := scratch.AddGroup(g.Name, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, g := range groups {
+		for k, v := range g.Variables {
+			if err := scratch.SetGroupVariable(g.Name, k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, h := range hosts {
+		if err := scratch.AddHost(h.Name, h.Parent); err != nil {
+			return nil, err
+		}
+		for k, v := range h.Variables {
+			if err := scratch.SetHostVariable(h.Name, k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	b, err := scratch.ToINI()
+	if err != nil {
+		return nil, err
+	}
+	inv := db.NewInventory(opts...)
+	if err := inv.LoadFromBytes(b); err != nil {
+		return nil, fmt.Errorf("failed loading stored inventory: %s", err)
+	}
+	for _, h := range hosts {
+		for _, p := range h.ExtraParents {
+			if err := inv.AddHostToGroup(h.Name, p); err != nil {
+				return nil, fmt.Errorf("failed loading stored inventory: %s", err)
+			}
+		}
+	}
+	return inv, nil
+}